@@ -0,0 +1,340 @@
+// Package admin provides an HTTP handler exposing the topics of RediMQ as a REST/JSON API along with an
+// embedded web dashboard, so that the operators can inspect and manage the queues without a REDIS shell.
+//
+// The handler can be mounted under any path using [http.StripPrefix]:
+//
+//	h := admin.NewHandler(client)
+//	http.Handle("/redimq/", http.StripPrefix("/redimq", h))
+//
+// The dashboard is served at the root of the handler and the API under "/api":
+//
+//	GET  /api/topics
+//	GET  /api/topics/{topic}
+//	GET  /api/topics/{topic}/messages?start=&end=&count=&reverse=
+//	POST /api/topics/{topic}/pause
+//	POST /api/topics/{topic}/resume
+//	GET  /api/grouped-topics/{topic}
+//	GET  /api/grouped-topics/{topic}/groups?consumerGroup=&offset=&count=&sort=backlog
+//	GET  /api/grouped-topics/{topic}/groups/{groupKey}?consumerGroup=
+//	GET  /api/grouped-topics/{topic}/groups/{groupKey}/messages?start=&end=&count=&reverse=
+//	POST /api/grouped-topics/{topic}/pause
+//	POST /api/grouped-topics/{topic}/resume
+//	POST /api/grouped-topics/{topic}/groups/{groupKey}/pause
+//	POST /api/grouped-topics/{topic}/groups/{groupKey}/resume
+//	GET  /api/grouped-topics/{topic}/parked-groups?consumerGroup=
+//	POST /api/grouped-topics/{topic}/groups/{groupKey}/release?consumerGroup=&skip=
+//	POST /api/grouped-topics/{topic}/redrive?deadLetterTopic=&count=
+//	GET  /api/consumers/{consumerGroup}
+//
+// The routes of a topic respond with 404 if the topic does not exist, as the API does not create topics. The
+// redrive uses the DeadLetterTopic of the grouped topic, so the deadLetterTopic is required only when the
+// topic was not created with one using the client of the Handler.
+package admin
+
+import (
+	"embed"
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/webbytes/redimq"
+)
+
+//go:embed ui
+var ui embed.FS
+
+// errNotFound is returned for the paths that do not match any route of the API
+var errNotFound = errors.New("not found")
+
+// Handler is the http.Handler serving the admin API and the dashboard. It is created using [NewHandler].
+type Handler struct {
+	// ReadOnly rejects the requests that change the state of the topics, i.e. all the POST requests
+	ReadOnly bool
+	client   *redimq.MQClient
+	static   http.Handler
+}
+
+// NewHandler creates a [Handler] for the topics of the client
+func NewHandler(client *redimq.MQClient) *Handler {
+	static, _ := fs.Sub(ui, "ui")
+	return &Handler{client: client, static: http.FileServer(http.FS(static))}
+}
+
+// statusError is an error with the HTTP status code of the response
+type statusError struct {
+	status int
+	err    error
+}
+
+func (e *statusError) Error() string {
+	return e.err.Error()
+}
+
+func badRequest(err error) error {
+	return &statusError{status: http.StatusBadRequest, err: err}
+}
+
+// ServeHTTP serves the API requests under "/api" and the dashboard for all the other paths
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/api" && !strings.HasPrefix(r.URL.Path, "/api/") {
+		h.static.ServeHTTP(w, r)
+		return
+	}
+	if r.Method != http.MethodGet && r.Method != http.MethodPost {
+		writeError(w, &statusError{status: http.StatusMethodNotAllowed, err: errors.New("method not allowed")})
+		return
+	}
+	if r.Method == http.MethodPost && h.ReadOnly {
+		writeError(w, &statusError{status: http.StatusForbidden, err: errors.New("the admin API is read only")})
+		return
+	}
+	segments := []string{}
+	for _, s := range strings.Split(strings.Trim(strings.TrimPrefix(r.URL.EscapedPath(), "/api"), "/"), "/") {
+		s, err := url.PathUnescape(s)
+		if err != nil {
+			writeError(w, badRequest(err))
+			return
+		}
+		segments = append(segments, s)
+	}
+	res, err := h.route(r, segments)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(res)
+}
+
+func writeError(w http.ResponseWriter, err error) {
+	status := http.StatusInternalServerError
+	var se *statusError
+	if errors.As(err, &se) {
+		status = se.status
+	} else if err == errNotFound {
+		status = http.StatusNotFound
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+}
+
+// route dispatches the request to the handler of the path segments after "/api"
+func (h *Handler) route(r *http.Request, segments []string) (interface{}, error) {
+	get := r.Method == http.MethodGet
+	n := len(segments)
+	switch {
+	case n == 1 && segments[0] == "topics" && get:
+		return h.listTopics()
+	case n == 2 && segments[0] == "consumers" && get:
+		return h.client.GetConsumers(segments[1])
+	case n >= 2 && segments[0] == "topics":
+		return h.routeTopic(r, segments[1], segments[2:])
+	case n >= 2 && segments[0] == "grouped-topics":
+		return h.routeGroupedTopic(r, segments[1], segments[2:])
+	}
+	return nil, errNotFound
+}
+
+func (h *Handler) listTopics() (interface{}, error) {
+	topics, err := h.client.GetAllUngroupedMessageTopics()
+	if err != nil {
+		return nil, err
+	}
+	gmts, err := h.client.GetAllGroupedMessageTopics()
+	if err != nil {
+		return nil, err
+	}
+	out := struct {
+		Topics            []*redimq.TopicStats               `json:"topics"`
+		GroupedTopics     []*redimq.GroupedMessageTopicStats `json:"groupedTopics"`
+		PartitionedTopics []string                           `json:"partitionedTopics"`
+	}{[]*redimq.TopicStats{}, []*redimq.GroupedMessageTopicStats{}, []string{}}
+	var cursor uint64
+	for {
+		names, next, err := h.client.FindPartitionedTopicNames(nil, 100, cursor)
+		if err != nil {
+			return nil, err
+		}
+		out.PartitionedTopics = append(out.PartitionedTopics, names...)
+		if cursor = next; cursor == 0 {
+			break
+		}
+	}
+	for _, t := range topics {
+		s, err := t.Stats()
+		if err != nil {
+			return nil, err
+		}
+		out.Topics = append(out.Topics, s)
+	}
+	for _, t := range gmts {
+		s, err := t.Stats()
+		if err != nil {
+			return nil, err
+		}
+		out.GroupedTopics = append(out.GroupedTopics, s)
+	}
+	return out, nil
+}
+
+func (h *Handler) routeTopic(r *http.Request, name string, segments []string) (interface{}, error) {
+	q := r.URL.Query()
+	t, err := h.client.GetTopic(name)
+	if err != nil {
+		return nil, topicError(err)
+	}
+	get := r.Method == http.MethodGet
+	switch {
+	case len(segments) == 0 && get:
+		stats, err := t.Stats()
+		if err != nil {
+			return nil, err
+		}
+		groups, err := t.GetConsumerGroups()
+		if err != nil {
+			return nil, err
+		}
+		return map[string]interface{}{"stats": stats, "consumerGroups": groups}, nil
+	case len(segments) == 1 && segments[0] == "messages" && get:
+		return browse(t.Browse, q)
+	case len(segments) == 1 && segments[0] == "pause" && !get:
+		return ok(t.Pause())
+	case len(segments) == 1 && segments[0] == "resume" && !get:
+		return ok(t.Resume())
+	}
+	return nil, errNotFound
+}
+
+func (h *Handler) routeGroupedTopic(r *http.Request, name string, segments []string) (interface{}, error) {
+	q := r.URL.Query()
+	t, err := h.client.GetGroupedMessageTopic(name)
+	if err != nil {
+		return nil, topicError(err)
+	}
+	get := r.Method == http.MethodGet
+	consumerGroup := q.Get("consumerGroup")
+	n := len(segments)
+	if n > 0 && (segments[0] == "groups" || segments[0] == "parked-groups") && consumerGroup == "" && (get || segments[n-1] == "release") {
+		return nil, badRequest(errors.New("consumerGroup is required"))
+	}
+	switch {
+	case n == 0 && get:
+		stats, err := t.Stats()
+		if err != nil {
+			return nil, err
+		}
+		groups, err := t.GetConsumerGroups()
+		if err != nil {
+			return nil, err
+		}
+		return map[string]interface{}{"stats": stats, "consumerGroups": groups}, nil
+	case n == 1 && segments[0] == "pause" && !get:
+		return ok(t.Pause())
+	case n == 1 && segments[0] == "resume" && !get:
+		return ok(t.Resume())
+	case n == 1 && segments[0] == "redrive" && !get:
+		// the DeadLetterTopic the topic was created with is used, and can only be given when it is not known
+		if deadLetterTopic := q.Get("deadLetterTopic"); t.DeadLetterTopic == "" {
+			if deadLetterTopic == "" {
+				return nil, badRequest(errors.New("deadLetterTopic is required as the topic does not have a DeadLetterTopic"))
+			}
+			t.DeadLetterTopic = deadLetterTopic
+		} else if deadLetterTopic != "" && deadLetterTopic != t.DeadLetterTopic {
+			return nil, badRequest(errors.New("deadLetterTopic does not match the DeadLetterTopic " + t.DeadLetterTopic + " of the topic"))
+		}
+		count, err := parseInt(q, "count", 1000)
+		if err != nil {
+			return nil, err
+		}
+		redriven, err := t.Redrive(count)
+		if err != nil {
+			return nil, err
+		}
+		return map[string]int64{"redriven": redriven}, nil
+	case n == 1 && segments[0] == "parked-groups" && get:
+		return t.GetParkedGroups(consumerGroup)
+	case n == 1 && segments[0] == "groups" && get:
+		options := &redimq.ListGroupsOptions{SortByBacklog: q.Get("sort") == "backlog"}
+		if options.Offset, err = parseInt(q, "offset", 0); err != nil {
+			return nil, err
+		}
+		if options.Count, err = parseInt(q, "count", redimq.DefaultBrowsePageSize); err != nil {
+			return nil, err
+		}
+		return t.ListGroups(consumerGroup, options)
+	case n == 2 && segments[0] == "groups" && get:
+		g, err := t.DescribeGroup(consumerGroup, segments[1])
+		if err == nil && g == nil {
+			return nil, errNotFound
+		}
+		return g, err
+	case n == 3 && segments[0] == "groups" && segments[2] == "messages" && get:
+		return browse(func(o *redimq.BrowseOptions) (*redimq.BrowsePage, error) {
+			return t.BrowseGroup(segments[1], o)
+		}, q)
+	case n == 3 && segments[0] == "groups" && segments[2] == "pause" && !get:
+		return ok(t.PauseGroup(segments[1]))
+	case n == 3 && segments[0] == "groups" && segments[2] == "resume" && !get:
+		return ok(t.ResumeGroup(segments[1]))
+	case n == 3 && segments[0] == "groups" && segments[2] == "release" && !get:
+		return ok(t.ReleaseParkedGroup(consumerGroup, segments[1], q.Get("skip") == "true"))
+	}
+	return nil, errNotFound
+}
+
+// topicError responds with 404 for a topic that does not exist
+func topicError(err error) error {
+	if errors.Is(err, redimq.ErrTopicNotFound) {
+		return &statusError{status: http.StatusNotFound, err: err}
+	}
+	return err
+}
+
+func ok(err error) (interface{}, error) {
+	if err != nil {
+		return nil, err
+	}
+	return map[string]bool{"ok": true}, nil
+}
+
+func parseInt(q url.Values, name string, fallback int64) (int64, error) {
+	if q.Get(name) == "" {
+		return fallback, nil
+	}
+	v, err := strconv.ParseInt(q.Get(name), 10, 64)
+	if err != nil {
+		return 0, badRequest(errors.New("invalid " + name + " " + q.Get(name)))
+	}
+	return v, nil
+}
+
+// message is a browsed message returned by the API
+type message struct {
+	Id       string                 `json:"id"`
+	GroupKey string                 `json:"groupKey,omitempty"`
+	Data     map[string]interface{} `json:"data"`
+	Headers  map[string]string      `json:"headers,omitempty"`
+	Pending  []*redimq.PendingState `json:"pending,omitempty"`
+}
+
+func browse(browseTopic func(o *redimq.BrowseOptions) (*redimq.BrowsePage, error), q url.Values) (interface{}, error) {
+	options := &redimq.BrowseOptions{Start: q.Get("start"), End: q.Get("end"), Reverse: q.Get("reverse") == "true"}
+	var err error
+	if options.Count, err = parseInt(q, "count", redimq.DefaultBrowsePageSize); err != nil {
+		return nil, err
+	}
+	page, err := browseTopic(options)
+	if err != nil {
+		return nil, err
+	}
+	msgs := make([]*message, len(page.Messages))
+	for i, m := range page.Messages {
+		msgs[i] = &message{Id: m.Id, GroupKey: m.GroupKey, Data: m.Data, Headers: m.Headers, Pending: m.Pending}
+	}
+	return map[string]interface{}{"messages": msgs, "nextId": page.NextId}, nil
+}
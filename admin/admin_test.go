@@ -0,0 +1,135 @@
+package admin
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/webbytes/redimq"
+)
+
+func newTestHandler(t *testing.T) (*Handler, *redimq.MQClient) {
+	// a separate database keeps the topics of the admin tests apart from the ones of the tests of the other
+	// packages, which count the registered topics
+	rc := redis.NewClient(&redis.Options{Addr: "localhost:36379", DB: 1})
+	client, err := redimq.NewMQClient(context.TODO(), rc)
+	if err != nil {
+		t.Fatal("NewMQClient failed", err)
+	}
+	return NewHandler(client), client
+}
+
+func serve(h http.Handler, method string, path string, v interface{}) int {
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(method, path, nil))
+	if v != nil {
+		json.Unmarshal(w.Body.Bytes(), v)
+	}
+	return w.Code
+}
+
+func TestTopicAPI(t *testing.T) {
+	h, client := newTestHandler(t)
+	topic, _ := client.NewTopic("admin", nil)
+	topic.PublishMessage(&redimq.Message{Data: map[string]interface{}{"foo": "test"}})
+	client.NewPartitionedTopic("admin-partitioned", 2, nil)
+	list := struct {
+		Topics            []*redimq.TopicStats `json:"topics"`
+		PartitionedTopics []string             `json:"partitionedTopics"`
+	}{}
+	if code := serve(h, "GET", "/api/topics", &list); code != 200 || len(list.Topics) == 0 {
+		t.Error("GET topics is not valid", code, list)
+	}
+	if len(list.PartitionedTopics) != 1 || list.PartitionedTopics[0] != "admin-partitioned" {
+		t.Error("GET topics did not list the partitioned topics", list.PartitionedTopics)
+	}
+	page := struct {
+		Messages []*message `json:"messages"`
+	}{}
+	if code := serve(h, "GET", "/api/topics/admin/messages?count=10", &page); code != 200 || len(page.Messages) != 1 || page.Messages[0].Data["foo"] != "test" {
+		t.Error("GET messages is not valid", code, page)
+	}
+	if code := serve(h, "POST", "/api/topics/admin/pause", nil); code != 200 {
+		t.Error("POST pause failed", code)
+	}
+	if paused, _ := topic.IsPaused(); !paused {
+		t.Error("POST pause did not pause the topic")
+	}
+	h.ReadOnly = true
+	if code := serve(h, "POST", "/api/topics/admin/resume", nil); code != http.StatusForbidden {
+		t.Error("POST resume was allowed for a read only handler", code)
+	}
+	h.ReadOnly = false
+	serve(h, "POST", "/api/topics/admin/resume", nil)
+	if code := serve(h, "GET", "/api/topics/admin/unknown", nil); code != http.StatusNotFound {
+		t.Error("GET unknown path did not return not found", code)
+	}
+	for _, path := range []string{"/api/topics/admin-missing", "/api/grouped-topics/admin-missing/groups?consumerGroup=admin-group"} {
+		if code := serve(h, "GET", path, nil); code != http.StatusNotFound {
+			t.Error("GET missing topic did not return not found", path, code)
+		}
+	}
+	if _, err := client.GetTopic("admin-missing"); err != redimq.ErrTopicNotFound {
+		t.Error("GET missing topic registered the topic", err)
+	}
+	topic.Purge(false)
+}
+
+func TestGroupedTopicAPI(t *testing.T) {
+	h, client := newTestHandler(t)
+	g, _ := client.NewGroupedMessageTopic("admin", nil)
+	g.PublishMessage("a/b", &redimq.Message{Data: map[string]interface{}{"foo": "test"}})
+	g.InitTopicGroups("admin-group", "admin-consumer")
+	page := &redimq.MessageGroupPage{}
+	if code := serve(h, "GET", "/api/grouped-topics/admin/groups?consumerGroup=admin-group&sort=backlog", page); code != 200 || page.Total != 1 {
+		t.Error("GET groups is not valid", code, page)
+	}
+	if code := serve(h, "GET", "/api/grouped-topics/admin/groups", nil); code != http.StatusBadRequest {
+		t.Error("GET groups without the consumer group did not return bad request", code)
+	}
+	info := &redimq.MessageGroupInfo{}
+	if code := serve(h, "GET", "/api/grouped-topics/admin/groups/a%2Fb?consumerGroup=admin-group", info); code != 200 || info.Backlog != 1 {
+		t.Error("GET group is not valid", code, info)
+	}
+	if code := serve(h, "POST", "/api/grouped-topics/admin/groups/a%2Fb/pause", nil); code != 200 {
+		t.Error("POST group pause failed", code)
+	}
+	if paused, _ := g.IsGroupPaused("a/b"); !paused {
+		t.Error("POST group pause did not pause the message group")
+	}
+	g.ResumeGroup("a/b")
+	g.Purge(false)
+}
+
+func TestRedriveAPI(t *testing.T) {
+	h, client := newTestHandler(t)
+	deadLetterTopic := "admin-redrive-dlt"
+	client.NewGroupedMessageTopic("admin-redrive", &redimq.TopicOptions{DeadLetterTopic: &deadLetterTopic})
+	client.NewGroupedMessageTopic("admin-redrive-unknown", nil)
+	redriven := map[string]int64{}
+	if code := serve(h, "POST", "/api/grouped-topics/admin-redrive/redrive", &redriven); code != 200 {
+		t.Error("POST redrive did not use the DeadLetterTopic of the topic", code)
+	}
+	if code := serve(h, "POST", "/api/grouped-topics/admin-redrive/redrive?deadLetterTopic="+deadLetterTopic, nil); code != 200 {
+		t.Error("POST redrive did not accept the DeadLetterTopic of the topic", code)
+	}
+	if code := serve(h, "POST", "/api/grouped-topics/admin-redrive/redrive?deadLetterTopic=other", nil); code != http.StatusBadRequest {
+		t.Error("POST redrive accepted a different dead letter topic", code)
+	}
+	if code := serve(h, "POST", "/api/grouped-topics/admin-redrive-unknown/redrive", nil); code != http.StatusBadRequest {
+		t.Error("POST redrive without a dead letter topic did not return bad request", code)
+	}
+}
+
+func TestDashboard(t *testing.T) {
+	h, _ := newTestHandler(t)
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+	if w.Code != 200 || !strings.Contains(w.Body.String(), "RediMQ") {
+		t.Error("Dashboard is not served", w.Code)
+	}
+}
@@ -0,0 +1,316 @@
+package redimq
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/go-redis/redis/v8"
+)
+
+const (
+	// ArchiveRecordMessage is the Type of the archive records holding a message
+	ArchiveRecordMessage = "message"
+	// ArchiveRecordConsumerGroup is the Type of the archive records holding the position of a consumer group
+	ArchiveRecordConsumerGroup = "consumer-group"
+)
+
+// ArchiveRecord is a line of the JSON Lines archive written by the Export functions of the topics and read
+// by their Import functions. The messages are written in the order of their ids per stream, followed by the
+// positions of the consumer groups if exported.
+type ArchiveRecord struct {
+	Type     string                 `json:"type"`
+	Id       string                 `json:"id,omitempty"`
+	GroupKey string                 `json:"groupKey,omitempty"`
+	Priority int64                  `json:"priority,omitempty"`
+	Data     map[string]interface{} `json:"data,omitempty"`
+	Headers  map[string]string      `json:"headers,omitempty"`
+	// ConsumerGroupName and LastDeliveredId are the position of a consumer group. For a GroupedMessageTopic
+	// the GroupKey of the position is the key of the message group stream, i.e. the key of the lane if
+	// the topic has Lanes.
+	ConsumerGroupName string `json:"consumerGroupName,omitempty"`
+	LastDeliveredId   string `json:"lastDeliveredId,omitempty"`
+}
+
+// ExportOptions are the options of the Export functions of the topics
+type ExportOptions struct {
+	// ConsumerGroups exports the positions of the consumer groups along with the messages
+	ConsumerGroups bool
+}
+
+// ImportOptions are the options of the Import functions of the topics
+type ImportOptions struct {
+	// RewriteIds publishes the messages with new ids instead of the ids in the archive. It is required for
+	// importing into a topic already having messages with greater ids. The positions of the consumer
+	// groups are moved to the new ids of the messages.
+	RewriteIds bool
+}
+
+// ImportReport describes what was restored by the Import functions of the topics
+type ImportReport struct {
+	Messages       int64
+	ConsumerGroups int64
+}
+
+// archiveWriter writes the records of an archive counting the messages
+type archiveWriter struct {
+	e        *json.Encoder
+	messages int64
+}
+
+func (w *archiveWriter) writeMessages(client MQClient, stream string, record func(xm redis.XMessage) (*ArchiveRecord, error)) error {
+	start := "-"
+	for {
+		res, err := client.rc.XRangeN(client.c, stream, start, "+", DefaultBrowsePageSize).Result()
+		if err != nil {
+			return err
+		}
+		for _, xm := range res {
+			r, err := record(xm)
+			if err != nil {
+				return &DecodeError{MessageId: xm.ID, StreamKey: stream, Err: err}
+			}
+			if err := w.e.Encode(r); err != nil {
+				return err
+			}
+			w.messages++
+		}
+		if int64(len(res)) < DefaultBrowsePageSize {
+			return nil
+		}
+		start = nextStreamId(res[len(res)-1].ID)
+	}
+}
+
+func (w *archiveWriter) writeConsumerGroups(client MQClient, stream string, groupKey string, priority int64) error {
+	groups, err := client.rc.XInfoGroups(client.c, stream).Result()
+	if err != nil && !isNoSuchKeyError(err) {
+		return err
+	}
+	for _, g := range groups {
+		err := w.e.Encode(&ArchiveRecord{
+			Type:              ArchiveRecordConsumerGroup,
+			GroupKey:          groupKey,
+			Priority:          priority,
+			ConsumerGroupName: g.Name,
+			LastDeliveredId:   g.LastDeliveredID,
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Export writes the messages of the Topic, with their ids, priorities and headers, to the writer as JSON
+// Lines, so that they can be restored into another topic or REDIS instance using Import. The positions of
+// the consumer groups are written as well if set in the options. The messages are read in pages while the
+// topic is in use, so the messages published during the export may not be included. The Data of the claim
+// checked messages is read from the BlobStore and written in the archive, so that it is stored again by the
+// ClaimCheck of the topic it is imported into. It returns the number of messages exported.
+//
+//	f, _ := os.Create("orders.jsonl")
+//	defer f.Close()
+//	count, err := topic.Export(f, &redimq.ExportOptions{ConsumerGroups: true})
+func (t *Topic) Export(w io.Writer, options *ExportOptions) (int64, error) {
+	if options == nil {
+		options = &ExportOptions{}
+	}
+	aw := &archiveWriter{e: json.NewEncoder(w)}
+	topics := t.getPriorityTopics()
+	for l, pt := range topics {
+		priority := int64(l)
+		err := aw.writeMessages(t.MQClient, pt.StreamKey, func(xm redis.XMessage) (*ArchiveRecord, error) {
+			data, headers, err := splitValues(xm.Values)
+			if err == nil {
+				data, err = resolveClaimCheck(t.ClaimCheck, data, headers)
+			}
+			return &ArchiveRecord{Type: ArchiveRecordMessage, Id: xm.ID, Priority: priority, Data: data, Headers: headers}, err
+		})
+		if err != nil {
+			return aw.messages, err
+		}
+	}
+	if options.ConsumerGroups {
+		for l, pt := range topics {
+			if err := aw.writeConsumerGroups(t.MQClient, pt.StreamKey, "", int64(l)); err != nil {
+				return aw.messages, err
+			}
+		}
+	}
+	return aw.messages, nil
+}
+
+// Export writes the messages of all the message groups of the GroupedMessageTopic, with their ids, group
+// keys and headers, to the writer as JSON Lines, so that they can be restored into another topic or REDIS
+// instance using Import. The messages of a message group are written in their order. The positions of the
+// consumer groups on every message group are written as well if set in the options. The claim checked
+// messages are written with their Data as for [Topic.Export]. It returns the number of messages exported.
+func (t *GroupedMessageTopic) Export(w io.Writer, options *ExportOptions) (int64, error) {
+	if options == nil {
+		options = &ExportOptions{}
+	}
+	entries, err := t.getMessageGroupEntries()
+	if err != nil {
+		return 0, err
+	}
+	aw := &archiveWriter{e: json.NewEncoder(w)}
+	for _, e := range entries {
+		messageGroupKey := getMessageGroupEntryKey(e)
+		stream := t.getStreamKeyForGroup(messageGroupKey)
+		err := aw.writeMessages(t.MQClient, stream, func(xm redis.XMessage) (*ArchiveRecord, error) {
+			data, headers, err := splitValues(xm.Values)
+			if err == nil {
+				data, err = resolveClaimCheck(t.ClaimCheck, data, headers)
+			}
+			groupKey := messageGroupKey
+			if k, ok := headers[HeaderGroupKey]; ok {
+				groupKey = k
+				delete(headers, HeaderGroupKey)
+			}
+			return &ArchiveRecord{Type: ArchiveRecordMessage, Id: xm.ID, GroupKey: groupKey, Data: data, Headers: headers}, err
+		})
+		if err != nil {
+			return aw.messages, err
+		}
+		if options.ConsumerGroups {
+			if err := aw.writeConsumerGroups(t.MQClient, stream, messageGroupKey, 0); err != nil {
+				return aw.messages, err
+			}
+		}
+	}
+	return aw.messages, nil
+}
+
+// idMapping holds the new ids of the imported messages of a stream in the order of their old ids
+type idMapping struct {
+	oldIds []string
+	newIds []string
+}
+
+// translate returns the new id of the last message imported at or before the old id, or the id just before
+// the first imported message if there is none
+func (m *idMapping) translate(id string) string {
+	i := sort.Search(len(m.oldIds), func(i int) bool { return compareStreamIds(m.oldIds[i], id) > 0 })
+	if i == 0 {
+		return previousStreamId(m.newIds[0])
+	}
+	return m.newIds[i-1]
+}
+
+// importArchive reads the records of the archive and passes them to the publish and seek functions. The
+// publish and stream functions return the stream that the record is restored into. The positions of the
+// consumer groups are translated to the new ids of the messages when the ids are rewritten.
+func importArchive(r io.Reader, options *ImportOptions, publish func(rec *ArchiveRecord, m *Message, id string) (string, error), seek func(rec *ArchiveRecord, position StreamPosition) error, stream func(rec *ArchiveRecord) string) (*ImportReport, error) {
+	if options == nil {
+		options = &ImportOptions{}
+	}
+	report := &ImportReport{}
+	mappings := map[string]*idMapping{}
+	s := bufio.NewScanner(r)
+	s.Buffer(make([]byte, 64*1024), 64*1024*1024)
+	for line := 1; s.Scan(); line++ {
+		if strings.TrimSpace(s.Text()) == "" {
+			continue
+		}
+		rec := &ArchiveRecord{}
+		if err := json.Unmarshal(s.Bytes(), rec); err != nil {
+			return report, fmt.Errorf("invalid archive record at line %d: %v", line, err)
+		}
+		switch rec.Type {
+		case ArchiveRecordMessage:
+			id := rec.Id
+			if options.RewriteIds || id == "" {
+				id = "*"
+			}
+			m := &Message{Data: rec.Data, Headers: rec.Headers}
+			key, err := publish(rec, m, id)
+			if err != nil {
+				if strings.Contains(err.Error(), "equal or smaller") {
+					err = errors.New("message " + rec.Id + " is older than the messages of the topic, import with RewriteIds")
+				}
+				return report, err
+			}
+			report.Messages++
+			if id == "*" && rec.Id != "" {
+				mapping, ok := mappings[key]
+				if !ok {
+					mapping = &idMapping{}
+					mappings[key] = mapping
+				}
+				mapping.oldIds = append(mapping.oldIds, rec.Id)
+				mapping.newIds = append(mapping.newIds, m.Id)
+			}
+		case ArchiveRecordConsumerGroup:
+			position := rec.LastDeliveredId
+			if options.RewriteIds {
+				if mapping, ok := mappings[stream(rec)]; ok {
+					position = mapping.translate(position)
+				} else {
+					position = string(PositionEnd)
+				}
+			}
+			if err := seek(rec, StreamPosition(position)); err != nil {
+				return report, err
+			}
+			report.ConsumerGroups++
+		default:
+			return report, fmt.Errorf("unknown archive record type %q at line %d", rec.Type, line)
+		}
+	}
+	return report, s.Err()
+}
+
+// Import publishes the messages of an archive written by Export to the Topic and restores the positions of
+// the consumer groups in it. The messages keep their ids and priorities unless RewriteIds is set in the
+// options, in which case they are published with new ids in the order of the archive. The messages of an
+// archive of a GroupedMessageTopic are imported without their group keys.
+//
+//	f, _ := os.Open("orders.jsonl")
+//	defer f.Close()
+//	report, err := topic.Import(f, &redimq.ImportOptions{RewriteIds: true})
+func (t *Topic) Import(r io.Reader, options *ImportOptions) (*ImportReport, error) {
+	topicFor := func(rec *ArchiveRecord) *Topic {
+		return t.getTopicForPriority(rec.Priority)
+	}
+	return importArchive(r, options,
+		func(rec *ArchiveRecord, m *Message, id string) (string, error) {
+			m.Priority = rec.Priority
+			return topicFor(rec).StreamKey, t.publishMessage(m, id)
+		},
+		func(rec *ArchiveRecord, position StreamPosition) error {
+			return seekConsumerGroup(t.MQClient, topicFor(rec).StreamKey, rec.ConsumerGroupName, position)
+		},
+		func(rec *ArchiveRecord) string {
+			return topicFor(rec).StreamKey
+		})
+}
+
+// Import publishes the messages of an archive written by Export to their message groups in the
+// GroupedMessageTopic, in the order of the archive, and restores the positions of the consumer groups in
+// them. The messages keep their ids unless RewriteIds is set in the options. The positions are restored
+// into the message groups of the same keys, so an archive of a topic having Lanes should be imported into
+// a topic having the same number of Lanes. Every message of the archive must have a group key.
+func (t *GroupedMessageTopic) Import(r io.Reader, options *ImportOptions) (*ImportReport, error) {
+	return importArchive(r, options,
+		func(rec *ArchiveRecord, m *Message, id string) (string, error) {
+			if rec.GroupKey == "" {
+				return "", errors.New("message " + rec.Id + " does not have a group key")
+			}
+			return t.getStreamKeyForGroup(t.getMessageGroupKey(rec.GroupKey)), t.publishMessage(rec.GroupKey, m, id)
+		},
+		func(rec *ArchiveRecord, position StreamPosition) error {
+			_, err := t.MQClient.rc.XGroupCreateMkStream(t.MQClient.c, t.MessageGroupStreamKey, rec.ConsumerGroupName, "0").Result()
+			if err != nil && !strings.HasPrefix(err.Error(), "BUSYGROUP") {
+				return err
+			}
+			return seekConsumerGroup(t.MQClient, t.getStreamKeyForGroup(rec.GroupKey), rec.ConsumerGroupName, position)
+		},
+		func(rec *ArchiveRecord) string {
+			return t.getStreamKeyForGroup(rec.GroupKey)
+		})
+}
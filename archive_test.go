@@ -0,0 +1,128 @@
+package redimq
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestTopicExportImport(t *testing.T) {
+	group := "archive-group"
+	src, _ := client.NewTopic(getTestName(t, "archive-src"), nil)
+	dst, _ := client.NewTopic(getTestName(t, "archive-dst"), nil)
+	defer src.Purge(false)
+	defer dst.Purge(false)
+	ids := []string{}
+	for _, v := range []string{"1", "2", "3"} {
+		m := &Message{Data: map[string]interface{}{"seq": v}, Headers: map[string]string{"source": "test"}}
+		src.PublishMessage(m)
+		ids = append(ids, m.Id)
+	}
+	src.SeekConsumerGroup(group, PositionAtId(ids[1]))
+	buf := &bytes.Buffer{}
+	count, err := src.Export(buf, &ExportOptions{ConsumerGroups: true})
+	if err != nil || count != 3 || strings.Count(buf.String(), "\n") != 4 {
+		t.Fatal("Export is not valid", count, err, buf.String())
+	}
+	report, err := dst.Import(bytes.NewReader(buf.Bytes()), nil)
+	if err != nil || report.Messages != 3 || report.ConsumerGroups != 1 {
+		t.Fatal("Import failed", report, err)
+	}
+	page, _ := dst.Browse(nil)
+	if len(page.Messages) != 3 || page.Messages[2].Id != ids[2] || page.Messages[2].Headers["source"] != "test" {
+		t.Error("Imported messages are not valid", page.Messages)
+	}
+	msgs, err := dst.ConsumeMessages(group, "archive-consumer", 10)
+	if err != nil || len(msgs) != 2 || msgs[0].Data["seq"] != "2" {
+		t.Error("Consumer group position is not restored", msgs, err)
+	}
+	if _, err := dst.Import(bytes.NewReader(buf.Bytes()), nil); err == nil {
+		t.Error("Import accepted the ids older than the messages of the topic")
+	}
+}
+
+func TestTopicImportRewriteIds(t *testing.T) {
+	group := "archive-group"
+	src, _ := client.NewTopic(getTestName(t, "archive-src"), nil)
+	dst, _ := client.NewTopic(getTestName(t, "archive-dst"), nil)
+	defer src.Purge(false)
+	defer dst.Purge(false)
+	ids := []string{}
+	for _, v := range []string{"1", "2", "3"} {
+		m := &Message{Data: map[string]interface{}{"seq": v}}
+		src.PublishMessage(m)
+		ids = append(ids, m.Id)
+	}
+	src.SeekConsumerGroup(group, PositionAtId(ids[2]))
+	buf := &bytes.Buffer{}
+	src.Export(buf, &ExportOptions{ConsumerGroups: true})
+	last := &Message{Data: map[string]interface{}{"seq": "0"}}
+	dst.PublishMessage(last)
+	if _, err := dst.Import(bytes.NewReader(buf.Bytes()), &ImportOptions{RewriteIds: true}); err != nil {
+		t.Fatal("Import failed", err)
+	}
+	msgs, err := dst.ConsumeMessages(group, "archive-consumer", 10)
+	if err != nil || len(msgs) != 1 || msgs[0].Data["seq"] != "3" || compareStreamIds(msgs[0].Id, last.Id) <= 0 {
+		t.Error("Consumer group position is not translated to the new ids", msgs, err)
+	}
+}
+
+func TestGMTExportImport(t *testing.T) {
+	lanes := int64(2)
+	src, _ := client.NewGroupedMessageTopic(getTestName(t, "archive-src"), &TopicOptions{Lanes: &lanes})
+	dst, _ := client.NewGroupedMessageTopic(getTestName(t, "archive-dst"), nil)
+	defer src.Purge(false)
+	defer dst.Purge(false)
+	for _, key := range []string{"a", "b", "c"} {
+		for _, v := range []string{"1", "2"} {
+			src.PublishMessage(key, &Message{Data: map[string]interface{}{"seq": v}})
+		}
+	}
+	buf := &bytes.Buffer{}
+	count, err := src.Export(buf, &ExportOptions{ConsumerGroups: true})
+	if err != nil || count != 6 || strings.Contains(buf.String(), HeaderGroupKey) {
+		t.Fatal("Export is not valid", count, err, buf.String())
+	}
+	report, err := dst.Import(bytes.NewReader(buf.Bytes()), &ImportOptions{RewriteIds: true})
+	if err != nil || report.Messages != 6 {
+		t.Fatal("Import failed", report, err)
+	}
+	for _, key := range []string{"a", "b", "c"} {
+		page, _ := dst.BrowseGroup(key, nil)
+		if len(page.Messages) != 2 || page.Messages[0].Data["seq"] != "1" || page.Messages[1].Data["seq"] != "2" {
+			t.Error("Imported message group is not valid", key, page.Messages)
+		}
+	}
+	if _, err := dst.Import(strings.NewReader(`{"type":"message","data":{"seq":"1"}}`), nil); err == nil {
+		t.Error("Import accepted a message without a group key")
+	}
+	if _, err := dst.Import(strings.NewReader(`{"type":"unknown"}`), nil); err == nil {
+		t.Error("Import accepted an unknown record type")
+	}
+}
+
+func TestTopicExportImportClaimCheck(t *testing.T) {
+	srcStore, _ := NewFileBlobStore(t.TempDir())
+	dstStore, _ := NewFileBlobStore(t.TempDir())
+	src, _ := client.NewTopic(getTestName(t, "archive-src"), &TopicOptions{ClaimCheck: &ClaimCheck{Store: srcStore, Threshold: 1}})
+	dst, _ := client.NewTopic(getTestName(t, "archive-dst"), &TopicOptions{ClaimCheck: &ClaimCheck{Store: dstStore, Threshold: 1}})
+	defer src.Purge(false)
+	defer dst.Purge(false)
+	src.PublishMessage(&Message{Data: map[string]interface{}{"doc": "order"}})
+	buf := &bytes.Buffer{}
+	if _, err := src.Export(buf, nil); err != nil || !strings.Contains(buf.String(), "order") || strings.Contains(buf.String(), HeaderClaimCheck) {
+		t.Fatal("Claim checked message is not exported with its data", err, buf.String())
+	}
+	if _, err := dst.Import(bytes.NewReader(buf.Bytes()), nil); err != nil {
+		t.Fatal("Import failed", err)
+	}
+	raw, _ := client.rc.XRange(client.c, dst.StreamKey, "-", "+").Result()
+	key, _ := raw[0].Values[headerFieldPrefix+HeaderClaimCheck].(string)
+	if _, err := dstStore.Get(key); err != nil {
+		t.Error("Imported message is not stored in the blob store of the topic", key, err)
+	}
+	page, err := dst.Browse(nil)
+	if err != nil || len(page.Messages) != 1 || page.Messages[0].Data["doc"] != "order" {
+		t.Error("Imported message is not valid", page, err)
+	}
+}
@@ -0,0 +1,31 @@
+package redimq
+
+import (
+	"context"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// Backend is the storage of the topics used by the MQClient. It is the subset of the go-redis API used by
+// RediMQ, so a [redis.Client] or a [redis.ClusterClient] is a Backend storing the topics in REDIS, while
+// the [MemoryBackend] stores them in memory for the unit tests and the single process tools.
+type Backend interface {
+	redis.Cmdable
+	Watch(ctx context.Context, fn func(*redis.Tx) error, keys ...string) error
+}
+
+// clock is implemented by the backends having their own time, like the [MemoryBackend] with a clock set by
+// a test. The MQClient uses the time of such a backend for the idle times, the expiry, the retention and
+// the heartbeats, so that they agree with the backend.
+type clock interface {
+	Now() time.Time
+}
+
+// now returns the current time of the backend of the client if it has a clock, time.Now otherwise
+func (c *MQClient) now() time.Time {
+	if clk, ok := c.rc.(clock); ok {
+		return clk.Now()
+	}
+	return time.Now()
+}
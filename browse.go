@@ -0,0 +1,279 @@
+package redimq
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// BrowseOptions are the options for browsing the messages of a topic using [Topic.Browse]
+type BrowseOptions struct {
+	// Start is the id of the first message of the page. Defaults to the first message of the stream.
+	Start string
+	// End is the id of the last message of the page. Defaults to the last message of the stream.
+	End string
+	// StartTime is used instead of the Start when set, to browse the messages published at or after it
+	StartTime *time.Time
+	// EndTime is used instead of the End when set, to browse the messages published at or before it
+	EndTime *time.Time
+	// Count is the maximum number of messages read for the page. Defaults to the DefaultBrowsePageSize.
+	Count int64
+	// Reverse browses the messages from the End to the Start
+	Reverse bool
+	// Headers filters the messages to the ones having all the headers with the same values
+	Headers map[string]string
+}
+
+// PendingState is the state of a message delivered to a consumer but not yet acknowledged
+type PendingState struct {
+	ConsumerGroupName string
+	ConsumerName      string
+	Idle              time.Duration
+	DeliveryCount     int64
+}
+
+// BrowsedMessage is a message returned while browsing a topic along with its pending state in each of
+// the consumer groups where it is yet to be acknowledged
+type BrowsedMessage struct {
+	*Message
+	Pending []*PendingState
+}
+
+// BrowsePage is a page of messages returned by [Topic.Browse]. The NextId can be used as the Start (or
+// the End when browsing in reverse) for the next page, and is empty when there are no more messages.
+type BrowsePage struct {
+	Messages []*BrowsedMessage
+	NextId   string
+}
+
+func (o *BrowseOptions) getRange() (string, string) {
+	start, end := "-", "+"
+	if o.Start != "" {
+		start = o.Start
+	}
+	if o.End != "" {
+		end = o.End
+	}
+	if o.StartTime != nil {
+		start = fmt.Sprintf("%d-0", o.StartTime.UnixMilli())
+	}
+	if o.EndTime != nil {
+		end = fmt.Sprintf("%d-%d", o.EndTime.UnixMilli(), ^uint64(0))
+	}
+	return start, end
+}
+
+func (o *BrowseOptions) matches(m *Message) bool {
+	for k, v := range o.Headers {
+		if h, ok := m.Headers[k]; !ok || h != v {
+			return false
+		}
+	}
+	return true
+}
+
+// Browse returns a page of the messages in the Topic without consuming them. The messages are read from
+// the stream as is, so no consumer group is created or moved while browsing. Along with every message,
+// its pending state in each consumer group is returned, i.e. the consumer it is delivered to, the time
+// since it was delivered and the number of times it has been delivered.
+//
+//	page, err := topic.Browse(&redimq.BrowseOptions{Count: 10})
+//	for err == nil && page.NextId != "" {
+//		page, err = topic.Browse(&redimq.BrowseOptions{Start: page.NextId, Count: 10})
+//	}
+//
+// For a Topic having PriorityLevels, the messages of all the levels are returned in the order of their ids
+// along with their Priority.
+func (t *Topic) Browse(options *BrowseOptions) (*BrowsePage, error) {
+	if options == nil {
+		options = &BrowseOptions{}
+	}
+	count := options.Count
+	if count <= 0 {
+		count = DefaultBrowsePageSize
+	}
+	if t.PriorityLevels > 1 {
+		return t.browsePriorities(options, count)
+	}
+	start, end := options.getRange()
+	var res []redis.XMessage
+	var err error
+	if options.Reverse {
+		res, err = t.MQClient.rc.XRevRangeN(t.MQClient.c, t.StreamKey, end, start, count).Result()
+	} else {
+		res, err = t.MQClient.rc.XRangeN(t.MQClient.c, t.StreamKey, start, end, count).Result()
+	}
+	if err != nil {
+		return nil, err
+	}
+	page := &BrowsePage{Messages: []*BrowsedMessage{}}
+	if int64(len(res)) == count {
+		last := res[len(res)-1].ID
+		if options.Reverse {
+			page.NextId = previousStreamId(last)
+		} else {
+			page.NextId = nextStreamId(last)
+		}
+	}
+	if len(res) == 0 {
+		return page, nil
+	}
+	pending, err := t.getPendingStates(res[0].ID, res[len(res)-1].ID, int64(len(res)))
+	if err != nil {
+		return nil, err
+	}
+	for _, xm := range res {
+		m := xMessageToMessage(xm, *t, "", "")
+		if !options.matches(m) {
+			continue
+		}
+		page.Messages = append(page.Messages, &BrowsedMessage{Message: m, Pending: pending[xm.ID]})
+	}
+	return page, nil
+}
+
+// browsePriorities returns a page of the messages of all the priority levels, merged in the order of their
+// ids. The page ends before the first id not yet read from any of the streams, so that no message is skipped
+// or repeated by the next page.
+func (t *Topic) browsePriorities(options *BrowseOptions, count int64) (*BrowsePage, error) {
+	before := func(a string, b string) bool {
+		if options.Reverse {
+			return compareStreamIds(a, b) > 0
+		}
+		return compareStreamIds(a, b) < 0
+	}
+	page := &BrowsePage{Messages: []*BrowsedMessage{}}
+	levelOptions := *options
+	levelOptions.Count = count
+	for priority, pt := range t.getPriorityTopics() {
+		p, err := pt.Browse(&levelOptions)
+		if err != nil {
+			return nil, err
+		}
+		for _, m := range p.Messages {
+			m.Priority = int64(priority)
+		}
+		page.Messages = append(page.Messages, p.Messages...)
+		if p.NextId != "" && (page.NextId == "" || before(p.NextId, page.NextId)) {
+			page.NextId = p.NextId
+		}
+	}
+	sort.SliceStable(page.Messages, func(i, j int) bool {
+		return before(page.Messages[i].Id, page.Messages[j].Id)
+	})
+	messages := page.Messages[:0]
+	for _, m := range page.Messages {
+		if page.NextId == "" || before(m.Id, page.NextId) {
+			messages = append(messages, m)
+		}
+	}
+	page.Messages = messages
+	if int64(len(page.Messages)) > count {
+		page.Messages = page.Messages[:count]
+		last := page.Messages[count-1].Id
+		if options.Reverse {
+			page.NextId = previousStreamId(last)
+		} else {
+			page.NextId = nextStreamId(last)
+		}
+	}
+	return page, nil
+}
+
+// getPendingStates returns the pending states of the messages between the ids in all the consumer groups
+func (t *Topic) getPendingStates(first string, last string, count int64) (map[string][]*PendingState, error) {
+	if compareStreamIds(first, last) > 0 {
+		first, last = last, first
+	}
+	states := map[string][]*PendingState{}
+	groups, err := t.MQClient.rc.XInfoGroups(t.MQClient.c, t.StreamKey).Result()
+	if isNoSuchKeyError(err) {
+		return states, nil
+	} else if err != nil {
+		return nil, err
+	}
+	for _, g := range groups {
+		if g.Pending == 0 {
+			continue
+		}
+		res, err := t.MQClient.rc.XPendingExt(t.MQClient.c, &redis.XPendingExtArgs{
+			Stream: t.StreamKey,
+			Group:  g.Name,
+			Start:  first,
+			End:    last,
+			Count:  count,
+		}).Result()
+		if err != nil && err != redis.Nil {
+			return nil, err
+		}
+		for _, p := range res {
+			states[p.ID] = append(states[p.ID], &PendingState{
+				ConsumerGroupName: g.Name,
+				ConsumerName:      p.Consumer,
+				Idle:              p.Idle,
+				DeliveryCount:     p.RetryCount,
+			})
+		}
+	}
+	return states, nil
+}
+
+// Peek returns upto count messages that would be delivered next to the consumer group, without consuming
+// them. If the consumer group does not exist, the messages from the beginning of the Topic are returned.
+//
+// For a Topic having PriorityLevels, the messages are returned from the highest level to the lowest, without
+// considering the PriorityWeights.
+func (t *Topic) Peek(consumerGroupName string, count int64) ([]*BrowsedMessage, error) {
+	if t.PriorityLevels > 1 {
+		msgs := []*BrowsedMessage{}
+		for l := t.PriorityLevels - 1; l >= 0 && int64(len(msgs)) < count; l-- {
+			res, err := t.getTopicForPriority(l).Peek(consumerGroupName, count-int64(len(msgs)))
+			if err != nil {
+				return nil, err
+			}
+			for _, m := range res {
+				m.Priority = l
+			}
+			msgs = append(msgs, res...)
+		}
+		return msgs, nil
+	}
+	start := ""
+	groups, err := t.MQClient.rc.XInfoGroups(t.MQClient.c, t.StreamKey).Result()
+	if isNoSuchKeyError(err) {
+		return []*BrowsedMessage{}, nil
+	} else if err != nil {
+		return nil, err
+	}
+	for _, g := range groups {
+		if g.Name == consumerGroupName {
+			start = nextStreamId(g.LastDeliveredID)
+		}
+	}
+	page, err := t.Browse(&BrowseOptions{Start: start, Count: count})
+	if err != nil {
+		return nil, err
+	}
+	return page.Messages, nil
+}
+
+// BrowseGroup returns a page of the messages in a message group of the GroupedMessageTopic without consuming
+// them. It works the same way as [Topic.Browse].
+//
+// For a topic having Lanes, only the messages of the message group are returned from its lane, so a page
+// can have fewer messages than the Count even if there are more messages.
+func (t *GroupedMessageTopic) BrowseGroup(groupKey string, options *BrowseOptions) (*BrowsePage, error) {
+	if t.Lanes > 0 {
+		options = laneBrowseOptions(groupKey, options)
+	}
+	page, err := t.getTopicForGroup(t.getMessageGroupKey(groupKey)).Browse(options)
+	if err != nil {
+		return nil, err
+	}
+	for _, m := range page.Messages {
+		m.GroupKey = groupKey
+	}
+	return page, nil
+}
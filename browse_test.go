@@ -0,0 +1,88 @@
+package redimq
+
+import (
+	"testing"
+	"time"
+)
+
+func TestTopicBrowse(t *testing.T) {
+	b, _ := client.NewTopic(getTestName(t, "browse"), nil)
+	for _, tenant := range []string{"a", "b", "a"} {
+		m := &Message{Data: map[string]interface{}{"foo": "test"}, Headers: map[string]string{"tenant": tenant}}
+		if err := b.PublishMessage(m); err != nil {
+			t.Fatal("PublishMessage failed", err)
+		}
+	}
+	b.SeekConsumerGroup("browse-group", PositionBeginning)
+	consumed, _ := b.ConsumeMessages("browse-group", "browse-consumer", 1)
+	page, err := b.Browse(&BrowseOptions{Count: 2})
+	if err != nil {
+		t.Fatal("Browse returned error", err)
+	}
+	if len(page.Messages) != 2 || page.NextId == "" {
+		t.Fatal("Browse did not return the first page")
+	}
+	if len(page.Messages[0].Pending) != 1 || page.Messages[0].Pending[0].ConsumerName != "browse-consumer" {
+		t.Error("Browse did not return the pending state of the consumed message")
+	}
+	if page.Messages[0].Id != consumed[0].Id || page.Messages[0].Headers["tenant"] != "a" {
+		t.Error("Browse message does not match")
+	}
+	page, err = b.Browse(&BrowseOptions{Start: page.NextId, Count: 2})
+	if err != nil || len(page.Messages) != 1 || page.NextId != "" {
+		t.Error("Browse did not return the last page", err)
+	}
+	page, err = b.Browse(&BrowseOptions{Headers: map[string]string{"tenant": "a"}, Reverse: true})
+	if err != nil || len(page.Messages) != 2 {
+		t.Error("Browse did not filter the messages by headers", err)
+	}
+	peeked, err := b.Peek("browse-group", 10)
+	if err != nil || len(peeked) != 2 {
+		t.Error("Peek did not return the messages after the consumer group position", err)
+	}
+}
+
+func TestTopicBrowseHeaderLikeData(t *testing.T) {
+	b, _ := client.NewTopic(getTestName(t, "browse-fields"), nil)
+	b.PublishMessage(&Message{Data: map[string]interface{}{"header:tenant": "a"}})
+	page, err := b.Browse(nil)
+	if err != nil || len(page.Messages) != 1 {
+		t.Fatal("Browse returned error", err)
+	}
+	if m := page.Messages[0]; m.Data["header:tenant"] != "a" || len(m.Headers) != 0 {
+		t.Error("Data field was taken for a header", m.Data, m.Headers)
+	}
+}
+
+func TestTopicBrowsePriority(t *testing.T) {
+	levels := int64(2)
+	b, _ := client.NewTopic(getTestName(t, "browse-priority"), &TopicOptions{PriorityLevels: &levels})
+	ids := []string{}
+	for _, p := range []int64{1, 0, 1, 0} {
+		m := &Message{Priority: p, Data: map[string]interface{}{"foo": "test"}}
+		if err := b.PublishMessage(m); err != nil {
+			t.Fatal("PublishMessage failed", err)
+		}
+		ids = append(ids, m.Id)
+		time.Sleep(2 * time.Millisecond)
+	}
+	page, err := b.Browse(&BrowseOptions{Count: 2})
+	if err != nil || len(page.Messages) != 2 || page.NextId == "" {
+		t.Fatal("Browse did not return the first page", err)
+	}
+	if page.Messages[0].Id != ids[0] || page.Messages[0].Priority != 1 || page.Messages[1].Id != ids[1] || page.Messages[1].Priority != 0 {
+		t.Error("Browse did not merge the priority levels in the order of the ids")
+	}
+	page, err = b.Browse(&BrowseOptions{Start: page.NextId, Count: 2})
+	if err != nil || len(page.Messages) != 2 || page.NextId != "" {
+		t.Fatal("Browse did not return the last page", err)
+	}
+	if page.Messages[0].Id != ids[2] || page.Messages[1].Id != ids[3] {
+		t.Error("Browse skipped or repeated messages across the pages")
+	}
+	b.SeekConsumerGroup("browse-group", PositionBeginning)
+	peeked, err := b.Peek("browse-group", 3)
+	if err != nil || len(peeked) != 3 || peeked[0].Priority != 1 || peeked[1].Priority != 1 || peeked[2].Priority != 0 {
+		t.Error("Peek did not return the messages from the highest priority level", err)
+	}
+}
@@ -0,0 +1,422 @@
+package redimq
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// HeaderClaimCheck is the header holding the key of the BlobStore entry that the Data of a message was
+// stored in
+const HeaderClaimCheck = "redimq-claim-check"
+
+// ErrBlobNotFound is returned by a BlobStore for a key that it does not have
+var ErrBlobNotFound = errors.New("redimq: blob not found")
+
+// BlobStore stores the Data of the messages too large for the streams, for the topics having a ClaimCheck
+type BlobStore interface {
+	Put(key string, data []byte) error
+	// Get returns the blob of the key, or ErrBlobNotFound if there is none
+	Get(key string) ([]byte, error)
+	// Delete removes the blob of the key. Deleting a missing blob is not an error.
+	Delete(key string) error
+}
+
+// ClaimCheck enables the claim-check pattern for a topic. The Data of a message at least the Threshold in
+// size is stored in the Store and the message is published with only the reference to it in the
+// HeaderClaimCheck header, which is resolved back to the Data when the message is consumed or browsed from
+// a topic having the same Store. A consumed message whose blob cannot be read is left pending with a
+// [DecodeError]. The blobs are removed by CollectBlobs once their messages are trimmed or acknowledged by
+// all the consumer groups, and the blobs whose messages were never added after the
+// DefaultClaimCheckGracePeriod. A ClaimCheck takes precedence over the Compression of the
+// topic for the messages it stores. The messages routed by an [Exchange] are claim checked only for the
+// topics created using the same MQClient as the exchange, as the Store cannot be kept in the bindings.
+//
+//	store, err := redimq.NewFileBlobStore("/var/lib/orders/blobs")
+//	topic, err := client.NewTopic("orders", &redimq.TopicOptions{
+//		ClaimCheck: &redimq.ClaimCheck{Store: store},
+//	})
+type ClaimCheck struct {
+	Store BlobStore
+	// Threshold is the size in bytes of the Data from which a message is stored in the Store. Defaults
+	// to the DefaultClaimCheckThreshold.
+	Threshold int
+}
+
+// FileBlobStore is a BlobStore keeping every blob in a file of a directory, e.g. a shared volume
+type FileBlobStore struct {
+	Dir string
+}
+
+// NewFileBlobStore creates a FileBlobStore in the directory, creating the directory if needed
+func NewFileBlobStore(dir string) (*FileBlobStore, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	return &FileBlobStore{Dir: dir}, nil
+}
+
+func (s *FileBlobStore) getPath(key string) string {
+	return filepath.Join(s.Dir, url.PathEscape(key))
+}
+
+// Put writes the blob to a temporary file and renames it, so that a blob is never read partially
+func (s *FileBlobStore) Put(key string, data []byte) error {
+	f, err := os.CreateTemp(s.Dir, ".blob-*")
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(data)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(f.Name(), s.getPath(key))
+	}
+	if err != nil {
+		os.Remove(f.Name())
+	}
+	return err
+}
+
+func (s *FileBlobStore) Get(key string) ([]byte, error) {
+	data, err := os.ReadFile(s.getPath(key))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, ErrBlobNotFound
+	}
+	return data, err
+}
+
+func (s *FileBlobStore) Delete(key string) error {
+	err := os.Remove(s.getPath(key))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	return err
+}
+
+// RedisBlobStore is a BlobStore keeping every blob in a REDIS key, e.g. of another REDIS instance with
+// more memory or eviction disabled. It is created using the NewRedisBlobStore function of the MQClient.
+type RedisBlobStore struct {
+	MQClient
+}
+
+// NewRedisBlobStore creates a RedisBlobStore keeping the blobs in the REDIS of the client
+func (c *MQClient) NewRedisBlobStore() *RedisBlobStore {
+	return &RedisBlobStore{MQClient: *c}
+}
+
+func getBlobKey(key string) string {
+	return "redimq:blob:" + key
+}
+
+func (s *RedisBlobStore) Put(key string, data []byte) error {
+	return s.rc.Set(s.c, getBlobKey(key), data, 0).Err()
+}
+
+func (s *RedisBlobStore) Get(key string) ([]byte, error) {
+	data, err := s.rc.Get(s.c, getBlobKey(key)).Bytes()
+	if err == redis.Nil {
+		return nil, ErrBlobNotFound
+	}
+	return data, err
+}
+
+func (s *RedisBlobStore) Delete(key string) error {
+	return s.rc.Del(s.c, getBlobKey(key)).Err()
+}
+
+// getBlobIndexKey returns the key of the hash of the blobs of the stream, mapping their keys to the ids of
+// their messages. It has the hash tag of the stream.
+func getBlobIndexKey(stream string) string {
+	return "{" + getHashTag(stream) + "}:blobs"
+}
+
+// Values of the blob index for the blobs whose message ids are not known. A blob is indexed with an intent,
+// holding the time in unix milliseconds, before it is stored, and marked as added along with adding its
+// message to the stream, till the id of the message is indexed. A blob being collected is marked as deleting
+// till it is deleted from the store.
+const (
+	blobIntentPrefix = "intent:"
+	blobAdded        = "added"
+	blobDeleting     = "deleting"
+)
+
+// parseClaimCheck validates the claim-check options and returns the ClaimCheck for the topic
+func parseClaimCheck(options *TopicOptions) (*ClaimCheck, error) {
+	if options.ClaimCheck == nil {
+		return nil, nil
+	}
+	if options.ClaimCheck.Store == nil {
+		return nil, errors.New("ClaimCheck Store is not set")
+	}
+	claimCheck := *options.ClaimCheck
+	if claimCheck.Threshold <= 0 {
+		claimCheck.Threshold = DefaultClaimCheckThreshold
+	}
+	return &claimCheck, nil
+}
+
+// getStreamValues returns the fields of the stream entry for the message published to the stream. The Data
+// is stored in the BlobStore of the claim check if large enough, in which case the key of the blob is
+// returned for marking it as added along with the message using markBlobAdded, or compressed otherwise if
+// the compression is set. The blob is indexed with an intent before it is stored, so that it is collected
+// if the message is never added.
+func (m *Message) getStreamValues(client MQClient, stream string, claimCheck *ClaimCheck, compression *Compression) (map[string]interface{}, string, error) {
+	if claimCheck == nil || len(m.Data) == 0 {
+		values, err := m.getCompressedValues(compression)
+		return values, "", err
+	}
+	encoded, err := encodeData(m)
+	if err != nil {
+		return nil, "", err
+	}
+	if len(encoded) < claimCheck.Threshold {
+		values, err := m.getCompressedValues(compression)
+		return values, "", err
+	}
+	key := stream + "/" + newRandomId()
+	intent := blobIntentPrefix + strconv.FormatInt(client.now().UnixMilli(), 10)
+	if err := client.rc.HSet(client.c, getBlobIndexKey(stream), key, intent).Err(); err != nil {
+		return nil, "", err
+	}
+	if err := claimCheck.Store.Put(key, encoded); err != nil {
+		abandonBlob(client, stream, claimCheck, key, err)
+		return nil, "", err
+	}
+	values := make(map[string]interface{}, len(m.Headers)+2)
+	for k, v := range m.getValues() {
+		if _, ok := m.Data[k]; !ok {
+			values[k] = v
+		}
+	}
+	values[headerFieldPrefix+HeaderClaimCheck] = key
+	return values, key, nil
+}
+
+// markBlobAdded marks the blob as added in the transaction adding its message to the stream
+func markBlobAdded(client MQClient, pipe redis.Pipeliner, stream string, blobKey string) {
+	if blobKey != "" {
+		pipe.HSet(client.c, getBlobIndexKey(stream), blobKey, blobAdded)
+	}
+}
+
+// indexBlob records the id of the message added to the stream for its blob, for it to be collected by
+// CollectBlobs
+func indexBlob(client MQClient, stream string, blobKey string, id string) error {
+	if blobKey == "" {
+		return nil
+	}
+	return client.rc.HSet(client.c, getBlobIndexKey(stream), blobKey, id).Err()
+}
+
+// abandonBlob removes the blob of a message that failed to be added to the stream with the error. When the
+// error is not a reply of REDIS, e.g. a connection error, the message may have been added, so the blob is
+// removed only if it is not marked as added. A blob that could not be removed is left to CollectBlobs.
+func abandonBlob(client MQClient, stream string, claimCheck *ClaimCheck, blobKey string, addErr error) {
+	if blobKey == "" {
+		return
+	}
+	indexKey := getBlobIndexKey(stream)
+	var replyErr redis.Error
+	if !errors.As(addErr, &replyErr) {
+		v, err := client.rc.HGet(client.c, indexKey, blobKey).Result()
+		if err != nil || !strings.HasPrefix(v, blobIntentPrefix) {
+			return
+		}
+	}
+	if err := claimCheck.Store.Delete(blobKey); err != nil {
+		println("Error removing the blob "+blobKey+": ", err.Error())
+		return
+	}
+	client.rc.HDel(client.c, indexKey, blobKey)
+}
+
+// resolveClaimCheck returns the Data of the message from the BlobStore of the claim check, and removes the
+// HeaderClaimCheck header. The Data and the headers are left as is, with an error, if the blob cannot be
+// read, e.g. after it is collected or when the topic does not have a ClaimCheck.
+func resolveClaimCheck(claimCheck *ClaimCheck, data map[string]interface{}, headers map[string]string) (map[string]interface{}, error) {
+	key, ok := headers[HeaderClaimCheck]
+	if !ok {
+		return data, nil
+	}
+	if claimCheck == nil {
+		return data, errors.New("ClaimCheck is not set for the topic of the claim checked message")
+	}
+	encoded, err := claimCheck.Store.Get(key)
+	if err != nil {
+		return data, fmt.Errorf("reading the blob %s failed: %w", key, err)
+	}
+	resolved, err := decodeData(encoded)
+	if err != nil {
+		return data, err
+	}
+	delete(headers, HeaderClaimCheck)
+	return resolved, nil
+}
+
+// isBlobAcknowledged returns whether the message of the id has been acknowledged by all the consumer groups
+// reading the stream. The consumer groups are the ones of the groups stream, e.g. the MessageGroupStreamKey of
+// a GroupedMessageTopic, so a consumer group that has not read the stream yet has not acknowledged it.
+func isBlobAcknowledged(client MQClient, stream string, id string, cgs []redis.XInfoGroup, streamGroups map[string]redis.XInfoGroup) (bool, error) {
+	if len(cgs) == 0 {
+		return false, nil
+	}
+	for _, cg := range cgs {
+		g, ok := streamGroups[cg.Name]
+		if !ok || compareStreamIds(id, g.LastDeliveredID) > 0 {
+			return false, nil
+		}
+		pending, err := client.rc.XPendingExt(client.c, &redis.XPendingExtArgs{Stream: stream, Group: g.Name, Start: id, End: id, Count: 1}).Result()
+		if err != nil && err != redis.Nil {
+			return false, err
+		}
+		if len(pending) > 0 {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// getGracePeriod returns the DefaultClaimCheckGracePeriod
+func getGracePeriod() time.Duration {
+	gracePeriod, err := time.ParseDuration(DefaultClaimCheckGracePeriod)
+	if err != nil {
+		gracePeriod = time.Hour
+	}
+	return gracePeriod
+}
+
+// collectBlobs removes the blobs of the messages of the stream that are trimmed or acknowledged by all the
+// consumer groups of the groups stream, along with the blobs whose messages were never added within the
+// DefaultClaimCheckGracePeriod, and returns the number of blobs removed. The blobs are removed only while the
+// fencing token is the latest one, if the fence is set.
+func collectBlobs(client MQClient, stream string, groupsStream string, store BlobStore, f *fence) (int64, error) {
+	rc := client.rc
+	c := client.c
+	indexKey := getBlobIndexKey(stream)
+	index, err := rc.HGetAll(c, indexKey).Result()
+	if err != nil || len(index) == 0 {
+		return 0, err
+	}
+	cgs, err := rc.XInfoGroups(c, groupsStream).Result()
+	if err != nil && !isNoSuchKeyError(err) {
+		return 0, err
+	}
+	streamGroups := map[string]redis.XInfoGroup{}
+	groups := cgs
+	if groupsStream != stream {
+		groups, err = rc.XInfoGroups(c, stream).Result()
+		if err != nil && !isNoSuchKeyError(err) {
+			return 0, err
+		}
+	}
+	for _, g := range groups {
+		streamGroups[g.Name] = g
+	}
+	length, err := rc.XLen(c, stream).Result()
+	if err != nil {
+		return 0, err
+	}
+	cutoff := client.now().Add(-getGracePeriod()).UnixMilli()
+	var collected int64
+	for blobKey, id := range index {
+		var collect bool
+		switch {
+		case strings.HasPrefix(id, blobIntentPrefix):
+			at, _ := strconv.ParseInt(strings.TrimPrefix(id, blobIntentPrefix), 10, 64)
+			collect = at < cutoff
+		case id == blobDeleting:
+			// the blob was being deleted when the collection stopped
+			collect = true
+		case id == blobAdded:
+			// the id of the message is not known, so its blob is kept till the stream is emptied
+			collect = length == 0
+		default:
+			exists, err := rc.XRangeN(c, stream, id, id, 1).Result()
+			if err != nil {
+				return collected, err
+			}
+			collect = len(exists) == 0
+			if !collect {
+				collect, err = isBlobAcknowledged(client, stream, id, cgs, streamGroups)
+				if err != nil {
+					return collected, err
+				}
+			}
+		}
+		if !collect {
+			continue
+		}
+		// the blob is marked as being deleted while the fencing token is the latest one, so that it is not
+		// deleted by a janitor that has lost the leadership, and is removed from the index once deleted
+		if id != blobDeleting {
+			err = client.watchFenced(f, func(tx *redis.Tx) error {
+				_, err := tx.TxPipelined(c, func(pipe redis.Pipeliner) error {
+					pipe.HSet(c, indexKey, blobKey, blobDeleting)
+					return nil
+				})
+				return err
+			})
+			if err != nil {
+				return collected, err
+			}
+		}
+		if err := store.Delete(blobKey); err != nil {
+			return collected, err
+		}
+		if err := rc.HDel(c, indexKey, blobKey).Err(); err != nil {
+			return collected, err
+		}
+		collected++
+	}
+	return collected, nil
+}
+
+// CollectBlobs removes the blobs of the ClaimCheck of the Topic whose messages have been trimmed or
+// acknowledged by all the consumer groups, and returns the number of blobs removed. A Topic without
+// consumer groups keeps the blobs of its messages till they are trimmed. It should be run periodically,
+// e.g. as a leader duty of a [Consumer].
+func (t *Topic) CollectBlobs() (int64, error) {
+	if t.ClaimCheck == nil {
+		return 0, errors.New("ClaimCheck is not set for the Topic " + t.Name)
+	}
+	var collected int64
+	for _, pt := range t.getPriorityTopics() {
+		n, err := collectBlobs(t.MQClient, pt.StreamKey, pt.StreamKey, t.ClaimCheck.Store, nil)
+		collected += n
+		if err != nil {
+			return collected, err
+		}
+	}
+	return collected, nil
+}
+
+// CollectBlobs removes the blobs of the ClaimCheck of the GroupedMessageTopic whose messages have been
+// trimmed or acknowledged by all the consumer groups, and returns the number of blobs removed. It is run
+// along with the Cleanup of the topic.
+func (t *GroupedMessageTopic) CollectBlobs() (int64, error) {
+	if t.ClaimCheck == nil {
+		return 0, errors.New("ClaimCheck is not set for the GroupedMessageTopic " + t.Name)
+	}
+	entries, err := t.getMessageGroupEntries()
+	if err != nil {
+		return 0, err
+	}
+	var collected int64
+	for _, e := range entries {
+		n, err := collectBlobs(t.MQClient, t.getStreamKeyForGroup(getMessageGroupEntryKey(e)), t.MessageGroupStreamKey, t.ClaimCheck.Store, nil)
+		collected += n
+		if err != nil {
+			return collected, err
+		}
+	}
+	return collected, nil
+}
@@ -0,0 +1,178 @@
+package redimq
+
+import (
+	"errors"
+	"os"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTopicClaimCheck(t *testing.T) {
+	group := "claim-check-group"
+	store, err := NewFileBlobStore(t.TempDir())
+	if err != nil {
+		t.Fatal("NewFileBlobStore failed", err)
+	}
+	s, err := client.NewTopic(getTestName(t, "claim-check"), &TopicOptions{ClaimCheck: &ClaimCheck{Store: store, Threshold: 100}})
+	if err != nil {
+		t.Fatal("NewTopic failed", err)
+	}
+	defer s.Purge(false)
+	doc := strings.Repeat("order ", 100)
+	s.PublishMessage(&Message{Data: map[string]interface{}{"doc": doc, "count": 3}, Headers: map[string]string{"source": "test"}})
+	s.PublishMessage(&Message{Data: map[string]interface{}{"doc": "order"}})
+	raw, _ := client.rc.XRange(client.c, s.StreamKey, "-", "+").Result()
+	key, _ := raw[0].Values[headerFieldPrefix+HeaderClaimCheck].(string)
+	if len(raw) != 2 || key == "" || raw[0].Values["doc"] != nil || raw[1].Values["doc"] != "order" {
+		t.Fatal("Messages are not claim checked by their size", raw)
+	}
+	s.SeekConsumerGroup(group, PositionBeginning)
+	msgs, err := s.ConsumeMessages(group, "claim-check-consumer", 10)
+	if err != nil || len(msgs) != 2 {
+		t.Fatal("ConsumeMessages failed", msgs, err)
+	}
+	m := msgs[0]
+	if m.Data["doc"] != doc || m.Data["count"] != "3" || m.Headers["source"] != "test" || m.Headers[HeaderClaimCheck] != "" {
+		t.Error("Claim checked message is not resolved", m.Data, m.Headers)
+	}
+	if n, err := s.CollectBlobs(); err != nil || n != 0 {
+		t.Error("Blob of a pending message is collected", n, err)
+	}
+	m.Acknowledge()
+	if n, err := s.CollectBlobs(); err != nil || n != 1 {
+		t.Error("Blob of the acknowledged message is not collected", n, err)
+	}
+	if _, err := os.Stat(store.getPath(key)); !os.IsNotExist(err) {
+		t.Error("Blob file is not removed", err)
+	}
+	if _, err := client.NewTopic(getTestName(t, "claim-check"), &TopicOptions{ClaimCheck: &ClaimCheck{}}); err == nil {
+		t.Error("NewTopic accepted a ClaimCheck without a Store")
+	}
+}
+
+func TestGMTClaimCheck(t *testing.T) {
+	group := "claim-check-group"
+	store := client.NewRedisBlobStore()
+	g, _ := client.NewGroupedMessageTopic(getTestName(t, "claim-check"), &TopicOptions{ClaimCheck: &ClaimCheck{Store: store, Threshold: 1}})
+	defer g.Purge(false)
+	g.InitTopicGroups(group, "claim-check-consumer")
+	g.PublishMessage("a", &Message{Data: map[string]interface{}{"doc": "order"}})
+	msgs, err := g.ConsumeMessages(group, "claim-check-consumer")
+	if err != nil || len(msgs) != 1 || msgs[0].Data["doc"] != "order" {
+		t.Fatal("Claim checked message is not resolved", msgs, err)
+	}
+	key := getBlobKey(g.getStreamKeyForGroup("a") + "/")
+	msgs[0].Acknowledge()
+	report, err := g.Cleanup()
+	if err != nil || report.CollectedBlobs != 1 {
+		t.Error("Cleanup did not collect the blob", report, err)
+	}
+	if keys, _ := client.rc.Keys(client.c, key+"*").Result(); len(keys) != 0 {
+		t.Error("Blob key is not removed", keys)
+	}
+}
+
+func TestGMTClaimCheckUnreadGroup(t *testing.T) {
+	store := client.NewRedisBlobStore()
+	g, _ := client.NewGroupedMessageTopic(getTestName(t, "claim-check-unread"), &TopicOptions{ClaimCheck: &ClaimCheck{Store: store, Threshold: 1}})
+	g.InitTopicGroups("claim-check-group", "claim-check-consumer")
+	g.PublishMessage("a", &Message{Data: map[string]interface{}{"doc": "order"}})
+	g.InitTopicGroups("claim-check-late-group", "claim-check-consumer")
+	msgs, err := g.ConsumeMessages("claim-check-group", "claim-check-consumer")
+	if err != nil || len(msgs) != 1 {
+		t.Fatal("ConsumeMessages failed", msgs, err)
+	}
+	msgs[0].Acknowledge()
+	if n, err := g.CollectBlobs(); err != nil || n != 0 {
+		t.Error("Blob of a message not read by a consumer group is collected", n, err)
+	}
+}
+
+func TestTopicClaimCheckMissingBlob(t *testing.T) {
+	group := "claim-check-group"
+	store := client.NewRedisBlobStore()
+	s, _ := client.NewTopic(getTestName(t, "claim-check-missing"), &TopicOptions{ClaimCheck: &ClaimCheck{Store: store, Threshold: 1}})
+	s.PublishMessage(&Message{Data: map[string]interface{}{"doc": "order"}})
+	raw, _ := client.rc.XRange(client.c, s.StreamKey, "-", "+").Result()
+	key, _ := raw[0].Values[headerFieldPrefix+HeaderClaimCheck].(string)
+	store.Delete(key)
+	s.SeekConsumerGroup(group, PositionBeginning)
+	msgs, err := s.ConsumeMessages(group, "claim-check-consumer", 10)
+	var decodeErr *DecodeError
+	if !errors.As(err, &decodeErr) || !errors.Is(err, ErrBlobNotFound) || len(msgs) != 0 {
+		t.Error("Message with a missing blob is not reported", msgs, err)
+	}
+}
+
+func TestTopicClaimCheckAbandonedBlobs(t *testing.T) {
+	store := client.NewRedisBlobStore()
+	s, _ := client.NewTopic(getTestName(t, "claim-check-abandoned"), &TopicOptions{ClaimCheck: &ClaimCheck{Store: store, Threshold: 1}})
+	s.PublishMessage(&Message{Data: map[string]interface{}{"doc": "order"}})
+	if err := s.publishMessage(&Message{Data: map[string]interface{}{"doc": "order"}}, "1-1"); err == nil {
+		t.Fatal("Message older than the stream is added")
+	}
+	index, _ := client.rc.HGetAll(client.c, getBlobIndexKey(s.StreamKey)).Result()
+	if len(index) != 1 {
+		t.Error("Blob of the message that was not added is not removed", index)
+	}
+	if keys, _ := client.rc.Keys(client.c, getBlobKey(s.StreamKey+"/")+"*").Result(); len(keys) != 1 {
+		t.Error("Blob of the message that was not added is not removed", keys)
+	}
+	stale := blobIntentPrefix + strconv.FormatInt(time.Now().Add(-2*time.Hour).UnixMilli(), 10)
+	recent := blobIntentPrefix + strconv.FormatInt(time.Now().UnixMilli(), 10)
+	client.rc.HSet(client.c, getBlobIndexKey(s.StreamKey), s.StreamKey+"/stale", stale, s.StreamKey+"/recent", recent)
+	store.Put(s.StreamKey+"/stale", []byte("{}"))
+	store.Put(s.StreamKey+"/recent", []byte("{}"))
+	if n, err := s.CollectBlobs(); err != nil || n != 1 {
+		t.Error("CollectBlobs did not collect the stale blob only", n, err)
+	}
+	if _, err := store.Get(s.StreamKey + "/recent"); err != nil {
+		t.Error("Blob being published is collected", err)
+	}
+}
+
+// failingBlobStore is a BlobStore whose Delete fails while failing is set
+type failingBlobStore struct {
+	BlobStore
+	failing bool
+}
+
+func (s *failingBlobStore) Delete(key string) error {
+	if s.failing {
+		return errors.New("delete failed")
+	}
+	return s.BlobStore.Delete(key)
+}
+
+func TestCollectBlobsDeleting(t *testing.T) {
+	store := &failingBlobStore{BlobStore: client.NewRedisBlobStore(), failing: true}
+	s, _ := client.NewTopic(getTestName(t, "claim-check-deleting"), &TopicOptions{ClaimCheck: &ClaimCheck{Store: store, Threshold: 1}})
+	s.PublishMessage(&Message{Data: map[string]interface{}{"doc": "order"}})
+	raw, _ := client.rc.XRange(client.c, s.StreamKey, "-", "+").Result()
+	key, _ := raw[0].Values[headerFieldPrefix+HeaderClaimCheck].(string)
+	client.rc.XTrimMaxLen(client.c, s.StreamKey, 0)
+	if n, err := collectBlobs(*client, s.StreamKey, s.StreamKey, store, &fence{name: getTestName(t, "claim-check-fence"), token: 1}); err != ErrLeadershipLost || n != 0 {
+		t.Error("Blob is collected by a stale leader", n, err)
+	}
+	if _, err := store.Get(key); err != nil {
+		t.Error("Blob is deleted by a stale leader", err)
+	}
+	if n, err := s.CollectBlobs(); err == nil || n != 0 {
+		t.Error("Failed deletion of the blob is not reported", n, err)
+	}
+	if v, _ := client.rc.HGet(client.c, getBlobIndexKey(s.StreamKey), key).Result(); v != blobDeleting {
+		t.Error("Blob is not marked as being deleted", v)
+	}
+	store.failing = false
+	if n, err := s.CollectBlobs(); err != nil || n != 1 {
+		t.Error("Blob being deleted is not collected again", n, err)
+	}
+	if _, err := store.Get(key); err != ErrBlobNotFound {
+		t.Error("Blob is not deleted", err)
+	}
+	if n, _ := client.rc.HLen(client.c, getBlobIndexKey(s.StreamKey)).Result(); n != 0 {
+		t.Error("Blob is not removed from the index", n)
+	}
+}
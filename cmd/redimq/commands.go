@@ -0,0 +1,711 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/webbytes/redimq"
+)
+
+// topicFlags are the flags used for creating the topic a command works on
+type topicFlags struct {
+	grouped        bool
+	lanes          int64
+	priorityLevels int64
+}
+
+// addTopicFlags adds the flags of the topic to the command. The grouped flag is added only for the commands
+// working on both the topics and the grouped topics.
+func addTopicFlags(flags *flag.FlagSet, withGrouped bool) *topicFlags {
+	f := &topicFlags{grouped: !withGrouped}
+	if withGrouped {
+		flags.BoolVar(&f.grouped, "grouped", false, "the topic is a grouped topic")
+	}
+	return f
+}
+
+// addCreateTopicFlags adds the flags used for creating the topic to the commands writing the messages of a
+// topic. The other commands use the lanes and the priority levels stored for the topic.
+func addCreateTopicFlags(flags *flag.FlagSet) *topicFlags {
+	f := addTopicFlags(flags, true)
+	flags.Int64Var(&f.priorityLevels, "priority-levels", 0, "number of priority levels of the topic")
+	flags.Int64Var(&f.lanes, "lanes", 0, "number of lanes of the grouped topic")
+	return f
+}
+
+// topic looks up the topic without registering the name, so that a mistyped name is not created
+func (f *topicFlags) topic(c *cli, name string) (*redimq.Topic, error) {
+	t, err := c.client.GetTopic(name)
+	if errors.Is(err, redimq.ErrTopicNotFound) {
+		return nil, errors.New("topic " + name + " not found")
+	}
+	return t, err
+}
+
+// groupedTopic looks up the grouped topic without registering the name
+func (f *topicFlags) groupedTopic(c *cli, name string) (*redimq.GroupedMessageTopic, error) {
+	t, err := c.client.GetGroupedMessageTopic(name)
+	if errors.Is(err, redimq.ErrTopicNotFound) {
+		return nil, errors.New("grouped topic " + name + " not found")
+	}
+	return t, err
+}
+
+// newTopic creates the topic, for the commands writing the messages of a topic
+func (f *topicFlags) newTopic(c *cli, name string) (*redimq.Topic, error) {
+	options := &redimq.TopicOptions{}
+	if f.priorityLevels > 0 {
+		options.PriorityLevels = &f.priorityLevels
+	}
+	return c.client.NewTopic(name, options)
+}
+
+// newGroupedTopic creates the grouped topic, for the commands writing the messages of a grouped topic
+func (f *topicFlags) newGroupedTopic(c *cli, name string) (*redimq.GroupedMessageTopic, error) {
+	options := &redimq.TopicOptions{}
+	if f.lanes > 0 {
+		options.Lanes = &f.lanes
+	}
+	return c.client.NewGroupedMessageTopic(name, options)
+}
+
+func listTopics(c *cli, args []string) error {
+	flags := flag.NewFlagSet("topics", flag.ContinueOnError)
+	pattern := flags.String("pattern", "*", "pattern of the topic names")
+	if err := parseArgs(flags, args, 0); err != nil {
+		return err
+	}
+	topics := []*redimq.Topic{}
+	gmts := []*redimq.GroupedMessageTopic{}
+	var cursor uint64
+	for {
+		res, next, err := c.client.FindUngroupedMessageTopics(pattern, 100, cursor)
+		if err != nil {
+			return err
+		}
+		topics = append(topics, res...)
+		if cursor = next; cursor == 0 {
+			break
+		}
+	}
+	for {
+		res, next, err := c.client.FindGroupedMessageTopics(pattern, 100, cursor)
+		if err != nil {
+			return err
+		}
+		gmts = append(gmts, res...)
+		if cursor = next; cursor == 0 {
+			break
+		}
+	}
+	partitioned := []string{}
+	for {
+		res, next, err := c.client.FindPartitionedTopicNames(pattern, 100, cursor)
+		if err != nil {
+			return err
+		}
+		partitioned = append(partitioned, res...)
+		if cursor = next; cursor == 0 {
+			break
+		}
+	}
+	out := struct {
+		Topics            []*redimq.TopicStats               `json:"topics"`
+		GroupedTopics     []*redimq.GroupedMessageTopicStats `json:"groupedTopics"`
+		PartitionedTopics []string                           `json:"partitionedTopics"`
+	}{[]*redimq.TopicStats{}, []*redimq.GroupedMessageTopicStats{}, partitioned}
+	rows := [][]string{}
+	for _, t := range topics {
+		s, err := t.Stats()
+		if err != nil {
+			return err
+		}
+		out.Topics = append(out.Topics, s)
+		rows = append(rows, []string{"topic", s.Name, itoa(s.Messages), itoa(s.PendingMessages), "-", itoa(s.ConsumerGroups), strconv.FormatBool(s.Paused)})
+	}
+	for _, t := range gmts {
+		s, err := t.Stats()
+		if err != nil {
+			return err
+		}
+		out.GroupedTopics = append(out.GroupedTopics, s)
+		rows = append(rows, []string{"grouped", s.Name, "-", "-", itoa(s.MessageGroups), itoa(s.ConsumerGroups), strconv.FormatBool(s.Paused)})
+	}
+	for _, name := range partitioned {
+		rows = append(rows, []string{"partitioned", name, "-", "-", "-", "-", "-"})
+	}
+	return c.print(out, []string{"TYPE", "NAME", "MESSAGES", "PENDING", "MESSAGE-GROUPS", "CONSUMER-GROUPS", "PAUSED"}, rows)
+}
+
+func describeTopic(c *cli, args []string) error {
+	flags := flag.NewFlagSet("describe", flag.ContinueOnError)
+	tf := addTopicFlags(flags, true)
+	if err := parseArgs(flags, args, 1); err != nil {
+		return err
+	}
+	var stats interface{}
+	var groups []*redimq.ConsumerGroupStats
+	var rows [][]string
+	if tf.grouped {
+		t, err := tf.groupedTopic(c, flags.Arg(0))
+		if err != nil {
+			return err
+		}
+		s, err := t.Stats()
+		if err != nil {
+			return err
+		}
+		if groups, err = t.GetConsumerGroups(); err != nil {
+			return err
+		}
+		stats = s
+		rows = [][]string{{"Name", s.Name}, {"Paused", strconv.FormatBool(s.Paused)}, {"Message groups", itoa(s.MessageGroups)},
+			{"Paused groups", itoa(s.PausedGroups)}, {"Expired messages", itoa(s.ExpiredMessages)}}
+	} else {
+		t, err := tf.topic(c, flags.Arg(0))
+		if err != nil {
+			return err
+		}
+		s, err := t.Stats()
+		if err != nil {
+			return err
+		}
+		if groups, err = t.GetConsumerGroups(); err != nil {
+			return err
+		}
+		stats = s
+		rows = [][]string{{"Name", s.Name}, {"Paused", strconv.FormatBool(s.Paused)}, {"Messages", itoa(s.Messages)},
+			{"Pending messages", itoa(s.PendingMessages)}, {"Expired messages", itoa(s.ExpiredMessages)}}
+	}
+	if c.json {
+		return c.print(map[string]interface{}{"stats": stats, "consumerGroups": groups}, nil, nil)
+	}
+	if err := c.print(nil, []string{"FIELD", "VALUE"}, rows); err != nil {
+		return err
+	}
+	fmt.Fprintln(c.out)
+	rows = [][]string{}
+	for _, g := range groups {
+		rows = append(rows, []string{g.Name, strconv.Itoa(len(g.Consumers)), itoa(g.Pending), itoa(g.Lag), g.LastDeliveredId})
+	}
+	return c.print(nil, []string{"CONSUMER-GROUP", "CONSUMERS", "PENDING", "LAG", "LAST-DELIVERED-ID"}, rows)
+}
+
+func listConsumers(c *cli, args []string) error {
+	flags := flag.NewFlagSet("consumers", flag.ContinueOnError)
+	tf := addTopicFlags(flags, true)
+	if err := parseArgs(flags, args, 2); err != nil {
+		return err
+	}
+	groups, err := getConsumerGroups(c, tf, flags.Arg(0))
+	if err != nil {
+		return err
+	}
+	var group *redimq.ConsumerGroupStats
+	for _, g := range groups {
+		if g.Name == flags.Arg(1) {
+			group = g
+		}
+	}
+	if group == nil {
+		return errors.New("consumer group " + flags.Arg(1) + " not found for the topic " + flags.Arg(0))
+	}
+	registry, err := c.client.GetConsumers(group.Name)
+	if err != nil {
+		return err
+	}
+	infos := map[string]*redimq.ConsumerInfo{}
+	for _, i := range registry {
+		infos[i.Name] = i
+	}
+	rows := [][]string{}
+	for _, s := range group.Consumers {
+		alive, host := "-", "-"
+		if i, ok := infos[s.Name]; ok {
+			alive, host = strconv.FormatBool(i.IsAlive()), i.Host
+		}
+		rows = append(rows, []string{s.Name, itoa(s.Pending), s.Idle.String(), alive, host})
+	}
+	if !c.json {
+		fmt.Fprintf(c.out, "Pending: %d, Lag: %d\n\n", group.Pending, group.Lag)
+	}
+	out := map[string]interface{}{"consumerGroup": group, "registry": registry}
+	return c.print(out, []string{"CONSUMER", "PENDING", "IDLE", "ALIVE", "HOST"}, rows)
+}
+
+func getConsumerGroups(c *cli, tf *topicFlags, name string) ([]*redimq.ConsumerGroupStats, error) {
+	if tf.grouped {
+		t, err := tf.groupedTopic(c, name)
+		if err != nil {
+			return nil, err
+		}
+		return t.GetConsumerGroups()
+	}
+	t, err := tf.topic(c, name)
+	if err != nil {
+		return nil, err
+	}
+	return t.GetConsumerGroups()
+}
+
+func listGroups(c *cli, args []string) error {
+	flags := flag.NewFlagSet("groups", flag.ContinueOnError)
+	tf := addTopicFlags(flags, false)
+	options := &redimq.ListGroupsOptions{}
+	flags.BoolVar(&options.SortByBacklog, "sort-backlog", false, "sort the message groups by their backlog")
+	flags.Int64Var(&options.Offset, "offset", 0, "number of message groups to skip")
+	flags.Int64Var(&options.Count, "count", redimq.DefaultBrowsePageSize, "number of message groups to list")
+	if err := parseArgs(flags, args, 2); err != nil {
+		return err
+	}
+	t, err := tf.groupedTopic(c, flags.Arg(0))
+	if err != nil {
+		return err
+	}
+	page, err := t.ListGroups(flags.Arg(1), options)
+	if err != nil {
+		return err
+	}
+	rows := [][]string{}
+	for _, g := range page.Groups {
+		rows = append(rows, groupRow(g))
+	}
+	if err := c.print(page, groupHeader, rows); err != nil || c.json {
+		return err
+	}
+	if page.NextOffset > 0 {
+		fmt.Fprintf(c.out, "\n%d of %d message groups, next page with -offset %d\n", len(page.Groups), page.Total, page.NextOffset)
+	}
+	return nil
+}
+
+func describeGroup(c *cli, args []string) error {
+	flags := flag.NewFlagSet("group", flag.ContinueOnError)
+	tf := addTopicFlags(flags, false)
+	if err := parseArgs(flags, args, 3); err != nil {
+		return err
+	}
+	t, err := tf.groupedTopic(c, flags.Arg(0))
+	if err != nil {
+		return err
+	}
+	g, err := t.DescribeGroup(flags.Arg(1), flags.Arg(2))
+	if err != nil {
+		return err
+	}
+	if g == nil {
+		return errors.New("message group " + flags.Arg(2) + " not found for the grouped topic " + flags.Arg(0))
+	}
+	return c.print(g, groupHeader, [][]string{groupRow(g)})
+}
+
+var groupHeader = []string{"GROUP-KEY", "BACKLOG", "OLDEST", "OWNER", "LOCK-IDLE", "PENDING", "LAST-DELIVERED-ID", "PAUSED"}
+
+func groupRow(g *redimq.MessageGroupInfo) []string {
+	return []string{g.GroupKey, itoa(g.Backlog), g.OldestMessageAge.Round(time.Millisecond).String(), g.Owner,
+		g.LockIdle.String(), itoa(g.Pending), g.LastDeliveredId, strconv.FormatBool(g.Paused)}
+}
+
+// inputMessage is a message read from the stdin for publishing
+type inputMessage struct {
+	GroupKey  string                 `json:"groupKey"`
+	Data      map[string]interface{} `json:"data"`
+	Headers   map[string]string      `json:"headers"`
+	Priority  int64                  `json:"priority"`
+	ExpiresAt *time.Time             `json:"expiresAt"`
+}
+
+// toMessage returns the message to be published. The nested objects and arrays of the data are published
+// as JSON strings, as the fields of a stream entry can only hold strings.
+func (i *inputMessage) toMessage() (*redimq.Message, error) {
+	m := &redimq.Message{Data: map[string]interface{}{}, Headers: i.Headers, Priority: i.Priority}
+	for k, v := range i.Data {
+		switch v.(type) {
+		case map[string]interface{}, []interface{}:
+			b, err := json.Marshal(v)
+			if err != nil {
+				return nil, err
+			}
+			m.Data[k] = string(b)
+		case nil:
+			m.Data[k] = ""
+		default:
+			m.Data[k] = v
+		}
+	}
+	if i.ExpiresAt != nil {
+		m.ExpiresAt = *i.ExpiresAt
+	}
+	return m, nil
+}
+
+func publish(c *cli, args []string) error {
+	flags := flag.NewFlagSet("publish", flag.ContinueOnError)
+	tf := addCreateTopicFlags(flags)
+	if err := parseArgs(flags, args, 1); err != nil {
+		return err
+	}
+	var publishMessage func(i *inputMessage, m *redimq.Message) error
+	if tf.grouped {
+		t, err := tf.newGroupedTopic(c, flags.Arg(0))
+		if err != nil {
+			return err
+		}
+		publishMessage = func(i *inputMessage, m *redimq.Message) error {
+			if i.GroupKey == "" {
+				return errors.New("groupKey is required for a grouped topic")
+			}
+			return t.PublishMessage(i.GroupKey, m)
+		}
+	} else {
+		t, err := tf.newTopic(c, flags.Arg(0))
+		if err != nil {
+			return err
+		}
+		publishMessage = func(i *inputMessage, m *redimq.Message) error {
+			return t.PublishMessage(m)
+		}
+	}
+	scanner := bufio.NewScanner(c.in)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	ids := []string{}
+	rows := [][]string{}
+	for line := 1; scanner.Scan(); line++ {
+		if strings.TrimSpace(scanner.Text()) == "" {
+			continue
+		}
+		i := &inputMessage{}
+		if err := json.Unmarshal(scanner.Bytes(), i); err != nil {
+			return fmt.Errorf("invalid message on line %d: [%w]", line, err)
+		}
+		m, err := i.toMessage()
+		if err == nil {
+			err = publishMessage(i, m)
+		}
+		if err != nil {
+			return fmt.Errorf("publishing the message on line %d failed: [%w]", line, err)
+		}
+		ids = append(ids, m.Id)
+		rows = append(rows, []string{m.Id, i.GroupKey})
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	return c.print(ids, []string{"ID", "GROUP-KEY"}, rows)
+}
+
+// outputMessage is a message printed by the browse and the tail commands
+type outputMessage struct {
+	Id       string                 `json:"id"`
+	GroupKey string                 `json:"groupKey,omitempty"`
+	Data     map[string]interface{} `json:"data"`
+	Headers  map[string]string      `json:"headers,omitempty"`
+	Pending  []*redimq.PendingState `json:"pending,omitempty"`
+}
+
+func toOutputMessages(msgs []*redimq.BrowsedMessage) []*outputMessage {
+	out := make([]*outputMessage, len(msgs))
+	for i, m := range msgs {
+		out[i] = &outputMessage{Id: m.Id, GroupKey: m.GroupKey, Data: m.Data, Headers: m.Headers, Pending: m.Pending}
+	}
+	return out
+}
+
+func messageRow(m *outputMessage) []string {
+	data, _ := json.Marshal(m.Data)
+	headers := ""
+	if len(m.Headers) > 0 {
+		b, _ := json.Marshal(m.Headers)
+		headers = string(b)
+	}
+	pending := []string{}
+	for _, p := range m.Pending {
+		pending = append(pending, fmt.Sprintf("%s/%s x%d", p.ConsumerGroupName, p.ConsumerName, p.DeliveryCount))
+	}
+	return []string{m.Id, m.GroupKey, string(data), headers, strings.Join(pending, ",")}
+}
+
+var messageHeader = []string{"ID", "GROUP-KEY", "DATA", "HEADERS", "PENDING"}
+
+// browseFunc returns the function browsing the topic, or the message group of a grouped topic
+func browseFunc(c *cli, tf *topicFlags, name string, groupKey string) (func(o *redimq.BrowseOptions) (*redimq.BrowsePage, error), error) {
+	if tf.grouped {
+		if groupKey == "" {
+			return nil, errors.New("-group is required for a grouped topic")
+		}
+		t, err := tf.groupedTopic(c, name)
+		if err != nil {
+			return nil, err
+		}
+		return func(o *redimq.BrowseOptions) (*redimq.BrowsePage, error) { return t.BrowseGroup(groupKey, o) }, nil
+	}
+	t, err := tf.topic(c, name)
+	if err != nil {
+		return nil, err
+	}
+	return t.Browse, nil
+}
+
+func browse(c *cli, args []string) error {
+	flags := flag.NewFlagSet("browse", flag.ContinueOnError)
+	tf := addTopicFlags(flags, true)
+	groupKey := flags.String("group", "", "key of the message group of the grouped topic")
+	options := &redimq.BrowseOptions{}
+	flags.StringVar(&options.Start, "start", "", "id of the first message")
+	flags.StringVar(&options.End, "end", "", "id of the last message")
+	flags.Int64Var(&options.Count, "count", redimq.DefaultBrowsePageSize, "maximum number of messages")
+	flags.BoolVar(&options.Reverse, "reverse", false, "browse from the last message to the first")
+	if err := parseArgs(flags, args, 1); err != nil {
+		return err
+	}
+	browseTopic, err := browseFunc(c, tf, flags.Arg(0), *groupKey)
+	if err != nil {
+		return err
+	}
+	page, err := browseTopic(options)
+	if err != nil {
+		return err
+	}
+	msgs := toOutputMessages(page.Messages)
+	rows := [][]string{}
+	for _, m := range msgs {
+		rows = append(rows, messageRow(m))
+	}
+	out := map[string]interface{}{"messages": msgs, "nextId": page.NextId}
+	if err := c.print(out, messageHeader, rows); err != nil || c.json {
+		return err
+	}
+	if page.NextId != "" {
+		fmt.Fprintf(c.out, "\nnext page with -start %s\n", page.NextId)
+	}
+	return nil
+}
+
+func tail(c *cli, args []string) error {
+	flags := flag.NewFlagSet("tail", flag.ContinueOnError)
+	tf := addTopicFlags(flags, true)
+	groupKey := flags.String("group", "", "key of the message group of the grouped topic")
+	interval := flags.Duration("interval", time.Second, "interval for checking the new messages")
+	if err := parseArgs(flags, args, 1); err != nil {
+		return err
+	}
+	browseTopic, err := browseFunc(c, tf, flags.Arg(0), *groupKey)
+	if err != nil {
+		return err
+	}
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	page, err := browseTopic(&redimq.BrowseOptions{Reverse: true, Count: 1})
+	if err != nil {
+		return err
+	}
+	last := ""
+	if len(page.Messages) > 0 {
+		last = page.Messages[0].Id
+	}
+	enc := json.NewEncoder(c.out)
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(*interval):
+		}
+		page, err := browseTopic(&redimq.BrowseOptions{Start: last})
+		if err != nil {
+			return err
+		}
+		for _, m := range toOutputMessages(page.Messages) {
+			if m.Id == last {
+				continue
+			}
+			last = m.Id
+			if c.json {
+				err = enc.Encode(m)
+			} else {
+				_, err = fmt.Fprintln(c.out, strings.Join(messageRow(m)[:4], "  "))
+			}
+			if err != nil {
+				return err
+			}
+		}
+	}
+}
+
+func purge(c *cli, args []string) error {
+	flags := flag.NewFlagSet("purge", flag.ContinueOnError)
+	tf := addTopicFlags(flags, true)
+	groupKey := flags.String("group", "", "key of the message group to purge from the grouped topic")
+	dryRun := flags.Bool("dry-run", false, "report what would be removed without removing it")
+	if err := parseArgs(flags, args, 1); err != nil {
+		return err
+	}
+	var report *redimq.PurgeReport
+	if tf.grouped {
+		t, err := tf.groupedTopic(c, flags.Arg(0))
+		if err != nil {
+			return err
+		}
+		if *groupKey != "" {
+			report, err = t.PurgeGroup(*groupKey, *dryRun)
+		} else {
+			report, err = t.Purge(*dryRun)
+		}
+		if err != nil {
+			return err
+		}
+	} else {
+		t, err := tf.topic(c, flags.Arg(0))
+		if err != nil {
+			return err
+		}
+		if report, err = t.Purge(*dryRun); err != nil {
+			return err
+		}
+	}
+	rows := [][]string{{strconv.FormatBool(report.DryRun), itoa(report.Messages), itoa(report.PendingEntries),
+		strings.Join(report.MessageGroups, ",")}}
+	return c.print(report, []string{"DRY-RUN", "MESSAGES", "PENDING", "MESSAGE-GROUPS"}, rows)
+}
+
+func redrive(c *cli, args []string) error {
+	flags := flag.NewFlagSet("redrive", flag.ContinueOnError)
+	tf := addTopicFlags(flags, false)
+	deadLetterTopic := flags.String("dead-letter-topic", "", "name of the dead letter topic")
+	count := flags.Int64("count", 1000, "maximum number of messages to redrive")
+	if err := parseArgs(flags, args, 1); err != nil {
+		return err
+	}
+	if *deadLetterTopic == "" {
+		return errors.New("-dead-letter-topic is required")
+	}
+	t, err := tf.groupedTopic(c, flags.Arg(0))
+	if err != nil {
+		return err
+	}
+	t.DeadLetterTopic = *deadLetterTopic
+	n, err := t.Redrive(*count)
+	if err != nil {
+		return fmt.Errorf("redrive failed after %d messages: [%w]", n, err)
+	}
+	return c.print(map[string]int64{"redriven": n}, []string{"REDRIVEN"}, [][]string{{itoa(n)}})
+}
+
+func exportTopic(c *cli, args []string) error {
+	flags := flag.NewFlagSet("export", flag.ContinueOnError)
+	tf := addTopicFlags(flags, true)
+	consumerGroups := flags.Bool("consumer-groups", false, "export the positions of the consumer groups")
+	if err := parseArgs(flags, args, 1); err != nil {
+		return err
+	}
+	options := &redimq.ExportOptions{ConsumerGroups: *consumerGroups}
+	if tf.grouped {
+		t, err := tf.groupedTopic(c, flags.Arg(0))
+		if err != nil {
+			return err
+		}
+		_, err = t.Export(c.out, options)
+		return err
+	}
+	t, err := tf.topic(c, flags.Arg(0))
+	if err != nil {
+		return err
+	}
+	_, err = t.Export(c.out, options)
+	return err
+}
+
+func importTopic(c *cli, args []string) error {
+	flags := flag.NewFlagSet("import", flag.ContinueOnError)
+	tf := addCreateTopicFlags(flags)
+	rewriteIds := flags.Bool("rewrite-ids", false, "publish the messages with new ids")
+	if err := parseArgs(flags, args, 1); err != nil {
+		return err
+	}
+	options := &redimq.ImportOptions{RewriteIds: *rewriteIds}
+	var report *redimq.ImportReport
+	if tf.grouped {
+		t, err := tf.newGroupedTopic(c, flags.Arg(0))
+		if err != nil {
+			return err
+		}
+		if report, err = t.Import(c.in, options); err != nil {
+			return fmt.Errorf("import failed after %d messages: [%w]", report.Messages, err)
+		}
+	} else {
+		t, err := tf.newTopic(c, flags.Arg(0))
+		if err != nil {
+			return err
+		}
+		if report, err = t.Import(c.in, options); err != nil {
+			return fmt.Errorf("import failed after %d messages: [%w]", report.Messages, err)
+		}
+	}
+	rows := [][]string{{itoa(report.Messages), itoa(report.ConsumerGroups)}}
+	return c.print(report, []string{"MESSAGES", "CONSUMER-GROUPS"}, rows)
+}
+
+var streamIdPattern = regexp.MustCompile(`^\d+(-\d+)?$`)
+
+// parsePosition parses the position of a consumer group given as beginning, end, a message id or a time
+func parsePosition(s string) (redimq.StreamPosition, error) {
+	switch s {
+	case "beginning":
+		return redimq.PositionBeginning, nil
+	case "end":
+		return redimq.PositionEnd, nil
+	}
+	if streamIdPattern.MatchString(s) {
+		return redimq.PositionAtId(s), nil
+	}
+	t, err := time.Parse(time.RFC3339, s)
+	if err != nil {
+		return "", errors.New("invalid position " + s + ", should be beginning, end, a message id or an RFC3339 time")
+	}
+	return redimq.PositionAtTime(t), nil
+}
+
+func reset(c *cli, args []string) error {
+	flags := flag.NewFlagSet("reset", flag.ContinueOnError)
+	tf := addTopicFlags(flags, true)
+	if err := parseArgs(flags, args, 3); err != nil {
+		return err
+	}
+	position, err := parsePosition(flags.Arg(2))
+	if err != nil {
+		return err
+	}
+	if err := seekConsumerGroup(c, tf, flags.Arg(0), flags.Arg(1), position); err != nil {
+		return err
+	}
+	out := map[string]string{"consumerGroup": flags.Arg(1), "position": string(position)}
+	return c.print(out, []string{"CONSUMER-GROUP", "POSITION"}, [][]string{{flags.Arg(1), string(position)}})
+}
+
+func seekConsumerGroup(c *cli, tf *topicFlags, name string, consumerGroupName string, position redimq.StreamPosition) error {
+	if tf.grouped {
+		t, err := tf.groupedTopic(c, name)
+		if err != nil {
+			return err
+		}
+		return t.SeekConsumerGroup(consumerGroupName, position)
+	}
+	t, err := tf.topic(c, name)
+	if err != nil {
+		return err
+	}
+	return t.SeekConsumerGroup(consumerGroupName, position)
+}
+
+func itoa(n int64) string {
+	return strconv.FormatInt(n, 10)
+}
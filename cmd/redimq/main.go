@@ -0,0 +1,157 @@
+// Command redimq is a command-line tool for operating the topics of RediMQ. It can list and describe the
+// topics, show their consumer groups and consumers, publish, tail, browse and purge the messages, redrive
+// the dead lettered messages, export and import the topics as JSON Lines archives and reset the positions of the consumer groups.
+//
+//	redimq [-addr localhost:6379] [-password ""] [-db 0] [-o table|json] <command> [arguments]
+//
+// Run "redimq help" for the list of commands.
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/webbytes/redimq"
+)
+
+// command is a sub command of the tool
+type command struct {
+	usage       string
+	description string
+	run         func(cli *cli, args []string) error
+}
+
+var commands map[string]*command
+
+func init() {
+	commands = map[string]*command{
+		"topics":   {"topics [-pattern p]", "List the topics and grouped topics with their statistics", listTopics},
+		"describe": {"describe [-grouped] <topic>", "Show the statistics and the consumer groups of a topic", describeTopic},
+		"consumers": {"consumers [-grouped] <topic> <consumer-group>", "Show the consumers of a consumer group with their lag",
+			listConsumers},
+		"groups": {"groups [-sort-backlog] [-offset n] [-count n] <grouped-topic> <consumer-group>",
+			"List the message groups of a grouped topic with their backlog and lock", listGroups},
+		"group": {"group <grouped-topic> <consumer-group> <group-key>", "Describe a message group of a grouped topic",
+			describeGroup},
+		"publish": {"publish [-grouped] [-lanes n] [-priority-levels n] <topic>",
+			"Publish the messages read from stdin, one JSON object per line with data, headers and groupKey", publish},
+		"tail": {"tail [-grouped -group key] [-interval d] <topic>", "Print the messages published to a topic as they arrive",
+			tail},
+		"browse": {"browse [-grouped -group key] [-start id] [-end id] [-count n] [-reverse] <topic>",
+			"Print a page of the messages of a topic without consuming them", browse},
+		"purge": {"purge [-grouped [-group key]] [-dry-run] <topic>", "Remove the messages of a topic or a message group",
+			purge},
+		"redrive": {"redrive -dead-letter-topic t [-count n] <grouped-topic>",
+			"Publish the dead lettered messages back to their message groups", redrive},
+		"export": {"export [-grouped] [-consumer-groups] <topic>",
+			"Write the messages of a topic to stdout as JSON Lines", exportTopic},
+		"import": {"import [-grouped] [-lanes n] [-priority-levels n] [-rewrite-ids] <topic>",
+			"Restore the messages of a topic from a JSON Lines archive read from stdin", importTopic},
+		"reset": {"reset [-grouped] <topic> <consumer-group> <beginning|end|id|RFC3339 time>",
+			"Move a consumer group to a position in the topic", reset},
+	}
+}
+
+// cli holds the client and the output settings shared by the commands
+type cli struct {
+	client *redimq.MQClient
+	json   bool
+	out    io.Writer
+	in     io.Reader
+}
+
+func main() {
+	if err := run(os.Args[1:], os.Stdin, os.Stdout); err != nil {
+		fmt.Fprintln(os.Stderr, "redimq:", err)
+		os.Exit(1)
+	}
+}
+
+func run(args []string, in io.Reader, out io.Writer) error {
+	flags := flag.NewFlagSet("redimq", flag.ContinueOnError)
+	addr := flags.String("addr", getEnv("REDIMQ_ADDR", "localhost:6379"), "address of the REDIS server")
+	password := flags.String("password", os.Getenv("REDIMQ_PASSWORD"), "password of the REDIS server")
+	db := flags.Int("db", 0, "REDIS database")
+	output := flags.String("o", "table", "output format, table or json")
+	flags.Usage = func() { printUsage(flags.Output()) }
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if *output != "table" && *output != "json" {
+		return errors.New("invalid output format " + *output)
+	}
+	if flags.NArg() == 0 || flags.Arg(0) == "help" {
+		printUsage(out)
+		return nil
+	}
+	cmd, ok := commands[flags.Arg(0)]
+	if !ok {
+		return errors.New("unknown command " + flags.Arg(0) + ", run redimq help for the commands")
+	}
+	rc := redis.NewClient(&redis.Options{Addr: *addr, Password: *password, DB: *db})
+	defer rc.Close()
+	client, err := redimq.NewMQClient(context.Background(), rc)
+	if err != nil {
+		return err
+	}
+	return cmd.run(&cli{client: client, json: *output == "json", out: out, in: in}, flags.Args()[1:])
+}
+
+func getEnv(key string, fallback string) string {
+	if v, ok := os.LookupEnv(key); ok {
+		return v
+	}
+	return fallback
+}
+
+func printUsage(w io.Writer) {
+	fmt.Fprintln(w, "Usage: redimq [-addr localhost:6379] [-password p] [-db 0] [-o table|json] <command> [arguments]")
+	fmt.Fprintln(w, "\nCommands:")
+	names := make([]string, 0, len(commands))
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	for _, name := range names {
+		fmt.Fprintf(tw, "  %s\t%s\n", commands[name].usage, commands[name].description)
+	}
+	tw.Flush()
+}
+
+// parseArgs parses the flags of a command and checks the number of its arguments
+func parseArgs(flags *flag.FlagSet, args []string, count int) error {
+	cmd := commands[flags.Name()]
+	flags.Usage = func() { fmt.Fprintln(flags.Output(), "Usage: redimq", cmd.usage) }
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() != count {
+		return errors.New("usage: redimq " + cmd.usage)
+	}
+	return nil
+}
+
+// print writes the value as JSON, or the rows as a table with the header
+func (c *cli) print(v interface{}, header []string, rows [][]string) error {
+	if c.json {
+		e := json.NewEncoder(c.out)
+		e.SetIndent("", "  ")
+		return e.Encode(v)
+	}
+	tw := tabwriter.NewWriter(c.out, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, strings.Join(header, "\t"))
+	for _, r := range rows {
+		fmt.Fprintln(tw, strings.Join(r, "\t"))
+	}
+	return tw.Flush()
+}
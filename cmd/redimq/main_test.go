@@ -0,0 +1,115 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/webbytes/redimq"
+)
+
+const testAddr = "localhost:36379"
+
+// testDB keeps the topics of the CLI tests apart from the ones of the tests of the other packages, which
+// count the registered topics
+const testDB = "2"
+
+func TestParsePosition(t *testing.T) {
+	positions := map[string]redimq.StreamPosition{
+		"beginning":            redimq.PositionBeginning,
+		"end":                  redimq.PositionEnd,
+		"1700000000000-5":      redimq.PositionAtId("1700000000000-5"),
+		"2024-01-01T00:00:00Z": "1704067199999-18446744073709551615",
+	}
+	for s, expected := range positions {
+		if p, err := parsePosition(s); err != nil || p != expected {
+			t.Error("parsePosition is not valid for", s, p, err)
+		}
+	}
+	if _, err := parsePosition("yesterday"); err == nil {
+		t.Error("parsePosition accepted an invalid position")
+	}
+}
+
+func TestInputMessage(t *testing.T) {
+	i := &inputMessage{}
+	json.Unmarshal([]byte(`{"data":{"id":1,"items":[1,2],"note":null}}`), i)
+	m, err := i.toMessage()
+	if err != nil || m.Data["items"] != "[1,2]" || m.Data["note"] != "" || m.Data["id"] != float64(1) {
+		t.Error("toMessage is not valid", m, err)
+	}
+}
+
+func TestPublishAndBrowse(t *testing.T) {
+	in := strings.NewReader("{\"groupKey\":\"a\",\"data\":{\"foo\":\"test\"}}\n\n{\"groupKey\":\"a\",\"data\":{\"foo\":\"test\"}}\n")
+	out := &bytes.Buffer{}
+	if err := run([]string{"-addr", testAddr, "-db", testDB, "-o", "json", "publish", "-grouped", "cli-test"}, in, out); err != nil {
+		t.Fatal("publish failed", err)
+	}
+	ids := []string{}
+	if err := json.Unmarshal(out.Bytes(), &ids); err != nil || len(ids) != 2 {
+		t.Fatal("publish output is not valid", out.String(), err)
+	}
+	out.Reset()
+	if err := run([]string{"-addr", testAddr, "-db", testDB, "browse", "-grouped", "-group", "a", "cli-test"}, nil, out); err != nil {
+		t.Fatal("browse failed", err)
+	}
+	if !strings.Contains(out.String(), ids[0]) || !strings.Contains(out.String(), ids[1]) {
+		t.Error("browse output does not have the published messages", out.String())
+	}
+	out.Reset()
+	if err := run([]string{"-addr", testAddr, "-db", testDB, "-o", "json", "purge", "-grouped", "cli-test"}, nil, out); err != nil {
+		t.Fatal("purge failed", err)
+	}
+	report := &redimq.PurgeReport{}
+	if err := json.Unmarshal(out.Bytes(), report); err != nil || report.Messages != 2 {
+		t.Error("purge output is not valid", out.String(), err)
+	}
+}
+
+func TestUnknownCommand(t *testing.T) {
+	if err := run([]string{"-addr", testAddr, "-db", testDB, "unknown"}, nil, &bytes.Buffer{}); err == nil {
+		t.Error("run accepted an unknown command")
+	}
+	if err := run([]string{"-addr", testAddr, "-db", testDB, "browse"}, nil, &bytes.Buffer{}); err == nil {
+		t.Error("run accepted a command without its arguments")
+	}
+}
+
+func TestMissingTopic(t *testing.T) {
+	for _, args := range [][]string{{"describe", "cli-missing"}, {"browse", "-grouped", "-group", "a", "cli-missing"}} {
+		if err := run(append([]string{"-addr", testAddr, "-db", testDB}, args...), nil, &bytes.Buffer{}); err == nil || !strings.Contains(err.Error(), "not found") {
+			t.Error("run did not fail for a missing topic", args, err)
+		}
+	}
+	out := &bytes.Buffer{}
+	if err := run([]string{"-addr", testAddr, "-db", testDB, "-o", "json", "topics", "-pattern", "cli-missing"}, nil, out); err != nil {
+		t.Fatal("topics failed", err)
+	}
+	if strings.Contains(out.String(), "cli-missing") {
+		t.Error("Looking up a missing topic registered its name", out.String())
+	}
+}
+
+func TestExportAndImport(t *testing.T) {
+	in := strings.NewReader("{\"groupKey\":\"a\",\"data\":{\"foo\":\"test\"}}\n")
+	if err := run([]string{"-addr", testAddr, "-db", testDB, "publish", "-grouped", "cli-export"}, in, &bytes.Buffer{}); err != nil {
+		t.Fatal("publish failed", err)
+	}
+	archive := &bytes.Buffer{}
+	if err := run([]string{"-addr", testAddr, "-db", testDB, "export", "-grouped", "cli-export"}, nil, archive); err != nil {
+		t.Fatal("export failed", err)
+	}
+	out := &bytes.Buffer{}
+	if err := run([]string{"-addr", testAddr, "-db", testDB, "-o", "json", "import", "-grouped", "-rewrite-ids", "cli-import"}, archive, out); err != nil {
+		t.Fatal("import failed", err)
+	}
+	report := &redimq.ImportReport{}
+	if err := json.Unmarshal(out.Bytes(), report); err != nil || report.Messages != 1 {
+		t.Error("import output is not valid", out.String(), err)
+	}
+	for _, name := range []string{"cli-export", "cli-import"} {
+		run([]string{"-addr", testAddr, "-db", testDB, "purge", "-grouped", name}, nil, &bytes.Buffer{})
+	}
+}
@@ -0,0 +1,318 @@
+package redimq
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang/snappy"
+	"github.com/klauspost/compress/zstd"
+)
+
+// HeaderCompression is the header holding the algorithm that the Data of a message was compressed with
+const HeaderCompression = "redimq-compression"
+
+// Compression algorithms available by default. Other algorithms, e.g. lz4, can be added using
+// [RegisterCodec].
+const (
+	CompressionGzip   = "gzip"
+	CompressionSnappy = "snappy"
+	CompressionZstd   = "zstd"
+)
+
+// compressedDataField is the field of the stream entry holding the compressed Data of a message
+const compressedDataField = "redimq:data"
+
+// Codec compresses and decompresses the Data of the messages for a compression algorithm
+type Codec interface {
+	Compress(data []byte) ([]byte, error)
+	Decompress(data []byte) ([]byte, error)
+}
+
+// Compression enables the compression of the Data of the messages published to a topic. A message is
+// compressed if its Data is at least the Threshold in size and gets smaller when compressed. The algorithm
+// is recorded in the HeaderCompression header of the message, so the consumers decompress the messages
+// irrespective of the Compression of the topic, and a stream can have both compressed and uncompressed
+// messages. The Data of a compressed message is stored as a single field, so the values of the Data are
+// strings when consumed, as with the uncompressed messages.
+//
+//	topic, err := client.NewTopic("orders", &redimq.TopicOptions{
+//		Compression: &redimq.Compression{Algorithm: redimq.CompressionGzip},
+//	})
+type Compression struct {
+	Algorithm string
+	// Threshold is the size in bytes of the Data from which a message is compressed. Defaults to the
+	// DefaultCompressionThreshold.
+	Threshold int
+}
+
+type gzipCodec struct{}
+
+func (gzipCodec) Compress(data []byte) ([]byte, error) {
+	buf := &bytes.Buffer{}
+	w := gzip.NewWriter(buf)
+	if _, err := w.Write(data); err != nil {
+		return nil, err
+	}
+	err := w.Close()
+	return buf.Bytes(), err
+}
+
+func (gzipCodec) Decompress(data []byte) ([]byte, error) {
+	r, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	return io.ReadAll(r)
+}
+
+type snappyCodec struct{}
+
+func (snappyCodec) Compress(data []byte) ([]byte, error) {
+	return snappy.Encode(nil, data), nil
+}
+
+func (snappyCodec) Decompress(data []byte) ([]byte, error) {
+	return snappy.Decode(nil, data)
+}
+
+// zstdCodec uses a single encoder and decoder, which are safe for concurrent use with EncodeAll and DecodeAll
+type zstdCodec struct {
+	encoder *zstd.Encoder
+	decoder *zstd.Decoder
+}
+
+func newZstdCodec() zstdCodec {
+	// the encoder and the decoder fail only for invalid options
+	encoder, _ := zstd.NewWriter(nil)
+	decoder, _ := zstd.NewReader(nil)
+	return zstdCodec{encoder: encoder, decoder: decoder}
+}
+
+func (c zstdCodec) Compress(data []byte) ([]byte, error) {
+	return c.encoder.EncodeAll(data, nil), nil
+}
+
+func (c zstdCodec) Decompress(data []byte) ([]byte, error) {
+	return c.decoder.DecodeAll(data, nil)
+}
+
+var (
+	codecs = map[string]Codec{
+		CompressionGzip:   gzipCodec{},
+		CompressionSnappy: snappyCodec{},
+		CompressionZstd:   newZstdCodec(),
+	}
+	codecsMu sync.RWMutex
+)
+
+// RegisterCodec adds a compression algorithm, or replaces the Codec of an algorithm. It should be called
+// by both the publishers and the consumers before creating the topics using the algorithm.
+//
+//	redimq.RegisterCodec("lz4", lz4Codec{})
+func RegisterCodec(algorithm string, codec Codec) {
+	codecsMu.Lock()
+	defer codecsMu.Unlock()
+	codecs[algorithm] = codec
+}
+
+func getCodec(algorithm string) (Codec, error) {
+	codecsMu.RLock()
+	defer codecsMu.RUnlock()
+	codec, ok := codecs[algorithm]
+	if !ok {
+		return nil, errors.New("Compression algorithm " + algorithm + " is not registered")
+	}
+	return codec, nil
+}
+
+// parseCompression validates the compression options and returns the Compression for the topic
+func parseCompression(options *TopicOptions) (*Compression, error) {
+	if options.Compression == nil {
+		return nil, nil
+	}
+	if _, err := getCodec(options.Compression.Algorithm); err != nil {
+		return nil, err
+	}
+	compression := *options.Compression
+	if compression.Threshold <= 0 {
+		compression.Threshold = DefaultCompressionThreshold
+	}
+	return &compression, nil
+}
+
+// formatField formats a value of the Data the same way as go-redis formats the values of the stream
+// entries, so that a compressed message is consumed with the same Data as an uncompressed one
+func formatField(v interface{}) (string, error) {
+	switch v := v.(type) {
+	case nil:
+		return "", nil
+	case string:
+		return v, nil
+	case []byte:
+		return string(v), nil
+	case int:
+		return strconv.FormatInt(int64(v), 10), nil
+	case int8:
+		return strconv.FormatInt(int64(v), 10), nil
+	case int16:
+		return strconv.FormatInt(int64(v), 10), nil
+	case int32:
+		return strconv.FormatInt(int64(v), 10), nil
+	case int64:
+		return strconv.FormatInt(v, 10), nil
+	case uint:
+		return strconv.FormatUint(uint64(v), 10), nil
+	case uint8:
+		return strconv.FormatUint(uint64(v), 10), nil
+	case uint16:
+		return strconv.FormatUint(uint64(v), 10), nil
+	case uint32:
+		return strconv.FormatUint(uint64(v), 10), nil
+	case uint64:
+		return strconv.FormatUint(v, 10), nil
+	case float32:
+		return strconv.FormatFloat(float64(v), 'f', -1, 64), nil
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64), nil
+	case bool:
+		if v {
+			return "1", nil
+		}
+		return "0", nil
+	case time.Time:
+		return v.Format(time.RFC3339Nano), nil
+	case time.Duration:
+		return strconv.FormatInt(v.Nanoseconds(), 10), nil
+	case encoding.BinaryMarshaler:
+		b, err := v.MarshalBinary()
+		return string(b), err
+	}
+	return "", fmt.Errorf("redis: can't marshal %T (implement encoding.BinaryMarshaler)", v)
+}
+
+// encodeData returns the Data of the message as JSON with the values formatted like the fields of a stream
+// entry
+func encodeData(m *Message) ([]byte, error) {
+	fields := make(map[string]string, len(m.Data))
+	for k, v := range m.Data {
+		s, err := formatField(v)
+		if err != nil {
+			return nil, err
+		}
+		fields[k] = s
+	}
+	return json.Marshal(fields)
+}
+
+// decodeData returns the Data encoded by encodeData
+func decodeData(encoded []byte) (map[string]interface{}, error) {
+	fields := map[string]string{}
+	if err := json.Unmarshal(encoded, &fields); err != nil {
+		return nil, err
+	}
+	data := make(map[string]interface{}, len(fields))
+	for k, v := range fields {
+		data[k] = v
+	}
+	return data, nil
+}
+
+// getCompressedValues returns the fields of the stream entry for the message, with the Data compressed if
+// the compression is set and the message is large enough
+func (m *Message) getCompressedValues(compression *Compression) (map[string]interface{}, error) {
+	values := m.getValues()
+	if compression == nil || len(m.Data) == 0 {
+		return values, nil
+	}
+	data, err := encodeData(m)
+	if err != nil || len(data) < compression.Threshold {
+		return values, err
+	}
+	codec, err := getCodec(compression.Algorithm)
+	if err != nil {
+		return nil, err
+	}
+	compressed, err := codec.Compress(data)
+	if err != nil || len(compressed) >= len(data) {
+		return values, err
+	}
+	res := make(map[string]interface{}, len(values)-len(m.Data)+2)
+	for k, v := range values {
+		if strings.HasPrefix(k, headerFieldPrefix) {
+			res[k] = v
+		}
+	}
+	res[headerFieldPrefix+HeaderCompression] = compression.Algorithm
+	res[compressedDataField] = compressed
+	return res, nil
+}
+
+// DecodeError is the error of a consumed message whose Data could not be decoded, e.g. when it is compressed
+// with an algorithm that is not registered by the consumer. The message is not delivered and is left pending
+// in its consumer group, so that it is delivered again once it can be decoded, or handled by the
+// FailurePolicy of a GroupedMessageTopic.
+type DecodeError struct {
+	MessageId string
+	StreamKey string
+	Err       error
+}
+
+func (e *DecodeError) Error() string {
+	return fmt.Sprintf("Message %s of %s could not be decoded: %v", e.MessageId, e.StreamKey, e.Err)
+}
+
+func (e *DecodeError) Unwrap() error {
+	return e.Err
+}
+
+// keepDecodedMessages removes the consumed messages that could not be decoded, leaving them pending, and
+// returns the error of the first one as a [DecodeError] unless the consumption returned an error
+func keepDecodedMessages(msgs []*Message, err error) ([]*Message, error) {
+	kept := make([]*Message, 0, len(msgs))
+	for _, m := range msgs {
+		if m.decodeErr == nil {
+			kept = append(kept, m)
+			continue
+		}
+		println("Error decoding message "+m.Id+": ", m.decodeErr.Error())
+		if err == nil {
+			err = m.decodeErr
+		}
+	}
+	return kept, err
+}
+
+// decompressData returns the Data of a compressed message, and removes the HeaderCompression header. The
+// Data and the headers are left as is, with an error, if the message cannot be decompressed, e.g. when the
+// algorithm is not registered by the consumer.
+func decompressData(data map[string]interface{}, headers map[string]string) (map[string]interface{}, error) {
+	algorithm, ok := headers[HeaderCompression]
+	if !ok {
+		return data, nil
+	}
+	compressed, _ := data[compressedDataField].(string)
+	codec, err := getCodec(algorithm)
+	if err != nil {
+		return data, err
+	}
+	decompressed, err := codec.Decompress([]byte(compressed))
+	if err != nil {
+		return data, err
+	}
+	res, err := decodeData(decompressed)
+	if err != nil {
+		return data, err
+	}
+	delete(headers, HeaderCompression)
+	return res, nil
+}
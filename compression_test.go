@@ -0,0 +1,93 @@
+package redimq
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestTopicCompression(t *testing.T) {
+	group := "compression-group"
+	s, err := client.NewTopic(getTestName(t, "compression"), &TopicOptions{Compression: &Compression{Algorithm: CompressionGzip, Threshold: 100}})
+	if err != nil {
+		t.Fatal("NewTopic failed", err)
+	}
+	defer s.Purge(false)
+	large := &Message{Data: map[string]interface{}{"doc": strings.Repeat("order ", 100), "count": 3, "paid": true}, Headers: map[string]string{"source": "test"}}
+	small := &Message{Data: map[string]interface{}{"doc": "order"}}
+	s.PublishMessage(large)
+	s.PublishMessage(small)
+	raw, _ := client.rc.XRange(client.c, s.StreamKey, "-", "+").Result()
+	if len(raw) != 2 || raw[0].Values[compressedDataField] == nil || raw[0].Values["doc"] != nil || raw[1].Values["doc"] != "order" {
+		t.Fatal("Messages are not compressed by their size", raw)
+	}
+	s.SeekConsumerGroup(group, PositionBeginning)
+	msgs, err := s.ConsumeMessages(group, "compression-consumer", 10)
+	if err != nil || len(msgs) != 2 {
+		t.Fatal("ConsumeMessages failed", msgs, err)
+	}
+	m := msgs[0]
+	if m.Data["doc"] != large.Data["doc"] || m.Data["count"] != "3" || m.Data["paid"] != "1" || len(m.Data) != 3 {
+		t.Error("Data of the compressed message is not valid", m.Data)
+	}
+	if _, ok := m.Headers[HeaderCompression]; ok || m.Headers["source"] != "test" {
+		t.Error("Headers of the compressed message are not valid", m.Headers)
+	}
+	if msgs[1].Data["doc"] != "order" {
+		t.Error("Data of the uncompressed message is not valid", msgs[1].Data)
+	}
+	if _, err := client.NewTopic(getTestName(t, "compression"), &TopicOptions{Compression: &Compression{Algorithm: "unknown"}}); err == nil {
+		t.Error("NewTopic accepted an unknown compression algorithm")
+	}
+}
+
+func TestGMTCompression(t *testing.T) {
+	g, _ := client.NewGroupedMessageTopic(getTestName(t, "compression"), &TopicOptions{Compression: &Compression{Algorithm: CompressionSnappy, Threshold: 1}})
+	defer g.Purge(false)
+	g.PublishMessage("a", &Message{Data: map[string]interface{}{"doc": strings.Repeat("order ", 100)}, Headers: map[string]string{"source": "test"}})
+	page, err := g.BrowseGroup("a", nil)
+	if err != nil || len(page.Messages) != 1 || page.Messages[0].Data["doc"] != strings.Repeat("order ", 100) {
+		t.Error("Compressed message of the message group is not valid", page, err)
+	}
+	if page.Messages[0].Headers["source"] != "test" {
+		t.Error("Headers of the compressed message are not kept", page.Messages[0].Headers)
+	}
+}
+
+func TestTopicCompressionZstd(t *testing.T) {
+	group := "compression-group"
+	s, err := client.NewTopic(getTestName(t, "compression-zstd"), &TopicOptions{Compression: &Compression{Algorithm: CompressionZstd, Threshold: 1}})
+	if err != nil {
+		t.Fatal("NewTopic failed", err)
+	}
+	s.PublishMessage(&Message{Data: map[string]interface{}{"doc": strings.Repeat("order ", 100)}})
+	raw, _ := client.rc.XRange(client.c, s.StreamKey, "-", "+").Result()
+	if len(raw) != 1 || raw[0].Values[headerFieldPrefix+HeaderCompression] != CompressionZstd {
+		t.Fatal("Message is not compressed with zstd", raw)
+	}
+	s.SeekConsumerGroup(group, PositionBeginning)
+	msgs, err := s.ConsumeMessages(group, "compression-consumer", 10)
+	if err != nil || len(msgs) != 1 || msgs[0].Data["doc"] != strings.Repeat("order ", 100) {
+		t.Error("Message compressed with zstd is not valid", msgs, err)
+	}
+}
+
+func TestTopicConsumeUndecodableMessage(t *testing.T) {
+	group := "compression-group"
+	s, _ := client.NewTopic(getTestName(t, "compression-undecodable"), nil)
+	s.PublishMessage(&Message{Data: map[string]interface{}{compressedDataField: "data"}, Headers: map[string]string{HeaderCompression: "unknown"}})
+	s.PublishMessage(&Message{Data: map[string]interface{}{"doc": "order"}})
+	s.SeekConsumerGroup(group, PositionBeginning)
+	msgs, err := s.ConsumeMessages(group, "compression-consumer", 10)
+	var decodeErr *DecodeError
+	if !errors.As(err, &decodeErr) || decodeErr.StreamKey != s.StreamKey {
+		t.Fatal("ConsumeMessages did not return the DecodeError", err)
+	}
+	if len(msgs) != 1 || msgs[0].Data["doc"] != "order" {
+		t.Error("Undecodable message is delivered", msgs)
+	}
+	page, _ := s.Browse(nil)
+	if len(page.Messages) != 2 || page.Messages[0].Id != decodeErr.MessageId || len(page.Messages[0].Pending) != 1 {
+		t.Error("Undecodable message is not left pending", page.Messages)
+	}
+}
@@ -33,17 +33,224 @@ type Consumer struct {
 	Handler           func(m *Message)
 	BatchHandler      func(msgs []*Message)
 	Errors            chan error
-	inProgressTopic   map[string]bool
+	// Version of the application running the consumer. It is published to the consumer registry
+	// along with the other metadata of the consumer.
+	Version string
+	// DisableJanitor stops the consumer from running the cleanup of the GroupedMessageTopics that it
+	// consumes. By default the cleanup is run by the consumer instance elected as the leader for it.
+	DisableJanitor bool
+	// IdempotencyWindow enables the idempotent consumption when set. The messages acknowledged by the
+	// handler are marked as processed in the consumer group for the window, atomically with their
+	// acknowledgement, and a message delivered again within the window is acknowledged without calling
+	// the handler. A message is also marked as in progress while the handler runs, so a message claimed
+	// from a slow consumer still processing it is left pending without calling the handler, and is
+	// delivered again if that consumer does not acknowledge it. The marker expires after the
+	// MaxIdleTimeForMessages of the topic unless it is refreshed by the running handler, and is taken over
+	// from a consumer that has stopped publishing heartbeats. The same applies to the BatchHandler.
+	IdempotencyWindow time.Duration
+	inProgressTopic   map[string]*consumeLoop
+	client            *MQClient
+	info              *ConsumerInfo
+	heartbeatStop     chan bool
+	heartbeatDone     chan bool
+	duties            []*consumerDuty
+	mu                sync.Mutex
+	// publishMu is held while publishing a heartbeat so that Close can wait for it before removing
+	// the consumer from the registry
+	publishMu sync.Mutex
+}
+
+type consumerDuty struct {
+	name     string
+	interval time.Duration
+	task     func(token int64) error
+	duty     *leaderDuty
+}
+
+func (c *Consumer) sendError(err error) {
+	select {
+	case c.Errors <- err:
+	default:
+	}
+}
+
+// registerTopic adds the topic to the metadata of the consumer in the consumer registry and starts
+// publishing heartbeats if not already started.
+func (c *Consumer) registerTopic(client *MQClient, topic string) {
+	c.mu.Lock()
+	if c.client == nil {
+		c.client = client
+	}
+	if c.info == nil {
+		c.info = newConsumerInfo(c.ConsumerGroupName, c.ConsumerName)
+	}
+	if !c.info.HasTopic(topic) {
+		c.info.Topics = append(c.info.Topics, topic)
+	}
+	started := c.heartbeatStop != nil
+	if !started {
+		c.heartbeatStop = make(chan bool)
+		c.heartbeatDone = make(chan bool)
+		for _, d := range c.duties {
+			if err := c.startDuty(d); err != nil {
+				c.sendError(err)
+			}
+		}
+	}
+	stop, done := c.heartbeatStop, c.heartbeatDone
+	c.mu.Unlock()
+	c.sendHeartbeat()
+	if !started {
+		go c.heartbeat(stop, done)
+	}
+}
+
+func (c *Consumer) unregisterTopic(topic string) {
+	c.mu.Lock()
+	if c.info != nil {
+		topics := []string{}
+		for _, t := range c.info.Topics {
+			if t != topic {
+				topics = append(topics, t)
+			}
+		}
+		c.info.Topics = topics
+	}
+	c.mu.Unlock()
+	c.sendHeartbeat()
+}
+
+// sendHeartbeat publishes the metadata of the consumer unless it is closed. The publishMu is held until
+// the heartbeat is published, so a heartbeat never re-adds a consumer removed by Close.
+func (c *Consumer) sendHeartbeat() {
+	c.publishMu.Lock()
+	defer c.publishMu.Unlock()
+	c.mu.Lock()
+	if c.info == nil || c.client == nil || c.heartbeatStop == nil {
+		c.mu.Unlock()
+		return
+	}
+	info := *c.info
+	info.Version = c.Version
+	info.Topics = append([]string{}, c.info.Topics...)
+	c.mu.Unlock()
+	if err := c.client.publishHeartbeat(&info); err != nil {
+		c.sendError(err)
+	}
+}
+
+func (c *Consumer) heartbeat(stop chan bool, done chan bool) {
+	defer close(done)
+	interval, err := time.ParseDuration(DefaultHeartbeatInterval)
+	if err != nil {
+		interval = 5 * time.Second
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			c.sendHeartbeat()
+		}
+	}
+}
+
+// AddLeaderDuty registers a task that is run at the interval by only one of the consumer instances, the
+// one elected as the leader for the name using a [LeaderElection]. The task receives the fencing token of
+// the leader, to do its writes using [MQClient.WatchAsLeader]. The duties are started along with the
+// consumption of the first topic and stopped when the consumer is closed. Errors returned by the task are
+// sent to the [Consumer.Errors] channel.
+func (c *Consumer) AddLeaderDuty(name string, interval time.Duration, task func(token int64) error) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, d := range c.duties {
+		if d.name == name {
+			return errors.New("Leader duty " + name + " is already added")
+		}
+	}
+	d := &consumerDuty{name: name, interval: interval, task: task}
+	c.duties = append(c.duties, d)
+	if c.heartbeatStop != nil {
+		return c.startDuty(d)
+	}
+	return nil
+}
+
+// startDuty starts campaigning for the leadership of the duty. It should be called with the lock held.
+func (c *Consumer) startDuty(d *consumerDuty) error {
+	d.duty = newLeaderDuty(c.client, d.name, c.ConsumerGroupName+":"+c.ConsumerName, d.interval, func(token int64) {
+		if err := d.task(token); err != nil {
+			c.sendError(err)
+		}
+	})
+	return d.duty.start()
+}
+
+// addJanitor adds the cleanup of the GroupedMessageTopic as a leader duty of the consumer
+func (c *Consumer) addJanitor(t *GroupedMessageTopic) {
+	if c.DisableJanitor {
+		return
+	}
+	interval, err := time.ParseDuration(DefaultJanitorInterval)
+	if err != nil {
+		interval = time.Minute
+	}
+	name := t.getJanitorLeaderName()
+	c.AddLeaderDuty(name, interval, func(token int64) error {
+		_, err := t.cleanup(&fence{name: name, token: token})
+		return err
+	})
+}
+
+// Close stops the consumption of the topics, waiting for the messages being handled, stops publishing the
+// heartbeats of the consumer, stops its leader duties and removes it from the consumer registry. This should
+// be called before the application shuts down so that the other consumers can take over its message groups
+// and duties without waiting for the DefaultHeartbeatTimeout.
+func (c *Consumer) Close() error {
+	c.stopLoops()
+	c.mu.Lock()
+	stop, done := c.heartbeatStop, c.heartbeatDone
+	c.heartbeatStop, c.heartbeatDone = nil, nil
+	for _, d := range c.duties {
+		if d.duty != nil {
+			d.duty.close()
+			d.duty = nil
+		}
+	}
+	client := c.client
+	c.mu.Unlock()
+	if stop != nil {
+		close(stop)
+		<-done
+	}
+	if client == nil {
+		return nil
+	}
+	// waits for a heartbeat being published by a topic registration before removing the consumer
+	c.publishMu.Lock()
+	defer c.publishMu.Unlock()
+	return client.removeConsumerInfo(c.ConsumerGroupName, c.ConsumerName)
 }
 
 func (c *Consumer) consumeMessages(msgs []*Message) {
+	if c.IdempotencyWindow > 0 {
+		var err error
+		msgs, err = dropProcessedMessages(msgs, c.IdempotencyWindow)
+		if err != nil {
+			c.sendError(err)
+		}
+	}
 	var wg sync.WaitGroup
 	for i := range msgs {
 		wg.Add(1)
-		go func() {
+		go func(m *Message) {
 			defer wg.Done()
-			c.Handler(msgs[i])
-		}()
+			release := holdInProgress([]*Message{m}, c.sendError)
+			defer release()
+			c.Handler(m)
+		}(msgs[i])
 	}
 	wg.Wait()
 }
@@ -51,41 +258,135 @@ func (c *Consumer) consumeMessages(msgs []*Message) {
 func (c *Consumer) consumeMessagesInBatches(msgs [][]*Message) {
 	var wg sync.WaitGroup
 	for i := range msgs {
+		batch := msgs[i]
+		if c.IdempotencyWindow > 0 {
+			var err error
+			batch, err = dropProcessedMessages(batch, c.IdempotencyWindow)
+			if err != nil {
+				c.sendError(err)
+			}
+			if len(batch) == 0 {
+				continue
+			}
+		}
 		wg.Add(1)
-		go func() {
+		go func(batch []*Message) {
 			defer wg.Done()
-			c.BatchHandler(msgs[i])
-		}()
+			release := holdInProgress(batch, c.sendError)
+			defer release()
+			c.BatchHandler(batch)
+		}(batch)
 	}
 	wg.Wait()
 }
 
+// waitWhilePaused checks if the topic is paused and if so, waits for the DefaultPauseCheckInterval
+// before returning true so that the caller can check again.
+func (c *Consumer) waitWhilePaused(isPaused func() (bool, error)) bool {
+	paused, err := isPaused()
+	if err != nil || !paused {
+		return false
+	}
+	interval, err := time.ParseDuration(DefaultPauseCheckInterval)
+	if err != nil {
+		interval = time.Second
+	}
+	time.Sleep(interval)
+	return true
+}
+
+// consumeLoop is the loop consuming a topic, which exits once its stop channel is closed
+type consumeLoop struct {
+	stop chan bool
+	done chan bool
+}
+
+// reserveLoop reserves the loop consuming the topic, and returns false if the topic is already being consumed
+func (c *Consumer) reserveLoop(topic string) (*consumeLoop, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.inProgressTopic == nil {
+		c.inProgressTopic = map[string]*consumeLoop{}
+	}
+	if _, ok := c.inProgressTopic[topic]; ok {
+		return nil, false
+	}
+	l := &consumeLoop{stop: make(chan bool), done: make(chan bool)}
+	c.inProgressTopic[topic] = l
+	return l, true
+}
+
+// runLoop calls consume repeatedly till the loop is stopped
+func (c *Consumer) runLoop(l *consumeLoop, consume func()) {
+	defer close(l.done)
+	for {
+		select {
+		case <-l.stop:
+			return
+		default:
+		}
+		consume()
+	}
+}
+
+// sendLoopError sends the error to the Errors channel, waiting for it to be read unless the loop is stopped
+func (c *Consumer) sendLoopError(l *consumeLoop, err error) {
+	select {
+	case c.Errors <- err:
+	case <-l.stop:
+	}
+}
+
+// stopLoop stops the loop consuming the topic and waits for it to exit, along with the handlers it is running
+func (c *Consumer) stopLoop(topic string) {
+	c.mu.Lock()
+	l := c.inProgressTopic[topic]
+	delete(c.inProgressTopic, topic)
+	c.mu.Unlock()
+	if l != nil {
+		close(l.stop)
+		<-l.done
+	}
+}
+
+// stopLoops stops all the loops of the consumer and waits for them to exit
+func (c *Consumer) stopLoops() {
+	c.mu.Lock()
+	topics := make([]string, 0, len(c.inProgressTopic))
+	for topic := range c.inProgressTopic {
+		topics = append(topics, topic)
+	}
+	c.mu.Unlock()
+	for _, topic := range topics {
+		c.stopLoop(topic)
+	}
+}
+
 func (c *Consumer) StartConsumingTopic(t *Topic, count int64) error {
 	if c.Handler == nil {
 		return errors.New("Consumer Handler is not set")
 	}
-	if c.inProgressTopic["umts:"+t.Name] {
+	l, ok := c.reserveLoop("umts:" + t.Name)
+	if !ok {
 		return errors.New("Topic is already being consumed")
 	}
 	_, err := t.MQClient.rc.XGroupCreate(t.MQClient.c, t.StreamKey, c.ConsumerGroupName, "0-0").Result()
 	if err != nil {
 		println("group creation error - ", err.Error())
 	}
-	go func() {
-		c.inProgressTopic["umts:"+t.Name] = true
-		for {
-			if c.inProgressTopic[t.Name] {
-				break
-			}
-			msgs, err := t.ConsumeMessages(c.ConsumerGroupName, c.ConsumerName, count)
-			if err != nil {
-				c.Errors <- err
-			}
-			if len(msgs) > 0 {
-				c.consumeMessages(msgs)
-			}
+	c.registerTopic(&t.MQClient, "umts:"+t.Name)
+	go c.runLoop(l, func() {
+		if c.waitWhilePaused(t.IsPaused) {
+			return
+		}
+		msgs, err := t.ConsumeMessages(c.ConsumerGroupName, c.ConsumerName, count)
+		if err != nil {
+			c.sendLoopError(l, err)
 		}
-	}()
+		if len(msgs) > 0 {
+			c.consumeMessages(msgs)
+		}
+	})
 	return nil
 }
 
@@ -97,25 +398,50 @@ func (c *Consumer) StartConsumingGroupedMessageTopic(t *GroupedMessageTopic) err
 	if c.Handler == nil {
 		return errors.New("Consumer Handler is not set")
 	}
-	if c.inProgressTopic["gmts:"+t.Name] {
+	l, ok := c.reserveLoop("gmts:" + t.Name)
+	if !ok {
 		return errors.New("GroupedMessageTopic is already being consumed")
 	}
 	t.MQClient.createGroupAndConsumer(t.MessageGroupStreamKey, c.ConsumerGroupName, c.ConsumerName)
-	go func() {
-		c.inProgressTopic["gmts:"+t.Name] = true
-		for {
-			if c.inProgressTopic["gmts"+t.Name] {
-				break
-			}
-			msgs, err := t.ConsumeMessages(c.ConsumerGroupName, c.ConsumerName)
-			if err != nil {
-				c.Errors <- err
-			}
-			if len(msgs) > 0 {
-				c.consumeMessages(msgs)
-			}
+	c.addJanitor(t)
+	c.registerTopic(&t.MQClient, "gmts:"+t.Name)
+	go c.runLoop(l, func() {
+		if c.waitWhilePaused(t.IsPaused) {
+			return
+		}
+		msgs, err := t.ConsumeMessages(c.ConsumerGroupName, c.ConsumerName)
+		if err != nil {
+			c.sendLoopError(l, err)
 		}
-	}()
+		if len(msgs) > 0 {
+			c.consumeMessages(msgs)
+		}
+	})
+	return nil
+}
+
+// StartConsumingPartitionedTopic function will start continuously reading upto count messages at a time from
+// the partitions of the PartitionedTopic assigned to the consumer and call the handler function for each of
+// the messages. The partitions are rebalanced across the consumers of the consumer group as they start and
+// stop. Any errors encountered would be sent into the [Consumer.Errors] channel.
+func (c *Consumer) StartConsumingPartitionedTopic(t *PartitionedTopic, count int64) error {
+	if c.Handler == nil {
+		return errors.New("Consumer Handler is not set")
+	}
+	l, ok := c.reserveLoop("pmts:" + t.Name)
+	if !ok {
+		return errors.New("PartitionedTopic is already being consumed")
+	}
+	c.registerTopic(&t.MQClient, "pmts:"+t.Name)
+	go c.runLoop(l, func() {
+		msgs, err := t.ConsumeMessages(c.ConsumerGroupName, c.ConsumerName, count)
+		if err != nil {
+			c.sendLoopError(l, err)
+		}
+		if len(msgs) > 0 {
+			c.consumeMessages(msgs)
+		}
+	})
 	return nil
 }
 
@@ -128,36 +454,45 @@ func (c *Consumer) StartConsumingGroupedMessageTopicInBatches(t *GroupedMessageT
 	if c.BatchHandler == nil {
 		return errors.New("Consumer BatchHandler is not set")
 	}
-	if c.inProgressTopic["gmts:"+t.Name] {
+	l, ok := c.reserveLoop("gmts:" + t.Name)
+	if !ok {
 		return errors.New("GroupedMessageTopic is already being consumed")
 	}
 	t.MQClient.createGroupAndConsumer(t.MessageGroupStreamKey, c.ConsumerGroupName, c.ConsumerName)
-	go func() {
-		c.inProgressTopic["gmts:"+t.Name] = true
-		for {
-			if c.inProgressTopic["gmts"+t.Name] {
-				break
-			}
-			// msgs, err := t.ConsumeMessagesInBatches(c.ConsumerGroupName, c.ConsumerName, batchSize)
-			// if err != nil {
-			// 	c.Errors <- err
-			// }
-			// if len(msgs) > 0 {
-			// 	c.consumeMessagesInBatches(msgs)
-			// }
-		}
-	}()
+	c.addJanitor(t)
+	c.registerTopic(&t.MQClient, "gmts:"+t.Name)
+	go c.runLoop(l, func() {
+		// msgs, err := t.ConsumeMessagesInBatches(c.ConsumerGroupName, c.ConsumerName, batchSize)
+		// if err != nil {
+		// 	c.Errors <- err
+		// }
+		// if len(msgs) > 0 {
+		// 	c.consumeMessagesInBatches(msgs)
+		// }
+	})
 	return nil
 }
 
-// StopConsumingTopic function is used to stop the consumption of messages. This can be restarted again by
-// calling the [StartConsumingTopic] function
+// StopConsumingTopic function is used to stop the consumption of messages. It waits for the messages being
+// handled before removing the topic from the consumer registry. This can be restarted again by calling the
+// [StartConsumingTopic] function
 func (c *Consumer) StopConsumingTopic(t *Topic) {
-	c.inProgressTopic["umts"+t.Name] = false
+	c.stopLoop("umts:" + t.Name)
+	c.unregisterTopic("umts:" + t.Name)
+}
+
+// StopConsumingPartitionedTopic function is used to stop the consumption of messages. It waits for the
+// messages being handled, after which the partitions of the consumer are rebalanced to the other consumers of
+// the consumer group.
+func (c *Consumer) StopConsumingPartitionedTopic(t *PartitionedTopic) {
+	c.stopLoop("pmts:" + t.Name)
+	c.unregisterTopic("pmts:" + t.Name)
 }
 
-// StopConsumingGroupedMessageTopic function is used to stop the consumption of messages. This can be restarted
-// again by calling the [StartConsumingGroupedMessageTopic] function
+// StopConsumingGroupedMessageTopic function is used to stop the consumption of messages. It waits for the
+// messages being handled before the message groups of the consumer are handed over to the other consumers.
+// This can be restarted again by calling the [StartConsumingGroupedMessageTopic] function
 func (c *Consumer) StopConsumingGroupedMessageTopic(t *GroupedMessageTopic) {
-	c.inProgressTopic["gmts"+t.Name] = false
+	c.stopLoop("gmts:" + t.Name)
+	c.unregisterTopic("gmts:" + t.Name)
 }
@@ -0,0 +1,163 @@
+package redimq
+
+import (
+	"encoding/json"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// ConsumerInfo is the metadata published by a [Consumer] to the consumer registry with every
+// heartbeat. It can be retrieved using the [MQClient.GetLiveConsumers] function.
+type ConsumerInfo struct {
+	Name              string    `json:"name"`
+	ConsumerGroupName string    `json:"consumerGroupName"`
+	Host              string    `json:"host"`
+	Pid               int       `json:"pid"`
+	Version           string    `json:"version"`
+	StartedAt         time.Time `json:"startedAt"`
+	LastHeartbeat     time.Time `json:"lastHeartbeat"`
+	Topics            []string  `json:"topics"`
+	// now is the clock of the client that retrieved the metadata
+	now func() time.Time
+}
+
+func getConsumerRegistryKey(consumerGroupName string) string {
+	return "redimq:cg:" + consumerGroupName + ":consumers"
+}
+
+func getHeartbeatTimeout() time.Duration {
+	timeout, err := time.ParseDuration(DefaultHeartbeatTimeout)
+	if err != nil {
+		timeout = 15 * time.Second
+	}
+	return timeout
+}
+
+// IsAlive returns true if the consumer has published a heartbeat within the DefaultHeartbeatTimeout
+func (i *ConsumerInfo) IsAlive() bool {
+	now := time.Now
+	if i.now != nil {
+		now = i.now
+	}
+	return now().Sub(i.LastHeartbeat) < getHeartbeatTimeout()
+}
+
+// HasTopic returns true if the consumer is consuming the topic. The topic is identified by the
+// topic type and name, e.g. "umts:orders" or "gmts:orders"
+func (i *ConsumerInfo) HasTopic(topic string) bool {
+	for _, t := range i.Topics {
+		if t == topic {
+			return true
+		}
+	}
+	return false
+}
+
+func getConsumerRegistryTTL() time.Duration {
+	ttl, err := time.ParseDuration(DefaultConsumerRegistryTTL)
+	if err != nil {
+		ttl = 5 * time.Minute
+	}
+	return ttl
+}
+
+func (c *MQClient) publishHeartbeat(info *ConsumerInfo) error {
+	info.LastHeartbeat = c.now()
+	data, err := json.Marshal(info)
+	if err != nil {
+		return err
+	}
+	key := getConsumerRegistryKey(info.ConsumerGroupName)
+	_, err = c.rc.TxPipelined(c.c, func(p redis.Pipeliner) error {
+		p.HSet(c.c, key, info.Name, data)
+		p.Expire(c.c, key, getConsumerRegistryTTL())
+		return nil
+	})
+	return err
+}
+
+func (c *MQClient) removeConsumerInfo(consumerGroupName string, consumerName string) error {
+	_, err := c.rc.HDel(c.c, getConsumerRegistryKey(consumerGroupName), consumerName).Result()
+	return err
+}
+
+// GetConsumers returns the metadata of all the consumers registered for the consumer group, including
+// the ones that have stopped sending heartbeats. The consumers without a heartbeat within the
+// DefaultConsumerRegistryTTL are removed from the registry instead. The consumers are sorted by their name.
+func (c *MQClient) GetConsumers(consumerGroupName string) ([]*ConsumerInfo, error) {
+	key := getConsumerRegistryKey(consumerGroupName)
+	res, err := c.rc.HGetAll(c.c, key).Result()
+	if err != nil {
+		return nil, err
+	}
+	consumers := make([]*ConsumerInfo, 0, len(res))
+	expired := []string{}
+	for k, v := range res {
+		info := &ConsumerInfo{now: c.now}
+		if err := json.Unmarshal([]byte(v), info); err != nil {
+			continue
+		}
+		if c.now().Sub(info.LastHeartbeat) >= getConsumerRegistryTTL() {
+			expired = append(expired, k)
+			continue
+		}
+		consumers = append(consumers, info)
+	}
+	if len(expired) > 0 {
+		if err := c.rc.HDel(c.c, key, expired...).Err(); err != nil {
+			println("consumer registry error - ", err.Error())
+		}
+	}
+	sort.Slice(consumers, func(i, j int) bool {
+		return consumers[i].Name < consumers[j].Name
+	})
+	return consumers, nil
+}
+
+// GetLiveConsumers returns the metadata of the consumers of the consumer group that have published a
+// heartbeat within the DefaultHeartbeatTimeout. The consumers are sorted by their name.
+func (c *MQClient) GetLiveConsumers(consumerGroupName string) ([]*ConsumerInfo, error) {
+	consumers, err := c.GetConsumers(consumerGroupName)
+	if err != nil {
+		return nil, err
+	}
+	live := make([]*ConsumerInfo, 0, len(consumers))
+	for _, info := range consumers {
+		if info.IsAlive() {
+			live = append(live, info)
+		}
+	}
+	return live, nil
+}
+
+// getAssignmentMembers returns the names of the live consumers of the consumer group that are consuming
+// the topic, including the calling consumer, sorted by their name.
+func (c *MQClient) getAssignmentMembers(topic string, consumerGroupName string, consumerName string) []string {
+	members := []string{consumerName}
+	consumers, err := c.GetLiveConsumers(consumerGroupName)
+	if err != nil {
+		println("consumer registry error - ", err.Error())
+	}
+	for _, info := range consumers {
+		if info.Name != consumerName && info.HasTopic(topic) {
+			members = append(members, info.Name)
+		}
+	}
+	sort.Strings(members)
+	return members
+}
+
+func newConsumerInfo(consumerGroupName string, consumerName string) *ConsumerInfo {
+	host, _ := os.Hostname()
+	return &ConsumerInfo{
+		Name:              consumerName,
+		ConsumerGroupName: consumerGroupName,
+		Host:              host,
+		Pid:               os.Getpid(),
+		StartedAt:         time.Now(),
+		Topics:            []string{},
+	}
+}
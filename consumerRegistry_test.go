@@ -0,0 +1,57 @@
+package redimq
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestClientGetLiveConsumers(t *testing.T) {
+	consumer := client.NewConsumer("registry-group", "registry-consumer", func(m *Message) {})
+	consumer.Version = "1.0.0"
+	consumer.registerTopic(client, "gmts:test")
+	consumers, err := client.GetLiveConsumers("registry-group")
+	if err != nil {
+		t.Fatal("GetLiveConsumers returned error", err)
+	}
+	if len(consumers) != 1 {
+		t.Fatal("GetLiveConsumers did not return the registered consumer")
+	}
+	if consumers[0].Name != "registry-consumer" || consumers[0].Version != "1.0.0" {
+		t.Error("Consumer metadata does not match")
+	}
+	if !consumers[0].HasTopic("gmts:test") {
+		t.Error("Consumer topics do not match")
+	}
+	err = consumer.Close()
+	if err != nil {
+		t.Error("Close returned error", err)
+	}
+	consumers, err = client.GetLiveConsumers("registry-group")
+	if err != nil || len(consumers) != 0 {
+		t.Error("Consumer was not removed from the registry", err)
+	}
+}
+
+func TestClientGetConsumersRemovesExpired(t *testing.T) {
+	key := getConsumerRegistryKey("registry-expired-group")
+	info := &ConsumerInfo{Name: "crashed-consumer", ConsumerGroupName: "registry-expired-group",
+		LastHeartbeat: client.now().Add(-2 * getConsumerRegistryTTL())}
+	data, _ := json.Marshal(info)
+	client.rc.HSet(client.c, key, info.Name, data)
+	consumer := client.NewConsumer("registry-expired-group", "registry-live-consumer", func(m *Message) {})
+	consumer.registerTopic(client, "gmts:test")
+	defer consumer.Close()
+	if ttl := client.rc.TTL(client.c, key).Val(); ttl <= 0 {
+		t.Error("Consumer registry has no expiry", ttl)
+	}
+	consumers, err := client.GetConsumers("registry-expired-group")
+	if err != nil {
+		t.Fatal("GetConsumers returned error", err)
+	}
+	if len(consumers) != 1 || consumers[0].Name != "registry-live-consumer" {
+		t.Error("GetConsumers returned the expired consumer")
+	}
+	if client.rc.HGet(client.c, key, info.Name).Val() != "" {
+		t.Error("Expired consumer was not removed from the registry")
+	}
+}
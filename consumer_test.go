@@ -2,7 +2,9 @@ package redimq
 
 import (
 	"fmt"
+	"sync/atomic"
 	"testing"
+	"time"
 )
 
 func TestConsumerStartConsumingTopic(t *testing.T) {
@@ -39,3 +41,81 @@ func TestConsumerStartConsumingGroupedMessageTopic(t *testing.T) {
 		fmt.Println("No errors")
 	}
 }
+
+func TestConsumerStopConsumingGroupedMessageTopic(t *testing.T) {
+	g, _ := client.NewGroupedMessageTopic(getTestName(t, "stop"), nil)
+	var handled int64
+	consumer := client.NewConsumer("stop-group", "stop-consumer", func(m *Message) {
+		atomic.AddInt64(&handled, 1)
+		m.Acknowledge()
+	})
+	consumer.DisableJanitor = true
+	defer consumer.Close()
+	if err := consumer.StartConsumingGroupedMessageTopic(g); err != nil {
+		t.Fatal("StartConsumingGroupedMessageTopic failed", err)
+	}
+	if err := consumer.StartConsumingGroupedMessageTopic(g); err == nil {
+		t.Error("GroupedMessageTopic is consumed twice")
+	}
+	g.PublishMessage("a", &Message{Data: map[string]interface{}{"foo": "test"}})
+	for i := 0; i < 100 && atomic.LoadInt64(&handled) == 0; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if atomic.LoadInt64(&handled) != 1 {
+		t.Fatal("Message is not handled", handled)
+	}
+	consumer.StopConsumingGroupedMessageTopic(g)
+	g.PublishMessage("b", &Message{Data: map[string]interface{}{"foo": "test"}})
+	time.Sleep(100 * time.Millisecond)
+	if n := atomic.LoadInt64(&handled); n != 1 {
+		t.Error("Message is handled after the consumption is stopped", n)
+	}
+	consumers, _ := client.GetConsumers("stop-group")
+	for _, info := range consumers {
+		if info.HasTopic("gmts:" + g.Name) {
+			t.Error("Stopped topic is still registered", info.Topics)
+		}
+	}
+	if err := consumer.StartConsumingGroupedMessageTopic(g); err != nil {
+		t.Error("Consumption could not be restarted", err)
+	}
+}
+
+func TestConsumerStopConsumingPartitionedTopic(t *testing.T) {
+	pt, _ := client.NewPartitionedTopic(getTestName(t, "stop-partitioned"), 2, nil)
+	var handled int64
+	consumer := client.NewConsumer("stop-partitioned-group", "stop-partitioned-consumer", func(m *Message) {
+		atomic.AddInt64(&handled, 1)
+		m.Acknowledge()
+	})
+	consumer.DisableJanitor = true
+	defer consumer.Close()
+	if err := consumer.StartConsumingPartitionedTopic(pt, 10); err != nil {
+		t.Fatal("StartConsumingPartitionedTopic failed", err)
+	}
+	if err := consumer.StartConsumingPartitionedTopic(pt, 10); err == nil {
+		t.Error("PartitionedTopic is consumed twice")
+	}
+	pt.PublishMessage("a", &Message{Data: map[string]interface{}{"foo": "test"}})
+	for i := 0; i < 100 && atomic.LoadInt64(&handled) == 0; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if atomic.LoadInt64(&handled) != 1 {
+		t.Fatal("Message is not handled", handled)
+	}
+	consumer.StopConsumingPartitionedTopic(pt)
+	pt.PublishMessage("b", &Message{Data: map[string]interface{}{"foo": "test"}})
+	time.Sleep(100 * time.Millisecond)
+	if n := atomic.LoadInt64(&handled); n != 1 {
+		t.Error("Message is handled after the consumption is stopped", n)
+	}
+	consumers, _ := client.GetConsumers("stop-partitioned-group")
+	for _, info := range consumers {
+		if info.HasTopic("pmts:" + pt.Name) {
+			t.Error("Stopped topic is still registered", info.Topics)
+		}
+	}
+	if err := consumer.StartConsumingPartitionedTopic(pt, 10); err != nil {
+		t.Error("Consumption could not be restarted", err)
+	}
+}
@@ -0,0 +1,457 @@
+package redimq
+
+import (
+	"encoding/json"
+	"errors"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// ExchangeType defines how an [Exchange] routes the messages published to it
+type ExchangeType string
+
+const (
+	// DirectExchange routes a message to the bindings having the same routing key as the message
+	DirectExchange ExchangeType = "direct"
+	// FanoutExchange routes a message to all the bindings irrespective of the routing key
+	FanoutExchange ExchangeType = "fanout"
+	// PatternExchange routes a message to the bindings having a pattern matching the routing key of the
+	// message. The routing keys are made up of words separated by dots, e.g. "orders.eu.created". In the
+	// pattern, a "*" matches exactly one word and a "#" matches zero or more words, e.g. "orders.*.created"
+	// or "orders.#".
+	PatternExchange ExchangeType = "pattern"
+)
+
+// Exchange is used to publish a message to multiple topics at once. The topics are bound to the exchange
+// with a routing key and every message published to the exchange is routed to the bound topics based on
+// the ExchangeType. The bindings are stored in REDIS so they can be changed at runtime by any instance
+// and are picked up by the next publish. It is created using the NewExchange function of the MQClient.
+//
+//	exchange, err := client.NewExchange("orders", redimq.PatternExchange)
+//	exchange.Bind(auditTopic, "orders.#")
+//	exchange.BindGrouped(shippingTopic, "orders.*.created")
+//	msgs, err := exchange.Publish("orders.eu.created", &redimq.Message{GroupKey: "customer-1", Data: data})
+type Exchange struct {
+	Name        string
+	Type        ExchangeType
+	BindingsKey string
+	MQClient
+	bound *boundTopics
+}
+
+// boundTopics keeps the topics bound to an Exchange, resolved once with their options at the time of
+// binding or of the first publish, so that they are not created again for every message. A topic is
+// resolved again when its binding is changed, e.g. by another instance.
+type boundTopics struct {
+	mu     sync.Mutex
+	topics map[string]*boundTopic
+}
+
+type boundTopic struct {
+	options string
+	topic   *Topic
+	gmt     *GroupedMessageTopic
+}
+
+func newBoundTopics() *boundTopics {
+	return &boundTopics{topics: map[string]*boundTopic{}}
+}
+
+// Binding binds a topic to an [Exchange] with a routing key. The RoutingKey is ignored by a FanoutExchange
+// and is a pattern for a PatternExchange. The Options are the options of the topic at the time of binding,
+// which are used for publishing the messages routed to it. The options that the topic was created with are
+// used instead if it was created using the same MQClient as the exchange, along with the Compression and
+// the ClaimCheck which are not kept in the Options.
+type Binding struct {
+	RoutingKey string        `json:"routingKey"`
+	TopicType  TopicType     `json:"topicType"`
+	TopicName  string        `json:"topicName"`
+	Options    *TopicOptions `json:"options,omitempty"`
+}
+
+func getExchangesKey() string {
+	return "redimq:exchanges"
+}
+
+// NewExchange creates an [Exchange] of the type, or returns the existing one if it has already been
+// created with the same type.
+func (c *MQClient) NewExchange(name string, exchangeType ExchangeType) (*Exchange, error) {
+	if exchangeType != DirectExchange && exchangeType != FanoutExchange && exchangeType != PatternExchange {
+		return nil, errors.New("Invalid exchange type " + string(exchangeType))
+	}
+	_, err := c.rc.HSetNX(c.c, getExchangesKey(), name, string(exchangeType)).Result()
+	if err != nil {
+		return nil, err
+	}
+	existing, err := c.rc.HGet(c.c, getExchangesKey(), name).Result()
+	if err != nil {
+		return nil, err
+	}
+	if existing != string(exchangeType) {
+		return nil, errors.New("Exchange " + name + " already exists with the type " + existing)
+	}
+	return &Exchange{
+		Name:        name,
+		Type:        exchangeType,
+		BindingsKey: "redimq:exchanges:" + name + ":bindings",
+		MQClient:    *c,
+		bound:       newBoundTopics(),
+	}, nil
+}
+
+// Delete removes the exchange along with all its bindings. The bound topics are not affected.
+func (e *Exchange) Delete() error {
+	_, err := e.MQClient.rc.TxPipelined(e.MQClient.c, func(pipe redis.Pipeliner) error {
+		pipe.HDel(e.MQClient.c, getExchangesKey(), e.Name)
+		pipe.Del(e.MQClient.c, e.BindingsKey)
+		return nil
+	})
+	return err
+}
+
+func (b *Binding) getField() string {
+	return string(b.TopicType) + ":" + b.TopicName + ":" + b.RoutingKey
+}
+
+func (b *Binding) getTopicKey() string {
+	return string(b.TopicType) + ":" + b.TopicName
+}
+
+func (e *Exchange) bind(b *Binding) error {
+	value, err := json.Marshal(b)
+	if err != nil {
+		return err
+	}
+	_, err = e.MQClient.rc.HSet(e.MQClient.c, e.BindingsKey, b.getField(), string(value)).Result()
+	if err != nil {
+		return err
+	}
+	e.forgetTopic(b)
+	_, _, err = e.getBoundTopic(b)
+	return err
+}
+
+// getBoundTopic returns the Topic, or the GroupedMessageTopic, of the binding. The topic is resolved with the
+// options it was created with using the client, or with the Options of the binding if it was not, and is
+// kept for the later publishes.
+func (e *Exchange) getBoundTopic(b *Binding) (*Topic, *GroupedMessageTopic, error) {
+	if e.bound == nil {
+		return nil, nil, errors.New("Exchange " + e.Name + " was not created using the MQClient")
+	}
+	options, err := json.Marshal(b.Options)
+	if err != nil {
+		return nil, nil, err
+	}
+	e.bound.mu.Lock()
+	defer e.bound.mu.Unlock()
+	key := b.getTopicKey()
+	if bt, ok := e.bound.topics[key]; ok && bt.options == string(options) {
+		return bt.topic, bt.gmt, nil
+	}
+	bt := &boundTopic{options: string(options)}
+	if b.TopicType == GroupedMessages {
+		bt.gmt, err = e.MQClient.getConfiguredGroupedMessageTopic(b.TopicName, b.Options)
+	} else {
+		bt.topic, err = e.getConfiguredBoundTopic(b)
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	e.bound.topics[key] = bt
+	return bt.topic, bt.gmt, nil
+}
+
+// getConfiguredBoundTopic returns the Topic of the binding along with the Retention and the MaxLen of the
+// options it was created with, which take precedence over the Options of the binding
+func (e *Exchange) getConfiguredBoundTopic(b *Binding) (*Topic, error) {
+	options := e.MQClient.getConfiguredOptions(UngroupedMessages, b.TopicName, b.Options)
+	t, err := e.MQClient.newTopic(b.TopicName, options)
+	if err != nil || options == nil {
+		return t, err
+	}
+	if t.Retention, err = parseRetention(options); err != nil {
+		return nil, err
+	}
+	t.MaxLen = options.MaxLength
+	return t, nil
+}
+
+// forgetTopic removes the resolved topic of the binding, so that it is resolved again on the next publish
+func (e *Exchange) forgetTopic(b *Binding) {
+	if e.bound == nil {
+		return
+	}
+	e.bound.mu.Lock()
+	defer e.bound.mu.Unlock()
+	delete(e.bound.topics, b.getTopicKey())
+}
+
+// getTopicOptions returns the options for creating a topic with the same retention and max length
+func getTopicOptions(t *Topic) *TopicOptions {
+	options := &TopicOptions{MaxLength: t.MaxLen}
+	if t.ExpiredMessagesTopic != "" {
+		expired := t.ExpiredMessagesTopic
+		options.ExpiredMessagesTopic = &expired
+	}
+	if t.PriorityLevels > 0 {
+		levels := t.PriorityLevels
+		options.PriorityLevels = &levels
+		options.PriorityWeights = t.PriorityWeights
+	}
+	if t.Retention != nil {
+		retention := t.Retention.String()
+		options.MaxRetentionDuration = &retention
+	}
+	return options
+}
+
+// Bind binds the Topic to the exchange with the routing key
+func (e *Exchange) Bind(t *Topic, routingKey string) error {
+	return e.bind(&Binding{
+		RoutingKey: routingKey,
+		TopicType:  UngroupedMessages,
+		TopicName:  t.Name,
+		Options:    getTopicOptions(t),
+	})
+}
+
+// BindGrouped binds the GroupedMessageTopic to the exchange with the routing key. The messages routed to
+// it are published to the message group set in the GroupKey of the message.
+func (e *Exchange) BindGrouped(t *GroupedMessageTopic, routingKey string) error {
+	options := getTopicOptions(t.getTopic())
+	if t.Lanes > 0 {
+		lanes := t.Lanes
+		options.Lanes = &lanes
+	}
+	return e.bind(&Binding{
+		RoutingKey: routingKey,
+		TopicType:  GroupedMessages,
+		TopicName:  t.Name,
+		Options:    options,
+	})
+}
+
+// Unbind removes the binding of the Topic with the routing key
+func (e *Exchange) Unbind(t *Topic, routingKey string) error {
+	b := &Binding{RoutingKey: routingKey, TopicType: UngroupedMessages, TopicName: t.Name}
+	_, err := e.MQClient.rc.HDel(e.MQClient.c, e.BindingsKey, b.getField()).Result()
+	e.forgetTopic(b)
+	return err
+}
+
+// UnbindGrouped removes the binding of the GroupedMessageTopic with the routing key
+func (e *Exchange) UnbindGrouped(t *GroupedMessageTopic, routingKey string) error {
+	b := &Binding{RoutingKey: routingKey, TopicType: GroupedMessages, TopicName: t.Name}
+	_, err := e.MQClient.rc.HDel(e.MQClient.c, e.BindingsKey, b.getField()).Result()
+	e.forgetTopic(b)
+	return err
+}
+
+// GetBindings returns all the bindings of the exchange sorted by the topic and the routing key
+func (e *Exchange) GetBindings() ([]*Binding, error) {
+	res, err := e.MQClient.rc.HGetAll(e.MQClient.c, e.BindingsKey).Result()
+	if err != nil {
+		return nil, err
+	}
+	fields := make([]string, 0, len(res))
+	for f := range res {
+		fields = append(fields, f)
+	}
+	sort.Strings(fields)
+	bindings := make([]*Binding, 0, len(res))
+	for _, f := range fields {
+		b := &Binding{}
+		if err := json.Unmarshal([]byte(res[f]), b); err != nil {
+			println("Error parsing exchange binding "+f+": ", err.Error())
+			continue
+		}
+		bindings = append(bindings, b)
+	}
+	return bindings, nil
+}
+
+// matches returns true if the binding routes the messages with the routing key for the exchange type
+func (b *Binding) matches(exchangeType ExchangeType, routingKey string) bool {
+	switch exchangeType {
+	case FanoutExchange:
+		return true
+	case PatternExchange:
+		return matchRoutingPattern(strings.Split(b.RoutingKey, "."), strings.Split(routingKey, "."))
+	default:
+		return b.RoutingKey == routingKey
+	}
+}
+
+func matchRoutingPattern(pattern []string, words []string) bool {
+	if len(pattern) == 0 {
+		return len(words) == 0
+	}
+	if pattern[0] == "#" {
+		for i := 0; i <= len(words); i++ {
+			if matchRoutingPattern(pattern[1:], words[i:]) {
+				return true
+			}
+		}
+		return false
+	}
+	if len(words) == 0 || (pattern[0] != "*" && pattern[0] != words[0]) {
+		return false
+	}
+	return matchRoutingPattern(pattern[1:], words[1:])
+}
+
+// route returns the bindings matching the routing key, with every topic included only once
+func (e *Exchange) route(routingKey string) ([]*Binding, error) {
+	bindings, err := e.GetBindings()
+	if err != nil {
+		return nil, err
+	}
+	routed := []*Binding{}
+	seen := map[string]bool{}
+	for _, b := range bindings {
+		key := b.getTopicKey()
+		if !seen[key] && b.matches(e.Type, routingKey) {
+			seen[key] = true
+			routed = append(routed, b)
+		}
+	}
+	return routed, nil
+}
+
+// Publish routes the message to the topics bound to the exchange with the routing key. The message is
+// appended to the streams of all the routed topics atomically, so either all or none of them receive it.
+// A copy of the message is returned for every routed topic with the Id and the Topic it is published
+// to. The GroupKey of the message is required if it is routed to a GroupedMessageTopic.
+func (e *Exchange) Publish(routingKey string, m *Message) ([]*Message, error) {
+	bindings, err := e.route(routingKey)
+	if err != nil || len(bindings) == 0 {
+		return []*Message{}, err
+	}
+	topics := make([]*Topic, len(bindings))
+	gmts := make([]*GroupedMessageTopic, len(bindings))
+	messageGroupKeys := make([]string, len(bindings))
+	values := make([]map[string]interface{}, len(bindings))
+	blobKeys := make([]string, len(bindings))
+	claimChecks := make([]*ClaimCheck, len(bindings))
+	adds := make([]*redis.StringCmd, len(bindings))
+	added := false
+	// the blobs stored for the topics are removed if the messages are not added
+	defer func() {
+		if added {
+			return
+		}
+		for i, blobKey := range blobKeys {
+			if blobKey == "" {
+				continue
+			}
+			var addErr error
+			if adds[i] != nil {
+				addErr = adds[i].Err()
+			}
+			abandonBlob(e.MQClient, topics[i].StreamKey, claimChecks[i], blobKey, addErr)
+		}
+	}()
+	watch := []string{}
+	for i, b := range bindings {
+		if b.TopicType == GroupedMessages {
+			if m.GroupKey == "" {
+				return nil, errors.New("Message GroupKey is required for the GroupedMessageTopic " + b.TopicName)
+			}
+			_, gmts[i], err = e.getBoundTopic(b)
+			if err != nil {
+				return nil, err
+			}
+			messageGroupKeys[i] = gmts[i].getMessageGroupKey(m.GroupKey)
+			topics[i] = gmts[i].getTopicForGroup(messageGroupKeys[i])
+			msg := *m
+			gmts[i].addGroupKeyHeader(m.GroupKey, &msg)
+			claimChecks[i] = gmts[i].ClaimCheck
+			values[i], blobKeys[i], err = msg.getStreamValues(e.MQClient, topics[i].StreamKey, gmts[i].ClaimCheck, gmts[i].Compression)
+			if err != nil {
+				return nil, err
+			}
+			if err = gmts[i].createStreamGroups(topics[i].StreamKey); err != nil {
+				return nil, err
+			}
+			watch = append(watch, gmts[i].MessageGroupSetKey)
+		} else {
+			t, _, err := e.getBoundTopic(b)
+			if err != nil {
+				return nil, err
+			}
+			if err := t.validatePriority(m); err != nil {
+				return nil, err
+			}
+			topics[i] = t.getTopicForPriority(m.Priority)
+			claimChecks[i] = t.ClaimCheck
+			values[i], blobKeys[i], err = m.getStreamValues(e.MQClient, topics[i].StreamKey, t.ClaimCheck, t.Compression)
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+	c := e.MQClient.c
+	var msgs []*Message
+	txf := func(tx *redis.Tx) error {
+		var err error
+		registered := make([]bool, len(bindings))
+		for i, g := range gmts {
+			if g != nil {
+				registered[i], err = tx.SIsMember(c, g.MessageGroupSetKey, messageGroupKeys[i]).Result()
+				if err != nil {
+					return err
+				}
+			}
+		}
+		_, err = tx.TxPipelined(c, func(pipe redis.Pipeliner) error {
+			for i, t := range topics {
+				adds[i] = pipe.XAdd(c, t.getXAddArgs(values[i], "*"))
+				markBlobAdded(e.MQClient, pipe, t.StreamKey, blobKeys[i])
+				if g := gmts[i]; g != nil {
+					if !registered[i] {
+						pipe.SAdd(c, g.MessageGroupSetKey, messageGroupKeys[i])
+						pipe.XAdd(c, &redis.XAddArgs{
+							Stream: g.MessageGroupStreamKey,
+							ID:     "*",
+							Values: []interface{}{"key", messageGroupKeys[i]},
+						})
+					}
+					if g.Retention != nil {
+						pipe.Expire(c, t.StreamKey, *g.Retention)
+					}
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		msgs = make([]*Message, len(topics))
+		for i, t := range topics {
+			msg := *m
+			msg.Id = adds[i].Val()
+			msg.Topic = *t
+			msgs[i] = &msg
+		}
+		return nil
+	}
+	for i := 0; i < 3; i++ {
+		err = e.MQClient.rc.Watch(c, txf, watch...)
+		if err != redis.TxFailedErr {
+			break
+		}
+	}
+	if err != nil {
+		return msgs, err
+	}
+	added = true
+	for i, msg := range msgs {
+		if err = indexBlob(e.MQClient, msg.Topic.StreamKey, blobKeys[i], msg.Id); err != nil {
+			return msgs, err
+		}
+	}
+	return msgs, nil
+}
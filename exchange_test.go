@@ -0,0 +1,108 @@
+package redimq
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMatchRoutingPattern(t *testing.T) {
+	cases := map[string]bool{
+		"orders.*.created|orders.eu.created": true,
+		"orders.*.created|orders.created":    false,
+		"orders.#|orders":                    true,
+		"orders.#|orders.eu.created":         true,
+		"#.created|orders.eu.created":        true,
+		"orders.#.created|orders.created":    true,
+		"orders.*|orders.eu.created":         false,
+	}
+	for c, expected := range cases {
+		parts := strings.Split(c, "|")
+		if matchRoutingPattern(strings.Split(parts[0], "."), strings.Split(parts[1], ".")) != expected {
+			t.Error("Routing pattern", parts[0], "for", parts[1], "should return", expected)
+		}
+	}
+}
+
+func TestExchangePublish(t *testing.T) {
+	name := getTestName(t, "orders")
+	exchange, err := client.NewExchange(name, PatternExchange)
+	if err != nil {
+		t.Fatal("NewExchange returned error", err)
+	}
+	t.Cleanup(func() { exchange.Delete() })
+	if _, err = client.NewExchange(name, FanoutExchange); err == nil {
+		t.Error("NewExchange did not fail for a different type")
+	}
+	audit, _ := client.NewTopic(getTestName(t, "exchange-audit"), nil)
+	shipping, _ := client.NewGroupedMessageTopic(getTestName(t, "exchange-shipping"), nil)
+	exchange.Bind(audit, "orders.#")
+	exchange.BindGrouped(shipping, "orders.*.created")
+	msgs, err := exchange.Publish("orders.eu.created", &Message{GroupKey: "customer-1", Data: map[string]interface{}{"foo": "test"}})
+	if err != nil || len(msgs) != 2 {
+		t.Fatal("Publish did not route to both the topics", msgs, err)
+	}
+	msgs, err = exchange.Publish("orders.eu.cancelled", &Message{Data: map[string]interface{}{"foo": "test"}})
+	if err != nil || len(msgs) != 1 || msgs[0].Topic.StreamKey != audit.StreamKey {
+		t.Error("Publish did not route to the audit topic only", msgs, err)
+	}
+	if n, _ := client.rc.XLen(client.c, audit.StreamKey).Result(); n != 2 {
+		t.Error("Audit topic has", n, "messages, expected 2")
+	}
+	if ok, _ := shipping.MQClient.rc.SIsMember(client.c, shipping.MessageGroupSetKey, "customer-1").Result(); !ok {
+		t.Error("Publish did not register the message group")
+	}
+	exchange.UnbindGrouped(shipping, "orders.*.created")
+	bindings, _ := exchange.GetBindings()
+	if len(bindings) != 1 {
+		t.Error("UnbindGrouped did not remove the binding")
+	}
+}
+
+func TestExchangePublishClaimCheck(t *testing.T) {
+	exchange, _ := client.NewExchange(getTestName(t, "documents"), FanoutExchange)
+	t.Cleanup(func() { exchange.Delete() })
+	store := client.NewRedisBlobStore()
+	archive, _ := client.NewTopic(getTestName(t, "exchange-archive"), &TopicOptions{ClaimCheck: &ClaimCheck{Store: store, Threshold: 1}})
+	exchange.Bind(archive, "")
+	msgs, err := exchange.Publish("", &Message{Data: map[string]interface{}{"doc": "order"}})
+	if err != nil || len(msgs) != 1 {
+		t.Fatal("Publish failed", msgs, err)
+	}
+	raw, _ := client.rc.XRange(client.c, archive.StreamKey, "-", "+").Result()
+	if len(raw) != 1 || raw[0].Values["doc"] != nil || raw[0].Values[headerFieldPrefix+HeaderClaimCheck] == nil {
+		t.Fatal("Routed message is not claim checked", raw)
+	}
+	page, err := archive.Browse(nil)
+	if err != nil || len(page.Messages) != 1 || page.Messages[0].Data["doc"] != "order" {
+		t.Error("Routed message is not resolved", page, err)
+	}
+}
+
+func TestExchangeBoundTopicOptions(t *testing.T) {
+	exchange, _ := client.NewExchange(getTestName(t, "exchange-options"), DirectExchange)
+	t.Cleanup(func() { exchange.Delete() })
+	retention := "1h"
+	maxLen := int64(100)
+	levels := int64(2)
+	created, _ := client.NewTopic(getTestName(t, "exchange-options-topic"), &TopicOptions{MaxRetentionDuration: &retention, MaxLength: &maxLen, PriorityLevels: &levels})
+	bound := *created
+	bindingRetention := time.Minute
+	bindingMaxLen := int64(1)
+	bound.Retention = &bindingRetention
+	bound.MaxLen = &bindingMaxLen
+	if err := exchange.Bind(&bound, "orders"); err != nil {
+		t.Fatal("Bind returned error", err)
+	}
+	client.rc.Del(client.c, created.StreamKey+":priority-levels")
+	msgs, err := exchange.Publish("orders", &Message{Data: map[string]interface{}{"foo": "test"}})
+	if err != nil || len(msgs) != 1 {
+		t.Fatal("Publish failed", err)
+	}
+	if r := msgs[0].Topic.Retention; r == nil || *r != time.Hour || msgs[0].Topic.MaxLen == nil || *msgs[0].Topic.MaxLen != maxLen {
+		t.Error("Publish did not use the options the topic was created with")
+	}
+	if n, _ := client.rc.Exists(client.c, created.StreamKey+":priority-levels").Result(); n != 0 {
+		t.Error("Publish resolved the bound topic again")
+	}
+}
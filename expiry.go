@@ -0,0 +1,93 @@
+package redimq
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// Headers used for the expiry of messages
+const (
+	// HeaderExpiresAt is the header holding the expiry time of a message in unix milliseconds
+	HeaderExpiresAt = "redimq-expires-at"
+	// HeaderExpiredFrom is the header holding the name of the topic that an expired message was routed from
+	HeaderExpiredFrom = "redimq-expired-from"
+)
+
+// parseExpiresAt returns the expiry time from the headers of a message, or a zero time if it is not set
+func parseExpiresAt(headers map[string]string) time.Time {
+	v, ok := headers[HeaderExpiresAt]
+	if !ok {
+		return time.Time{}
+	}
+	ms, err := strconv.ParseInt(v, 10, 64)
+	if err != nil {
+		return time.Time{}
+	}
+	return time.UnixMilli(ms)
+}
+
+// IsExpired returns true if the message has an expiry time which has passed
+func (m *Message) IsExpired() bool {
+	return !m.ExpiresAt.IsZero() && !m.Topic.MQClient.now().Before(m.ExpiresAt)
+}
+
+// dropExpiredMessages removes the expired messages from the consumed messages. The expired messages are
+// published to the expired messages topic if set, acknowledged and counted in the counter key. An expired
+// message that could not be published to the expired messages topic is left pending so that it is retried.
+func dropExpiredMessages(client MQClient, msgs []*Message, expiredMessagesTopic string, counterKey string) []*Message {
+	kept := make([]*Message, 0, len(msgs))
+	for _, m := range msgs {
+		if !m.IsExpired() {
+			kept = append(kept, m)
+			continue
+		}
+		if expiredMessagesTopic != "" {
+			if err := routeExpiredMessage(client, m, expiredMessagesTopic); err != nil {
+				println("Error routing expired message "+m.Id+": ", err.Error())
+				continue
+			}
+		}
+		_, err := client.rc.TxPipelined(client.c, func(pipe redis.Pipeliner) error {
+			pipe.XAck(client.c, m.Topic.StreamKey, m.ConsumerGroupName, m.Id)
+			pipe.Incr(client.c, counterKey)
+			return nil
+		})
+		if err != nil {
+			println("Error acknowledging expired message "+m.Id+": ", err.Error())
+		}
+	}
+	return kept
+}
+
+func routeExpiredMessage(client MQClient, m *Message, topicName string) error {
+	t, err := client.getTargetTopic(topicName)
+	if err != nil {
+		return err
+	}
+	headers := make(map[string]string, len(m.Headers)+1)
+	for k, v := range m.Headers {
+		if k != HeaderExpiresAt {
+			headers[k] = v
+		}
+	}
+	headers[HeaderExpiredFrom] = m.Topic.Name
+	return t.PublishMessage(&Message{GroupKey: m.GroupKey, Data: m.Data, Headers: headers})
+}
+
+func (t *Topic) dropExpiredMessages(msgs []*Message) []*Message {
+	return dropExpiredMessages(t.MQClient, msgs, t.ExpiredMessagesTopic, t.getExpiredCountKey())
+}
+
+func (t *Topic) getExpiredCountKey() string {
+	return t.StreamKey + ":expired-count"
+}
+
+func (t *GroupedMessageTopic) dropExpiredMessages(msgs []*Message) []*Message {
+	return dropExpiredMessages(t.MQClient, msgs, t.ExpiredMessagesTopic, t.getExpiredCountKey())
+}
+
+func (t *GroupedMessageTopic) getExpiredCountKey() string {
+	return t.StreamPrefix + ":expired-count"
+}
@@ -0,0 +1,65 @@
+package redimq
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTopicMessageExpiry(t *testing.T) {
+	group := "expiry-group"
+	expired := getTestName(t, "expiry-expired")
+	s, _ := client.NewTopic(getTestName(t, "expiry"), &TopicOptions{ExpiredMessagesTopic: &expired})
+	s.SeekConsumerGroup(group, PositionBeginning)
+	s.PublishMessage(&Message{ExpiresAt: time.Now().Add(-time.Second), Data: map[string]interface{}{"foo": "expired"}})
+	s.PublishMessage(&Message{ExpiresAt: time.Now().Add(time.Minute), Data: map[string]interface{}{"foo": "valid"}})
+	msgs, err := s.ConsumeMessages(group, "expiry-consumer", 2)
+	if err != nil || len(msgs) != 1 || msgs[0].Data["foo"] != "valid" {
+		t.Fatal("ConsumeMessages did not drop the expired message", err)
+	}
+	if msgs[0].ExpiresAt.IsZero() {
+		t.Error("ExpiresAt of the consumed message is not set")
+	}
+	if p, _ := client.rc.XPending(client.c, s.StreamKey, group).Result(); p.Count != 1 {
+		t.Error("Expired message is not acknowledged")
+	}
+	e, _ := client.NewTopic(expired, nil)
+	page, _ := e.Browse(nil)
+	if len(page.Messages) != 1 || page.Messages[0].Headers[HeaderExpiredFrom] != s.Name || !page.Messages[0].ExpiresAt.IsZero() {
+		t.Error("Expired message is not routed to the expired messages topic")
+	}
+	stats, err := s.Stats()
+	if err != nil || stats.ExpiredMessages != 1 {
+		t.Error("Stats did not count the expired message", stats, err)
+	}
+}
+
+func TestGMTMessageExpiry(t *testing.T) {
+	group := "expiry-group"
+	g, _ := client.NewGroupedMessageTopic(getTestName(t, "expiry"), nil)
+	g.InitTopicGroups(group, "expiry-consumer")
+	g.PublishMessage("a", &Message{ExpiresAt: time.Now().Add(-time.Second), Data: map[string]interface{}{"foo": "expired"}})
+	msgs, _ := g.ConsumeMessages(group, "expiry-consumer")
+	if len(msgs) != 0 {
+		t.Error("ConsumeMessages did not drop the expired message")
+	}
+	stats, err := g.Stats()
+	if err != nil || stats.ExpiredMessages != 1 {
+		t.Error("Stats did not count the expired message", stats, err)
+	}
+}
+
+func TestTopicMessageExpiryConfiguredTopic(t *testing.T) {
+	group := "expiry-group"
+	expired := getTestName(t, "expiry-expired")
+	client.NewTopic(expired, &TopicOptions{Compression: &Compression{Algorithm: CompressionGzip, Threshold: 1}})
+	s, _ := client.NewTopic(getTestName(t, "expiry"), &TopicOptions{ExpiredMessagesTopic: &expired})
+	s.SeekConsumerGroup(group, PositionBeginning)
+	s.PublishMessage(&Message{ExpiresAt: time.Now().Add(-time.Second), Data: map[string]interface{}{"foo": strings.Repeat("expired ", 100)}})
+	s.ConsumeMessages(group, "expiry-consumer", 1)
+	e, _ := client.NewTopic(expired, nil)
+	raw, _ := client.rc.XRange(client.c, e.StreamKey, "-", "+").Result()
+	if len(raw) != 1 || raw[0].Values[compressedDataField] == nil {
+		t.Error("Expired message is not routed with the options of the expired messages topic", raw)
+	}
+}
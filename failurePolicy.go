@@ -0,0 +1,257 @@
+package redimq
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// FailurePolicy defines what a [GroupedMessageTopic] does with a message of a message group that is not
+// acknowledged after being delivered MaxDeliveryAttempts times
+type FailurePolicy string
+
+const (
+	// BlockGroup keeps delivering the failed message till it is acknowledged, which blocks the rest of
+	// its message group. This is the default policy.
+	BlockGroup FailurePolicy = "block"
+	// DeadLetterMessage publishes the failed message to the DeadLetterTopic and acknowledges it, so that
+	// the message group continues with its next message
+	DeadLetterMessage FailurePolicy = "dead-letter"
+	// ParkGroup stops delivering the messages of the message group to the consumer group till it is
+	// released using [GroupedMessageTopic.ReleaseParkedGroup], e.g. after the cause of the failure is fixed
+	ParkGroup FailurePolicy = "park"
+)
+
+// Headers used for the dead lettered messages
+const (
+	// HeaderDeadLetteredFrom is the header holding the name of the topic that a message was dead lettered from
+	HeaderDeadLetteredFrom = "redimq-dead-lettered-from"
+	// HeaderDeliveryAttempts is the header holding the number of times a dead lettered message was delivered
+	HeaderDeliveryAttempts = "redimq-delivery-attempts"
+)
+
+// setFailurePolicy validates the failure policy options and sets them on the topic
+func (t *GroupedMessageTopic) setFailurePolicy(options *TopicOptions) error {
+	t.FailurePolicy = BlockGroup
+	if options.FailurePolicy != nil {
+		t.FailurePolicy = *options.FailurePolicy
+	}
+	if t.FailurePolicy != BlockGroup && t.FailurePolicy != DeadLetterMessage && t.FailurePolicy != ParkGroup {
+		return errors.New("Invalid failure policy " + string(t.FailurePolicy))
+	}
+	t.MaxDeliveryAttempts = DefaultMaxDeliveryAttempts
+	if options.MaxDeliveryAttempts != nil {
+		t.MaxDeliveryAttempts = *options.MaxDeliveryAttempts
+	}
+	if t.MaxDeliveryAttempts <= 0 {
+		return errors.New("MaxDeliveryAttempts should be greater than 0")
+	}
+	if options.DeadLetterTopic != nil {
+		t.DeadLetterTopic = *options.DeadLetterTopic
+	}
+	if t.FailurePolicy == DeadLetterMessage && t.DeadLetterTopic == "" {
+		return errors.New("DeadLetterTopic is required for the failure policy " + string(DeadLetterMessage))
+	}
+	return nil
+}
+
+func (t *GroupedMessageTopic) getParkedGroupSetKey(consumerGroupName string) string {
+	return t.StreamPrefix + ":parked-groups:" + consumerGroupName
+}
+
+func (t *GroupedMessageTopic) getDeliveryOffsetsKey(consumerGroupName string) string {
+	return t.StreamPrefix + ":delivery-offsets:" + consumerGroupName
+}
+
+// GetParkedGroups returns the keys of the message groups parked for the consumer group, or the keys of the
+// parked lanes for a topic having Lanes
+func (t *GroupedMessageTopic) GetParkedGroups(consumerGroupName string) ([]string, error) {
+	return t.MQClient.rc.SMembers(t.MQClient.c, t.getParkedGroupSetKey(consumerGroupName)).Result()
+}
+
+func (t *GroupedMessageTopic) getParkedGroups(consumerGroupName string) (map[string]bool, error) {
+	parked := map[string]bool{}
+	if t.FailurePolicy != ParkGroup {
+		return parked, nil
+	}
+	keys, err := t.GetParkedGroups(consumerGroupName)
+	if err != nil {
+		return nil, err
+	}
+	for _, k := range keys {
+		parked[k] = true
+	}
+	return parked, nil
+}
+
+// ReleaseParkedGroup restarts the delivery of the messages of a message group parked for the consumer group.
+// If skipMessage is set, the failed message is published to the DeadLetterTopic, if any, and acknowledged,
+// or else it is delivered again for another MaxDeliveryAttempts.
+func (t *GroupedMessageTopic) ReleaseParkedGroup(consumerGroupName string, groupKey string, skipMessage bool) error {
+	rc := t.MQClient.rc
+	c := t.MQClient.c
+	key := t.getMessageGroupKey(groupKey)
+	p, err := t.getFailedMessage(consumerGroupName, key)
+	if err != nil {
+		return err
+	}
+	if p != nil {
+		if skipMessage {
+			err = t.deadLetterMessage(consumerGroupName, key, p)
+		} else {
+			err = rc.HSet(c, t.getDeliveryOffsetsKey(consumerGroupName), key, fmt.Sprintf("%s %d", p.ID, p.RetryCount)).Err()
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return rc.SRem(c, t.getParkedGroupSetKey(consumerGroupName), key).Err()
+}
+
+// getFailedMessage returns the oldest pending message of the message group for the consumer group, or nil
+// if there is none
+func (t *GroupedMessageTopic) getFailedMessage(consumerGroupName string, groupKey string) (*redis.XPendingExt, error) {
+	pending, err := t.MQClient.rc.XPendingExt(t.MQClient.c, &redis.XPendingExtArgs{
+		Stream: t.getStreamKeyForGroup(groupKey),
+		Group:  consumerGroupName,
+		Start:  "-",
+		End:    "+",
+		Count:  1,
+	}).Result()
+	if err == redis.Nil || isNoGroupError(err) || len(pending) == 0 {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	return &pending[0], nil
+}
+
+// getDeliveryOffsets returns the delivery counts of the pending messages of the message groups released for
+// the consumer group, read at once for all the message groups of a poll
+func (t *GroupedMessageTopic) getDeliveryOffsets(consumerGroupName string) (map[string]string, error) {
+	if t.FailurePolicy == "" || t.FailurePolicy == BlockGroup {
+		return map[string]string{}, nil
+	}
+	return t.MQClient.rc.HGetAll(t.MQClient.c, t.getDeliveryOffsetsKey(consumerGroupName)).Result()
+}
+
+// getDeliveryAttempts returns the number of times the pending message is delivered since its message group
+// was last released, given the delivery offset of the message group
+func getDeliveryAttempts(offset string, p *redis.XPendingExt) int64 {
+	parts := strings.SplitN(offset, " ", 2)
+	if len(parts) != 2 || parts[0] != p.ID {
+		return p.RetryCount
+	}
+	count, err := strconv.ParseInt(parts[1], 10, 64)
+	if err != nil {
+		return p.RetryCount
+	}
+	return p.RetryCount - count
+}
+
+// applyFailurePolicy applies the FailurePolicy to the pending message of the message group, read along with
+// its delivery offset by the caller, if it has been delivered MaxDeliveryAttempts times. It returns the policy
+// applied, or an empty policy if the message is to be delivered again.
+func (t *GroupedMessageTopic) applyFailurePolicy(consumerGroupName string, groupKey string, p *redis.XPendingExt, offset string) (FailurePolicy, error) {
+	if t.FailurePolicy == "" || t.FailurePolicy == BlockGroup || p == nil {
+		return "", nil
+	}
+	if getDeliveryAttempts(offset, p) < t.MaxDeliveryAttempts {
+		return "", nil
+	}
+	if t.FailurePolicy == ParkGroup {
+		return ParkGroup, t.MQClient.rc.SAdd(t.MQClient.c, t.getParkedGroupSetKey(consumerGroupName), groupKey).Err()
+	}
+	return DeadLetterMessage, t.deadLetterMessage(consumerGroupName, groupKey, p)
+}
+
+// deadLetterMessage publishes the pending message to the DeadLetterTopic, if set, and acknowledges it. The
+// message is published without its expiry so that it is retained till it is looked into.
+func (t *GroupedMessageTopic) deadLetterMessage(consumerGroupName string, groupKey string, p *redis.XPendingExt) error {
+	rc := t.MQClient.rc
+	c := t.MQClient.c
+	topic := t.getTopicForGroup(groupKey)
+	if t.DeadLetterTopic != "" {
+		res, err := rc.XRangeN(c, topic.StreamKey, p.ID, p.ID, 1).Result()
+		if err != nil {
+			return err
+		}
+		if len(res) > 0 {
+			m := xMessageToMessage(res[0], *topic, consumerGroupName, p.Consumer)
+			dlt, err := t.MQClient.getTargetTopic(t.DeadLetterTopic)
+			if err != nil {
+				return err
+			}
+			headers := make(map[string]string, len(m.Headers)+3)
+			for k, v := range m.Headers {
+				if k != HeaderExpiresAt {
+					headers[k] = v
+				}
+			}
+			if _, ok := headers[HeaderGroupKey]; !ok {
+				headers[HeaderGroupKey] = groupKey
+			}
+			headers[HeaderDeadLetteredFrom] = t.Name
+			headers[HeaderDeliveryAttempts] = strconv.FormatInt(p.RetryCount, 10)
+			err = dlt.PublishMessage(&Message{Data: m.Data, Headers: headers})
+			if err != nil {
+				return err
+			}
+		}
+	}
+	_, err := rc.TxPipelined(c, func(pipe redis.Pipeliner) error {
+		pipe.XAck(c, topic.StreamKey, consumerGroupName, p.ID)
+		pipe.HDel(c, t.getDeliveryOffsetsKey(consumerGroupName), groupKey)
+		return nil
+	})
+	return err
+}
+
+// Redrive publishes upto count messages dead lettered from the topic back to their message groups and removes
+// them from the DeadLetterTopic. The messages are published again at the end of their message groups, after
+// the ones published since they were dead lettered. A message is published again before it is removed, so a
+// message may be redriven twice if the redrive fails in between. It returns the number of messages redriven.
+func (t *GroupedMessageTopic) Redrive(count int64) (int64, error) {
+	var redriven int64
+	if t.DeadLetterTopic == "" {
+		return redriven, errors.New("DeadLetterTopic is not set for the GroupedMessageTopic " + t.Name)
+	}
+	dlt, err := t.MQClient.getConfiguredTopic(t.DeadLetterTopic, nil)
+	if err != nil {
+		return redriven, err
+	}
+	options := &BrowseOptions{Count: DefaultBrowsePageSize, Headers: map[string]string{HeaderDeadLetteredFrom: t.Name}}
+	for redriven < count {
+		page, err := dlt.Browse(options)
+		if err != nil {
+			return redriven, err
+		}
+		for _, m := range page.Messages {
+			if redriven >= count {
+				break
+			}
+			groupKey := m.Headers[HeaderGroupKey]
+			headers := make(map[string]string, len(m.Headers))
+			for k, v := range m.Headers {
+				if k != HeaderDeadLetteredFrom && k != HeaderDeliveryAttempts && k != HeaderGroupKey {
+					headers[k] = v
+				}
+			}
+			if err := t.PublishMessage(groupKey, &Message{Data: m.Data, Headers: headers}); err != nil {
+				return redriven, err
+			}
+			if _, err := dlt.DeleteMessage(m.Id, false); err != nil {
+				return redriven, err
+			}
+			redriven++
+		}
+		if page.NextId == "" {
+			break
+		}
+		options.Start = page.NextId
+	}
+	return redriven, nil
+}
@@ -0,0 +1,132 @@
+package redimq
+
+import (
+	"strings"
+	"testing"
+)
+
+func publishFailureMessages(t *testing.T, g *GroupedMessageTopic) {
+	for _, seq := range []string{"1", "2"} {
+		if err := g.PublishMessage("a", &Message{Data: map[string]interface{}{"seq": seq}}); err != nil {
+			t.Fatal("PublishMessage failed", err)
+		}
+	}
+}
+
+func consumeFailureMessage(g *GroupedMessageTopic, group string, consumer string) string {
+	msgs, _ := g.ConsumeMessages(group, consumer)
+	if len(msgs) == 0 {
+		return ""
+	}
+	seq, _ := msgs[0].Data["seq"].(string)
+	return seq
+}
+
+func TestGMTFailurePolicyDeadLetter(t *testing.T) {
+	group := "failure-group"
+	consumer := "failure-consumer"
+	policy := DeadLetterMessage
+	attempts := int64(2)
+	dlt := getTestName(t, "failure-dead-letters")
+	g, err := client.NewGroupedMessageTopic(getTestName(t, "failure-dlq"), &TopicOptions{FailurePolicy: &policy, MaxDeliveryAttempts: &attempts, DeadLetterTopic: &dlt})
+	if err != nil {
+		t.Fatal("NewGroupedMessageTopic failed", err)
+	}
+	g.InitTopicGroups(group, consumer)
+	publishFailureMessages(t, g)
+	for i := 0; i < 2; i++ {
+		if seq := consumeFailureMessage(g, group, consumer); seq != "1" {
+			t.Fatal("ConsumeMessages did not redeliver the failed message", seq)
+		}
+	}
+	if seq := consumeFailureMessage(g, group, consumer); seq != "2" {
+		t.Error("ConsumeMessages did not move on after dead lettering the failed message", seq)
+	}
+	d, _ := client.NewTopic(dlt, nil)
+	page, err := d.Browse(nil)
+	if err != nil || len(page.Messages) != 1 {
+		t.Fatal("Failed message was not dead lettered", page, err)
+	}
+	m := page.Messages[0]
+	if m.Data["seq"] != "1" || m.Headers[HeaderDeadLetteredFrom] != g.Name || m.Headers[HeaderGroupKey] != "a" || m.Headers[HeaderDeliveryAttempts] != "2" {
+		t.Error("Dead lettered message is not valid", m.Message)
+	}
+	if n, err := g.Redrive(10); err != nil || n != 1 {
+		t.Fatal("Redrive failed", n, err)
+	}
+	if n, _ := client.rc.XLen(client.c, d.StreamKey).Result(); n != 0 {
+		t.Error("Redrive did not remove the dead lettered message")
+	}
+	page, _ = g.BrowseGroup("a", nil)
+	last := page.Messages[len(page.Messages)-1]
+	if last.Data["seq"] != "1" || last.Headers[HeaderDeadLetteredFrom] != "" {
+		t.Error("Redrive did not publish the message back to its message group", last.Message)
+	}
+	g.Purge(false)
+	d.Purge(false)
+}
+
+func TestGMTFailurePolicyDeadLetterConfiguredTopic(t *testing.T) {
+	group := "failure-group"
+	consumer := "failure-consumer"
+	policy := DeadLetterMessage
+	attempts := int64(1)
+	dlt := getTestName(t, "failure-dead-letters")
+	client.NewTopic(dlt, &TopicOptions{Compression: &Compression{Algorithm: CompressionGzip, Threshold: 1}})
+	g, _ := client.NewGroupedMessageTopic(getTestName(t, "failure-dlq"), &TopicOptions{FailurePolicy: &policy, MaxDeliveryAttempts: &attempts, DeadLetterTopic: &dlt})
+	g.InitTopicGroups(group, consumer)
+	g.PublishMessage("a", &Message{Data: map[string]interface{}{"doc": strings.Repeat("failed ", 100)}})
+	g.ConsumeMessages(group, consumer)
+	g.ConsumeMessages(group, consumer)
+	d, _ := client.NewTopic(dlt, nil)
+	raw, _ := client.rc.XRange(client.c, d.StreamKey, "-", "+").Result()
+	if len(raw) != 1 || raw[0].Values[compressedDataField] == nil {
+		t.Error("Failed message is not dead lettered with the options of the DeadLetterTopic", raw)
+	}
+}
+
+func TestGMTFailurePolicyPark(t *testing.T) {
+	group := "failure-group"
+	consumer := "failure-consumer"
+	policy := ParkGroup
+	attempts := int64(2)
+	g, _ := client.NewGroupedMessageTopic(getTestName(t, "failure-park"), &TopicOptions{FailurePolicy: &policy, MaxDeliveryAttempts: &attempts})
+	g.InitTopicGroups(group, consumer)
+	publishFailureMessages(t, g)
+	consumeFailureMessage(g, group, consumer)
+	consumeFailureMessage(g, group, consumer)
+	if seq := consumeFailureMessage(g, group, consumer); seq != "" {
+		t.Error("ConsumeMessages did not park the message group", seq)
+	}
+	if parked, _ := g.GetParkedGroups(group); len(parked) != 1 || parked[0] != "a" {
+		t.Error("GetParkedGroups is not valid", parked)
+	}
+	if err := g.ReleaseParkedGroup(group, "a", false); err != nil {
+		t.Fatal("ReleaseParkedGroup failed", err)
+	}
+	if seq := consumeFailureMessage(g, group, consumer); seq != "1" {
+		t.Error("ReleaseParkedGroup did not redeliver the failed message", seq)
+	}
+	consumeFailureMessage(g, group, consumer)
+	if seq := consumeFailureMessage(g, group, consumer); seq != "" {
+		t.Error("ConsumeMessages did not park the message group again", seq)
+	}
+	if err := g.ReleaseParkedGroup(group, "a", true); err != nil {
+		t.Fatal("ReleaseParkedGroup failed", err)
+	}
+	if seq := consumeFailureMessage(g, group, consumer); seq != "2" {
+		t.Error("ReleaseParkedGroup did not skip the failed message", seq)
+	}
+	g.Purge(false)
+}
+
+func TestGMTFailurePolicyOptions(t *testing.T) {
+	policy := DeadLetterMessage
+	if _, err := client.NewGroupedMessageTopic(getTestName(t, "failure-options"), &TopicOptions{FailurePolicy: &policy}); err == nil {
+		t.Error("NewGroupedMessageTopic allowed dead lettering without a DeadLetterTopic")
+	}
+	invalid := FailurePolicy("retry")
+	if _, err := client.NewGroupedMessageTopic(getTestName(t, "failure-options"), &TopicOptions{FailurePolicy: &invalid}); err == nil {
+		t.Error("NewGroupedMessageTopic allowed an invalid failure policy")
+	}
+}
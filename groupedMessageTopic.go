@@ -2,7 +2,8 @@ package redimq
 
 import (
 	"fmt"
-	"math"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/go-redis/redis/v8"
@@ -46,13 +47,119 @@ type GroupedMessageTopic struct {
 	MaxIdleTimeForMessages   time.Duration
 	NeedsAcknowledgements    bool
 	MessageKeysBeingConsumed []string
+	// ExpiredMessagesTopic is the name of the Topic where the expired messages are routed to when they
+	// are consumed, see [Topic.ExpiredMessagesTopic]
+	ExpiredMessagesTopic string
+	// Lanes is the number of ordered lanes that the message groups are hashed into. If set, the messages of
+	// a message group are published to the stream of its lane instead of a stream of its own, which bounds
+	// the number of streams irrespective of the number of group keys. The order of the messages and their
+	// consumption by a single consumer at a time is still guaranteed for every message group, as it is for
+	// the whole lane. The lanes are stored when the topic is created, so that all the instances publishing
+	// to or consuming the topic use the same lanes, and creating it with different lanes fails.
+	Lanes int64
+	// Compression compresses the Data of the large messages published to the topic, see [Compression]
+	Compression *Compression
+	// ClaimCheck stores the Data of the very large messages published to the topic in a BlobStore, see
+	// [ClaimCheck]
+	ClaimCheck *ClaimCheck
+	// FailurePolicy defines what is done with a message that is not acknowledged after being delivered
+	// MaxDeliveryAttempts times. By default the message is delivered again till it is acknowledged, which
+	// blocks its message group. It can instead be published to the DeadLetterTopic so that the message
+	// group moves on, or its message group can be parked till it is released.
+	FailurePolicy       FailurePolicy
+	MaxDeliveryAttempts int64
+	// DeadLetterTopic is the name of the Topic where the failed messages are published to by the
+	// DeadLetterMessage policy, or when a parked message group is released skipping its failed message
+	DeadLetterTopic string
 	MQClient
+	assignments *groupAssignments
 }
 
 func (t *GroupedMessageTopic) getStreamKeyForGroup(groupKey string) string {
 	return t.StreamPrefix + ":mg:" + groupKey + ":messages"
 }
 
+// getTopicForGroup returns the Topic for the stream of the message group
+func (t *GroupedMessageTopic) getTopicForGroup(groupKey string) *Topic {
+	return &Topic{
+		StreamKey:              t.getStreamKeyForGroup(groupKey),
+		Name:                   t.Name + "#" + groupKey,
+		Retention:              t.Retention,
+		MaxIdleTimeForMessages: t.MaxIdleTimeForMessages,
+		NeedsAcknowledgements:  t.NeedsAcknowledgements,
+		ClaimCheck:             t.ClaimCheck,
+		MQClient:               t.MQClient,
+	}
+}
+
+func (t *GroupedMessageTopic) getPausedKey() string {
+	return t.StreamPrefix + ":paused"
+}
+
+func (t *GroupedMessageTopic) getPausedGroupSetKey() string {
+	return t.StreamPrefix + ":paused-groups"
+}
+
+// Pause stops the consumption of messages from all the message groups of the GroupedMessageTopic.
+// The state is kept in REDIS so that every consumer instance honors it. Messages can still be
+// published while the topic is paused and are consumed in order once it is resumed.
+func (t *GroupedMessageTopic) Pause() error {
+	_, err := t.MQClient.rc.Set(t.MQClient.c, t.getPausedKey(), 1, 0).Result()
+	return err
+}
+
+// Resume restarts the consumption of messages from a GroupedMessageTopic paused using
+// [GroupedMessageTopic.Pause]. Message groups paused individually remain paused.
+func (t *GroupedMessageTopic) Resume() error {
+	_, err := t.MQClient.rc.Del(t.MQClient.c, t.getPausedKey()).Result()
+	return err
+}
+
+// IsPaused returns true if the consumption of messages from the GroupedMessageTopic is paused
+func (t *GroupedMessageTopic) IsPaused() (bool, error) {
+	res, err := t.MQClient.rc.Exists(t.MQClient.c, t.getPausedKey()).Result()
+	return res > 0, err
+}
+
+// PauseGroup stops the consumption of messages for a single message group, e.g. a tenant whose
+// downstream system is unavailable. The other message groups continue to be consumed. The messages
+// of the paused group are left intact and their order is maintained when the group is resumed.
+// For a topic having Lanes, the whole lane of the message group is paused.
+func (t *GroupedMessageTopic) PauseGroup(groupKey string) error {
+	_, err := t.MQClient.rc.SAdd(t.MQClient.c, t.getPausedGroupSetKey(), t.getMessageGroupKey(groupKey)).Result()
+	return err
+}
+
+// ResumeGroup restarts the consumption of messages for a message group paused using
+// [GroupedMessageTopic.PauseGroup]
+func (t *GroupedMessageTopic) ResumeGroup(groupKey string) error {
+	_, err := t.MQClient.rc.SRem(t.MQClient.c, t.getPausedGroupSetKey(), t.getMessageGroupKey(groupKey)).Result()
+	return err
+}
+
+// IsGroupPaused returns true if the consumption of messages for the message group is paused
+func (t *GroupedMessageTopic) IsGroupPaused(groupKey string) (bool, error) {
+	return t.MQClient.rc.SIsMember(t.MQClient.c, t.getPausedGroupSetKey(), t.getMessageGroupKey(groupKey)).Result()
+}
+
+// GetPausedGroups returns the keys of all the message groups that are currently paused, or the keys of the
+// paused lanes for a topic having Lanes
+func (t *GroupedMessageTopic) GetPausedGroups() ([]string, error) {
+	return t.MQClient.rc.SMembers(t.MQClient.c, t.getPausedGroupSetKey()).Result()
+}
+
+func (t *GroupedMessageTopic) getPausedGroups() (map[string]bool, error) {
+	keys, err := t.GetPausedGroups()
+	if err != nil {
+		return nil, err
+	}
+	paused := make(map[string]bool, len(keys))
+	for _, k := range keys {
+		paused[k] = true
+	}
+	return paused, nil
+}
+
 // PublishMessage is used to publish any message to the GroupedMessageTopic. The message group key
 // is some string that you want to group your messages by. Messages in the same message group will
 // be consumed in sequence. Messages in different message groups need not be process in order. The
@@ -62,18 +169,86 @@ func (t *GroupedMessageTopic) getStreamKeyForGroup(groupKey string) string {
 // message groups keys that you can have. The messages follow the retention defined during the queue
 // creation.
 func (t *GroupedMessageTopic) PublishMessage(groupKey string, m *Message) error {
+	return t.publishMessage(groupKey, m, "*")
+}
+
+// publishMessage publishes the message to the message group with the id, or with a generated id if it is
+// "*". The stream is not trimmed for the Retention when the id is given.
+func (t *GroupedMessageTopic) publishMessage(groupKey string, m *Message, id string) error {
 	rc := t.MQClient.rc
 	c := t.MQClient.c
-	topic := &Topic{
-		StreamKey:              t.getStreamKeyForGroup(groupKey),
-		Retention:              t.Retention,
-		NeedsAcknowledgements:  t.NeedsAcknowledgements,
-		MaxIdleTimeForMessages: t.MaxIdleTimeForMessages,
-		MQClient:               t.MQClient,
+	messageGroupKey := t.getMessageGroupKey(groupKey)
+	topic := t.getTopicForGroup(messageGroupKey)
+	t.addGroupKeyHeader(groupKey, m)
+	values, blobKey, err := m.getStreamValues(t.MQClient, topic.StreamKey, t.ClaimCheck, t.Compression)
+	if err != nil {
+		return err
+	}
+	if err = t.createStreamGroups(topic.StreamKey); err != nil {
+		abandonBlob(t.MQClient, topic.StreamKey, t.ClaimCheck, blobKey, err)
+		return err
+	}
+	// the message is added before the message group is registered, so that the janitor never expires
+	// a message group that a message is being published to
+	var add *redis.StringCmd
+	_, err = rc.TxPipelined(c, func(pipe redis.Pipeliner) error {
+		add = pipe.XAdd(c, topic.getXAddArgs(values, id))
+		markBlobAdded(t.MQClient, pipe, topic.StreamKey, blobKey)
+		return nil
+	})
+	if err != nil {
+		abandonBlob(t.MQClient, topic.StreamKey, t.ClaimCheck, blobKey, add.Err())
+		return err
+	}
+	m.Id = add.Val()
+	m.GroupKey = groupKey
+	m.Topic = *topic
+	if err = indexBlob(t.MQClient, topic.StreamKey, blobKey, m.Id); err != nil {
+		return err
+	}
+	err = t.registerMessageGroup(messageGroupKey)
+	if err != nil {
+		return err
+	}
+	if t.Retention != nil {
+		_, err = rc.Expire(c, topic.StreamKey, *t.Retention).Result()
+	}
+	return err
+}
+
+// createStreamGroups creates the consumer groups of the topic on the stream of a message group before its
+// first message is added. A consumer group starts reading a message group from its end when it locks the
+// message group for the first time, so the stream is created with the existing consumer groups reading it
+// from the beginning.
+func (t *GroupedMessageTopic) createStreamGroups(stream string) error {
+	rc := t.MQClient.rc
+	c := t.MQClient.c
+	exists, err := rc.Exists(c, stream).Result()
+	if err != nil || exists > 0 {
+		return err
+	}
+	cgs, err := rc.XInfoGroups(c, t.MessageGroupStreamKey).Result()
+	if isNoSuchKeyError(err) {
+		return nil
+	} else if err != nil {
+		return err
 	}
+	for _, cg := range cgs {
+		err = rc.XGroupCreateMkStream(c, stream, cg.Name, "$").Err()
+		if err != nil && !strings.HasPrefix(err.Error(), "BUSYGROUP") {
+			return err
+		}
+	}
+	return nil
+}
+
+// registerMessageGroup adds the message group to the MessageGroupSetKey and the MessageGroupStreamKey if it
+// is not already registered
+func (t *GroupedMessageTopic) registerMessageGroup(groupKey string) error {
+	c := t.MQClient.c
 	txf := func(tx *redis.Tx) error {
 		res, err := tx.SIsMember(c, t.MessageGroupSetKey, groupKey).Result()
-		if res {
+		if res || err != nil {
 			return err
 		}
 		_, err = tx.TxPipelined(c, func(pipe redis.Pipeliner) error {
@@ -87,25 +262,7 @@ func (t *GroupedMessageTopic) PublishMessage(groupKey string, m *Message) error
 		})
 		return err
 	}
-
-	err := rc.Watch(c, txf, t.MessageGroupSetKey)
-	if err != nil {
-		return err
-	}
-	res, err := rc.XAdd(c, &redis.XAddArgs{
-		Stream: topic.StreamKey,
-		Values: m.Data,
-		ID:     "*",
-		MinID:  topic.getMinId(),
-		Approx: true,
-	}).Result()
-	if err != nil {
-		return err
-	}
-	m.Id = res
-	m.Topic = *topic
-	_, err = rc.Expire(c, topic.StreamKey, *t.Retention).Result()
-	return err
+	return t.MQClient.rc.Watch(c, txf, t.MessageGroupSetKey)
 }
 
 func (t *GroupedMessageTopic) getTopic() *Topic {
@@ -118,81 +275,307 @@ func (t *GroupedMessageTopic) getTopic() *Topic {
 	}
 }
 
+// InitTopicGroups creates the consumer group and the consumer for the GroupedMessageTopic. The consumer group
+// reads all the message groups, but starts reading the messages of the message groups that already exist
+// from their end. [GroupedMessageTopic.SeekConsumerGroup] can be used to read them from the beginning.
 func (t *GroupedMessageTopic) InitTopicGroups(consumerGroupName string, consumerName string) (string, error) {
 	gres, err := t.MQClient.rc.XGroupCreateMkStream(t.MQClient.c, t.MessageGroupStreamKey, consumerGroupName, "0").Result()
 	cres, err := t.MQClient.rc.XGroupCreateConsumer(t.MQClient.c, t.MessageGroupStreamKey, consumerGroupName, consumerName).Result()
 	return fmt.Sprintf("%s, %d", gres, cres), err
 }
 
+// getAssignmentMembers returns the names of the live consumers of the consumer group that are consuming
+// this topic, including the calling consumer, sorted by their name.
+func (t *GroupedMessageTopic) getAssignmentMembers(consumerGroupName string, consumerName string) []string {
+	return t.MQClient.getAssignmentMembers("gmts:"+t.Name, consumerGroupName, consumerName)
+}
+
+// groupAssignments caches the keys of the message groups and the consumers that the message groups were
+// last rebalanced for, so that the MessageGroupStreamKey is scanned in full only when the live consumers
+// of a consumer group change. It is shared by all the consumers using the same GroupedMessageTopic.
+type groupAssignments struct {
+	mu      sync.Mutex
+	keys    map[string]string // keys of the message groups by the ids of their entries
+	members map[string]string // members of the last rebalance by the consumer group and consumer
+}
+
+func newGroupAssignments() *groupAssignments {
+	return &groupAssignments{keys: map[string]string{}, members: map[string]string{}}
+}
+
+// assignmentsMu guards the creation of the groupAssignments of the GroupedMessageTopics not created using
+// the MQClient
+var assignmentsMu sync.Mutex
+
+// getAssignments returns the groupAssignments of the topic, creating them if the topic was not created using
+// the MQClient
+func (t *GroupedMessageTopic) getAssignments() *groupAssignments {
+	assignmentsMu.Lock()
+	defer assignmentsMu.Unlock()
+	if t.assignments == nil {
+		t.assignments = newGroupAssignments()
+	}
+	return t.assignments
+}
+
+func (a *groupAssignments) getKey(id string) (string, bool) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	key, ok := a.keys[id]
+	return key, ok
+}
+
+func (a *groupAssignments) setKeys(entries []redis.XMessage) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	for _, e := range entries {
+		a.keys[e.ID] = getMessageGroupEntryKey(e)
+	}
+}
+
+func (a *groupAssignments) getMembers(consumerGroupName string, consumerName string) string {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.members[consumerGroupName+":"+consumerName]
+}
+
+func (a *groupAssignments) setMembers(consumerGroupName string, consumerName string, members string) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.members[consumerGroupName+":"+consumerName] = members
+}
+
+// lockMessageGroups returns the message groups assigned to the consumer. Every message group is assigned
+// to one of the live consumers using rendezvous hashing, so a message group stays with the same consumer
+// and moves only when consumers join or leave. A message group is locked by a consumer as long as its
+// entry in the MessageGroupStreamKey is pending for that consumer. The consumer hands over the message
+// groups it holds that are assigned to another consumer, while the message groups locked by consumers that
+// are no longer alive are claimed by their new owner when the live consumers change.
 func (t *GroupedMessageTopic) lockMessageGroups(consumerGroupName string, consumerName string) ([]*Message, error) {
-	count := t.getGroupCountPerConsumer(t.Name, consumerGroupName, consumerName, t.MessageGroupStreamKey)
-	res, err := reclaimMessageGroup(t.MQClient, consumerGroupName, consumerName, count, t.MessageGroupStreamKey, t.MaxIdleTimeForMessages)
+	members := t.getAssignmentMembers(consumerGroupName, consumerName)
+	// new message groups are delivered to this consumer first and handed over below if needed, a page at a
+	// time so that a large number of new message groups is spread over the polls
+	res, err := readNewMessageFromStream(t.MQClient, consumerGroupName, consumerName, DefaultBrowsePageSize, t.MessageGroupStreamKey)
+	if err != nil {
+		println("Error reading new message groups: ", err.Error())
+	}
+	t.getAssignments().setKeys(res)
+	membership := strings.Join(members, ",")
+	if t.getAssignments().getMembers(consumerGroupName, consumerName) != membership {
+		if err = t.rebalanceMessageGroups(consumerGroupName, consumerName, members); err != nil {
+			println("Error rebalancing message groups: ", err.Error())
+		} else {
+			t.getAssignments().setMembers(consumerGroupName, consumerName, membership)
+		}
+	}
+	locked, err := t.getLockedMessageGroups(consumerGroupName, consumerName)
+	if err != nil {
+		return []*Message{}, err
+	}
+	owned := []redis.XMessage{}
+	handovers := map[string][]string{}
+	for _, g := range locked {
+		assignee := rendezvousOwner(getMessageGroupEntryKey(g), members)
+		if assignee == consumerName {
+			owned = append(owned, g)
+		} else {
+			handovers[assignee] = append(handovers[assignee], g.ID)
+		}
+	}
+	for assignee, ids := range handovers {
+		err = t.MQClient.rc.XClaimJustID(t.MQClient.c, &redis.XClaimArgs{
+			Stream:   t.MessageGroupStreamKey,
+			Group:    consumerGroupName,
+			Consumer: assignee,
+			MinIdle:  0,
+			Messages: ids,
+		}).Err()
+		if err != nil {
+			println("Error handing over message groups: ", err.Error())
+		}
+	}
+	return xMessageArrayToMessageArray(owned, *t.getTopic(), consumerGroupName, consumerName), nil
+}
+
+// getLockedMessageGroups returns the entries of the message groups locked by the consumer. The keys of the
+// message groups are read from the MessageGroupStreamKey only if they are not already cached.
+func (t *GroupedMessageTopic) getLockedMessageGroups(consumerGroupName string, consumerName string) ([]redis.XMessage, error) {
+	rc := t.MQClient.rc
+	c := t.MQClient.c
+	locked := []redis.XMessage{}
+	unknown := []string{}
+	start := "-"
+	for {
+		pending, err := rc.XPendingExt(c, &redis.XPendingExtArgs{
+			Stream:   t.MessageGroupStreamKey,
+			Group:    consumerGroupName,
+			Start:    start,
+			End:      "+",
+			Count:    1000,
+			Consumer: consumerName,
+		}).Result()
+		if isNoGroupError(err) || err == redis.Nil {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+		for _, p := range pending {
+			if key, ok := t.getAssignments().getKey(p.ID); ok {
+				locked = append(locked, redis.XMessage{ID: p.ID, Values: map[string]interface{}{"key": key}})
+			} else {
+				unknown = append(unknown, p.ID)
+			}
+		}
+		if len(pending) < 1000 {
+			break
+		}
+		start = nextStreamId(pending[len(pending)-1].ID)
+	}
+	if len(unknown) == 0 {
+		return locked, nil
+	}
+	cmds, err := rc.Pipelined(c, func(pipe redis.Pipeliner) error {
+		for _, id := range unknown {
+			pipe.XRangeN(c, t.MessageGroupStreamKey, id, id, 1)
+		}
+		return nil
+	})
 	if err != nil {
-		fmt.Print("Error reclaiming message groups: ", err)
-		res = []redis.XMessage{}
-		// return nil, err
-	}
-	mgs := xMessageArrayToMessageArray(res, *t.getTopic(), consumerGroupName, consumerName)
-	lessCount := count - int64(len(mgs))
-	if lessCount > 0 {
-		res, err = readNewMessageFromStream(t.MQClient, consumerGroupName, consumerName, count, t.MessageGroupStreamKey)
+		return nil, err
+	}
+	for _, cmd := range cmds {
+		res := cmd.(*redis.XMessageSliceCmd).Val()
+		t.getAssignments().setKeys(res)
+		locked = append(locked, res...)
+	}
+	return locked, nil
+}
+
+// rebalanceMessageGroups claims the message groups assigned to the consumer that are locked by consumers
+// that are no longer alive. It scans all the message groups, so it is only done when the members change.
+func (t *GroupedMessageTopic) rebalanceMessageGroups(consumerGroupName string, consumerName string, members []string) error {
+	live := make(map[string]bool, len(members))
+	for _, m := range members {
+		live[m] = true
+	}
+	keys := map[string]string{}
+	start := "-"
+	for {
+		res, err := t.MQClient.rc.XRangeN(t.MQClient.c, t.MessageGroupStreamKey, start, "+", 1000).Result()
 		if err != nil {
-			fmt.Print("Error reading new message groups: ", err)
-			res = []redis.XMessage{}
-			// return nil, err
+			return err
+		}
+		if len(res) == 0 {
+			break
 		}
-		mgs = append(mgs, xMessageArrayToMessageArray(res, *t.getTopic(), consumerGroupName, consumerName)...)
-		lessCount = count - int64(len(mgs))
-		if lessCount > 0 {
-			res, err = claimStuckStreamMessages(t.MQClient, consumerGroupName, consumerName, lessCount, t.MessageGroupStreamKey, t.MaxIdleTimeForMessages)
+		locks, err := t.getMessageGroupLocks(consumerGroupName, res[0].ID, res[len(res)-1].ID, int64(len(res)))
+		if err != nil {
+			return err
+		}
+		claims := []string{}
+		for _, g := range res {
+			key := getMessageGroupEntryKey(g)
+			keys[g.ID] = key
+			lock, ok := locks[g.ID]
+			if ok && !live[lock.Consumer] && rendezvousOwner(key, members) == consumerName {
+				claims = append(claims, g.ID)
+			}
+		}
+		if len(claims) > 0 {
+			err = t.MQClient.rc.XClaimJustID(t.MQClient.c, &redis.XClaimArgs{
+				Stream:   t.MessageGroupStreamKey,
+				Group:    consumerGroupName,
+				Consumer: consumerName,
+				MinIdle:  0,
+				Messages: claims,
+			}).Err()
 			if err != nil {
-				fmt.Print("Error claiming stuck message groups: ", err)
-				res = []redis.XMessage{}
-				// return nil, err
+				return err
 			}
-			mgs = append(mgs, xMessageArrayToMessageArray(res, *t.getTopic(), consumerGroupName, consumerName)...)
 		}
+		if len(res) < 1000 {
+			break
+		}
+		start = nextStreamId(res[len(res)-1].ID)
 	}
-	// fmt.Printf("Group: %s, Consumer: %s, Message Group Locks Requested: %d, Message Groups Locked: %d\n",
-	// 	consumerGroupName, consumerName, count, len(mgs))
-	return mgs, err
+	// the keys of the expired message groups are dropped from the cache
+	assignments := t.getAssignments()
+	assignments.mu.Lock()
+	assignments.keys = keys
+	assignments.mu.Unlock()
+	return nil
 }
 
-// ConsumeMessages is used to consume messages from the GroupedMessageTopic. This function will try obtaining a
-// lock on the a fixed number of message groups (say N) and then consume 1 message from each group locked. The
-// number of message group locks requested (N) depends on the total number of message groups present (MG) and
-// the total number of consumers (C) for the consumer group (N = MG / C + 1). The function would return one
-// message from each message group locked and having messages. So it can return a maximum of N messages and a
-// minimum  of 0 messages if none of the message groups have any messages.
+// ConsumeMessages is used to consume messages from the GroupedMessageTopic. This function will lock the message
+// groups assigned to the consumer (say N) and then consume 1 message from each group locked. The message groups
+// are spread evenly across the live consumers of the consumer group in the consumer registry and stay with the
+// same consumer till a consumer joins or leaves. The function would return one message from each message group
+// locked and having messages. So it can return a maximum of N messages and a minimum of 0 messages if none of
+// the message groups have any messages. No messages are returned while the topic is paused, and message groups
+// paused using [GroupedMessageTopic.PauseGroup] are skipped. A message that is not acknowledged is delivered
+// again on the next call, till the FailurePolicy of the topic is applied after MaxDeliveryAttempts.
 func (t *GroupedMessageTopic) ConsumeMessages(consumerGroupName string, consumerName string) ([]*Message, error) {
-	mgs, err := t.lockMessageGroups(consumerGroupName, consumerName)
 	msgs := []*Message{}
+	paused, err := t.IsPaused()
+	if err != nil || paused {
+		return msgs, err
+	}
+	pausedGroups, err := t.getPausedGroups()
+	if err != nil {
+		return msgs, err
+	}
+	parkedGroups, err := t.getParkedGroups(consumerGroupName)
+	if err != nil {
+		return msgs, err
+	}
+	offsets, err := t.getDeliveryOffsets(consumerGroupName)
+	if err != nil {
+		return msgs, err
+	}
+	mgs, err := t.lockMessageGroups(consumerGroupName, consumerName)
 	for _, g := range mgs {
-		t.MQClient.rc.XGroupCreate(t.MQClient.c, t.getStreamKeyForGroup(g.GroupKey), consumerGroupName, "$").Result()
-		t.MQClient.rc.XGroupCreateConsumer(t.MQClient.c, t.getStreamKeyForGroup(g.GroupKey), consumerGroupName, consumerName).Result()
-		res, err := claimStuckStreamMessages(t.MQClient, consumerGroupName, consumerName, 1, t.getStreamKeyForGroup(g.GroupKey), 0)
+		if pausedGroups[g.GroupKey] || parkedGroups[g.GroupKey] {
+			continue
+		}
+		stream := t.getStreamKeyForGroup(g.GroupKey)
+		t.MQClient.rc.XGroupCreate(t.MQClient.c, stream, consumerGroupName, "$").Result()
+		t.MQClient.rc.XGroupCreateConsumer(t.MQClient.c, stream, consumerGroupName, consumerName).Result()
+		pending, err := getPendingStreamMessages(t.MQClient, consumerGroupName, 1, stream, 0)
+		if err != nil {
+			fmt.Println("Error reading pending messages for "+g.GroupKey+": ", err)
+			continue
+		}
+		var p *redis.XPendingExt
+		if len(pending) > 0 {
+			p = &pending[0]
+		}
+		if policy, err := t.applyFailurePolicy(consumerGroupName, g.GroupKey, p, offsets[g.GroupKey]); err != nil {
+			fmt.Println("Error applying the failure policy for "+g.GroupKey+": ", err)
+			continue
+		} else if policy == ParkGroup {
+			continue
+		} else if policy == DeadLetterMessage {
+			pending = nil
+		}
+		res, err := claimPendingStreamMessages(t.MQClient, consumerGroupName, consumerName, stream, 0, pending)
 		if err != nil {
 			fmt.Println("Error claiming stuck messages for "+g.GroupKey+": ", err)
 		} else if len(res) == 0 {
-			res, err = readNewMessageFromStream(t.MQClient, consumerGroupName, consumerName, 1, t.getStreamKeyForGroup(g.GroupKey))
+			res, err = readNewMessageFromStream(t.MQClient, consumerGroupName, consumerName, 1, stream)
 			if err != nil {
 				fmt.Println("Error reading new messages for "+g.GroupKey+": ", err)
 			}
 		}
 		if len(res) > 0 {
-			topic := &Topic{
-				StreamKey:              t.getStreamKeyForGroup(g.GroupKey),
-				Name:                   t.Name + "#" + g.GroupKey,
-				Retention:              t.Retention,
-				MaxIdleTimeForMessages: t.MaxIdleTimeForMessages,
-				NeedsAcknowledgements:  t.NeedsAcknowledgements,
-				MQClient:               t.MQClient,
-			}
-			msgs = append(msgs, xMessageArrayToMessageArray(res, *topic, consumerGroupName, consumerName)...)
+			topic := t.getTopicForGroup(g.GroupKey)
+			groupMsgs := xMessageArrayToMessageArray(res, *topic, consumerGroupName, consumerName)
+			setGroupKeys(groupMsgs, g.GroupKey)
+			msgs = append(msgs, groupMsgs...)
 		}
 	}
 	// fmt.Printf("Group: %s, Consumer: %s, Messages Pulled: %d\n", consumerGroupName, consumerName, len(msgs))
-	return msgs, err
+	msgs, err = keepDecodedMessages(msgs, err)
+	return t.dropExpiredMessages(msgs), err
 }
 
 // ConsumeMessages is used to consume messages from the GroupedMessageTopic. This function will try obtaining a
@@ -206,7 +589,7 @@ func (t *GroupedMessageTopic) ConsumeMessages(consumerGroupName string, consumer
 // 	msgs := [][]*Message{}
 // 	streamKeys := []string{}
 // 	for _, g := range mgs {
-// 		t.MQClient.rc.XGroupCreate(t.MQClient.c, t.getStreamKeyForGroup(g.GroupKey), consumerGroupName, "0").Result()
+// 		t.MQClient.rc.XGroupCreate(t.MQClient.c, t.getStreamKeyForGroup(g.GroupKey), consumerGroupName, "$").Result()
 // 		res, err := claimStuckStreamMessages(t.MQClient, consumerGroupName, consumerName, batchSize, t.getStreamKeyForGroup(g.GroupKey), t.MaxIdleTimeForMessages)
 // 		if err == nil && res != nil && len(res) > 0 {
 // 			topic := &Topic{
@@ -243,50 +626,12 @@ func (t *GroupedMessageTopic) ConsumeMessages(consumerGroupName string, consumer
 // 	return msgs, err
 // }
 
+// CleanupMessageGroupsAndConsumers runs the cleanup of the GroupedMessageTopic once.
+//
+// Deprecated: Use [GroupedMessageTopic.Cleanup] or a [Janitor] instead. The consumerGroupName is ignored
+// as the cleanup is done for all the consumer groups of the topic.
 func (t *GroupedMessageTopic) CleanupMessageGroupsAndConsumers(consumerGroupName string) {
-	res, err := claimStuckStreamMessages(t.MQClient, "redimq-system", "", 100, t.MessageGroupStreamKey, *t.Retention)
-	if err != nil {
-		println("Claiming message groups for delete error - ", err.Error())
-	}
-	if len(res) == 0 {
-		return
-	}
-	for _, m := range res {
-		pipe := t.MQClient.rc.TxPipeline()
-		pipe.XDel(t.MQClient.c, t.MessageGroupStreamKey, m.ID)
-		pipe.SRem(t.MQClient.c, t.MessageGroupSetKey, m.Values["key"])
-		_, err = pipe.Exec(t.MQClient.c)
-		if err != nil {
-			println("Deleting Messge Group error - ", err.Error())
-		}
-	}
-	consumers, err := t.MQClient.rc.XInfoConsumers(t.MQClient.c, t.MessageGroupStreamKey, consumerGroupName).Result()
-	if err != nil {
-		println("xinfo consumers error - ", err.Error())
+	if _, err := t.Cleanup(); err != nil {
+		println("Cleanup of message groups and consumers error - ", err.Error())
 	}
-	for _, c := range consumers {
-		if c.Pending == 0 && c.Idle < int64(t.MaxIdleTimeForMessages/time.Millisecond) {
-			t.MQClient.rc.XGroupDelConsumer(t.MQClient.c, t.MessageGroupStreamKey, consumerGroupName, c.Name)
-		}
-	}
-}
-
-func (t *GroupedMessageTopic) getActiveConsumerCountPerGroup(stream string, consumerGroupName string, consumerName string) int {
-	count := 1
-	res, err := t.MQClient.rc.XInfoConsumers(t.MQClient.c, stream, consumerGroupName).Result()
-	if err != nil {
-		println("xinfo consumers error - ", err.Error())
-	}
-	for _, c := range res {
-		if c.Name != consumerName && c.Idle < int64(t.MaxIdleTimeForMessages/time.Millisecond) {
-			count = count + 1
-		}
-	}
-	return count
-}
-
-func (t *GroupedMessageTopic) getGroupCountPerConsumer(topicName string, consumerGroupName string, consumerName string, messageGroupKey string) int64 {
-	consumerCount := t.getActiveConsumerCountPerGroup(messageGroupKey, consumerGroupName, consumerName)
-	res, _ := t.MQClient.rc.XLen(t.MQClient.c, messageGroupKey).Result()
-	return int64(math.Ceil(float64(res) / float64(consumerCount)))
 }
@@ -3,6 +3,7 @@ package redimq
 import (
 	"fmt"
 	"testing"
+	"time"
 	// "github.com/go-redis/redis/v8"
 )
 
@@ -39,11 +40,16 @@ func TestGMTConsumeMessages(t *testing.T) {
 	// 	Messages: []redis.XMessage { *msg },
 	// }
 	// mock.ExpectXReadGroup(args).SetVal([]redis.XStream { *resStream })
-	msgs, err := gmt.ConsumeMessages(group, consumer)
+	g, _ := client.NewGroupedMessageTopic(getTestName(t, "consume"), nil)
+	g.InitTopicGroups(group, consumer)
+	if err := g.PublishMessage("groupkey", &Message{Data: map[string]interface{}{"foo": "test", "bar": "test"}}); err != nil {
+		t.Fatal("PublishMessage failed", err)
+	}
+	msgs, err := g.ConsumeMessages(group, consumer)
 	if err != nil {
-		t.Error("ConsumeMessage failed", err)
-	} else if msgs == nil {
-		t.Error("ConsumeMessage did not return message")
+		t.Fatal("ConsumeMessage failed", err)
+	} else if len(msgs) != 1 {
+		t.Fatal("ConsumeMessage did not return message")
 	} else if msgs[0].Id == "" {
 		t.Error("ConsumeMessage message does not match")
 	}
@@ -54,3 +60,116 @@ func TestGMTCleanupMessageGroupsAndConsumers(t *testing.T) {
 	group := "test-group"
 	gmt.CleanupMessageGroupsAndConsumers(group)
 }
+
+func TestGMTPauseResumeGroup(t *testing.T) {
+	group := "pause-group"
+	consumer := "pause-consumer"
+	g, _ := client.NewGroupedMessageTopic(getTestName(t, "pause"), nil)
+	g.InitTopicGroups(group, consumer)
+	g.PublishMessage("paused", &Message{Data: map[string]interface{}{"foo": "paused"}})
+	g.PublishMessage("active", &Message{Data: map[string]interface{}{"foo": "active"}})
+	err := g.PauseGroup("paused")
+	if err != nil {
+		t.Fatal("PauseGroup failed", err)
+	}
+	paused, err := g.IsGroupPaused("paused")
+	if err != nil || !paused {
+		t.Error("Message group is not paused", err)
+	}
+	groups, err := g.GetPausedGroups()
+	if err != nil || len(groups) != 1 {
+		t.Error("GetPausedGroups did not return the paused group", err)
+	}
+	msgs, err := g.ConsumeMessages(group, consumer)
+	if err != nil || len(msgs) != 1 || msgs[0].GroupKey != "active" {
+		t.Error("ConsumeMessages did not skip the paused message group", msgs, err)
+	}
+	err = g.ResumeGroup("paused")
+	if err != nil {
+		t.Fatal("ResumeGroup failed", err)
+	}
+	paused, err = g.IsGroupPaused("paused")
+	if err != nil || paused {
+		t.Error("Message group is still paused", err)
+	}
+	msgs, _ = g.ConsumeMessages(group, consumer)
+	delivered := false
+	for _, m := range msgs {
+		delivered = delivered || m.GroupKey == "paused"
+	}
+	if !delivered {
+		t.Error("ConsumeMessages did not return the message of the resumed message group", msgs)
+	}
+}
+
+func TestGMTMessageGroupAssignment(t *testing.T) {
+	group := "assignment-group"
+	g, _ := client.NewGroupedMessageTopic(getTestName(t, "assignment"), nil)
+	retention := time.Hour
+	g.Retention = &retention
+	keys := []string{"a", "b", "c", "d", "e", "f"}
+	for _, k := range keys {
+		if err := g.PublishMessage(k, &Message{Data: map[string]interface{}{"foo": k}}); err != nil {
+			t.Fatal("PublishMessage failed", err)
+		}
+	}
+	consumers := []*Consumer{
+		client.NewConsumer(group, "consumer-1", func(m *Message) {}),
+		client.NewConsumer(group, "consumer-2", func(m *Message) {}),
+	}
+	for _, c := range consumers {
+		client.createGroupAndConsumer(g.MessageGroupStreamKey, group, c.ConsumerName)
+		c.registerTopic(client, "gmts:"+g.Name)
+		defer c.Close()
+	}
+	assigned := map[string]string{}
+	for i := 0; i < 2; i++ {
+		for _, c := range consumers {
+			mgs, err := g.lockMessageGroups(group, c.ConsumerName)
+			if err != nil {
+				t.Fatal("lockMessageGroups failed", err)
+			}
+			for _, mg := range mgs {
+				if owner, ok := assigned[mg.GroupKey]; ok && owner != c.ConsumerName {
+					t.Error("Message group", mg.GroupKey, "locked by", owner, "and", c.ConsumerName)
+				}
+				assigned[mg.GroupKey] = c.ConsumerName
+			}
+		}
+	}
+	if len(assigned) != len(keys) {
+		t.Error("Message groups locked", len(assigned), "expected", len(keys))
+	}
+	consumers[1].Close()
+	mgs, err := g.lockMessageGroups(group, consumers[0].ConsumerName)
+	if err != nil || len(mgs) != len(keys) {
+		t.Error("Message groups of the closed consumer were not claimed", len(mgs), err)
+	}
+}
+
+func TestGMTLockMessageGroupsInPages(t *testing.T) {
+	group := "paging-group"
+	consumer := "paging-consumer"
+	created, _ := client.NewGroupedMessageTopic(getTestName(t, "paging"), nil)
+	g := &GroupedMessageTopic{
+		Name:                   created.Name,
+		StreamPrefix:           created.StreamPrefix,
+		MessageGroupStreamKey:  created.MessageGroupStreamKey,
+		MessageGroupSetKey:     created.MessageGroupSetKey,
+		MaxIdleTimeForMessages: created.MaxIdleTimeForMessages,
+		MQClient:               created.MQClient,
+	}
+	g.InitTopicGroups(group, consumer)
+	for _, k := range []string{"a", "b", "c"} {
+		created.PublishMessage(k, &Message{Data: map[string]interface{}{"foo": k}})
+	}
+	pageSize := DefaultBrowsePageSize
+	DefaultBrowsePageSize = 2
+	defer func() { DefaultBrowsePageSize = pageSize }()
+	if mgs, err := g.lockMessageGroups(group, consumer); err != nil || len(mgs) != 2 {
+		t.Fatal("lockMessageGroups did not lock a page of the new message groups", len(mgs), err)
+	}
+	if mgs, err := g.lockMessageGroups(group, consumer); err != nil || len(mgs) != 3 {
+		t.Error("lockMessageGroups did not lock the next page of the new message groups", len(mgs), err)
+	}
+}
@@ -1,6 +1,12 @@
 package redimq
 
 import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"hash/fnv"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/go-redis/redis/v8"
@@ -34,7 +40,16 @@ func claimStuckStreamMessages(client MQClient, consumerGroupName string, consume
 	// 	MinIdle:  idle,
 	// }
 	// msgs, a, err := client.rc.XAutoClaim(client.c, args).Result()
-	var msgs []redis.XMessage
+	res, err := getPendingStreamMessages(client, consumerGroupName, count, stream, idle)
+	if err != nil {
+		return nil, err
+	}
+	return claimPendingStreamMessages(client, consumerGroupName, consumerName, stream, idle, res)
+}
+
+// getPendingStreamMessages returns upto count of the oldest messages pending in the consumer group for at
+// least the idle time
+func getPendingStreamMessages(client MQClient, consumerGroupName string, count int64, stream string, idle time.Duration) ([]redis.XPendingExt, error) {
 	res, err := client.rc.XPendingExt(client.c, &redis.XPendingExtArgs{
 		Stream: stream,
 		Group:  consumerGroupName,
@@ -43,63 +58,140 @@ func claimStuckStreamMessages(client MQClient, consumerGroupName string, consume
 		End:    "+",
 		Count:  count,
 	}).Result()
+	if err == redis.Nil {
+		return []redis.XPendingExt{}, nil
+	}
 	if err != nil {
 		println("XPending", err.Error())
 		return nil, err
 	}
-	if len(res) > 0 {
-		ids := make([]string, len(res))
-		for i, m := range res {
-			ids[i] = m.ID
-		}
-		msgs, err = client.rc.XClaim(client.c, &redis.XClaimArgs{
-			Stream:   stream,
-			Group:    consumerGroupName,
-			Consumer: consumerName,
-			MinIdle:  idle,
-			Messages: ids,
-		}).Result()
-		if err != nil {
-			println("XClaim", err.Error())
-			return nil, err
-		}
-	}
-	if len(res) == 0 {
-		return []redis.XMessage{}, nil
-	}
-	return msgs, err
+	return res, nil
 }
 
-func reclaimMessageGroup(client MQClient, consumerGroupName string, consumerName string, count int64, stream string, maxIdle time.Duration) ([]redis.XMessage, error) {
-	pending, err := client.rc.XPendingExt(client.c, &redis.XPendingExtArgs{
-		Stream:   stream,
-		Group:    consumerGroupName,
-		Start:    "-",
-		End:      "+",
-		Count:    count,
-		Consumer: consumerName,
-		Idle:     0,
-	}).Result()
-	if err != nil {
-		return nil, err
+// claimPendingStreamMessages claims the pending messages for the consumer
+func claimPendingStreamMessages(client MQClient, consumerGroupName string, consumerName string, stream string, idle time.Duration, pending []redis.XPendingExt) ([]redis.XMessage, error) {
+	if len(pending) == 0 {
+		return []redis.XMessage{}, nil
 	}
-	msgIds := []string{}
-	for i, p := range pending {
-		if p.Idle < (maxIdle - 10*time.Second) {
-			msgIds[i] = p.ID
-		}
+	ids := make([]string, len(pending))
+	for i, m := range pending {
+		ids[i] = m.ID
 	}
 	msgs, err := client.rc.XClaim(client.c, &redis.XClaimArgs{
 		Stream:   stream,
 		Group:    consumerGroupName,
 		Consumer: consumerName,
-		MinIdle:  0,
-		Messages: msgIds,
+		MinIdle:  idle,
+		Messages: ids,
 	}).Result()
 	if err != nil {
+		println("XClaim", err.Error())
 		return nil, err
 	}
-	return msgs, err
+	return msgs, nil
+}
+
+// parseStreamId splits a REDIS stream id of the form "<milliseconds>-<sequence>" into its parts. The
+// sequence is optional and defaults to 0.
+func parseStreamId(id string) (uint64, uint64, error) {
+	parts := strings.SplitN(id, "-", 2)
+	ms, err := strconv.ParseUint(parts[0], 10, 64)
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid stream id %q: [%w]", id, err)
+	}
+	if len(parts) == 1 {
+		return ms, 0, nil
+	}
+	seq, err := strconv.ParseUint(parts[1], 10, 64)
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid stream id %q: [%w]", id, err)
+	}
+	return ms, seq, nil
+}
+
+// compareStreamIds returns -1, 0 or 1 if the stream id a is less than, equal to or greater than b.
+// Invalid ids are considered to be the smallest.
+func compareStreamIds(a string, b string) int {
+	ams, aseq, _ := parseStreamId(a)
+	bms, bseq, _ := parseStreamId(b)
+	switch {
+	case ams < bms || (ams == bms && aseq < bseq):
+		return -1
+	case ams > bms || (ams == bms && aseq > bseq):
+		return 1
+	}
+	return 0
+}
+
+// previousStreamId returns the greatest stream id that is less than the id
+func previousStreamId(id string) string {
+	ms, seq, err := parseStreamId(id)
+	if err != nil || (ms == 0 && seq == 0) {
+		return "0-0"
+	}
+	if seq == 0 {
+		return fmt.Sprintf("%d-%d", ms-1, ^uint64(0))
+	}
+	return fmt.Sprintf("%d-%d", ms, seq-1)
+}
+
+// nextStreamId returns the smallest stream id that is greater than the id
+func nextStreamId(id string) string {
+	ms, seq, err := parseStreamId(id)
+	if err != nil {
+		return "0-1"
+	}
+	if seq == ^uint64(0) {
+		return fmt.Sprintf("%d-0", ms+1)
+	}
+	return fmt.Sprintf("%d-%d", ms, seq+1)
+}
+
+// newRandomId returns a random hex string that can be used to create unique names
+func newRandomId() string {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return strconv.FormatInt(time.Now().UnixNano(), 16)
+	}
+	return hex.EncodeToString(b)
+}
+
+func isNoGroupError(err error) bool {
+	return err != nil && strings.HasPrefix(err.Error(), "NOGROUP")
+}
+
+func isNoSuchKeyError(err error) bool {
+	return err != nil && strings.Contains(strings.ToLower(err.Error()), "no such key")
+}
+
+// rendezvousOwner returns the member with the highest score for the key using rendezvous (highest random
+// weight) hashing. For the same set of members a key is always assigned to the same member, and when a
+// member joins or leaves only the keys assigned to that member move.
+func rendezvousOwner(key string, members []string) string {
+	owner := ""
+	var max uint64
+	for _, m := range members {
+		h := fnv.New64a()
+		h.Write([]byte(m))
+		h.Write([]byte{0})
+		h.Write([]byte(key))
+		score := mix64(h.Sum64())
+		if owner == "" || score > max {
+			owner = m
+			max = score
+		}
+	}
+	return owner
+}
+
+// mix64 is the finalizer of the splitmix64 generator. It spreads the bits of similar fnv hashes.
+func mix64(x uint64) uint64 {
+	x ^= x >> 30
+	x *= 0xbf58476d1ce4e5b9
+	x ^= x >> 27
+	x *= 0x94d049bb133111eb
+	x ^= x >> 31
+	return x
 }
 
 func xMessageToMessage(s redis.XMessage, t Topic, consumerGroupName string, consumerName string) *Message {
@@ -107,13 +199,24 @@ func xMessageToMessage(s redis.XMessage, t Topic, consumerGroupName string, cons
 	if val, ok := s.Values["key"]; ok {
 		groupKey = val.(string)
 	}
+	data, headers, err := splitValues(s.Values)
+	if err == nil {
+		data, err = resolveClaimCheck(t.ClaimCheck, data, headers)
+	}
+	var decodeErr error
+	if err != nil {
+		decodeErr = &DecodeError{MessageId: s.ID, StreamKey: t.StreamKey, Err: err}
+	}
 	return &Message{
 		GroupKey:          groupKey,
 		Id:                s.ID,
-		Data:              s.Values,
+		Data:              data,
+		Headers:           headers,
+		ExpiresAt:         parseExpiresAt(headers),
 		Topic:             t,
 		ConsumerGroupName: consumerGroupName,
 		ConsumerName:      consumerName,
+		decodeErr:         decodeErr,
 	}
 }
 
@@ -0,0 +1,275 @@
+package redimq
+
+import (
+	"strings"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// getHashTag returns the part of the key that REDIS Cluster hashes for its slot, i.e. the hash tag between
+// the first braces if any, or the whole key
+func getHashTag(key string) string {
+	if s := strings.Index(key, "{"); s >= 0 {
+		if e := strings.Index(key[s+1:], "}"); e > 0 {
+			return key[s+1 : s+1+e]
+		}
+	}
+	return key
+}
+
+// getProcessedKey returns the key marking the message as processed by its consumer group. The key has the
+// hash tag of the stream of the message so that it is set in the same transaction as the acknowledgement.
+func getProcessedKey(m *Message) string {
+	return "{" + getHashTag(m.Topic.StreamKey) + "}:processed:" + m.ConsumerGroupName + ":" + m.Id
+}
+
+// getInProgressKey returns the key marking the message as being processed by a consumer of its consumer
+// group, so that it is not processed by another one claiming it meanwhile
+func getInProgressKey(m *Message) string {
+	return "{" + getHashTag(m.Topic.StreamKey) + "}:in-progress:" + m.ConsumerGroupName + ":" + m.Id
+}
+
+// getInProgressTTL returns the expiry of the in-progress marker of the message. It is bounded by the
+// MaxIdleTimeForMessages of the topic, after which the message can be claimed by another consumer, so that the
+// marker of a consumer that stopped without releasing it does not keep the message from being processed.
+func getInProgressTTL(m *Message) time.Duration {
+	if idle := m.Topic.MaxIdleTimeForMessages; idle > 0 && idle < m.processedWindow {
+		return idle
+	}
+	return m.processedWindow
+}
+
+// refreshInProgress extends the in-progress marker of the message while it is held by its consumer, and
+// returns false if the marker has been taken over by another consumer
+func (m *Message) refreshInProgress() (bool, error) {
+	rc := m.Topic.MQClient.rc
+	c := m.Topic.MQClient.c
+	key := getInProgressKey(m)
+	held := false
+	err := rc.Watch(c, func(tx *redis.Tx) error {
+		holder, err := tx.Get(c, key).Result()
+		if err == redis.Nil {
+			return nil
+		}
+		if err != nil || holder != m.ConsumerName {
+			return err
+		}
+		_, err = tx.TxPipelined(c, func(pipe redis.Pipeliner) error {
+			pipe.PExpire(c, key, getInProgressTTL(m))
+			return nil
+		})
+		held = err == nil
+		return err
+	}, key)
+	return held, err
+}
+
+// holdInProgress refreshes the in-progress markers held for the messages while they are processed, so that a
+// slow handler does not lose them, and returns a function that stops the refreshing and releases the markers
+func holdInProgress(msgs []*Message, errs func(err error)) func() {
+	held := make([]*Message, 0, len(msgs))
+	for _, m := range msgs {
+		if m.inProgress {
+			held = append(held, m)
+		}
+	}
+	if len(held) == 0 {
+		return func() {}
+	}
+	stop := make(chan bool)
+	done := make(chan bool)
+	go func() {
+		defer close(done)
+		ticker := time.NewTicker(getInProgressTTL(held[0]) / 3)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+				for _, m := range held {
+					if !m.inProgress {
+						continue
+					}
+					ok, err := m.refreshInProgress()
+					if err != nil {
+						errs(err)
+					} else if !ok {
+						m.inProgress = false
+					}
+				}
+			}
+		}
+	}()
+	return func() {
+		close(stop)
+		<-done
+		for _, m := range held {
+			if !m.inProgress {
+				continue
+			}
+			if err := m.releaseInProgress(); err != nil {
+				errs(err)
+			}
+		}
+	}
+}
+
+// takeOverInProgress marks the message as in progress for its consumer if the marker is held by the same
+// consumer, e.g. after a restart, or by a consumer that has stopped publishing heartbeats, and returns true
+// if the marker was taken over
+func (m *Message) takeOverInProgress(dead map[string]bool) (bool, error) {
+	rc := m.Topic.MQClient.rc
+	c := m.Topic.MQClient.c
+	key := getInProgressKey(m)
+	taken := false
+	err := rc.Watch(c, func(tx *redis.Tx) error {
+		holder, err := tx.Get(c, key).Result()
+		if err != nil && err != redis.Nil {
+			return err
+		}
+		if err == nil && holder != m.ConsumerName && !dead[holder] {
+			return nil
+		}
+		_, err = tx.TxPipelined(c, func(pipe redis.Pipeliner) error {
+			pipe.Set(c, key, m.ConsumerName, getInProgressTTL(m))
+			return nil
+		})
+		taken = err == nil
+		return err
+	}, key)
+	if err == redis.TxFailedErr {
+		return false, nil
+	}
+	return taken, err
+}
+
+// getDeadConsumers returns the consumers of the consumer group in the consumer registry that have not
+// published a heartbeat within the DefaultHeartbeatTimeout
+func getDeadConsumers(client MQClient, consumerGroupName string) (map[string]bool, error) {
+	consumers, err := client.GetConsumers(consumerGroupName)
+	if err != nil {
+		return nil, err
+	}
+	dead := map[string]bool{}
+	for _, info := range consumers {
+		if !info.IsAlive() {
+			dead[info.Name] = true
+		}
+	}
+	return dead, nil
+}
+
+// releaseInProgress removes the in-progress marker of the message if it is still held by its consumer, so
+// that the message can be processed again by the consumer claiming it if it was not acknowledged
+func (m *Message) releaseInProgress() error {
+	rc := m.Topic.MQClient.rc
+	c := m.Topic.MQClient.c
+	key := getInProgressKey(m)
+	return rc.Watch(c, func(tx *redis.Tx) error {
+		holder, err := tx.Get(c, key).Result()
+		if err == redis.Nil {
+			return nil
+		}
+		if err != nil || holder != m.ConsumerName {
+			return err
+		}
+		_, err = tx.TxPipelined(c, func(pipe redis.Pipeliner) error {
+			pipe.Del(c, key)
+			return nil
+		})
+		return err
+	}, key)
+}
+
+// acknowledgeProcessed acknowledges the message and marks it as processed for the window in a transaction
+func (m *Message) acknowledgeProcessed() error {
+	rc := m.Topic.MQClient.rc
+	c := m.Topic.MQClient.c
+	_, err := rc.TxPipelined(c, func(pipe redis.Pipeliner) error {
+		pipe.Set(c, getProcessedKey(m), 1, m.processedWindow)
+		pipe.XAck(c, m.Topic.StreamKey, m.ConsumerGroupName, m.Id)
+		return nil
+	})
+	return err
+}
+
+// IsProcessed returns true if the message has been acknowledged by a [Consumer] having an
+// IdempotencyWindow in its consumer group within the window
+func (m *Message) IsProcessed() (bool, error) {
+	n, err := m.Topic.MQClient.rc.Exists(m.Topic.MQClient.c, getProcessedKey(m)).Result()
+	return n > 0, err
+}
+
+// dropProcessedMessages acknowledges the messages already processed by their consumer group, drops the ones
+// being processed by another live consumer without acknowledging them and returns the rest, after marking them
+// as in progress. The returned messages are marked as processed for the window when they are acknowledged.
+// All the messages are returned if it could not be checked whether they were processed.
+func dropProcessedMessages(msgs []*Message, window time.Duration) ([]*Message, error) {
+	if len(msgs) == 0 {
+		return msgs, nil
+	}
+	client := msgs[0].Topic.MQClient
+	for _, m := range msgs {
+		m.processedWindow = window
+	}
+	cmds := make([]*redis.IntCmd, len(msgs))
+	_, err := client.rc.Pipelined(client.c, func(pipe redis.Pipeliner) error {
+		for i, m := range msgs {
+			cmds[i] = pipe.Exists(client.c, getProcessedKey(m))
+		}
+		return nil
+	})
+	if err != nil {
+		return msgs, err
+	}
+	unprocessed := make([]*Message, 0, len(msgs))
+	for i, m := range msgs {
+		if cmds[i].Val() == 0 {
+			unprocessed = append(unprocessed, m)
+			continue
+		}
+		// a processed message that could not be acknowledged is delivered again later and dropped then
+		_, ackErr := client.rc.XAck(client.c, m.Topic.StreamKey, m.ConsumerGroupName, m.Id).Result()
+		if ackErr != nil && err == nil {
+			err = ackErr
+		}
+	}
+	if len(unprocessed) == 0 {
+		return unprocessed, err
+	}
+	markers := make([]*redis.BoolCmd, len(unprocessed))
+	_, markErr := client.rc.Pipelined(client.c, func(pipe redis.Pipeliner) error {
+		for i, m := range unprocessed {
+			markers[i] = pipe.SetNX(client.c, getInProgressKey(m), m.ConsumerName, getInProgressTTL(m))
+		}
+		return nil
+	})
+	if markErr != nil {
+		return unprocessed, markErr
+	}
+	var dead map[string]bool
+	kept := make([]*Message, 0, len(unprocessed))
+	for i, m := range unprocessed {
+		if !markers[i].Val() {
+			if dead == nil {
+				if dead, markErr = getDeadConsumers(client, m.ConsumerGroupName); markErr != nil {
+					return kept, markErr
+				}
+			}
+			// a message being processed by another live consumer stays pending, so that it is delivered
+			// again if that consumer does not acknowledge it
+			taken, takeErr := m.takeOverInProgress(dead)
+			if takeErr != nil && err == nil {
+				err = takeErr
+			}
+			if !taken {
+				continue
+			}
+		}
+		m.inProgress = true
+		kept = append(kept, m)
+	}
+	return kept, err
+}
@@ -0,0 +1,153 @@
+package redimq
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+func TestIdempotentConsumer(t *testing.T) {
+	group := "idempotent-group"
+	s, _ := client.NewTopic(getTestName(t, "idempotent"), nil)
+	defer s.Purge(false)
+	s.PublishMessage(&Message{Data: map[string]interface{}{"foo": "once"}})
+	s.SeekConsumerGroup(group, PositionBeginning)
+	calls := 0
+	c := client.NewConsumer(group, "idempotent-consumer", func(m *Message) {
+		calls++
+		m.Acknowledge()
+	})
+	c.IdempotencyWindow = time.Minute
+	msgs, _ := s.ConsumeMessages(group, c.ConsumerName, 1)
+	c.consumeMessages(msgs)
+	if calls != 1 {
+		t.Fatal("Handler is not called for the message", calls)
+	}
+	if processed, err := msgs[0].IsProcessed(); err != nil || !processed {
+		t.Error("Message is not marked as processed", processed, err)
+	}
+	s.SeekConsumerGroup(group, PositionBeginning)
+	msgs, _ = s.ConsumeMessages(group, c.ConsumerName, 1)
+	if len(msgs) != 1 {
+		t.Fatal("Message is not delivered again", msgs)
+	}
+	c.consumeMessages(msgs)
+	if calls != 1 {
+		t.Error("Handler is called for the processed message", calls)
+	}
+	page, _ := s.Browse(nil)
+	if len(page.Messages) != 1 || len(page.Messages[0].Pending) != 0 {
+		t.Error("Processed message is not acknowledged", page.Messages)
+	}
+}
+
+func TestIdempotentConsumerInProgress(t *testing.T) {
+	group := "idempotent-group"
+	s, _ := client.NewTopic(getTestName(t, "idempotent-in-progress"), nil)
+	s.PublishMessage(&Message{Data: map[string]interface{}{"foo": "once"}})
+	s.SeekConsumerGroup(group, PositionBeginning)
+	slow, _ := s.ConsumeMessages(group, "slow-consumer", 1)
+	slow, _ = dropProcessedMessages(slow, time.Minute)
+	if len(slow) != 1 {
+		t.Fatal("Message is not marked as in progress", slow)
+	}
+	calls := 0
+	c := client.NewConsumer(group, "idempotent-consumer", func(m *Message) {
+		calls++
+		m.Acknowledge()
+	})
+	c.IdempotencyWindow = time.Minute
+	s.SeekConsumerGroup(group, PositionBeginning)
+	msgs, _ := s.ConsumeMessages(group, c.ConsumerName, 1)
+	c.consumeMessages(msgs)
+	if calls != 0 {
+		t.Error("Handler is called for the message in progress", calls)
+	}
+	page, _ := s.Browse(nil)
+	if len(page.Messages) != 1 || len(page.Messages[0].Pending) != 1 {
+		t.Fatal("Message in progress is acknowledged", page.Messages)
+	}
+	if err := slow[0].releaseInProgress(); err != nil {
+		t.Fatal("releaseInProgress failed", err)
+	}
+	s.SeekConsumerGroup(group, PositionBeginning)
+	msgs, _ = s.ConsumeMessages(group, c.ConsumerName, 1)
+	c.consumeMessages(msgs)
+	if calls != 1 {
+		t.Error("Handler is not called for the released message", calls)
+	}
+	if exists, _ := client.rc.Exists(client.c, getInProgressKey(msgs[0])).Result(); exists != 0 {
+		t.Error("In-progress marker is not released", exists)
+	}
+}
+
+func TestIdempotentConsumerInProgressExpiry(t *testing.T) {
+	group := "idempotent-group"
+	idle := "40ms"
+	s, _ := client.NewTopic(getTestName(t, "idempotent-expiry"), &TopicOptions{MaxIdleTimeForMessages: &idle})
+	s.PublishMessage(&Message{Data: map[string]interface{}{"foo": "once"}})
+	s.SeekConsumerGroup(group, PositionBeginning)
+	var ttl time.Duration
+	c := client.NewConsumer(group, "idempotent-consumer", func(m *Message) {
+		// the marker is refreshed while the handler runs longer than the MaxIdleTimeForMessages
+		time.Sleep(100 * time.Millisecond)
+		ttl, _ = client.rc.PTTL(client.c, getInProgressKey(m)).Result()
+		m.Acknowledge()
+	})
+	c.IdempotencyWindow = time.Minute
+	msgs, _ := s.ConsumeMessages(group, c.ConsumerName, 1)
+	c.consumeMessages(msgs)
+	if ttl <= 0 || ttl > 40*time.Millisecond {
+		t.Error("In-progress marker is not bounded by the MaxIdleTimeForMessages or not refreshed", ttl)
+	}
+}
+
+func TestIdempotentConsumerTakeOver(t *testing.T) {
+	group := getTestName(t, "idempotent-takeover-group")
+	s, _ := client.NewTopic(getTestName(t, "idempotent-takeover"), nil)
+	s.PublishMessage(&Message{Data: map[string]interface{}{"foo": "once"}})
+	s.SeekConsumerGroup(group, PositionBeginning)
+	dead, _ := json.Marshal(&ConsumerInfo{Name: "dead-consumer", ConsumerGroupName: group, LastHeartbeat: time.Now().Add(-time.Minute)})
+	client.rc.HSet(client.c, getConsumerRegistryKey(group), "dead-consumer", string(dead))
+	held, _ := s.ConsumeMessages(group, "dead-consumer", 1)
+	client.rc.Set(client.c, getInProgressKey(held[0]), "dead-consumer", time.Minute)
+	calls := 0
+	c := client.NewConsumer(group, "idempotent-consumer", func(m *Message) {
+		calls++
+		m.Acknowledge()
+	})
+	c.IdempotencyWindow = time.Minute
+	s.SeekConsumerGroup(group, PositionBeginning)
+	msgs, _ := s.ConsumeMessages(group, c.ConsumerName, 1)
+	c.consumeMessages(msgs)
+	if calls != 1 {
+		t.Error("In-progress marker of a dead consumer is not taken over", calls)
+	}
+}
+
+func TestIdempotentBatchConsumer(t *testing.T) {
+	group := "idempotent-group"
+	s, _ := client.NewTopic(getTestName(t, "idempotent-batch"), nil)
+	s.PublishMessage(&Message{Data: map[string]interface{}{"foo": "once"}})
+	s.SeekConsumerGroup(group, PositionBeginning)
+	calls := 0
+	c := client.NewConsumer(group, "idempotent-consumer", nil)
+	c.BatchHandler = func(msgs []*Message) {
+		calls++
+		for _, m := range msgs {
+			m.Acknowledge()
+		}
+	}
+	c.IdempotencyWindow = time.Minute
+	msgs, _ := s.ConsumeMessages(group, c.ConsumerName, 1)
+	c.consumeMessagesInBatches([][]*Message{msgs})
+	s.SeekConsumerGroup(group, PositionBeginning)
+	msgs, _ = s.ConsumeMessages(group, c.ConsumerName, 1)
+	c.consumeMessagesInBatches([][]*Message{msgs})
+	if calls != 1 {
+		t.Error("BatchHandler is called for the processed message", calls)
+	}
+	if exists, _ := client.rc.Exists(client.c, getInProgressKey(msgs[0])).Result(); exists != 0 {
+		t.Error("In-progress marker is not released", exists)
+	}
+}
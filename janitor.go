@@ -0,0 +1,311 @@
+package redimq
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// CleanupReport describes what was done by a single cleanup run of a [GroupedMessageTopic]
+type CleanupReport struct {
+	TopicName            string
+	StartedAt            time.Time
+	Duration             time.Duration
+	ExpiredMessageGroups []string
+	RemovedConsumers     []string
+	TrimmedMessages      int64
+	// CollectedBlobs is the number of blobs of the ClaimCheck of the topic removed, see [ClaimCheck]
+	CollectedBlobs int64
+}
+
+// Janitor runs the cleanup of a [GroupedMessageTopic] in the background at a fixed interval. Multiple
+// instances can be started for the same topic, e.g. one per application instance, and only the instance
+// elected as the leader using a [LeaderElection] runs the cleanup. It is created using the NewJanitor
+// function of the GroupedMessageTopic. A [Consumer] starts a Janitor for every GroupedMessageTopic it
+// consumes, so it is only needed by applications that do not use a Consumer.
+//
+//	janitor := gmt.NewJanitor("instance-1", func(r *redimq.CleanupReport, err error) {
+//		fmt.Println("Expired message groups", r.ExpiredMessageGroups, err)
+//	})
+//	janitor.Start()
+//	defer janitor.Stop()
+type Janitor struct {
+	Topic        *GroupedMessageTopic
+	InstanceName string
+	Interval     time.Duration
+	Handler      func(r *CleanupReport, err error)
+	duty         *leaderDuty
+}
+
+// NewJanitor creates a [Janitor] for the GroupedMessageTopic. The instanceName should be unique for every
+// instance of the application. The handler is called with the report of every cleanup run by this instance
+// and can be nil. The Interval defaults to the DefaultJanitorInterval.
+func (t *GroupedMessageTopic) NewJanitor(instanceName string, handler func(r *CleanupReport, err error)) *Janitor {
+	interval, err := time.ParseDuration(DefaultJanitorInterval)
+	if err != nil {
+		interval = time.Minute
+	}
+	return &Janitor{
+		Topic:        t,
+		InstanceName: instanceName,
+		Interval:     interval,
+		Handler:      handler,
+	}
+}
+
+func (t *GroupedMessageTopic) getJanitorLeaderName() string {
+	return "gmts:" + t.Name + ":janitor"
+}
+
+func (j *Janitor) run(token int64) {
+	report, err := j.Topic.cleanup(&fence{name: j.Topic.getJanitorLeaderName(), token: token})
+	if j.Handler != nil {
+		j.Handler(report, err)
+	}
+}
+
+// Start starts campaigning for the leadership of the cleanup of the topic. The cleanup is run immediately
+// on being elected and then at every Interval.
+func (j *Janitor) Start() error {
+	if j.duty != nil {
+		return errors.New("Janitor is already running")
+	}
+	duty := newLeaderDuty(&j.Topic.MQClient, j.Topic.getJanitorLeaderName(), j.InstanceName, j.Interval, j.run)
+	if err := duty.start(); err != nil {
+		return err
+	}
+	j.duty = duty
+	return nil
+}
+
+// Stop stops the background cleanup and gives up the leadership so that another instance can take over
+func (j *Janitor) Stop() {
+	if j.duty != nil {
+		j.duty.close()
+		j.duty = nil
+	}
+}
+
+// Cleanup runs the cleanup of the GroupedMessageTopic once and returns a report of what was done.
+// It does the following:
+//
+//  1. Trims the stale messages of every message group. If the topic has a Retention, messages older than
+//     the Retention are stale, otherwise the messages consumed by all the consumer groups are stale. The
+//     blobs of the trimmed or consumed messages are removed if the topic has a ClaimCheck.
+//  2. Expires the message groups that do not have any messages left.
+//  3. Removes the consumers that are not alive in the consumer registry, have been idle for longer than
+//     MaxIdleTimeForMessages and do not hold any message groups.
+//
+// The cleanup continues on errors and returns the first error encountered. A [Janitor] can be used to
+// run the cleanup in the background.
+func (t *GroupedMessageTopic) Cleanup() (*CleanupReport, error) {
+	return t.cleanup(nil)
+}
+
+// cleanup runs the cleanup with its writes fenced by the fencing token of the leader running it, if any. The
+// cleanup stops with ErrLeadershipLost once another leader is elected.
+func (t *GroupedMessageTopic) cleanup(f *fence) (*CleanupReport, error) {
+	rc := t.MQClient.rc
+	c := t.MQClient.c
+	report := &CleanupReport{
+		TopicName:            t.Name,
+		StartedAt:            time.Now(),
+		ExpiredMessageGroups: []string{},
+		RemovedConsumers:     []string{},
+	}
+	defer func() {
+		report.Duration = time.Since(report.StartedAt)
+	}()
+	cgs, err := rc.XInfoGroups(c, t.MessageGroupStreamKey).Result()
+	if isNoSuchKeyError(err) {
+		return report, nil
+	} else if err != nil {
+		return report, err
+	}
+	var firstErr error
+	// failed records the first error and returns true if the cleanup should stop
+	failed := func(err error) bool {
+		if err != nil && firstErr == nil {
+			firstErr = err
+		}
+		return err == ErrLeadershipLost
+	}
+	// the message groups are read a page at a time so that a large number of message groups is not loaded at once
+	for start := "-"; start != ""; {
+		groups, err := rc.XRangeN(c, t.MessageGroupStreamKey, start, "+", DefaultBrowsePageSize).Result()
+		if err != nil {
+			return report, err
+		}
+		start = ""
+		if int64(len(groups)) == DefaultBrowsePageSize {
+			start = nextStreamId(groups[len(groups)-1].ID)
+		}
+		for _, g := range groups {
+			key, _ := g.Values["key"].(string)
+			trimmed, err := t.trimMessageGroup(key, cgs, f)
+			report.TrimmedMessages += trimmed
+			if failed(err) {
+				return report, firstErr
+			}
+			if t.ClaimCheck != nil {
+				collected, err := collectBlobs(t.MQClient, t.getStreamKeyForGroup(key), t.MessageGroupStreamKey, t.ClaimCheck.Store, f)
+				report.CollectedBlobs += collected
+				if failed(err) {
+					return report, firstErr
+				}
+			}
+			expired, err := t.expireMessageGroup(g.ID, key, cgs, f)
+			if expired {
+				report.ExpiredMessageGroups = append(report.ExpiredMessageGroups, key)
+			}
+			if failed(err) {
+				return report, firstErr
+			}
+		}
+	}
+	for _, cg := range cgs {
+		removed, err := t.removeDeadConsumers(cg.Name, f)
+		report.RemovedConsumers = append(report.RemovedConsumers, removed...)
+		if failed(err) {
+			return report, firstErr
+		}
+	}
+	return report, firstErr
+}
+
+// trimMessageGroup removes the stale messages of the message group and returns the number of messages removed
+func (t *GroupedMessageTopic) trimMessageGroup(groupKey string, cgs []redis.XInfoGroup, f *fence) (int64, error) {
+	rc := t.MQClient.rc
+	c := t.MQClient.c
+	stream := t.getStreamKeyForGroup(groupKey)
+	minId := ""
+	if t.Retention != nil {
+		minId = fmt.Sprint(t.MQClient.now().Add(-*t.Retention).UnixMilli())
+	} else {
+		streamGroups, err := rc.XInfoGroups(c, stream).Result()
+		if isNoSuchKeyError(err) {
+			return 0, nil
+		} else if err != nil {
+			return 0, err
+		}
+		positions := make(map[string]redis.XInfoGroup, len(streamGroups))
+		for _, sg := range streamGroups {
+			positions[sg.Name] = sg
+		}
+		for _, cg := range cgs {
+			sg, ok := positions[cg.Name]
+			if !ok {
+				// the consumer group has not started consuming the message group yet
+				return 0, nil
+			}
+			id := nextStreamId(sg.LastDeliveredID)
+			if sg.Pending > 0 {
+				p, err := rc.XPending(c, stream, cg.Name).Result()
+				if err != nil {
+					return 0, err
+				}
+				id = p.Lower
+			}
+			if minId == "" || compareStreamIds(id, minId) < 0 {
+				minId = id
+			}
+		}
+	}
+	if minId == "" {
+		return 0, nil
+	}
+	var trimmed *redis.IntCmd
+	err := t.MQClient.watchFenced(f, func(tx *redis.Tx) error {
+		_, err := tx.TxPipelined(c, func(pipe redis.Pipeliner) error {
+			trimmed = pipe.XTrimMinID(c, stream, minId)
+			return nil
+		})
+		return err
+	})
+	if err != nil {
+		return 0, err
+	}
+	return trimmed.Val(), nil
+}
+
+// expireMessageGroup removes the message group if it does not have any messages. The stream of the message
+// group is watched so that the message group is not removed if a message is published to it concurrently.
+func (t *GroupedMessageTopic) expireMessageGroup(id string, groupKey string, cgs []redis.XInfoGroup, f *fence) (bool, error) {
+	c := t.MQClient.c
+	stream := t.getStreamKeyForGroup(groupKey)
+	expired := false
+	txf := func(tx *redis.Tx) error {
+		count, err := tx.XLen(c, stream).Result()
+		if err != nil || count > 0 {
+			return err
+		}
+		_, err = tx.TxPipelined(c, func(pipe redis.Pipeliner) error {
+			for _, cg := range cgs {
+				pipe.XAck(c, t.MessageGroupStreamKey, cg.Name, id)
+			}
+			pipe.XDel(c, t.MessageGroupStreamKey, id)
+			pipe.SRem(c, t.MessageGroupSetKey, groupKey)
+			pipe.Del(c, stream)
+			return nil
+		})
+		expired = err == nil
+		return err
+	}
+	err := t.MQClient.watchFenced(f, txf, stream)
+	if err == redis.TxFailedErr {
+		return false, nil
+	}
+	return expired, err
+}
+
+// removeDeadConsumers removes the dead consumers of the consumer group from the MessageGroupStreamKey and
+// the consumer registry, and returns their names. Consumers still holding message groups are left for the
+// new owners of those message groups to claim them first.
+func (t *GroupedMessageTopic) removeDeadConsumers(consumerGroupName string, f *fence) ([]string, error) {
+	rc := t.MQClient.rc
+	c := t.MQClient.c
+	removed := []string{}
+	registered, err := t.MQClient.GetConsumers(consumerGroupName)
+	if err != nil {
+		return removed, err
+	}
+	live := map[string]bool{}
+	for _, info := range registered {
+		if info.IsAlive() {
+			live[info.Name] = true
+		} else if t.MQClient.now().Sub(info.LastHeartbeat) > t.MaxIdleTimeForMessages {
+			err = t.MQClient.watchFenced(f, func(tx *redis.Tx) error {
+				_, err := tx.TxPipelined(c, func(pipe redis.Pipeliner) error {
+					pipe.HDel(c, getConsumerRegistryKey(consumerGroupName), info.Name)
+					return nil
+				})
+				return err
+			})
+			if err != nil {
+				return removed, err
+			}
+		}
+	}
+	consumers, err := rc.XInfoConsumers(c, t.MessageGroupStreamKey, consumerGroupName).Result()
+	if err != nil {
+		return removed, err
+	}
+	for _, ci := range consumers {
+		if ci.Pending == 0 && !live[ci.Name] && ci.Idle > int64(t.MaxIdleTimeForMessages/time.Millisecond) {
+			err = t.MQClient.watchFenced(f, func(tx *redis.Tx) error {
+				_, err := tx.TxPipelined(c, func(pipe redis.Pipeliner) error {
+					pipe.XGroupDelConsumer(c, t.MessageGroupStreamKey, consumerGroupName, ci.Name)
+					return nil
+				})
+				return err
+			})
+			if err != nil {
+				return removed, err
+			}
+			removed = append(removed, ci.Name)
+		}
+	}
+	return removed, nil
+}
@@ -0,0 +1,115 @@
+package redimq
+
+import (
+	"testing"
+	"time"
+)
+
+func TestGMTCleanup(t *testing.T) {
+	group := "janitor-group"
+	g, _ := client.NewGroupedMessageTopic(getTestName(t, "janitor"), nil)
+	client.createGroupAndConsumer(g.MessageGroupStreamKey, group, "janitor-consumer")
+	err := g.PublishMessage("expiring", &Message{Data: map[string]interface{}{"foo": "test"}})
+	if err != nil {
+		t.Fatal("PublishMessage failed", err)
+	}
+	msgs, err := g.ConsumeMessages(group, "janitor-consumer")
+	if err != nil || len(msgs) != 1 {
+		t.Fatal("ConsumeMessages failed", err)
+	}
+	msgs[0].Acknowledge()
+	report, err := g.Cleanup()
+	if err != nil {
+		t.Error("Cleanup returned error", err)
+	}
+	if report.TrimmedMessages != 1 {
+		t.Error("Cleanup trimmed", report.TrimmedMessages, "messages, expected 1")
+	}
+	if len(report.ExpiredMessageGroups) != 1 || report.ExpiredMessageGroups[0] != "expiring" {
+		t.Error("Cleanup did not expire the empty message group")
+	}
+	exists, _ := client.rc.SIsMember(client.c, g.MessageGroupSetKey, "expiring").Result()
+	if exists {
+		t.Error("Expired message group is still registered")
+	}
+}
+
+func TestJanitorStartStop(t *testing.T) {
+	g, _ := client.NewGroupedMessageTopic(getTestName(t, "janitor-start"), nil)
+	reports := make(chan *CleanupReport, 1)
+	janitor := g.NewJanitor("instance-1", func(r *CleanupReport, err error) {
+		if err != nil {
+			t.Error("Cleanup returned error", err)
+		}
+		reports <- r
+	})
+	if err := janitor.Start(); err != nil {
+		t.Fatal("Start returned error", err)
+	}
+	select {
+	case r := <-reports:
+		if r.TopicName != g.Name {
+			t.Error("Cleanup report topic does not match")
+		}
+	case <-time.After(5 * time.Second):
+		t.Error("Janitor did not run the cleanup")
+	}
+	janitor.Stop()
+	leader, _, err := client.GetLeader(g.getJanitorLeaderName())
+	if err != nil || leader != "" {
+		t.Error("Janitor did not give up the leadership", leader, err)
+	}
+}
+
+func TestGMTCleanupFenced(t *testing.T) {
+	group := "janitor-fenced-group"
+	g, _ := client.NewGroupedMessageTopic(getTestName(t, "janitor-fenced"), nil)
+	client.createGroupAndConsumer(g.MessageGroupStreamKey, group, "janitor-fenced-consumer")
+	g.PublishMessage("a", &Message{Data: map[string]interface{}{"foo": "test"}})
+	msgs, _ := g.ConsumeMessages(group, "janitor-fenced-consumer")
+	for _, m := range msgs {
+		m.Acknowledge()
+	}
+	name := g.getJanitorLeaderName()
+	token, err := client.rc.Incr(client.c, getLeaderTokenKey(name)).Result()
+	if err != nil {
+		t.Fatal("Incr failed", err)
+	}
+	report, err := g.cleanup(&fence{name: name, token: token - 1})
+	if err != ErrLeadershipLost || report.TrimmedMessages != 0 {
+		t.Error("Cleanup with a stale fencing token was not rejected", report, err)
+	}
+	report, err = g.cleanup(&fence{name: name, token: token})
+	if err != nil || report.TrimmedMessages != 1 {
+		t.Error("Cleanup with the latest fencing token failed", report, err)
+	}
+}
+
+func TestGMTCleanupInPages(t *testing.T) {
+	group := "janitor-paging-group"
+	consumer := "janitor-paging-consumer"
+	g, _ := client.NewGroupedMessageTopic(getTestName(t, "janitor-paging"), nil)
+	g.InitTopicGroups(group, consumer)
+	for _, k := range []string{"a", "b", "c"} {
+		if err := g.PublishMessage(k, &Message{Data: map[string]interface{}{"foo": k}}); err != nil {
+			t.Fatal("PublishMessage failed", err)
+		}
+	}
+	msgs, err := g.ConsumeMessages(group, consumer)
+	if err != nil || len(msgs) != 3 {
+		t.Fatal("ConsumeMessages failed", len(msgs), err)
+	}
+	for _, m := range msgs {
+		m.Acknowledge()
+	}
+	pageSize := DefaultBrowsePageSize
+	DefaultBrowsePageSize = 1
+	defer func() { DefaultBrowsePageSize = pageSize }()
+	report, err := g.Cleanup()
+	if err != nil {
+		t.Error("Cleanup returned error", err)
+	}
+	if report.TrimmedMessages != 3 || len(report.ExpiredMessageGroups) != 3 {
+		t.Error("Cleanup did not clean up every page of message groups", report.TrimmedMessages, report.ExpiredMessageGroups)
+	}
+}
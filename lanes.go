@@ -0,0 +1,126 @@
+package redimq
+
+import (
+	"fmt"
+	"hash/fnv"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// HeaderGroupKey is the header holding the key of the message group of a message published to a lane of a
+// [GroupedMessageTopic] having Lanes
+const HeaderGroupKey = "redimq-group-key"
+
+// LaneFor returns the lane that the message group is hashed into for a GroupedMessageTopic having Lanes
+func (t *GroupedMessageTopic) LaneFor(groupKey string) int64 {
+	if t.Lanes <= 0 {
+		return 0
+	}
+	h := fnv.New64a()
+	h.Write([]byte(groupKey))
+	return int64(mix64(h.Sum64()) % uint64(t.Lanes))
+}
+
+// getMessageGroupKey returns the key of the message group whose stream holds the messages of the group key,
+// i.e. the key of the lane if the topic has Lanes or else the group key itself
+func (t *GroupedMessageTopic) getMessageGroupKey(groupKey string) string {
+	if t.Lanes <= 0 {
+		return groupKey
+	}
+	return fmt.Sprintf("lane-%d", t.LaneFor(groupKey))
+}
+
+// addGroupKeyHeader adds the group key to the headers of the message for a topic having Lanes, so that the
+// consumers and the browse functions can tell apart the message groups sharing a lane
+func (t *GroupedMessageTopic) addGroupKeyHeader(groupKey string, m *Message) {
+	if t.Lanes <= 0 {
+		return
+	}
+	headers := make(map[string]string, len(m.Headers)+1)
+	for k, v := range m.Headers {
+		headers[k] = v
+	}
+	headers[HeaderGroupKey] = groupKey
+	m.Headers = headers
+}
+
+// setGroupKeys sets the GroupKey of the messages consumed from the stream of the message group
+func setGroupKeys(msgs []*Message, messageGroupKey string) {
+	for _, m := range msgs {
+		if k, ok := m.Headers[HeaderGroupKey]; ok {
+			m.GroupKey = k
+		} else {
+			m.GroupKey = messageGroupKey
+		}
+	}
+}
+
+// purgeLaneGroup removes only the messages of the group key from its lane, leaving the messages of the other
+// message groups sharing the lane intact
+func (t *GroupedMessageTopic) purgeLaneGroup(groupKey string, dryRun bool) (*PurgeReport, error) {
+	report, err := t.deleteLaneGroupMessages(groupKey, "+", dryRun)
+	if report.Messages > 0 {
+		report.MessageGroups = append(report.MessageGroups, groupKey)
+	}
+	return report, err
+}
+
+// trimLaneGroup removes only the messages of the group key upto the position from its lane
+func (t *GroupedMessageTopic) trimLaneGroup(groupKey string, position StreamPosition, dryRun bool) (*PurgeReport, error) {
+	switch position {
+	case PositionBeginning:
+		return &PurgeReport{DryRun: dryRun, MessageGroups: []string{}}, nil
+	case PositionEnd:
+		return t.deleteLaneGroupMessages(groupKey, "+", dryRun)
+	}
+	return t.deleteLaneGroupMessages(groupKey, string(position), dryRun)
+}
+
+// deleteLaneGroupMessages removes the messages of the group key upto the end id from its lane
+func (t *GroupedMessageTopic) deleteLaneGroupMessages(groupKey string, end string, dryRun bool) (*PurgeReport, error) {
+	report := &PurgeReport{DryRun: dryRun, MessageGroups: []string{}}
+	topic := t.getTopicForGroup(t.getMessageGroupKey(groupKey))
+	start := "-"
+	for {
+		res, err := t.MQClient.rc.XRangeN(t.MQClient.c, topic.StreamKey, start, end, 1000).Result()
+		if err != nil {
+			return report, err
+		}
+		for _, xm := range res {
+			if !isLaneMessage(xm, groupKey) {
+				continue
+			}
+			r, err := topic.DeleteMessage(xm.ID, dryRun)
+			report.add(r)
+			if err != nil {
+				return report, err
+			}
+		}
+		if len(res) < 1000 {
+			break
+		}
+		start = nextStreamId(res[len(res)-1].ID)
+	}
+	return report, nil
+}
+
+// laneBrowseOptions returns the browse options filtering the messages of the group key in its lane
+func laneBrowseOptions(groupKey string, options *BrowseOptions) *BrowseOptions {
+	o := BrowseOptions{}
+	if options != nil {
+		o = *options
+	}
+	headers := make(map[string]string, len(o.Headers)+1)
+	for k, v := range o.Headers {
+		headers[k] = v
+	}
+	headers[HeaderGroupKey] = groupKey
+	o.Headers = headers
+	return &o
+}
+
+// isLaneMessage returns true if the stream entry was published to a lane for the group key
+func isLaneMessage(xm redis.XMessage, groupKey string) bool {
+	k, _ := xm.Values[headerFieldPrefix+HeaderGroupKey].(string)
+	return k == groupKey
+}
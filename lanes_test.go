@@ -0,0 +1,104 @@
+package redimq
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestGMTLanes(t *testing.T) {
+	group := "lanes-group"
+	lanes := int64(2)
+	g, err := client.NewGroupedMessageTopic(getTestName(t, "lanes"), &TopicOptions{Lanes: &lanes})
+	if err != nil {
+		t.Fatal("NewGroupedMessageTopic failed", err)
+	}
+	g.InitTopicGroups(group, "lanes-consumer")
+	keys := []string{}
+	for i := 0; i < 10; i++ {
+		key := fmt.Sprintf("tenant-%d", i)
+		keys = append(keys, key)
+		if err := g.PublishMessage(key, &Message{Data: map[string]interface{}{"seq": "1"}}); err != nil {
+			t.Fatal("PublishMessage failed", err)
+		}
+		if err := g.PublishMessage(key, &Message{Data: map[string]interface{}{"seq": "2"}}); err != nil {
+			t.Fatal("PublishMessage failed", err)
+		}
+	}
+	if n, _ := client.rc.SCard(client.c, g.MessageGroupSetKey).Result(); n > lanes {
+		t.Error("Message groups are not bounded by the lanes", n)
+	}
+	page, err := g.BrowseGroup(keys[0], nil)
+	if err != nil || len(page.Messages) != 2 {
+		t.Fatal("BrowseGroup did not filter the messages of the group key", page, err)
+	}
+	if page.Messages[0].GroupKey != keys[0] || page.Messages[0].Data["seq"] != "1" {
+		t.Error("BrowseGroup message is not valid", page.Messages[0])
+	}
+	msgs, err := g.ConsumeMessages(group, "lanes-consumer")
+	if err != nil || len(msgs) == 0 {
+		t.Fatal("ConsumeMessages failed", msgs, err)
+	}
+	seen := map[string]bool{}
+	for _, m := range msgs {
+		if m.GroupKey == "" || m.Headers[HeaderGroupKey] != m.GroupKey {
+			t.Error("ConsumeMessages did not set the GroupKey", m)
+		}
+		if m.Data["seq"] == "2" && !seen[m.GroupKey] {
+			t.Error("ConsumeMessages did not keep the order of the group key", m)
+		}
+		seen[m.GroupKey] = true
+	}
+	report, err := g.PurgeGroup(keys[0], false)
+	if err != nil || report.Messages != 2 {
+		t.Error("PurgeGroup report is not valid", report, err)
+	}
+	page, _ = g.BrowseGroup(keys[0], nil)
+	if len(page.Messages) != 0 {
+		t.Error("PurgeGroup did not remove the messages of the group key")
+	}
+	lane := g.getTopicForGroup(g.getMessageGroupKey(keys[1]))
+	if n, _ := client.rc.XLen(client.c, lane.StreamKey).Result(); n == 0 {
+		t.Error("PurgeGroup removed the messages of the other group keys")
+	}
+	g.Purge(false)
+}
+
+func TestGMTLanesTrimGroupBefore(t *testing.T) {
+	name := getTestName(t, "lanes-trim")
+	lanes := int64(1)
+	g, _ := client.NewGroupedMessageTopic(name, &TopicOptions{Lanes: &lanes})
+	for _, key := range []string{"tenant-a", "tenant-b", "tenant-a"} {
+		g.PublishMessage(key, &Message{Data: map[string]interface{}{"foo": "test"}})
+	}
+	page, _ := g.BrowseGroup("tenant-a", nil)
+	report, err := g.TrimGroupBefore("tenant-a", PositionAtId(page.Messages[1].Id), false)
+	if err != nil || report.Messages != 1 {
+		t.Error("TrimGroupBefore report is not valid", report, err)
+	}
+	if page, _ = g.BrowseGroup("tenant-b", nil); len(page.Messages) != 1 {
+		t.Error("TrimGroupBefore removed the messages of the other group keys in the lane")
+	}
+	if page, _ = g.BrowseGroup("tenant-a", nil); len(page.Messages) != 1 {
+		t.Error("TrimGroupBefore did not keep the messages of the group key after the position")
+	}
+}
+
+func TestGMTLanesPersisted(t *testing.T) {
+	name := getTestName(t, "lanes-persisted")
+	lanes := int64(4)
+	if _, err := client.NewGroupedMessageTopic(name, &TopicOptions{Lanes: &lanes}); err != nil {
+		t.Fatal("NewGroupedMessageTopic failed", err)
+	}
+	g, err := client.NewGroupedMessageTopic(name, nil)
+	if err != nil || g.Lanes != lanes {
+		t.Error("NewGroupedMessageTopic did not load the persisted Lanes", err)
+	}
+	other := int64(2)
+	if _, err := client.NewGroupedMessageTopic(name, &TopicOptions{Lanes: &other}); err == nil {
+		t.Error("NewGroupedMessageTopic did not fail for different Lanes")
+	}
+	negative := int64(-1)
+	if _, err := client.NewGroupedMessageTopic(getTestName(t, "lanes-negative"), &TopicOptions{Lanes: &negative}); err == nil {
+		t.Error("NewGroupedMessageTopic did not fail for negative Lanes")
+	}
+}
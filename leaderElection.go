@@ -0,0 +1,352 @@
+package redimq
+
+import (
+	"errors"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// LeaderElection is used to elect a single instance, out of all the application instances, as the leader
+// for running a task, e.g. the cleanup of a topic. It is created using the NewLeaderElection function of
+// the MQClient. The leader holds a lease in REDIS which it renews periodically. If the leader stops or is
+// unable to renew the lease, another instance is elected once the lease expires.
+//
+// Every time an instance is elected, it receives a fencing token which is greater than the tokens of all
+// the previous leaders. The leader can do its writes using [MQClient.WatchAsLeader] with the token, so that
+// the writes of a previous leader that has not yet noticed the loss of its lease are rejected.
+//
+//	election := client.NewLeaderElection("reports", "instance-1", func(token int64) {
+//		fmt.Println("Elected as leader with token", token)
+//	}, func() {
+//		fmt.Println("No longer the leader")
+//	})
+//	election.Start()
+//	defer election.Stop()
+type LeaderElection struct {
+	Name          string
+	InstanceName  string
+	LeaseDuration time.Duration
+	RenewInterval time.Duration
+	OnElected     func(token int64)
+	OnRevoked     func()
+	client        *MQClient
+	token         int64
+	renewedAt     time.Time
+	stop          chan bool
+	done          chan bool
+	mu            sync.Mutex
+}
+
+// NewLeaderElection creates a [LeaderElection] for the name. The instanceName should be unique for every
+// instance of the application. The onElected function is called when this instance is elected as the
+// leader and the onRevoked function when it stops being the leader. Both the functions can be nil. The
+// LeaseDuration defaults to the DefaultLeaderLeaseDuration and the lease is renewed every one third of it.
+func (c *MQClient) NewLeaderElection(name string, instanceName string, onElected func(token int64), onRevoked func()) *LeaderElection {
+	lease, err := time.ParseDuration(DefaultLeaderLeaseDuration)
+	if err != nil {
+		lease = 15 * time.Second
+	}
+	return &LeaderElection{
+		Name:          name,
+		InstanceName:  instanceName,
+		LeaseDuration: lease,
+		RenewInterval: lease / 3,
+		OnElected:     onElected,
+		OnRevoked:     onRevoked,
+		client:        c,
+	}
+}
+
+func getLeaderKey(name string) string {
+	return "redimq:leader:" + name
+}
+
+func getLeaderTokenKey(name string) string {
+	return "redimq:leader:" + name + ":token"
+}
+
+// ErrLeadershipLost is returned for the writes of a leader after another leader has been elected
+var ErrLeadershipLost = errors.New("Leadership is lost to a newer leader")
+
+// fence is the fencing token received by a leader for the name
+type fence struct {
+	name  string
+	token int64
+}
+
+// watchFenced runs the transaction function using Watch after checking that the fencing token is still the
+// latest one. The token key is watched along with the keys, so the transaction fails if another leader is
+// elected before it is executed. The function is run without the check if the fence is nil.
+func (c *MQClient) watchFenced(f *fence, fn func(tx *redis.Tx) error, keys ...string) error {
+	if f == nil {
+		return c.rc.Watch(c.c, fn, keys...)
+	}
+	txf := func(tx *redis.Tx) error {
+		token, err := tx.Get(c.c, getLeaderTokenKey(f.name)).Int64()
+		if err != nil && err != redis.Nil {
+			return err
+		}
+		if token != f.token {
+			return ErrLeadershipLost
+		}
+		return fn(tx)
+	}
+	return c.rc.Watch(c.c, txf, append(keys, getLeaderTokenKey(f.name))...)
+}
+
+// WatchAsLeader runs the transaction function like the Watch function of the go-redis client, for the
+// writes of the leader elected for the name with the fencing token. It returns ErrLeadershipLost without
+// running the function if another leader has been elected since, and the transaction fails with
+// redis.TxFailedErr if another leader is elected before it is executed.
+func (c *MQClient) WatchAsLeader(name string, token int64, fn func(tx *redis.Tx) error, keys ...string) error {
+	return c.watchFenced(&fence{name: name, token: token}, fn, keys...)
+}
+
+// GetLeader returns the instance name and the fencing token of the current leader for the name. An
+// empty instance name is returned if there is no leader.
+func (c *MQClient) GetLeader(name string) (string, int64, error) {
+	res, err := c.rc.MGet(c.c, getLeaderKey(name), getLeaderTokenKey(name)).Result()
+	if err != nil || res[0] == nil {
+		return "", 0, err
+	}
+	instance, _ := res[0].(string)
+	token := int64(0)
+	if s, ok := res[1].(string); ok {
+		token, _ = strconv.ParseInt(s, 10, 64)
+	}
+	return instance, token, nil
+}
+
+// IsLeader returns true if this instance is currently the leader
+func (e *LeaderElection) IsLeader() bool {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.token > 0
+}
+
+// FencingToken returns the fencing token received when this instance was elected, or 0 if this instance
+// is not the leader
+func (e *LeaderElection) FencingToken() int64 {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.token
+}
+
+// acquire tries to obtain the lease and returns the fencing token if successful
+func (e *LeaderElection) acquire() (int64, error) {
+	c := e.client.c
+	key := getLeaderKey(e.Name)
+	var token int64
+	txf := func(tx *redis.Tx) error {
+		n, err := tx.Exists(c, key).Result()
+		if err != nil || n > 0 {
+			return err
+		}
+		cmds, err := tx.TxPipelined(c, func(pipe redis.Pipeliner) error {
+			pipe.Incr(c, getLeaderTokenKey(e.Name))
+			pipe.Set(c, key, e.InstanceName, e.LeaseDuration)
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		token = cmds[0].(*redis.IntCmd).Val()
+		return nil
+	}
+	err := e.client.rc.Watch(c, txf, key)
+	if err == redis.TxFailedErr {
+		return 0, nil
+	}
+	return token, err
+}
+
+// renew extends the lease and returns false if the lease is held by another instance
+func (e *LeaderElection) renew() (bool, error) {
+	c := e.client.c
+	key := getLeaderKey(e.Name)
+	renewed := false
+	txf := func(tx *redis.Tx) error {
+		owner, err := tx.Get(c, key).Result()
+		if err == redis.Nil || owner != e.InstanceName {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		_, err = tx.TxPipelined(c, func(pipe redis.Pipeliner) error {
+			pipe.PExpire(c, key, e.LeaseDuration)
+			return nil
+		})
+		renewed = err == nil
+		return err
+	}
+	err := e.client.rc.Watch(c, txf, key)
+	if err == redis.TxFailedErr {
+		return false, nil
+	}
+	return renewed, err
+}
+
+// release gives up the lease if it is held by this instance
+func (e *LeaderElection) release() error {
+	c := e.client.c
+	key := getLeaderKey(e.Name)
+	txf := func(tx *redis.Tx) error {
+		owner, err := tx.Get(c, key).Result()
+		if err == redis.Nil || owner != e.InstanceName {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		_, err = tx.TxPipelined(c, func(pipe redis.Pipeliner) error {
+			pipe.Del(c, key)
+			return nil
+		})
+		return err
+	}
+	return e.client.rc.Watch(c, txf, key)
+}
+
+// campaign acquires or renews the lease and calls the OnElected or OnRevoked functions on a change
+func (e *LeaderElection) campaign() {
+	e.mu.Lock()
+	leader := e.token > 0
+	e.mu.Unlock()
+	if !leader {
+		token, err := e.acquire()
+		if err != nil || token == 0 {
+			return
+		}
+		e.mu.Lock()
+		e.token = token
+		e.renewedAt = e.client.now()
+		e.mu.Unlock()
+		if e.OnElected != nil {
+			e.OnElected(token)
+		}
+		return
+	}
+	renewed, err := e.renew()
+	e.mu.Lock()
+	if renewed {
+		e.renewedAt = e.client.now()
+	}
+	// on errors, the leadership is kept till the lease would have expired in REDIS
+	revoked := (err == nil && !renewed) || e.client.now().Sub(e.renewedAt) >= e.LeaseDuration
+	if revoked {
+		e.token = 0
+	}
+	e.mu.Unlock()
+	if revoked && e.OnRevoked != nil {
+		e.OnRevoked()
+	}
+}
+
+// Start starts campaigning for the leadership in the background
+func (e *LeaderElection) Start() error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.stop != nil {
+		return errors.New("LeaderElection is already running")
+	}
+	if e.RenewInterval <= 0 || e.RenewInterval >= e.LeaseDuration {
+		return errors.New("LeaderElection RenewInterval should be greater than 0 and less than the LeaseDuration")
+	}
+	e.stop = make(chan bool)
+	e.done = make(chan bool)
+	go func(stop chan bool, done chan bool) {
+		defer close(done)
+		ticker := time.NewTicker(e.RenewInterval)
+		defer ticker.Stop()
+		e.campaign()
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+				e.campaign()
+			}
+		}
+	}(e.stop, e.done)
+	return nil
+}
+
+// Stop stops campaigning for the leadership. If this instance is the leader, the lease is released so that
+// another instance can be elected immediately and the OnRevoked function is called.
+func (e *LeaderElection) Stop() {
+	e.mu.Lock()
+	stop, done := e.stop, e.done
+	e.stop, e.done = nil, nil
+	e.mu.Unlock()
+	if stop == nil {
+		return
+	}
+	close(stop)
+	<-done
+	e.mu.Lock()
+	leader := e.token > 0
+	e.token = 0
+	e.mu.Unlock()
+	if leader {
+		e.release()
+		if e.OnRevoked != nil {
+			e.OnRevoked()
+		}
+	}
+}
+
+// leaderDuty runs a task at a fixed interval while the instance is the leader for the task
+type leaderDuty struct {
+	election *LeaderElection
+	interval time.Duration
+	run      func(token int64)
+	stop     chan bool
+	mu       sync.Mutex
+}
+
+func newLeaderDuty(client *MQClient, name string, instanceName string, interval time.Duration, run func(token int64)) *leaderDuty {
+	d := &leaderDuty{interval: interval, run: run}
+	d.election = client.NewLeaderElection(name, instanceName, d.elected, d.revoked)
+	return d
+}
+
+func (d *leaderDuty) elected(token int64) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.stop = make(chan bool)
+	go func(stop chan bool) {
+		ticker := time.NewTicker(d.interval)
+		defer ticker.Stop()
+		d.run(token)
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+				d.run(token)
+			}
+		}
+	}(d.stop)
+}
+
+func (d *leaderDuty) revoked() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.stop != nil {
+		close(d.stop)
+		d.stop = nil
+	}
+}
+
+func (d *leaderDuty) start() error {
+	if d.interval <= 0 {
+		return errors.New("Interval should be greater than 0")
+	}
+	return d.election.Start()
+}
+
+func (d *leaderDuty) close() {
+	d.election.Stop()
+}
@@ -0,0 +1,69 @@
+package redimq
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestLeaderElection(t *testing.T) {
+	elected := make(chan int64, 2)
+	first := client.NewLeaderElection("test-election", "instance-1", func(token int64) { elected <- token }, nil)
+	second := client.NewLeaderElection("test-election", "instance-2", func(token int64) { elected <- token }, nil)
+	if err := first.Start(); err != nil {
+		t.Fatal("Start returned error", err)
+	}
+	var token int64
+	select {
+	case token = <-elected:
+	case <-time.After(5 * time.Second):
+		t.Fatal("First instance was not elected")
+	}
+	second.Start()
+	if second.IsLeader() {
+		t.Error("Second instance elected while the first holds the lease")
+	}
+	leader, current, err := client.GetLeader("test-election")
+	if err != nil || leader != "instance-1" || current != token {
+		t.Error("GetLeader does not match the elected instance", leader, current, err)
+	}
+	first.Stop()
+	if first.IsLeader() {
+		t.Error("First instance is still the leader after stopping")
+	}
+	second.RenewInterval = 10 * time.Millisecond
+	second.Stop()
+	second.Start()
+	select {
+	case next := <-elected:
+		if next <= token {
+			t.Error("Fencing token", next, "is not greater than", token)
+		}
+	case <-time.After(5 * time.Second):
+		t.Error("Second instance was not elected after the first stopped")
+	}
+	second.Stop()
+}
+
+func TestLeaderElectionLeaseClock(t *testing.T) {
+	backend := NewMemoryBackend()
+	now := time.Now()
+	backend.SetClock(func() time.Time { return now })
+	c, _ := NewMQClientWithBackend(context.TODO(), backend)
+	e := c.NewLeaderElection("test-election", "instance-1", nil, nil)
+	e.campaign()
+	if !e.IsLeader() {
+		t.Fatal("Instance was not elected")
+	}
+	// the leadership is kept on the errors till the lease expires as per the clock of the client
+	backend.Close()
+	e.campaign()
+	if !e.IsLeader() {
+		t.Error("Leadership is lost before the lease expired")
+	}
+	now = now.Add(e.LeaseDuration)
+	e.campaign()
+	if e.IsLeader() {
+		t.Error("Leadership is kept after the lease expired")
+	}
+}
@@ -0,0 +1,1035 @@
+package redimq
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// MemoryBackend is a [Backend] storing the topics in memory instead of REDIS. It runs the REDIS commands
+// used by RediMQ, including the streams with their consumer groups, pending entries and claims, the
+// transactions and the expiry of the keys, with the same semantics as REDIS. It can be used for unit
+// testing the message handlers deterministically without a REDIS server, or for running RediMQ embedded
+// in a single process tool. The topics are lost when the process exits.
+//
+//	backend := redimq.NewMemoryBackend()
+//	defer backend.Close()
+//	client, err := redimq.NewMQClientWithBackend(context.TODO(), backend)
+//
+// The MemoryBackend is a [redis.Client] connected to an in-process server, so the commands not used by
+// RediMQ are not supported and return an error.
+type MemoryBackend struct {
+	*redis.Client
+	server *memoryServer
+}
+
+// NewMemoryBackend creates an empty [MemoryBackend]
+func NewMemoryBackend() *MemoryBackend {
+	s := newMemoryServer()
+	rc := redis.NewClient(&redis.Options{
+		Addr: "redimq-memory",
+		Dialer: func(ctx context.Context, network string, addr string) (net.Conn, error) {
+			return s.connect()
+		},
+	})
+	return &MemoryBackend{Client: rc, server: s}
+}
+
+// SetClock replaces the clock of the MemoryBackend, which defaults to time.Now. The clock is used for the
+// ids of the stream entries, the idle times of the pending entries and the expiry of the keys, and by the
+// MQClient using the backend, so that a test can move the time forward instead of waiting.
+//
+//	now := time.Now()
+//	backend.SetClock(func() time.Time { return now })
+func (b *MemoryBackend) SetClock(now func() time.Time) {
+	b.server.mu.Lock()
+	defer b.server.mu.Unlock()
+	b.server.now = now
+	// wake up the blocked reads, the keys they are waiting on may have expired
+	close(b.server.changed)
+	b.server.changed = make(chan struct{})
+}
+
+// Now returns the current time of the clock of the MemoryBackend
+func (b *MemoryBackend) Now() time.Time {
+	b.server.mu.Lock()
+	defer b.server.mu.Unlock()
+	return b.server.now()
+}
+
+// Close closes the client and removes all the keys of the MemoryBackend
+func (b *MemoryBackend) Close() error {
+	err := b.Client.Close()
+	b.server.close()
+	return err
+}
+
+var (
+	errMemoryServerClosed = errors.New("redimq: memory backend is closed")
+	errWrongType          = respError("WRONGTYPE Operation against a key holding the wrong kind of value")
+	errSyntax             = respError("ERR syntax error")
+	errNotInteger         = respError("ERR value is not an integer or out of range")
+)
+
+// respStatus, respError and respNilArray are the replies of the memory server other than the integers, the
+// bulk strings (a nil string is a nil bulk string) and the arrays
+type respStatus string
+type respError string
+type respNilArray struct{}
+
+var respOK = respStatus("OK")
+
+// memoryKey is a key of the memory server. The value is a string, a hash (map[string]string), a set
+// (map[string]bool) or a stream (*memoryStream).
+type memoryKey struct {
+	value     interface{}
+	expiresAt time.Time
+}
+
+// memoryServer runs the commands sent by the clients of a MemoryBackend against the keys held in memory.
+// All the commands are run holding the lock, so they are atomic like in REDIS.
+type memoryServer struct {
+	mu   sync.Mutex
+	keys map[string]*memoryKey
+	// versions are incremented whenever a key is modified, for the keys watched by the transactions
+	versions map[string]uint64
+	// changed is closed and replaced whenever a key is modified, waking up the blocked reads
+	changed chan struct{}
+	closed  chan struct{}
+	now     func() time.Time
+}
+
+func newMemoryServer() *memoryServer {
+	return &memoryServer{
+		keys:     map[string]*memoryKey{},
+		versions: map[string]uint64{},
+		changed:  make(chan struct{}),
+		closed:   make(chan struct{}),
+		now:      time.Now,
+	}
+}
+
+func (s *memoryServer) close() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	select {
+	case <-s.closed:
+	default:
+		close(s.closed)
+		s.keys = map[string]*memoryKey{}
+	}
+}
+
+// connect returns the client end of a new connection served by the server
+func (s *memoryServer) connect() (net.Conn, error) {
+	select {
+	case <-s.closed:
+		return nil, errMemoryServerClosed
+	default:
+	}
+	client, server := net.Pipe()
+	cn := &memoryConn{done: make(chan struct{}), ready: make(chan struct{}, 1)}
+	go cn.readCommands(server)
+	go s.serve(cn, server)
+	return client, nil
+}
+
+// memoryConn is a connection to the memory server along with its transaction state
+type memoryConn struct {
+	mu       sync.Mutex
+	commands [][]string
+	ready    chan struct{}
+	done     chan struct{}
+	watched  map[string]uint64
+	multi    bool
+	queued   [][]string
+	queueErr bool
+}
+
+// readCommands reads the commands sent on the connection into the queue of the connection. The commands
+// are read independently of running them, as the pipe does not buffer the commands of a pipeline while the
+// replies are written.
+func (cn *memoryConn) readCommands(conn net.Conn) {
+	defer close(cn.done)
+	r := bufio.NewReader(conn)
+	for {
+		args, err := readRespCommand(r)
+		if err != nil {
+			conn.Close()
+			return
+		}
+		cn.mu.Lock()
+		cn.commands = append(cn.commands, args)
+		cn.mu.Unlock()
+		select {
+		case cn.ready <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// nextCommand returns the next command sent on the connection, or nil if the connection is closed
+func (cn *memoryConn) nextCommand() []string {
+	for {
+		cn.mu.Lock()
+		if len(cn.commands) > 0 {
+			args := cn.commands[0]
+			cn.commands = cn.commands[1:]
+			cn.mu.Unlock()
+			return args
+		}
+		cn.mu.Unlock()
+		select {
+		case <-cn.ready:
+		case <-cn.done:
+			cn.mu.Lock()
+			pending := len(cn.commands)
+			cn.mu.Unlock()
+			if pending == 0 {
+				return nil
+			}
+		}
+	}
+}
+
+func (s *memoryServer) serve(cn *memoryConn, conn net.Conn) {
+	defer conn.Close()
+	w := bufio.NewWriter(conn)
+	for {
+		args := cn.nextCommand()
+		if args == nil {
+			return
+		}
+		writeRespReply(w, s.execute(cn, args))
+		cn.mu.Lock()
+		pending := len(cn.commands)
+		cn.mu.Unlock()
+		if pending == 0 && w.Flush() != nil {
+			return
+		}
+	}
+}
+
+func readRespCommand(r *bufio.Reader) ([]string, error) {
+	line, err := readRespLine(r)
+	if err != nil {
+		return nil, err
+	}
+	if len(line) == 0 || line[0] != '*' {
+		return strings.Fields(line), nil
+	}
+	n, err := strconv.Atoi(line[1:])
+	if err != nil {
+		return nil, err
+	}
+	args := make([]string, n)
+	for i := range args {
+		line, err := readRespLine(r)
+		if err != nil {
+			return nil, err
+		}
+		if len(line) == 0 || line[0] != '$' {
+			return nil, errors.New("redimq: invalid command from the client")
+		}
+		size, err := strconv.Atoi(line[1:])
+		if err != nil {
+			return nil, err
+		}
+		b := make([]byte, size+2)
+		if _, err := io.ReadFull(r, b); err != nil {
+			return nil, err
+		}
+		args[i] = string(b[:size])
+	}
+	return args, nil
+}
+
+func readRespLine(r *bufio.Reader) (string, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimRight(line, "\r\n"), nil
+}
+
+func writeRespReply(w *bufio.Writer, reply interface{}) {
+	switch v := reply.(type) {
+	case nil:
+		w.WriteString("$-1\r\n")
+	case respStatus:
+		w.WriteString("+" + string(v) + "\r\n")
+	case respError:
+		w.WriteString("-" + string(v) + "\r\n")
+	case respNilArray:
+		w.WriteString("*-1\r\n")
+	case int64:
+		w.WriteString(":" + strconv.FormatInt(v, 10) + "\r\n")
+	case int:
+		w.WriteString(":" + strconv.Itoa(v) + "\r\n")
+	case bool:
+		if v {
+			w.WriteString(":1\r\n")
+		} else {
+			w.WriteString(":0\r\n")
+		}
+	case string:
+		w.WriteString("$" + strconv.Itoa(len(v)) + "\r\n" + v + "\r\n")
+	case []string:
+		w.WriteString("*" + strconv.Itoa(len(v)) + "\r\n")
+		for _, s := range v {
+			writeRespReply(w, s)
+		}
+	case []interface{}:
+		w.WriteString("*" + strconv.Itoa(len(v)) + "\r\n")
+		for _, r := range v {
+			writeRespReply(w, r)
+		}
+	default:
+		writeRespReply(w, respError(fmt.Sprintf("ERR unsupported reply %T", reply)))
+	}
+}
+
+// memoryCommand is a command of the memory server. A negative arity is the minimum number of arguments.
+type memoryCommand struct {
+	arity int
+	run   func(s *memoryServer, cn *memoryConn, args []string) interface{}
+}
+
+// memoryBlock is returned by the blocking commands when they have nothing to reply yet. The command is run
+// again with the args whenever a key is modified till the timeout, after which a nil array is replied. A
+// zero timeout blocks indefinitely.
+type memoryBlock struct {
+	timeout time.Duration
+	args    []string
+}
+
+var memoryCommands map[string]*memoryCommand
+
+func init() {
+	memoryCommands = map[string]*memoryCommand{
+		"ping":      {arity: -1, run: memoryPing},
+		"echo":      {arity: 2, run: func(s *memoryServer, cn *memoryConn, args []string) interface{} { return args[1] }},
+		"select":    {arity: 2, run: memorySelect},
+		"flushdb":   {arity: -1, run: memoryFlush},
+		"flushall":  {arity: -1, run: memoryFlush},
+		"del":       {arity: -2, run: memoryDel},
+		"unlink":    {arity: -2, run: memoryDel},
+		"exists":    {arity: -2, run: memoryExists},
+		"expire":    {arity: 3, run: memoryExpire},
+		"pexpire":   {arity: 3, run: memoryExpire},
+		"ttl":       {arity: 2, run: memoryTTL},
+		"pttl":      {arity: 2, run: memoryTTL},
+		"type":      {arity: 2, run: memoryType},
+		"keys":      {arity: 2, run: memoryKeys},
+		"get":       {arity: 2, run: memoryGet},
+		"set":       {arity: -3, run: memorySet},
+		"setnx":     {arity: 3, run: memorySetNX},
+		"mget":      {arity: -2, run: memoryMGet},
+		"incr":      {arity: 2, run: memoryIncr},
+		"incrby":    {arity: 3, run: memoryIncr},
+		"hset":      {arity: -4, run: memoryHSet},
+		"hsetnx":    {arity: 4, run: memoryHSetNX},
+		"hget":      {arity: 3, run: memoryHGet},
+		"hgetall":   {arity: 2, run: memoryHGetAll},
+		"hdel":      {arity: -3, run: memoryHDel},
+		"hlen":      {arity: 2, run: memoryHLen},
+		"sadd":      {arity: -3, run: memorySAdd},
+		"srem":      {arity: -3, run: memorySRem},
+		"scard":     {arity: 2, run: memorySCard},
+		"sismember": {arity: 3, run: memorySIsMember},
+		"smembers":  {arity: 2, run: memorySMembers},
+		"sscan":     {arity: -3, run: memorySScan},
+		"watch":     {arity: -2, run: memoryWatch},
+		"unwatch":   {arity: 1, run: memoryUnwatch},
+		"multi":     {arity: 1, run: memoryMulti},
+		"exec":      {arity: 1},
+		"discard":   {arity: 1, run: memoryDiscard},
+	}
+	for name, cmd := range memoryStreamCommands {
+		memoryCommands[name] = cmd
+	}
+}
+
+// execute runs the command for the connection, or queues it if the connection is in a transaction
+func (s *memoryServer) execute(cn *memoryConn, args []string) interface{} {
+	if len(args) == 0 {
+		return respError("ERR empty command")
+	}
+	name := strings.ToLower(args[0])
+	cmd, ok := memoryCommands[name]
+	if !ok {
+		cn.queueErr = cn.multi
+		return respError("ERR unknown command '" + args[0] + "'")
+	}
+	if (cmd.arity > 0 && len(args) != cmd.arity) || (cmd.arity < 0 && len(args) < -cmd.arity) {
+		cn.queueErr = cn.multi
+		return respError("ERR wrong number of arguments for '" + name + "' command")
+	}
+	if name == "exec" {
+		return s.exec(cn)
+	}
+	if cn.multi && name != "multi" && name != "discard" && name != "watch" {
+		cn.queued = append(cn.queued, args)
+		return respStatus("QUEUED")
+	}
+	var timeout <-chan time.Time
+	for {
+		s.mu.Lock()
+		reply := cmd.run(s, cn, args)
+		changed := s.changed
+		s.mu.Unlock()
+		block, ok := reply.(memoryBlock)
+		if !ok {
+			return reply
+		}
+		args = block.args
+		if timeout == nil && block.timeout > 0 {
+			timer := time.NewTimer(block.timeout)
+			defer timer.Stop()
+			timeout = timer.C
+		}
+		select {
+		case <-changed:
+		case <-timeout:
+			return respNilArray{}
+		case <-cn.done:
+			return respNilArray{}
+		case <-s.closed:
+			return respError("ERR the memory backend is closed")
+		}
+	}
+}
+
+// exec runs the queued commands of the transaction atomically, unless a watched key has been modified
+func (s *memoryServer) exec(cn *memoryConn) interface{} {
+	if !cn.multi {
+		return respError("ERR EXEC without MULTI")
+	}
+	queued, queueErr, watched := cn.queued, cn.queueErr, cn.watched
+	cn.multi, cn.queued, cn.queueErr, cn.watched = false, nil, false, nil
+	if queueErr {
+		return respError("EXECABORT Transaction discarded because of previous errors.")
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for key, version := range watched {
+		s.expire(key)
+		if s.versions[key] != version {
+			return respNilArray{}
+		}
+	}
+	replies := make([]interface{}, len(queued))
+	for i, args := range queued {
+		replies[i] = memoryCommands[strings.ToLower(args[0])].run(s, cn, args)
+		if _, ok := replies[i].(memoryBlock); ok {
+			// the blocking commands do not block in a transaction
+			replies[i] = respNilArray{}
+		}
+	}
+	return replies
+}
+
+// modified records that the key has been modified for the transactions watching it and wakes up the
+// blocked reads
+func (s *memoryServer) modified(key string) {
+	s.versions[key]++
+	close(s.changed)
+	s.changed = make(chan struct{})
+}
+
+// expire removes the key if it has expired
+func (s *memoryServer) expire(key string) {
+	k, ok := s.keys[key]
+	if ok && !k.expiresAt.IsZero() && !s.now().Before(k.expiresAt) {
+		delete(s.keys, key)
+		s.modified(key)
+	}
+}
+
+func (s *memoryServer) lookup(key string) *memoryKey {
+	s.expire(key)
+	return s.keys[key]
+}
+
+func (s *memoryServer) delete(key string) bool {
+	if s.lookup(key) == nil {
+		return false
+	}
+	delete(s.keys, key)
+	s.modified(key)
+	return true
+}
+
+// deleteIfEmpty removes the hash or the set if it has no more members, like REDIS does
+func (s *memoryServer) deleteIfEmpty(key string, size int) {
+	if size == 0 {
+		delete(s.keys, key)
+	}
+}
+
+func (s *memoryServer) getString(key string) (string, bool, interface{}) {
+	k := s.lookup(key)
+	if k == nil {
+		return "", false, nil
+	}
+	v, ok := k.value.(string)
+	if !ok {
+		return "", false, errWrongType
+	}
+	return v, true, nil
+}
+
+func (s *memoryServer) getHash(key string, create bool) (map[string]string, interface{}) {
+	k := s.lookup(key)
+	if k == nil {
+		if !create {
+			return nil, nil
+		}
+		k = &memoryKey{value: map[string]string{}}
+		s.keys[key] = k
+	}
+	h, ok := k.value.(map[string]string)
+	if !ok {
+		return nil, errWrongType
+	}
+	return h, nil
+}
+
+func (s *memoryServer) getSet(key string, create bool) (map[string]bool, interface{}) {
+	k := s.lookup(key)
+	if k == nil {
+		if !create {
+			return nil, nil
+		}
+		k = &memoryKey{value: map[string]bool{}}
+		s.keys[key] = k
+	}
+	set, ok := k.value.(map[string]bool)
+	if !ok {
+		return nil, errWrongType
+	}
+	return set, nil
+}
+
+func memoryPing(s *memoryServer, cn *memoryConn, args []string) interface{} {
+	if len(args) > 1 {
+		return args[1]
+	}
+	return respStatus("PONG")
+}
+
+func memorySelect(s *memoryServer, cn *memoryConn, args []string) interface{} {
+	if args[1] != "0" {
+		return respError("ERR DB index is out of range")
+	}
+	return respOK
+}
+
+func memoryFlush(s *memoryServer, cn *memoryConn, args []string) interface{} {
+	for key := range s.keys {
+		s.delete(key)
+	}
+	return respOK
+}
+
+func memoryDel(s *memoryServer, cn *memoryConn, args []string) interface{} {
+	var n int64
+	for _, key := range args[1:] {
+		if s.delete(key) {
+			n++
+		}
+	}
+	return n
+}
+
+func memoryExists(s *memoryServer, cn *memoryConn, args []string) interface{} {
+	var n int64
+	for _, key := range args[1:] {
+		if s.lookup(key) != nil {
+			n++
+		}
+	}
+	return n
+}
+
+func memoryExpire(s *memoryServer, cn *memoryConn, args []string) interface{} {
+	v, err := strconv.ParseInt(args[2], 10, 64)
+	if err != nil {
+		return errNotInteger
+	}
+	k := s.lookup(args[1])
+	if k == nil {
+		return int64(0)
+	}
+	d := time.Duration(v) * time.Second
+	if strings.ToLower(args[0]) == "pexpire" {
+		d = time.Duration(v) * time.Millisecond
+	}
+	if d <= 0 {
+		s.delete(args[1])
+		return int64(1)
+	}
+	k.expiresAt = s.now().Add(d)
+	s.modified(args[1])
+	return int64(1)
+}
+
+func memoryTTL(s *memoryServer, cn *memoryConn, args []string) interface{} {
+	k := s.lookup(args[1])
+	switch {
+	case k == nil:
+		return int64(-2)
+	case k.expiresAt.IsZero():
+		return int64(-1)
+	case strings.ToLower(args[0]) == "pttl":
+		return k.expiresAt.Sub(s.now()).Milliseconds()
+	}
+	return int64(k.expiresAt.Sub(s.now()).Round(time.Second) / time.Second)
+}
+
+func memoryType(s *memoryServer, cn *memoryConn, args []string) interface{} {
+	k := s.lookup(args[1])
+	if k == nil {
+		return respStatus("none")
+	}
+	switch k.value.(type) {
+	case string:
+		return respStatus("string")
+	case map[string]string:
+		return respStatus("hash")
+	case map[string]bool:
+		return respStatus("set")
+	}
+	return respStatus("stream")
+}
+
+func memoryKeys(s *memoryServer, cn *memoryConn, args []string) interface{} {
+	keys := []string{}
+	for key := range s.keys {
+		if s.lookup(key) != nil && matchGlob(args[1], key) {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func memoryGet(s *memoryServer, cn *memoryConn, args []string) interface{} {
+	v, ok, err := s.getString(args[1])
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return nil
+	}
+	return v
+}
+
+// memorySet runs SET key value [EX s|PX ms] [NX|XX] [KEEPTTL] [GET]
+func memorySet(s *memoryServer, cn *memoryConn, args []string) interface{} {
+	key := args[1]
+	var expiresAt time.Time
+	var nx, xx, keepTTL, get bool
+	for i := 3; i < len(args); i++ {
+		switch strings.ToLower(args[i]) {
+		case "nx":
+			nx = true
+		case "xx":
+			xx = true
+		case "keepttl":
+			keepTTL = true
+		case "get":
+			get = true
+		case "ex", "px":
+			if i+1 == len(args) {
+				return errSyntax
+			}
+			v, err := strconv.ParseInt(args[i+1], 10, 64)
+			if err != nil || v <= 0 {
+				return respError("ERR invalid expire time in 'set' command")
+			}
+			unit := time.Second
+			if strings.ToLower(args[i]) == "px" {
+				unit = time.Millisecond
+			}
+			expiresAt = s.now().Add(time.Duration(v) * unit)
+			i++
+		default:
+			return errSyntax
+		}
+	}
+	k := s.lookup(key)
+	old, isString := "", false
+	if k != nil {
+		old, isString = k.value.(string)
+		if get && !isString {
+			return errWrongType
+		}
+		if keepTTL {
+			expiresAt = k.expiresAt
+		}
+	}
+	if (nx && k != nil) || (xx && k == nil) {
+		if get && k != nil {
+			return old
+		}
+		return nil
+	}
+	s.keys[key] = &memoryKey{value: args[2], expiresAt: expiresAt}
+	s.modified(key)
+	if get {
+		if k != nil {
+			return old
+		}
+		return nil
+	}
+	return respOK
+}
+
+func memorySetNX(s *memoryServer, cn *memoryConn, args []string) interface{} {
+	if s.lookup(args[1]) != nil {
+		return int64(0)
+	}
+	s.keys[args[1]] = &memoryKey{value: args[2]}
+	s.modified(args[1])
+	return int64(1)
+}
+
+func memoryMGet(s *memoryServer, cn *memoryConn, args []string) interface{} {
+	values := make([]interface{}, len(args)-1)
+	for i, key := range args[1:] {
+		if v, ok, err := s.getString(key); ok && err == nil {
+			values[i] = v
+		}
+	}
+	return values
+}
+
+func memoryIncr(s *memoryServer, cn *memoryConn, args []string) interface{} {
+	by := int64(1)
+	if len(args) == 3 {
+		var err error
+		if by, err = strconv.ParseInt(args[2], 10, 64); err != nil {
+			return errNotInteger
+		}
+	}
+	v, ok, err := s.getString(args[1])
+	if err != nil {
+		return err
+	}
+	var n int64
+	if ok {
+		if n, err = strconv.ParseInt(v, 10, 64); err != nil {
+			return errNotInteger
+		}
+	}
+	n += by
+	if k := s.keys[args[1]]; k != nil {
+		k.value = strconv.FormatInt(n, 10)
+	} else {
+		s.keys[args[1]] = &memoryKey{value: strconv.FormatInt(n, 10)}
+	}
+	s.modified(args[1])
+	return n
+}
+
+func memoryHSet(s *memoryServer, cn *memoryConn, args []string) interface{} {
+	if len(args)%2 != 0 {
+		return respError("ERR wrong number of arguments for 'hset' command")
+	}
+	h, err := s.getHash(args[1], true)
+	if err != nil {
+		return err
+	}
+	var n int64
+	for i := 2; i < len(args); i += 2 {
+		if _, ok := h[args[i]]; !ok {
+			n++
+		}
+		h[args[i]] = args[i+1]
+	}
+	s.modified(args[1])
+	return n
+}
+
+func memoryHSetNX(s *memoryServer, cn *memoryConn, args []string) interface{} {
+	h, err := s.getHash(args[1], true)
+	if err != nil {
+		return err
+	}
+	if _, ok := h[args[2]]; ok {
+		return int64(0)
+	}
+	h[args[2]] = args[3]
+	s.modified(args[1])
+	return int64(1)
+}
+
+func memoryHGet(s *memoryServer, cn *memoryConn, args []string) interface{} {
+	h, err := s.getHash(args[1], false)
+	if err != nil {
+		return err
+	}
+	if v, ok := h[args[2]]; ok {
+		return v
+	}
+	return nil
+}
+
+func memoryHGetAll(s *memoryServer, cn *memoryConn, args []string) interface{} {
+	h, err := s.getHash(args[1], false)
+	if err != nil {
+		return err
+	}
+	fields := make([]string, 0, len(h))
+	for f := range h {
+		fields = append(fields, f)
+	}
+	sort.Strings(fields)
+	values := make([]string, 0, 2*len(h))
+	for _, f := range fields {
+		values = append(values, f, h[f])
+	}
+	return values
+}
+
+func memoryHDel(s *memoryServer, cn *memoryConn, args []string) interface{} {
+	h, err := s.getHash(args[1], false)
+	if err != nil {
+		return err
+	}
+	if h == nil {
+		return int64(0)
+	}
+	var n int64
+	for _, f := range args[2:] {
+		if _, ok := h[f]; ok {
+			delete(h, f)
+			n++
+		}
+	}
+	if n > 0 {
+		s.deleteIfEmpty(args[1], len(h))
+		s.modified(args[1])
+	}
+	return n
+}
+
+func memoryHLen(s *memoryServer, cn *memoryConn, args []string) interface{} {
+	h, err := s.getHash(args[1], false)
+	if err != nil {
+		return err
+	}
+	return int64(len(h))
+}
+
+func memorySAdd(s *memoryServer, cn *memoryConn, args []string) interface{} {
+	set, err := s.getSet(args[1], true)
+	if err != nil {
+		return err
+	}
+	var n int64
+	for _, m := range args[2:] {
+		if !set[m] {
+			set[m] = true
+			n++
+		}
+	}
+	if n > 0 {
+		s.modified(args[1])
+	}
+	return n
+}
+
+func memorySRem(s *memoryServer, cn *memoryConn, args []string) interface{} {
+	set, err := s.getSet(args[1], false)
+	if err != nil {
+		return err
+	}
+	var n int64
+	for _, m := range args[2:] {
+		if set[m] {
+			delete(set, m)
+			n++
+		}
+	}
+	if n > 0 {
+		s.deleteIfEmpty(args[1], len(set))
+		s.modified(args[1])
+	}
+	return n
+}
+
+func memorySCard(s *memoryServer, cn *memoryConn, args []string) interface{} {
+	set, err := s.getSet(args[1], false)
+	if err != nil {
+		return err
+	}
+	return int64(len(set))
+}
+
+func memorySIsMember(s *memoryServer, cn *memoryConn, args []string) interface{} {
+	set, err := s.getSet(args[1], false)
+	if err != nil {
+		return err
+	}
+	return set[args[2]]
+}
+
+func memorySMembers(s *memoryServer, cn *memoryConn, args []string) interface{} {
+	set, err := s.getSet(args[1], false)
+	if err != nil {
+		return err
+	}
+	members := make([]string, 0, len(set))
+	for m := range set {
+		members = append(members, m)
+	}
+	sort.Strings(members)
+	return members
+}
+
+// memorySScan runs SSCAN key cursor [MATCH pattern] [COUNT count]. The members are sorted and the cursor
+// is the offset of the next member.
+func memorySScan(s *memoryServer, cn *memoryConn, args []string) interface{} {
+	cursor, err := strconv.Atoi(args[2])
+	if err != nil || cursor < 0 {
+		return respError("ERR invalid cursor")
+	}
+	pattern, count := "*", 10
+	for i := 3; i < len(args); i += 2 {
+		if i+1 == len(args) {
+			return errSyntax
+		}
+		switch strings.ToLower(args[i]) {
+		case "match":
+			pattern = args[i+1]
+		case "count":
+			if count, err = strconv.Atoi(args[i+1]); err != nil || count < 1 {
+				return errSyntax
+			}
+		default:
+			return errSyntax
+		}
+	}
+	res := memorySMembers(s, cn, args[:2])
+	members, ok := res.([]string)
+	if !ok {
+		return res
+	}
+	page := []string{}
+	next := cursor + count
+	if next >= len(members) {
+		next = 0
+	}
+	for i := cursor; i < len(members) && i < cursor+count; i++ {
+		if matchGlob(pattern, members[i]) {
+			page = append(page, members[i])
+		}
+	}
+	return []interface{}{strconv.Itoa(next), page}
+}
+
+func memoryWatch(s *memoryServer, cn *memoryConn, args []string) interface{} {
+	if cn.multi {
+		return respError("ERR WATCH inside MULTI is not allowed")
+	}
+	if cn.watched == nil {
+		cn.watched = map[string]uint64{}
+	}
+	for _, key := range args[1:] {
+		s.expire(key)
+		cn.watched[key] = s.versions[key]
+	}
+	return respOK
+}
+
+func memoryUnwatch(s *memoryServer, cn *memoryConn, args []string) interface{} {
+	cn.watched = nil
+	return respOK
+}
+
+func memoryMulti(s *memoryServer, cn *memoryConn, args []string) interface{} {
+	if cn.multi {
+		return respError("ERR MULTI calls can not be nested")
+	}
+	cn.multi = true
+	return respOK
+}
+
+func memoryDiscard(s *memoryServer, cn *memoryConn, args []string) interface{} {
+	if !cn.multi {
+		return respError("ERR DISCARD without MULTI")
+	}
+	cn.multi, cn.queued, cn.queueErr, cn.watched = false, nil, false, nil
+	return respOK
+}
+
+// matchGlob reports whether the string matches the REDIS glob style pattern supporting *, ?, [...] and \
+func matchGlob(pattern string, s string) bool {
+	for len(pattern) > 0 {
+		switch pattern[0] {
+		case '*':
+			for len(pattern) > 0 && pattern[0] == '*' {
+				pattern = pattern[1:]
+			}
+			if len(pattern) == 0 {
+				return true
+			}
+			for i := 0; i <= len(s); i++ {
+				if matchGlob(pattern, s[i:]) {
+					return true
+				}
+			}
+			return false
+		case '?':
+			if len(s) == 0 {
+				return false
+			}
+		case '[':
+			end := strings.IndexByte(pattern[1:], ']')
+			if end < 0 || len(s) == 0 {
+				return false
+			}
+			class := pattern[1 : end+1]
+			negate := strings.HasPrefix(class, "^")
+			if negate {
+				class = class[1:]
+			}
+			matched := false
+			for i := 0; i < len(class); i++ {
+				if i+2 < len(class) && class[i+1] == '-' {
+					matched = matched || (s[0] >= class[i] && s[0] <= class[i+2])
+					i += 2
+				} else {
+					matched = matched || s[0] == class[i]
+				}
+			}
+			if matched == negate {
+				return false
+			}
+			pattern = pattern[end+1:]
+		case '\\':
+			if len(pattern) > 1 {
+				pattern = pattern[1:]
+			}
+			fallthrough
+		default:
+			if len(s) == 0 || s[0] != pattern[0] {
+				return false
+			}
+		}
+		pattern, s = pattern[1:], s[1:]
+	}
+	return len(s) == 0
+}
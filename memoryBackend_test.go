@@ -0,0 +1,144 @@
+package redimq
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+func newMemoryClient(t *testing.T) (*MQClient, *MemoryBackend) {
+	backend := NewMemoryBackend()
+	t.Cleanup(func() { backend.Close() })
+	c, err := NewMQClientWithBackend(context.TODO(), backend)
+	if err != nil {
+		t.Fatal("NewMQClientWithBackend failed", err)
+	}
+	return c, backend
+}
+
+func TestMemoryBackendTopic(t *testing.T) {
+	c, _ := newMemoryClient(t)
+	group := "memory-group"
+	topic, _ := c.NewTopic("memory", nil)
+	for _, v := range []string{"1", "2", "3"} {
+		if err := topic.PublishMessage(&Message{Data: map[string]interface{}{"seq": v}}); err != nil {
+			t.Fatal("PublishMessage failed", err)
+		}
+	}
+	c.createGroupAndConsumer(topic.StreamKey, group, "consumer-1")
+	msgs, err := topic.ConsumeMessages(group, "consumer-1", 2)
+	if err != nil || len(msgs) != 2 || msgs[0].Data["seq"] != "1" {
+		t.Fatal("ConsumeMessages is not valid", msgs, err)
+	}
+	msgs[0].Acknowledge()
+	pending, _ := c.rc.XPending(c.c, topic.StreamKey, group).Result()
+	if pending.Count != 1 || pending.Consumers["consumer-1"] != 1 {
+		t.Error("Pending entries are not valid", pending)
+	}
+	topic.MaxIdleTimeForMessages = 0
+	msgs, _ = topic.ConsumeMessages(group, "consumer-2", 2)
+	if len(msgs) != 2 || msgs[0].Data["seq"] != "2" || msgs[1].Data["seq"] != "3" {
+		t.Error("ConsumeMessages did not claim the pending message first", msgs)
+	}
+	ext, _ := c.rc.XPendingExt(c.c, &redis.XPendingExtArgs{Stream: topic.StreamKey, Group: group, Start: "-", End: "+", Count: 10}).Result()
+	if len(ext) != 2 || ext[0].Consumer != "consumer-2" || ext[0].RetryCount != 2 {
+		t.Error("Claimed pending entry is not valid", ext)
+	}
+	groups, _ := c.rc.XInfoGroups(c.c, topic.StreamKey).Result()
+	if len(groups) != 1 || groups[0].Consumers != 2 || groups[0].LastDeliveredID != msgs[1].Id {
+		t.Error("XINFO GROUPS is not valid", groups)
+	}
+}
+
+func TestMemoryBackendGroupedTopic(t *testing.T) {
+	c, _ := newMemoryClient(t)
+	group := "memory-group"
+	g, _ := c.NewGroupedMessageTopic("memory", nil)
+	g.InitTopicGroups(group, "consumer")
+	for _, key := range []string{"a", "b"} {
+		for _, v := range []string{"1", "2"} {
+			g.PublishMessage(key, &Message{Data: map[string]interface{}{"seq": v}})
+		}
+	}
+	msgs, err := g.ConsumeMessages(group, "consumer")
+	if err != nil || len(msgs) != 2 {
+		t.Fatal("ConsumeMessages is not valid", msgs, err)
+	}
+	if again, _ := g.ConsumeMessages(group, "consumer"); len(again) != 2 || again[0].Id != msgs[0].Id {
+		t.Error("ConsumeMessages did not redeliver the unacknowledged messages first", again)
+	}
+	for _, m := range msgs {
+		m.Acknowledge()
+	}
+	msgs, _ = g.ConsumeMessages(group, "consumer")
+	if len(msgs) != 2 || msgs[0].Data["seq"] != "2" || msgs[1].Data["seq"] != "2" {
+		t.Error("ConsumeMessages did not move on in order", msgs)
+	}
+}
+
+func TestMemoryBackendTransactions(t *testing.T) {
+	c, backend := newMemoryClient(t)
+	ctx := context.TODO()
+	err := backend.Watch(ctx, func(tx *redis.Tx) error {
+		backend.Set(ctx, "memory:watched", "changed", 0)
+		_, err := tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			pipe.Set(ctx, "memory:watched", "tx", 0)
+			return nil
+		})
+		return err
+	}, "memory:watched")
+	if err != redis.TxFailedErr {
+		t.Error("Transaction did not fail for a modified watched key", err)
+	}
+	if v, _ := c.rc.Get(ctx, "memory:watched").Result(); v != "changed" {
+		t.Error("Failed transaction modified the key", v)
+	}
+	backend.Set(ctx, "memory:expiring", "1", 50*time.Millisecond)
+	time.Sleep(60 * time.Millisecond)
+	if n, _ := backend.Exists(ctx, "memory:expiring").Result(); n != 0 {
+		t.Error("Key did not expire")
+	}
+}
+
+func TestMemoryBackendBlockingRead(t *testing.T) {
+	_, backend := newMemoryClient(t)
+	ctx := context.TODO()
+	backend.XGroupCreateMkStream(ctx, "memory:stream", "g", "$")
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		backend.XAdd(ctx, &redis.XAddArgs{Stream: "memory:stream", Values: []interface{}{"foo", "test"}})
+	}()
+	res, err := backend.XReadGroup(ctx, &redis.XReadGroupArgs{Group: "g", Consumer: "c", Streams: []string{"memory:stream", ">"}, Block: time.Second}).Result()
+	if err != nil || len(res) != 1 || res[0].Messages[0].Values["foo"] != "test" {
+		t.Error("Blocked read did not return the added entry", res, err)
+	}
+	_, err = backend.XReadGroup(ctx, &redis.XReadGroupArgs{Group: "g", Consumer: "c", Streams: []string{"memory:stream", ">"}, Block: 10 * time.Millisecond}).Result()
+	if err != redis.Nil {
+		t.Error("Blocked read did not time out", err)
+	}
+	if _, err := backend.XReadGroup(ctx, &redis.XReadGroupArgs{Group: "unknown", Consumer: "c", Streams: []string{"memory:stream", ">"}}).Result(); !isNoGroupError(err) {
+		t.Error("Read from an unknown group did not return NOGROUP", err)
+	}
+}
+
+func TestMemoryBackendTrim(t *testing.T) {
+	_, backend := newMemoryClient(t)
+	ctx := context.TODO()
+	for i := 0; i < 150; i++ {
+		backend.XAdd(ctx, &redis.XAddArgs{Stream: "memory:trim", Values: []interface{}{"i", i}})
+	}
+	if n, _ := backend.XTrimMaxLenApprox(ctx, "memory:trim", 120, 0).Result(); n != 0 {
+		t.Error("Approximate trim removed a partial node", n)
+	}
+	if n, _ := backend.XTrimMaxLenApprox(ctx, "memory:trim", 10, 0).Result(); n != 100 {
+		t.Error("Approximate trim did not remove a node", n)
+	}
+	if n, _ := backend.XTrimMaxLen(ctx, "memory:trim", 10).Result(); n != 40 {
+		t.Error("Exact trim is not valid", n)
+	}
+	if _, err := backend.XAdd(ctx, &redis.XAddArgs{Stream: "memory:trim", ID: "1-1", Values: []interface{}{"i", 0}}).Result(); err == nil {
+		t.Error("XADD accepted an id smaller than the last id")
+	}
+}
@@ -0,0 +1,943 @@
+package redimq
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// memoryStreamCommands are the stream commands of the memory server
+var memoryStreamCommands = map[string]*memoryCommand{
+	"xadd":       {arity: -5, run: memoryXAdd},
+	"xlen":       {arity: 2, run: memoryXLen},
+	"xrange":     {arity: -4, run: memoryXRange},
+	"xrevrange":  {arity: -4, run: memoryXRange},
+	"xdel":       {arity: -3, run: memoryXDel},
+	"xtrim":      {arity: -4, run: memoryXTrim},
+	"xack":       {arity: -4, run: memoryXAck},
+	"xgroup":     {arity: -2, run: memoryXGroup},
+	"xread":      {arity: -4, run: memoryXRead},
+	"xreadgroup": {arity: -7, run: memoryXReadGroup},
+	"xpending":   {arity: -3, run: memoryXPending},
+	"xclaim":     {arity: -6, run: memoryXClaim},
+	"xautoclaim": {arity: -6, run: memoryXAutoClaim},
+	"xinfo":      {arity: -2, run: memoryXInfo},
+}
+
+var errStreamId = respError("ERR Invalid stream ID specified as stream command argument")
+
+// memoryStreamId is the id of a stream entry
+type memoryStreamId struct {
+	ms  uint64
+	seq uint64
+}
+
+var maxMemoryStreamId = memoryStreamId{^uint64(0), ^uint64(0)}
+
+func (id memoryStreamId) String() string {
+	return strconv.FormatUint(id.ms, 10) + "-" + strconv.FormatUint(id.seq, 10)
+}
+
+func (id memoryStreamId) less(o memoryStreamId) bool {
+	return id.ms < o.ms || (id.ms == o.ms && id.seq < o.seq)
+}
+
+func (id memoryStreamId) next() memoryStreamId {
+	if id.seq == ^uint64(0) {
+		return memoryStreamId{id.ms + 1, 0}
+	}
+	return memoryStreamId{id.ms, id.seq + 1}
+}
+
+func (id memoryStreamId) previous() memoryStreamId {
+	if id.seq == 0 {
+		return memoryStreamId{id.ms - 1, ^uint64(0)}
+	}
+	return memoryStreamId{id.ms, id.seq - 1}
+}
+
+// parseMemoryStreamId parses the id, using the missing sequence if the id does not have one
+func parseMemoryStreamId(s string, missingSeq uint64) (memoryStreamId, bool) {
+	ms, seq, err := parseStreamId(s)
+	if err != nil {
+		return memoryStreamId{}, false
+	}
+	if !strings.Contains(s, "-") {
+		seq = missingSeq
+	}
+	return memoryStreamId{ms, seq}, true
+}
+
+// parseMemoryRangeId parses the start or the end of a range, which can be "-", "+" or an exclusive id
+// prefixed with "("
+func parseMemoryRangeId(s string, start bool) (memoryStreamId, bool) {
+	switch s {
+	case "-":
+		return memoryStreamId{}, true
+	case "+":
+		return maxMemoryStreamId, true
+	}
+	missingSeq := ^uint64(0)
+	if start {
+		missingSeq = 0
+	}
+	if !strings.HasPrefix(s, "(") {
+		return parseMemoryStreamId(s, missingSeq)
+	}
+	id, ok := parseMemoryStreamId(s[1:], missingSeq)
+	switch {
+	case !ok:
+		return id, false
+	case start && id != maxMemoryStreamId:
+		return id.next(), true
+	case !start && id != (memoryStreamId{}):
+		return id.previous(), true
+	}
+	return id, false
+}
+
+type memoryEntry struct {
+	id     memoryStreamId
+	fields []string
+}
+
+type memoryPending struct {
+	consumer    string
+	deliveredAt time.Time
+	count       int64
+}
+
+type memoryConsumer struct {
+	seenAt time.Time
+}
+
+type memoryGroup struct {
+	lastId    memoryStreamId
+	pending   map[memoryStreamId]*memoryPending
+	consumers map[string]*memoryConsumer
+}
+
+// memoryStream is a stream of the memory server with its entries in the order of their ids
+type memoryStream struct {
+	entries []memoryEntry
+	lastId  memoryStreamId
+	groups  map[string]*memoryGroup
+}
+
+// search returns the index of the first entry having an id greater than or equal to the id
+func (st *memoryStream) search(id memoryStreamId) int {
+	return sort.Search(len(st.entries), func(i int) bool { return !st.entries[i].id.less(id) })
+}
+
+func (st *memoryStream) entry(id memoryStreamId) *memoryEntry {
+	i := st.search(id)
+	if i < len(st.entries) && st.entries[i].id == id {
+		return &st.entries[i]
+	}
+	return nil
+}
+
+// trim removes the oldest entries for the MAXLEN or the MINID threshold. Like REDIS, an approximate trim
+// only removes the entries by the hundred, i.e. the size of the nodes of a REDIS stream.
+func (st *memoryStream) trim(strategy string, threshold string, approx bool) (int64, interface{}) {
+	var n int
+	switch strategy {
+	case "maxlen":
+		maxLen, err := strconv.Atoi(threshold)
+		if err != nil || maxLen < 0 {
+			return 0, errNotInteger
+		}
+		n = len(st.entries) - maxLen
+	case "minid":
+		minId, ok := parseMemoryStreamId(threshold, 0)
+		if !ok {
+			return 0, errStreamId
+		}
+		n = st.search(minId)
+	default:
+		return 0, errSyntax
+	}
+	if approx {
+		n -= n % 100
+	}
+	if n <= 0 {
+		return 0, nil
+	}
+	st.entries = append([]memoryEntry{}, st.entries[n:]...)
+	return int64(n), nil
+}
+
+func (g *memoryGroup) consumer(name string, now time.Time) *memoryConsumer {
+	c, ok := g.consumers[name]
+	if !ok {
+		c = &memoryConsumer{}
+		g.consumers[name] = c
+	}
+	c.seenAt = now
+	return c
+}
+
+// pendingIds returns the ids of the pending entries of the group in order
+func (g *memoryGroup) pendingIds() []memoryStreamId {
+	ids := make([]memoryStreamId, 0, len(g.pending))
+	for id := range g.pending {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i].less(ids[j]) })
+	return ids
+}
+
+func memoryEntryReply(e *memoryEntry) []interface{} {
+	return []interface{}{e.id.String(), e.fields}
+}
+
+func (s *memoryServer) getStream(key string, create bool) (*memoryStream, interface{}) {
+	k := s.lookup(key)
+	if k == nil {
+		if !create {
+			return nil, nil
+		}
+		k = &memoryKey{value: &memoryStream{groups: map[string]*memoryGroup{}}}
+		s.keys[key] = k
+	}
+	st, ok := k.value.(*memoryStream)
+	if !ok {
+		return nil, errWrongType
+	}
+	return st, nil
+}
+
+// getGroup returns the consumer group of the stream, or the NOGROUP error
+func (s *memoryServer) getGroup(key string, group string, command string) (*memoryStream, *memoryGroup, interface{}) {
+	st, err := s.getStream(key, false)
+	if err != nil {
+		return nil, nil, err
+	}
+	if st == nil || st.groups[group] == nil {
+		return nil, nil, respError(fmt.Sprintf("NOGROUP No such key '%s' or consumer group '%s'%s", key, group, command))
+	}
+	return st, st.groups[group], nil
+}
+
+// memoryXAdd runs XADD key [NOMKSTREAM] [MAXLEN|MINID [=|~] threshold [LIMIT count]] *|id field value ...
+func memoryXAdd(s *memoryServer, cn *memoryConn, args []string) interface{} {
+	key := args[1]
+	noMkStream, strategy, threshold, approx := false, "", "", false
+	i := 2
+	for ; i < len(args); i++ {
+		switch o := strings.ToLower(args[i]); o {
+		case "nomkstream":
+			noMkStream = true
+			continue
+		case "maxlen", "minid":
+			strategy = o
+			if i+1 < len(args) && (args[i+1] == "~" || args[i+1] == "=") {
+				approx = args[i+1] == "~"
+				i++
+			}
+			if i+1 == len(args) {
+				return errSyntax
+			}
+			threshold = args[i+1]
+			i++
+			continue
+		case "limit":
+			i++
+			continue
+		}
+		break
+	}
+	if i == len(args) || (len(args)-i-1)%2 != 0 || len(args)-i-1 == 0 {
+		return respError("ERR wrong number of arguments for 'xadd' command")
+	}
+	st, err := s.getStream(key, false)
+	if err != nil {
+		return err
+	}
+	if st == nil && noMkStream {
+		return nil
+	}
+	var last memoryStreamId
+	if st != nil {
+		last = st.lastId
+	}
+	var id memoryStreamId
+	switch {
+	case args[i] == "*":
+		ms := uint64(s.now().UnixMilli())
+		if ms > last.ms {
+			id = memoryStreamId{ms, 0}
+		} else {
+			id = last.next()
+		}
+	case strings.HasSuffix(args[i], "-*"):
+		ms, err := strconv.ParseUint(strings.TrimSuffix(args[i], "-*"), 10, 64)
+		if err != nil {
+			return errStreamId
+		}
+		id = memoryStreamId{ms, 0}
+		if ms == last.ms {
+			id = last.next()
+		} else if ms == 0 {
+			id.seq = 1
+		}
+	default:
+		var ok bool
+		if id, ok = parseMemoryStreamId(args[i], 0); !ok {
+			return errStreamId
+		}
+	}
+	if id == (memoryStreamId{}) {
+		return respError("ERR The ID specified in XADD must be greater than 0-0")
+	}
+	if !last.less(id) {
+		return respError("ERR The ID specified in XADD is equal or smaller than the target stream top item")
+	}
+	if st == nil {
+		st, _ = s.getStream(key, true)
+	}
+	st.entries = append(st.entries, memoryEntry{id: id, fields: append([]string{}, args[i+1:]...)})
+	st.lastId = id
+	if strategy != "" {
+		if _, err := st.trim(strategy, threshold, approx); err != nil {
+			return err
+		}
+	}
+	s.modified(key)
+	return id.String()
+}
+
+func memoryXLen(s *memoryServer, cn *memoryConn, args []string) interface{} {
+	st, err := s.getStream(args[1], false)
+	if err != nil {
+		return err
+	}
+	if st == nil {
+		return int64(0)
+	}
+	return int64(len(st.entries))
+}
+
+// memoryXRange runs XRANGE key start end [COUNT count] and XREVRANGE key end start [COUNT count]
+func memoryXRange(s *memoryServer, cn *memoryConn, args []string) interface{} {
+	reverse := strings.ToLower(args[0]) == "xrevrange"
+	startArg, endArg := args[2], args[3]
+	if reverse {
+		startArg, endArg = endArg, startArg
+	}
+	start, ok := parseMemoryRangeId(startArg, true)
+	end, ok2 := parseMemoryRangeId(endArg, false)
+	if !ok || !ok2 {
+		return errStreamId
+	}
+	count := -1
+	if len(args) > 4 {
+		if len(args) != 6 || strings.ToLower(args[4]) != "count" {
+			return errSyntax
+		}
+		n, err := strconv.Atoi(args[5])
+		if err != nil {
+			return errNotInteger
+		}
+		count = n
+	}
+	st, err := s.getStream(args[1], false)
+	if err != nil {
+		return err
+	}
+	res := []interface{}{}
+	if st == nil || end.less(start) {
+		return res
+	}
+	from, to := st.search(start), st.search(end.next())
+	if end == maxMemoryStreamId {
+		to = len(st.entries)
+	}
+	for i := 0; i < to-from && (count < 0 || len(res) < count); i++ {
+		j := from + i
+		if reverse {
+			j = to - 1 - i
+		}
+		res = append(res, memoryEntryReply(&st.entries[j]))
+	}
+	return res
+}
+
+func memoryXDel(s *memoryServer, cn *memoryConn, args []string) interface{} {
+	st, err := s.getStream(args[1], false)
+	if err != nil {
+		return err
+	}
+	if st == nil {
+		return int64(0)
+	}
+	var n int64
+	for _, a := range args[2:] {
+		id, ok := parseMemoryStreamId(a, 0)
+		if !ok {
+			return errStreamId
+		}
+		if i := st.search(id); i < len(st.entries) && st.entries[i].id == id {
+			st.entries = append(st.entries[:i], st.entries[i+1:]...)
+			n++
+		}
+	}
+	if n > 0 {
+		s.modified(args[1])
+	}
+	return n
+}
+
+// memoryXTrim runs XTRIM key MAXLEN|MINID [=|~] threshold [LIMIT count]
+func memoryXTrim(s *memoryServer, cn *memoryConn, args []string) interface{} {
+	strategy := strings.ToLower(args[2])
+	i, approx := 3, false
+	if args[i] == "~" || args[i] == "=" {
+		approx = args[i] == "~"
+		i++
+	}
+	if i >= len(args) {
+		return errSyntax
+	}
+	st, err := s.getStream(args[1], false)
+	if err != nil {
+		return err
+	}
+	if st == nil {
+		return int64(0)
+	}
+	n, err := st.trim(strategy, args[i], approx)
+	if err != nil {
+		return err
+	}
+	if n > 0 {
+		s.modified(args[1])
+	}
+	return n
+}
+
+func memoryXAck(s *memoryServer, cn *memoryConn, args []string) interface{} {
+	st, err := s.getStream(args[1], false)
+	if err != nil {
+		return err
+	}
+	if st == nil || st.groups[args[2]] == nil {
+		return int64(0)
+	}
+	g := st.groups[args[2]]
+	var n int64
+	for _, a := range args[3:] {
+		id, ok := parseMemoryStreamId(a, 0)
+		if !ok {
+			return errStreamId
+		}
+		if _, ok := g.pending[id]; ok {
+			delete(g.pending, id)
+			n++
+		}
+	}
+	return n
+}
+
+// memoryXGroup runs the CREATE, SETID, DESTROY, CREATECONSUMER and DELCONSUMER sub commands of XGROUP
+func memoryXGroup(s *memoryServer, cn *memoryConn, args []string) interface{} {
+	sub := strings.ToLower(args[1])
+	if len(args) < 4 || (sub != "destroy" && len(args) < 5) {
+		return respError("ERR wrong number of arguments for 'xgroup|" + sub + "' command")
+	}
+	key, name := args[2], args[3]
+	mkStream := sub == "create" && len(args) > 5 && strings.ToLower(args[5]) == "mkstream"
+	st, err := s.getStream(key, mkStream)
+	if err != nil {
+		return err
+	}
+	if st == nil {
+		return respError("ERR The XGROUP subcommand requires the key to exist. Note that for CREATE you may want to use the MKSTREAM option to create an empty stream automatically.")
+	}
+	g := st.groups[name]
+	if g == nil && sub != "create" && sub != "destroy" {
+		return respError(fmt.Sprintf("NOGROUP No such consumer group '%s' for key name '%s'", name, key))
+	}
+	parseId := func(a string) (memoryStreamId, bool) {
+		if a == "$" {
+			return st.lastId, true
+		}
+		return parseMemoryStreamId(a, 0)
+	}
+	switch sub {
+	case "create":
+		if g != nil {
+			return respError("BUSYGROUP Consumer Group name already exists")
+		}
+		id, ok := parseId(args[4])
+		if !ok {
+			return errStreamId
+		}
+		st.groups[name] = &memoryGroup{lastId: id, pending: map[memoryStreamId]*memoryPending{}, consumers: map[string]*memoryConsumer{}}
+		s.modified(key)
+		return respOK
+	case "setid":
+		id, ok := parseId(args[4])
+		if !ok {
+			return errStreamId
+		}
+		g.lastId = id
+		s.modified(key)
+		return respOK
+	case "destroy":
+		if g == nil {
+			return int64(0)
+		}
+		delete(st.groups, name)
+		s.modified(key)
+		return int64(1)
+	case "createconsumer":
+		if _, ok := g.consumers[args[4]]; ok {
+			return int64(0)
+		}
+		g.consumer(args[4], s.now())
+		return int64(1)
+	case "delconsumer":
+		var n int64
+		for id, p := range g.pending {
+			if p.consumer == args[4] {
+				delete(g.pending, id)
+				n++
+			}
+		}
+		delete(g.consumers, args[4])
+		return n
+	}
+	return respError("ERR unknown subcommand '" + args[1] + "'")
+}
+
+// memoryReadOptions are the options of XREAD and XREADGROUP
+type memoryReadOptions struct {
+	count   int
+	block   bool
+	timeout time.Duration
+	noAck   bool
+	keys    []string
+	ids     []string
+}
+
+func parseMemoryReadOptions(args []string) (*memoryReadOptions, interface{}) {
+	o := &memoryReadOptions{count: -1}
+	for i := 0; i < len(args); i++ {
+		switch strings.ToLower(args[i]) {
+		case "count", "block":
+			if i+1 == len(args) {
+				return nil, errSyntax
+			}
+			n, err := strconv.ParseInt(args[i+1], 10, 64)
+			if err != nil || n < 0 {
+				return nil, errNotInteger
+			}
+			if strings.ToLower(args[i]) == "count" {
+				o.count = int(n)
+			} else {
+				o.block, o.timeout = true, time.Duration(n)*time.Millisecond
+			}
+			i++
+		case "noack":
+			o.noAck = true
+		case "streams":
+			streams := args[i+1:]
+			if len(streams) == 0 || len(streams)%2 != 0 {
+				return nil, respError("ERR Unbalanced 'xread' list of streams: for each stream key an ID or '$' must be specified.")
+			}
+			o.keys, o.ids = streams[:len(streams)/2], streams[len(streams)/2:]
+			return o, nil
+		default:
+			return nil, errSyntax
+		}
+	}
+	return nil, errSyntax
+}
+
+// memoryXRead runs XREAD [COUNT count] [BLOCK ms] STREAMS key ... id ...
+func memoryXRead(s *memoryServer, cn *memoryConn, args []string) interface{} {
+	o, err := parseMemoryReadOptions(args[1:])
+	if err != nil {
+		return err
+	}
+	res := []interface{}{}
+	ids := make([]string, len(o.ids))
+	for i, key := range o.keys {
+		st, err := s.getStream(key, false)
+		if err != nil {
+			return err
+		}
+		ids[i] = o.ids[i]
+		if ids[i] == "$" {
+			ids[i] = memoryStreamId{}.String()
+			if st != nil {
+				ids[i] = st.lastId.String()
+			}
+		}
+		after, ok := parseMemoryStreamId(ids[i], 0)
+		if !ok {
+			return errStreamId
+		}
+		if st == nil {
+			continue
+		}
+		entries := []interface{}{}
+		for j := st.search(after.next()); j < len(st.entries) && (o.count <= 0 || len(entries) < o.count); j++ {
+			entries = append(entries, memoryEntryReply(&st.entries[j]))
+		}
+		if len(entries) > 0 {
+			res = append(res, []interface{}{key, entries})
+		}
+	}
+	if len(res) > 0 {
+		return res
+	}
+	if o.block {
+		// the "$" ids are resolved once, so that the read returns the entries added while it is blocked
+		retry := append([]string{}, args[:len(args)-len(ids)]...)
+		return memoryBlock{timeout: o.timeout, args: append(retry, ids...)}
+	}
+	return respNilArray{}
+}
+
+// memoryXReadGroup runs XREADGROUP GROUP group consumer [COUNT count] [BLOCK ms] [NOACK] STREAMS key ... id ...
+func memoryXReadGroup(s *memoryServer, cn *memoryConn, args []string) interface{} {
+	if strings.ToLower(args[1]) != "group" {
+		return errSyntax
+	}
+	group, consumer := args[2], args[3]
+	o, err := parseMemoryReadOptions(args[4:])
+	if err != nil {
+		return err
+	}
+	now := s.now()
+	res := []interface{}{}
+	history := false
+	for i, key := range o.keys {
+		st, g, err := s.getGroup(key, group, " in XREADGROUP with GROUP option")
+		if err != nil {
+			return err
+		}
+		g.consumer(consumer, now)
+		entries := []interface{}{}
+		if o.ids[i] == ">" {
+			for j := st.search(g.lastId.next()); j < len(st.entries) && (o.count <= 0 || len(entries) < o.count); j++ {
+				e := &st.entries[j]
+				g.lastId = e.id
+				if !o.noAck {
+					g.pending[e.id] = &memoryPending{consumer: consumer, deliveredAt: now, count: 1}
+				}
+				entries = append(entries, memoryEntryReply(e))
+			}
+			if len(entries) > 0 {
+				res = append(res, []interface{}{key, entries})
+			}
+			continue
+		}
+		history = true
+		after, ok := parseMemoryStreamId(o.ids[i], 0)
+		if !ok {
+			return errStreamId
+		}
+		for _, id := range g.pendingIds() {
+			p := g.pending[id]
+			if !after.less(id) || p.consumer != consumer {
+				continue
+			}
+			if o.count > 0 && len(entries) == o.count {
+				break
+			}
+			p.deliveredAt = now
+			p.count++
+			if e := st.entry(id); e != nil {
+				entries = append(entries, memoryEntryReply(e))
+			} else {
+				entries = append(entries, []interface{}{id.String(), respNilArray{}})
+			}
+		}
+		res = append(res, []interface{}{key, entries})
+	}
+	if len(res) > 0 {
+		return res
+	}
+	if o.block && !history {
+		return memoryBlock{timeout: o.timeout, args: args}
+	}
+	return respNilArray{}
+}
+
+// memoryXPending runs XPENDING key group [[IDLE ms] start end count [consumer]]
+func memoryXPending(s *memoryServer, cn *memoryConn, args []string) interface{} {
+	if len(args) < 3 {
+		return errSyntax
+	}
+	_, g, err := s.getGroup(args[1], args[2], "")
+	if err != nil {
+		return err
+	}
+	now := s.now()
+	ids := g.pendingIds()
+	if len(args) == 3 {
+		if len(ids) == 0 {
+			return []interface{}{int64(0), nil, nil, respNilArray{}}
+		}
+		counts := map[string]int64{}
+		for _, p := range g.pending {
+			counts[p.consumer]++
+		}
+		names := make([]string, 0, len(counts))
+		for name := range counts {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		consumers := make([]interface{}, len(names))
+		for i, name := range names {
+			consumers[i] = []interface{}{name, strconv.FormatInt(counts[name], 10)}
+		}
+		return []interface{}{int64(len(ids)), ids[0].String(), ids[len(ids)-1].String(), consumers}
+	}
+	rest := args[3:]
+	var minIdle time.Duration
+	if strings.ToLower(rest[0]) == "idle" {
+		if len(rest) < 2 {
+			return errSyntax
+		}
+		ms, err := strconv.ParseInt(rest[1], 10, 64)
+		if err != nil {
+			return errNotInteger
+		}
+		minIdle, rest = time.Duration(ms)*time.Millisecond, rest[2:]
+	}
+	if len(rest) != 3 && len(rest) != 4 {
+		return errSyntax
+	}
+	start, ok := parseMemoryRangeId(rest[0], true)
+	end, ok2 := parseMemoryRangeId(rest[1], false)
+	if !ok || !ok2 {
+		return errStreamId
+	}
+	count, cerr := strconv.Atoi(rest[2])
+	if cerr != nil {
+		return errNotInteger
+	}
+	res := []interface{}{}
+	for _, id := range ids {
+		p := g.pending[id]
+		idle := now.Sub(p.deliveredAt)
+		if id.less(start) || end.less(id) || idle < minIdle || (len(rest) == 4 && p.consumer != rest[3]) {
+			continue
+		}
+		if len(res) == count {
+			break
+		}
+		res = append(res, []interface{}{id.String(), p.consumer, idle.Milliseconds(), p.count})
+	}
+	return res
+}
+
+// claimPending assigns the pending entry to the consumer if it has been idle for the minimum idle time. The
+// entries deleted from the stream are removed from the pending entries, like REDIS 7 does.
+func claimPending(st *memoryStream, g *memoryGroup, id memoryStreamId, consumer string, minIdle time.Duration, justId bool, now time.Time) *memoryEntry {
+	p := g.pending[id]
+	if p == nil || now.Sub(p.deliveredAt) < minIdle {
+		return nil
+	}
+	e := st.entry(id)
+	if e == nil {
+		delete(g.pending, id)
+		return nil
+	}
+	p.consumer, p.deliveredAt = consumer, now
+	if !justId {
+		p.count++
+	}
+	return e
+}
+
+// memoryXClaim runs XCLAIM key group consumer min-idle id ... [IDLE ms] [RETRYCOUNT count] [FORCE] [JUSTID]
+func memoryXClaim(s *memoryServer, cn *memoryConn, args []string) interface{} {
+	st, g, err := s.getGroup(args[1], args[2], "")
+	if err != nil {
+		return err
+	}
+	consumer := args[3]
+	ms, perr := strconv.ParseInt(args[4], 10, 64)
+	if perr != nil {
+		return errNotInteger
+	}
+	minIdle := time.Duration(ms) * time.Millisecond
+	ids := []memoryStreamId{}
+	i := 5
+	for ; i < len(args); i++ {
+		id, ok := parseMemoryStreamId(args[i], 0)
+		if !ok {
+			break
+		}
+		ids = append(ids, id)
+	}
+	var idle, retryCount *int64
+	force, justId := false, false
+	for ; i < len(args); i++ {
+		switch strings.ToLower(args[i]) {
+		case "idle", "time", "retrycount", "lastid":
+			if i+1 == len(args) {
+				return errSyntax
+			}
+			n, err := strconv.ParseInt(args[i+1], 10, 64)
+			if strings.ToLower(args[i]) == "idle" && err == nil {
+				idle = &n
+			} else if strings.ToLower(args[i]) == "retrycount" && err == nil {
+				retryCount = &n
+			}
+			i++
+		case "force":
+			force = true
+		case "justid":
+			justId = true
+		default:
+			return errStreamId
+		}
+	}
+	now := s.now()
+	g.consumer(consumer, now)
+	res := []interface{}{}
+	for _, id := range ids {
+		if force && g.pending[id] == nil && st.entry(id) != nil {
+			g.pending[id] = &memoryPending{consumer: consumer, deliveredAt: now}
+		}
+		e := claimPending(st, g, id, consumer, minIdle, justId, now)
+		if e == nil {
+			continue
+		}
+		p := g.pending[id]
+		if idle != nil {
+			p.deliveredAt = now.Add(-time.Duration(*idle) * time.Millisecond)
+		}
+		if retryCount != nil {
+			p.count = *retryCount
+		}
+		if justId {
+			res = append(res, id.String())
+		} else {
+			res = append(res, memoryEntryReply(e))
+		}
+	}
+	return res
+}
+
+// memoryXAutoClaim runs XAUTOCLAIM key group consumer min-idle start [COUNT count] [JUSTID]
+func memoryXAutoClaim(s *memoryServer, cn *memoryConn, args []string) interface{} {
+	st, g, err := s.getGroup(args[1], args[2], "")
+	if err != nil {
+		return err
+	}
+	consumer := args[3]
+	ms, perr := strconv.ParseInt(args[4], 10, 64)
+	if perr != nil {
+		return errNotInteger
+	}
+	start, ok := parseMemoryRangeId(args[5], true)
+	if !ok {
+		return errStreamId
+	}
+	count, justId := 100, false
+	for i := 6; i < len(args); i++ {
+		switch strings.ToLower(args[i]) {
+		case "count":
+			if i+1 == len(args) {
+				return errSyntax
+			}
+			if count, perr = strconv.Atoi(args[i+1]); perr != nil || count < 1 {
+				return respError("ERR COUNT must be > 0")
+			}
+			i++
+		case "justid":
+			justId = true
+		default:
+			return errSyntax
+		}
+	}
+	now := s.now()
+	g.consumer(consumer, now)
+	res := []interface{}{}
+	next := memoryStreamId{}
+	attempts := count * 10
+	for _, id := range g.pendingIds() {
+		if id.less(start) {
+			continue
+		}
+		if len(res) == count || attempts == 0 {
+			next = id
+			break
+		}
+		attempts--
+		e := claimPending(st, g, id, consumer, time.Duration(ms)*time.Millisecond, justId, now)
+		if e == nil {
+			continue
+		}
+		if justId {
+			res = append(res, id.String())
+		} else {
+			res = append(res, memoryEntryReply(e))
+		}
+	}
+	return []interface{}{next.String(), res}
+}
+
+// memoryXInfo runs the GROUPS and CONSUMERS sub commands of XINFO, replying in the format of REDIS 6.2
+func memoryXInfo(s *memoryServer, cn *memoryConn, args []string) interface{} {
+	sub := strings.ToLower(args[1])
+	switch {
+	case sub == "groups" && len(args) == 3:
+		st, err := s.getStream(args[2], false)
+		if err != nil {
+			return err
+		}
+		if st == nil {
+			return respError("ERR no such key")
+		}
+		names := make([]string, 0, len(st.groups))
+		for name := range st.groups {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		res := make([]interface{}, len(names))
+		for i, name := range names {
+			g := st.groups[name]
+			res[i] = []interface{}{"name", name, "consumers", int64(len(g.consumers)), "pending", int64(len(g.pending)),
+				"last-delivered-id", g.lastId.String()}
+		}
+		return res
+	case sub == "consumers" && len(args) == 4:
+		st, err := s.getStream(args[2], false)
+		if err != nil {
+			return err
+		}
+		if st == nil {
+			return respError("ERR no such key")
+		}
+		g := st.groups[args[3]]
+		if g == nil {
+			return respError(fmt.Sprintf("NOGROUP No such consumer group '%s' for key name '%s'", args[3], args[2]))
+		}
+		counts := map[string]int64{}
+		for _, p := range g.pending {
+			counts[p.consumer]++
+		}
+		names := make([]string, 0, len(g.consumers))
+		for name := range g.consumers {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		now := s.now()
+		res := make([]interface{}, len(names))
+		for i, name := range names {
+			res[i] = []interface{}{"name", name, "pending", counts[name], "idle", now.Sub(g.consumers[name].seenAt).Milliseconds()}
+		}
+		return res
+	}
+	return respError("ERR unknown subcommand or wrong number of arguments for '" + args[1] + "'")
+}
@@ -1,15 +1,81 @@
 package redimq
 
+import (
+	"strconv"
+	"strings"
+	"time"
+)
+
+// headerFieldPrefix is the prefix of the stream entry fields used for storing the headers of a message. It is
+// in the reserved "redimq:" namespace, so that the Data fields of the messages are never taken for headers.
+const headerFieldPrefix = "redimq:h:"
+
+// Message is a message published to or consumed from a topic. The Data is the payload of the message and
+// the Headers are its metadata. Both are stored as fields of the REDIS stream entry.
 type Message struct {
 	Id                string
 	GroupKey          string
 	Data              map[string]interface{}
+	Headers           map[string]string
 	ConsumerGroupName string
 	ConsumerName      string
+	// Priority is the priority level of the message for a Topic having PriorityLevels. Higher levels
+	// are consumed first.
+	Priority int64
+	// ExpiresAt is the time after which the message is not delivered to the consumers. The expired
+	// messages are acknowledged when consumed and routed to the ExpiredMessagesTopic of the topic if set.
+	// A zero time means that the message never expires.
+	ExpiresAt time.Time
 	Topic
+	// processedWindow is the IdempotencyWindow of the Consumer that the message was delivered to
+	processedWindow time.Duration
+	// inProgress is set when the Consumer holds the in-progress marker of the message
+	inProgress bool
+	// decodeErr is the DecodeError of the message if its Data could not be decoded
+	decodeErr error
 }
 
+// Acknowledge acknowledges the message in its consumer group. A message delivered by a Consumer having an
+// IdempotencyWindow is marked as processed along with the acknowledgement, atomically.
 func (m *Message) Acknowledge() error {
+	if m.processedWindow > 0 {
+		return m.acknowledgeProcessed()
+	}
 	_, err := m.Topic.MQClient.rc.XAck(m.Topic.MQClient.c, m.Topic.StreamKey, m.ConsumerGroupName, m.Id).Result()
 	return err
 }
+
+// getValues returns the fields of the stream entry for the message, i.e. the Data along with the Headers
+func (m *Message) getValues() map[string]interface{} {
+	if len(m.Headers) == 0 && m.ExpiresAt.IsZero() {
+		return m.Data
+	}
+	values := make(map[string]interface{}, len(m.Data)+len(m.Headers)+1)
+	for k, v := range m.Data {
+		values[k] = v
+	}
+	for k, v := range m.Headers {
+		values[headerFieldPrefix+k] = v
+	}
+	if !m.ExpiresAt.IsZero() {
+		values[headerFieldPrefix+HeaderExpiresAt] = strconv.FormatInt(m.ExpiresAt.UnixMilli(), 10)
+	}
+	return values
+}
+
+// splitValues splits the fields of a stream entry into the Data and the Headers of a message. It returns an
+// error along with the stored fields if the Data cannot be decompressed.
+func splitValues(values map[string]interface{}) (map[string]interface{}, map[string]string, error) {
+	data := make(map[string]interface{}, len(values))
+	headers := map[string]string{}
+	for k, v := range values {
+		if strings.HasPrefix(k, headerFieldPrefix) {
+			s, _ := v.(string)
+			headers[strings.TrimPrefix(k, headerFieldPrefix)] = s
+		} else {
+			data[k] = v
+		}
+	}
+	data, err := decompressData(data, headers)
+	return data, headers, err
+}
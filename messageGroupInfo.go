@@ -0,0 +1,251 @@
+package redimq
+
+import (
+	"sort"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// MessageGroupInfo describes the backlog and the lock of a message group of a [GroupedMessageTopic] for a
+// consumer group
+type MessageGroupInfo struct {
+	GroupKey string
+	// Backlog is the number of messages yet to be acknowledged by the consumer group, i.e. the Pending
+	// messages along with the ones not yet delivered
+	Backlog int64
+	// OldestMessageAge is the time since the oldest message of the Backlog was published
+	OldestMessageAge time.Duration
+	// Owner is the consumer holding the lock on the message group, or empty if it is not locked
+	Owner string
+	// LockIdle is the time since the lock was last claimed or its message group was delivered to the Owner
+	LockIdle time.Duration
+	// Pending is the number of messages delivered to the consumer group but not yet acknowledged
+	Pending int64
+	// LastDeliveredId is the id of the last message delivered to the consumer group, or empty if the
+	// consumer group has not started consuming the message group
+	LastDeliveredId string
+	Paused          bool
+}
+
+// ListGroupsOptions are the options for listing the message groups using [GroupedMessageTopic.ListGroups]
+type ListGroupsOptions struct {
+	// Offset is the number of message groups skipped before the page
+	Offset int64
+	// Count is the maximum number of message groups in the page. Defaults to the DefaultBrowsePageSize.
+	Count int64
+	// SortByBacklog sorts the message groups by the number of messages in their streams from the largest to
+	// the smallest instead of by their GroupKey. The number of messages includes the acknowledged ones not
+	// yet trimmed, so it approximates the Backlog without reading the streams of all the message groups.
+	SortByBacklog bool
+}
+
+// MessageGroupPage is a page of the message groups returned by [GroupedMessageTopic.ListGroups]. The
+// NextOffset can be used as the Offset for the next page, and is 0 when there are no more message groups.
+type MessageGroupPage struct {
+	Groups     []*MessageGroupInfo
+	Total      int64
+	NextOffset int64
+}
+
+// ListGroups returns a page of the message groups of the topic along with their backlog and lock for the
+// consumer group. This can be used to find the message groups that are stuck and the consumers holding
+// them. The backlog is counted from the streams of the message groups in the page only, while sorting by
+// the backlog reads just the length of the stream of every message group of the topic.
+// For a topic having Lanes, the lanes are listed instead of the group keys.
+//
+//	page, err := gmt.ListGroups("billing", &redimq.ListGroupsOptions{Count: 10, SortByBacklog: true})
+//	for _, g := range page.Groups {
+//		fmt.Println(g.GroupKey, g.Backlog, g.Owner, g.LockIdle)
+//	}
+func (t *GroupedMessageTopic) ListGroups(consumerGroupName string, options *ListGroupsOptions) (*MessageGroupPage, error) {
+	o := ListGroupsOptions{}
+	if options != nil {
+		o = *options
+	}
+	if o.Count <= 0 {
+		o.Count = DefaultBrowsePageSize
+	}
+	entries, err := t.getMessageGroupEntries()
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return getMessageGroupEntryKey(entries[i]) < getMessageGroupEntryKey(entries[j])
+	})
+	locks, err := t.getMessageGroupLocks(consumerGroupName, "-", "+", int64(len(entries)))
+	if err != nil {
+		return nil, err
+	}
+	pausedGroups, err := t.getPausedGroups()
+	if err != nil {
+		return nil, err
+	}
+	page := &MessageGroupPage{Groups: []*MessageGroupInfo{}, Total: int64(len(entries))}
+	if o.Offset >= page.Total {
+		return page, nil
+	}
+	end := o.Offset + o.Count
+	if end > page.Total {
+		end = page.Total
+	}
+	if o.SortByBacklog {
+		if err = t.sortMessageGroupEntriesByLength(entries); err != nil {
+			return nil, err
+		}
+	}
+	for _, e := range entries[o.Offset:end] {
+		key := getMessageGroupEntryKey(e)
+		info, err := t.describeMessageGroup(consumerGroupName, key, locks[e.ID], pausedGroups[key])
+		if err != nil {
+			return nil, err
+		}
+		page.Groups = append(page.Groups, info)
+	}
+	if end < page.Total {
+		page.NextOffset = end
+	}
+	return page, nil
+}
+
+// DescribeGroup returns the backlog and the lock of the message group for the consumer group, or nil if the
+// message group does not exist. For a topic having Lanes, the lane of the group key is described.
+func (t *GroupedMessageTopic) DescribeGroup(consumerGroupName string, groupKey string) (*MessageGroupInfo, error) {
+	key := t.getMessageGroupKey(groupKey)
+	id, err := t.findMessageGroupEntry(key)
+	if err != nil || id == "" {
+		return nil, err
+	}
+	locks, err := t.getMessageGroupLocks(consumerGroupName, id, id, 1)
+	if err != nil {
+		return nil, err
+	}
+	paused, err := t.MQClient.rc.SIsMember(t.MQClient.c, t.getPausedGroupSetKey(), key).Result()
+	if err != nil {
+		return nil, err
+	}
+	return t.describeMessageGroup(consumerGroupName, key, locks[id], paused)
+}
+
+func getMessageGroupEntryKey(e redis.XMessage) string {
+	key, _ := e.Values["key"].(string)
+	return key
+}
+
+// sortMessageGroupEntriesByLength sorts the entries of the message groups by the length of their streams from
+// the largest to the smallest, reading the lengths in a single pipeline
+func (t *GroupedMessageTopic) sortMessageGroupEntriesByLength(entries []redis.XMessage) error {
+	cmds := make([]*redis.IntCmd, len(entries))
+	_, err := t.MQClient.rc.Pipelined(t.MQClient.c, func(pipe redis.Pipeliner) error {
+		for i, e := range entries {
+			cmds[i] = pipe.XLen(t.MQClient.c, t.getStreamKeyForGroup(getMessageGroupEntryKey(e)))
+		}
+		return nil
+	})
+	if err != nil && err != redis.Nil {
+		return err
+	}
+	lengths := make(map[string]int64, len(entries))
+	for i, e := range entries {
+		lengths[e.ID] = cmds[i].Val()
+	}
+	sort.SliceStable(entries, func(i, j int) bool {
+		return lengths[entries[i].ID] > lengths[entries[j].ID]
+	})
+	return nil
+}
+
+// getMessageGroupEntries returns the entries of all the message groups in the MessageGroupStreamKey
+func (t *GroupedMessageTopic) getMessageGroupEntries() ([]redis.XMessage, error) {
+	entries := []redis.XMessage{}
+	start := "-"
+	for {
+		res, err := t.MQClient.rc.XRangeN(t.MQClient.c, t.MessageGroupStreamKey, start, "+", 1000).Result()
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, res...)
+		if len(res) < 1000 {
+			return entries, nil
+		}
+		start = nextStreamId(res[len(res)-1].ID)
+	}
+}
+
+// getMessageGroupLocks returns the pending entries of the message groups in the MessageGroupStreamKey for
+// the consumer group, i.e. the locks held on them, by the ids of the entries
+func (t *GroupedMessageTopic) getMessageGroupLocks(consumerGroupName string, start string, end string, count int64) (map[string]*redis.XPendingExt, error) {
+	locks := map[string]*redis.XPendingExt{}
+	if count == 0 {
+		return locks, nil
+	}
+	pending, err := t.MQClient.rc.XPendingExt(t.MQClient.c, &redis.XPendingExtArgs{
+		Stream: t.MessageGroupStreamKey,
+		Group:  consumerGroupName,
+		Start:  start,
+		End:    end,
+		Count:  count,
+	}).Result()
+	if isNoGroupError(err) || err == redis.Nil {
+		return locks, nil
+	} else if err != nil {
+		return nil, err
+	}
+	for i := range pending {
+		locks[pending[i].ID] = &pending[i]
+	}
+	return locks, nil
+}
+
+// describeMessageGroup reads the backlog of the message group from its stream for the consumer group
+func (t *GroupedMessageTopic) describeMessageGroup(consumerGroupName string, groupKey string, lock *redis.XPendingExt, paused bool) (*MessageGroupInfo, error) {
+	rc := t.MQClient.rc
+	c := t.MQClient.c
+	info := &MessageGroupInfo{GroupKey: groupKey, Paused: paused}
+	if lock != nil {
+		info.Owner = lock.Consumer
+		info.LockIdle = lock.Idle
+	}
+	stream := t.getStreamKeyForGroup(groupKey)
+	groups, err := rc.XInfoGroups(c, stream).Result()
+	if isNoSuchKeyError(err) {
+		return info, nil
+	} else if err != nil {
+		return nil, err
+	}
+	start := "-"
+	for _, g := range groups {
+		if g.Name == consumerGroupName {
+			info.Pending = g.Pending
+			info.LastDeliveredId = g.LastDeliveredID
+			start = nextStreamId(g.LastDeliveredID)
+		}
+	}
+	undelivered, err := countMessages(t.MQClient, stream, start, "+")
+	if err != nil {
+		return nil, err
+	}
+	info.Backlog = info.Pending + undelivered
+	oldest := ""
+	if info.Pending > 0 {
+		p, err := rc.XPending(c, stream, consumerGroupName).Result()
+		if err != nil {
+			return nil, err
+		}
+		oldest = p.Lower
+	} else if undelivered > 0 {
+		res, err := rc.XRangeN(c, stream, start, "+", 1).Result()
+		if err != nil {
+			return nil, err
+		}
+		if len(res) > 0 {
+			oldest = res[0].ID
+		}
+	}
+	if oldest != "" {
+		if ms, _, err := parseStreamId(oldest); err == nil {
+			info.OldestMessageAge = t.MQClient.now().Sub(time.UnixMilli(int64(ms)))
+		}
+	}
+	return info, nil
+}
@@ -0,0 +1,48 @@
+package redimq
+
+import (
+	"testing"
+)
+
+func TestGMTListAndDescribeGroups(t *testing.T) {
+	group := "introspection-group"
+	consumer := "introspection-consumer"
+	g, _ := client.NewGroupedMessageTopic(getTestName(t, "introspection"), nil)
+	g.InitTopicGroups(group, consumer)
+	for _, key := range []string{"a", "b", "b", "b", "c", "c"} {
+		if err := g.PublishMessage(key, &Message{Data: map[string]interface{}{"foo": "test"}}); err != nil {
+			t.Fatal("PublishMessage failed", err)
+		}
+	}
+	if _, err := g.ConsumeMessages(group, consumer); err != nil {
+		t.Fatal("ConsumeMessages failed", err)
+	}
+	page, err := g.ListGroups(group, &ListGroupsOptions{Count: 2, SortByBacklog: true})
+	if err != nil || page.Total != 3 || len(page.Groups) != 2 || page.NextOffset != 2 {
+		t.Fatal("ListGroups page is not valid", page, err)
+	}
+	b := page.Groups[0]
+	if b.GroupKey != "b" || b.Backlog != 3 || b.Pending != 1 || b.Owner != consumer || b.LastDeliveredId == "" {
+		t.Error("ListGroups group is not valid", b)
+	}
+	if page.Groups[1].GroupKey != "c" {
+		t.Error("ListGroups did not sort by the backlog", page.Groups[1])
+	}
+	page, err = g.ListGroups(group, &ListGroupsOptions{Offset: 2, Count: 2})
+	if err != nil || len(page.Groups) != 1 || page.Groups[0].GroupKey != "c" || page.NextOffset != 0 {
+		t.Error("ListGroups next page is not valid", page, err)
+	}
+	g.PauseGroup("a")
+	a, err := g.DescribeGroup(group, "a")
+	if err != nil || a == nil || a.Backlog != 1 || !a.Paused || a.Owner != consumer {
+		t.Error("DescribeGroup is not valid", a, err)
+	}
+	if a, _ = g.DescribeGroup("other-group", "a"); a == nil || a.Backlog != 1 || a.Owner != "" || a.LastDeliveredId != "" {
+		t.Error("DescribeGroup for a new consumer group is not valid", a)
+	}
+	if a, _ = g.DescribeGroup(group, "missing"); a != nil {
+		t.Error("DescribeGroup returned a missing message group", a)
+	}
+	g.ResumeGroup("a")
+	g.Purge(false)
+}
@@ -2,6 +2,9 @@ package redimq
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"sync"
 	"time"
 
 	"github.com/go-redis/redis/v8"
@@ -17,14 +20,107 @@ import (
 //	 	client, err := redimq.NewMQClient(content.TODO(), rdb)
 //		}
 type MQClient struct {
-	c  context.Context
-	rc *redis.Client
+	c       context.Context
+	rc      Backend
+	replies *replyListener
+	configs *topicConfigs
+}
+
+// topicConfigs keeps the options of the topics created using the client, so that a topic referred to by its
+// name, e.g. a topic bound to an Exchange, is published to with the options it was created with, including
+// the ones that cannot be stored in REDIS like the Store of a ClaimCheck
+type topicConfigs struct {
+	mu      sync.Mutex
+	options map[string]*TopicOptions
+}
+
+func newTopicConfigs() *topicConfigs {
+	return &topicConfigs{options: map[string]*TopicOptions{}}
+}
+
+func (c *MQClient) setConfiguredOptions(topicType TopicType, name string, options *TopicOptions) {
+	if options == nil || c.configs == nil {
+		return
+	}
+	o := *options
+	c.configs.mu.Lock()
+	defer c.configs.mu.Unlock()
+	c.configs.options[string(topicType)+":"+name] = &o
+}
+
+// getConfiguredOptions returns the options that the topic was last created with using the client, or the
+// options if it was not
+func (c *MQClient) getConfiguredOptions(topicType TopicType, name string, options *TopicOptions) *TopicOptions {
+	if c.configs == nil {
+		return options
+	}
+	c.configs.mu.Lock()
+	defer c.configs.mu.Unlock()
+	if o, ok := c.configs.options[string(topicType)+":"+name]; ok {
+		return o
+	}
+	return options
+}
+
+// getConfiguredTopic returns the Topic with the options it was created with using the client, or with the
+// options if it was not. The name of the Topic is not registered.
+func (c *MQClient) getConfiguredTopic(name string, options *TopicOptions) (*Topic, error) {
+	return c.newTopic(name, c.getConfiguredOptions(UngroupedMessages, name, options))
+}
+
+// getTargetTopic returns the configured Topic that the messages are routed to, like the ExpiredMessagesTopic,
+// and registers its name as it is created by routing the messages
+func (c *MQClient) getTargetTopic(name string) (*Topic, error) {
+	t, err := c.getConfiguredTopic(name, nil)
+	if err != nil {
+		return nil, err
+	}
+	return t, c.registerTopicName(UngroupedMessages, name)
+}
+
+// getConfiguredGroupedMessageTopic returns the GroupedMessageTopic with the options it was created with using
+// the client, or with the options if it was not. The name of the topic is not registered.
+func (c *MQClient) getConfiguredGroupedMessageTopic(name string, options *TopicOptions) (*GroupedMessageTopic, error) {
+	return c.newGroupedMessageTopic(name, c.getConfiguredOptions(GroupedMessages, name, options))
 }
 
 type TopicOptions struct {
 	MaxRetentionDuration   *string
 	MaxLength              *int64
 	MaxIdleTimeForMessages *string
+	// PriorityLevels enables the priorities for a Topic, see [Topic.PriorityLevels]
+	PriorityLevels *int64
+	// PriorityWeights are the weights of the priority levels of a Topic, see [Topic.PriorityWeights]
+	PriorityWeights []int64
+	// ExpiredMessagesTopic is the name of the Topic where the expired messages are routed to, see
+	// [Topic.ExpiredMessagesTopic]
+	ExpiredMessagesTopic *string
+	// Lanes enables the lanes for a GroupedMessageTopic, see [GroupedMessageTopic.Lanes]
+	Lanes *int64
+	// FailurePolicy is the policy for the failed messages of a GroupedMessageTopic, see
+	// [GroupedMessageTopic.FailurePolicy]. Defaults to BlockGroup.
+	FailurePolicy *FailurePolicy
+	// MaxDeliveryAttempts is the number of deliveries after which the FailurePolicy is applied. Defaults
+	// to the DefaultMaxDeliveryAttempts.
+	MaxDeliveryAttempts *int64
+	// DeadLetterTopic is the name of the Topic where the failed messages are published to, see
+	// [GroupedMessageTopic.DeadLetterTopic]
+	DeadLetterTopic *string
+	// Compression enables the compression of the large messages, see [Compression]
+	Compression *Compression
+	// ClaimCheck enables storing the Data of the very large messages in a BlobStore, see [ClaimCheck]
+	ClaimCheck *ClaimCheck
+}
+
+func parseRetention(options *TopicOptions) (*time.Duration, error) {
+	if options.MaxRetentionDuration == nil {
+		return nil, nil
+	}
+	retention, err := time.ParseDuration(*options.MaxRetentionDuration)
+	if err != nil {
+		return nil, err
+	}
+	return &retention, nil
 }
 
 type TopicType string
@@ -32,9 +128,22 @@ type TopicType string
 const (
 	UngroupedMessages TopicType = "umts"
 	GroupedMessages   TopicType = "gmts"
+	// PartitionedMessages is the type of a [PartitionedTopic]
+	PartitionedMessages TopicType = "pmts"
 )
 
+// NewTopic creates a [Topic] and registers its name, so that it is returned by the
+// [MQClient.GetAllUngroupedMessageTopics] and the [MQClient.FindUngroupedMessageTopics] functions
 func (c *MQClient) NewTopic(name string, options *TopicOptions) (*Topic, error) {
+	topic, err := c.newTopic(name, options)
+	if err != nil {
+		return nil, err
+	}
+	c.setConfiguredOptions(UngroupedMessages, name, options)
+	return topic, c.registerTopicName(UngroupedMessages, name)
+}
+
+func (c *MQClient) newTopic(name string, options *TopicOptions) (*Topic, error) {
 	if options == nil {
 		options = &TopicOptions{
 			MaxIdleTimeForMessages: &DefaultMaxIdleTimeForMessage,
@@ -43,17 +152,76 @@ func (c *MQClient) NewTopic(name string, options *TopicOptions) (*Topic, error)
 		options.MaxIdleTimeForMessages = &DefaultMaxIdleTimeForMessage
 	}
 	idle, err := time.ParseDuration(*options.MaxIdleTimeForMessages)
+	if err != nil {
+		return nil, err
+	}
+	levels, err := validatePriorityOptions(options)
+	if err != nil {
+		return nil, err
+	}
 	topic := &Topic{
 		StreamKey:              "redimq:umts:" + name,
 		Name:                   name,
 		MQClient:               *c,
 		MaxIdleTimeForMessages: idle,
 		NeedsAcknowledgements:  true,
+		PriorityLevels:         levels,
+		PriorityWeights:        options.PriorityWeights,
 	}
-	return topic, err
+	if options.ExpiredMessagesTopic != nil {
+		topic.ExpiredMessagesTopic = *options.ExpiredMessagesTopic
+	}
+	topic.Compression, err = parseCompression(options)
+	if err == nil {
+		topic.ClaimCheck, err = parseClaimCheck(options)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if topic.PriorityLevels, err = c.persistPriorityLevels(topic, options); err != nil {
+		return nil, err
+	}
+	if topic.PriorityLevels > 1 && len(options.PriorityWeights) > 0 {
+		topic.schedule = newPrioritySchedule(options.PriorityWeights)
+	}
+	return topic, nil
 }
 
+// NewGroupedMessageTopic creates a [GroupedMessageTopic] and registers its name, so that it is returned by
+// the [MQClient.GetAllGroupedMessageTopics] and the [MQClient.FindGroupedMessageTopics] functions
 func (c *MQClient) NewGroupedMessageTopic(name string, options *TopicOptions) (*GroupedMessageTopic, error) {
+	topic, err := c.newGroupedMessageTopic(name, options)
+	if err != nil {
+		return nil, err
+	}
+	c.setConfiguredOptions(GroupedMessages, name, options)
+	return topic, c.registerTopicName(GroupedMessages, name)
+}
+
+// ErrTopicNotFound is returned by [MQClient.GetTopic] and [MQClient.GetGroupedMessageTopic] when the name of
+// the topic is not registered
+var ErrTopicNotFound = errors.New("Topic not found")
+
+// GetTopic returns the [Topic] registered with the name, or ErrTopicNotFound if there is none. Unlike
+// [MQClient.NewTopic], the name is not registered, so it can be used for looking up a topic by a name
+// given by a user. The Topic has the options it was created with using the client, if any.
+func (c *MQClient) GetTopic(name string) (*Topic, error) {
+	if err := c.checkTopicName(UngroupedMessages, name); err != nil {
+		return nil, err
+	}
+	return c.getConfiguredTopic(name, nil)
+}
+
+// GetGroupedMessageTopic returns the [GroupedMessageTopic] registered with the name, or ErrTopicNotFound if
+// there is none. It works the same way as [MQClient.GetTopic].
+func (c *MQClient) GetGroupedMessageTopic(name string) (*GroupedMessageTopic, error) {
+	if err := c.checkTopicName(GroupedMessages, name); err != nil {
+		return nil, err
+	}
+	return c.getConfiguredGroupedMessageTopic(name, nil)
+}
+
+func (c *MQClient) newGroupedMessageTopic(name string, options *TopicOptions) (*GroupedMessageTopic, error) {
 	if options == nil {
 		options = &TopicOptions{
 			MaxIdleTimeForMessages: &DefaultMaxIdleTimeForMessage,
@@ -62,6 +230,10 @@ func (c *MQClient) NewGroupedMessageTopic(name string, options *TopicOptions) (*
 		options.MaxIdleTimeForMessages = &DefaultMaxIdleTimeForMessage
 	}
 	idle, err := time.ParseDuration(*options.MaxIdleTimeForMessages)
+	if err != nil {
+		return nil, err
+	}
+	retention, err := parseRetention(options)
 	topic := &GroupedMessageTopic{
 		StreamPrefix:           "redimq:gmts:" + name,
 		MessageGroupStreamKey:  "{redimq:gmts:" + name + "}:message-groups",
@@ -69,7 +241,30 @@ func (c *MQClient) NewGroupedMessageTopic(name string, options *TopicOptions) (*
 		MessageCountKey:        "redimq:gmts:" + name + ":message-count",
 		Name:                   name,
 		MQClient:               *c,
+		Retention:              retention,
 		MaxIdleTimeForMessages: idle,
+		assignments:            newGroupAssignments(),
+	}
+	if options.ExpiredMessagesTopic != nil {
+		topic.ExpiredMessagesTopic = *options.ExpiredMessagesTopic
+	}
+	if options.Lanes != nil && *options.Lanes < 0 {
+		return nil, errors.New("Lanes should not be negative")
+	}
+	if err == nil {
+		topic.Lanes, err = c.persistTopicSetting(topic.StreamPrefix+":lanes", options.Lanes)
+	}
+	if err == nil && options.Lanes != nil && topic.Lanes != *options.Lanes {
+		err = fmt.Errorf("GroupedMessageTopic %s already exists with %d Lanes", name, topic.Lanes)
+	}
+	if err == nil {
+		err = topic.setFailurePolicy(options)
+	}
+	if err == nil {
+		topic.Compression, err = parseCompression(options)
+	}
+	if err == nil {
+		topic.ClaimCheck, err = parseClaimCheck(options)
 	}
 	return topic, err
 }
@@ -80,7 +275,8 @@ func (c *MQClient) NewConsumer(consumerGroupName string, consumerName string, ha
 		ConsumerName:      consumerName,
 		Handler:           handler,
 		Errors:            make(chan error),
-		inProgressTopic:   map[string]bool{},
+		inProgressTopic:   map[string]*consumeLoop{},
+		client:            c,
 	}
 }
 func (c *MQClient) createGroupAndConsumer(stream string, consumerGroupName string, consumerName string) error {
@@ -93,6 +289,36 @@ func (c *MQClient) createGroupAndConsumer(stream string, consumerGroupName strin
 	return err
 }
 
+func (c *MQClient) registerTopicName(topicType TopicType, name string) error {
+	key := "redimq:" + string(topicType)
+	_, err := c.rc.SAdd(c.c, key, name).Result()
+	return err
+}
+
+// persistTopicSetting stores the value of a setting of a topic that cannot change once the topic has messages,
+// unless it is already stored. It returns the stored value, or 0 if the value is nil and none is stored.
+func (c *MQClient) persistTopicSetting(key string, value *int64) (int64, error) {
+	if value != nil {
+		if _, err := c.rc.SetNX(c.c, key, *value, 0).Result(); err != nil {
+			return 0, err
+		}
+	}
+	stored, err := c.rc.Get(c.c, key).Int64()
+	if err == redis.Nil {
+		return 0, nil
+	}
+	return stored, err
+}
+
+// checkTopicName returns ErrTopicNotFound if the name of the topic is not registered
+func (c *MQClient) checkTopicName(topicType TopicType, name string) error {
+	registered, err := c.rc.SIsMember(c.c, "redimq:"+string(topicType), name).Result()
+	if err == nil && !registered {
+		err = ErrTopicNotFound
+	}
+	return err
+}
+
 func (c *MQClient) getTopics(topicType TopicType) ([]string, error) {
 	key := "redimq:" + string(topicType)
 	ts, err := c.rc.SMembers(c.c, key).Result()
@@ -116,9 +342,11 @@ func (c *MQClient) GetAllUngroupedMessageTopics() ([]*Topic, error) {
 	}
 	topics := make([]*Topic, len(ts))
 	for i, t := range ts {
-		topics[i] = &Topic{Name: t, MQClient: *c}
+		if topics[i], err = c.newTopic(t, nil); err != nil {
+			return nil, err
+		}
 	}
-	return topics, err
+	return topics, nil
 }
 
 func (c *MQClient) GetAllGroupedMessageTopics() ([]*GroupedMessageTopic, error) {
@@ -128,9 +356,11 @@ func (c *MQClient) GetAllGroupedMessageTopics() ([]*GroupedMessageTopic, error)
 	}
 	topics := make([]*GroupedMessageTopic, len(ts))
 	for i, t := range ts {
-		topics[i] = &GroupedMessageTopic{Name: t, MQClient: *c}
+		if topics[i], err = c.newGroupedMessageTopic(t, nil); err != nil {
+			return nil, err
+		}
 	}
-	return topics, err
+	return topics, nil
 }
 
 func (c *MQClient) FindUngroupedMessageTopics(pattern *string, count int64, cursor uint64) ([]*Topic, uint64, error) {
@@ -140,9 +370,11 @@ func (c *MQClient) FindUngroupedMessageTopics(pattern *string, count int64, curs
 	}
 	topics := make([]*Topic, len(ts))
 	for i, t := range ts {
-		topics[i] = &Topic{Name: t, MQClient: *c}
+		if topics[i], err = c.newTopic(t, nil); err != nil {
+			return nil, 0, err
+		}
 	}
-	return topics, cur, err
+	return topics, cur, nil
 }
 
 func (c *MQClient) FindGroupedMessageTopics(pattern *string, count int64, cursor uint64) ([]*GroupedMessageTopic, uint64, error) {
@@ -152,7 +384,15 @@ func (c *MQClient) FindGroupedMessageTopics(pattern *string, count int64, cursor
 	}
 	topics := make([]*GroupedMessageTopic, len(ts))
 	for i, t := range ts {
-		topics[i] = &GroupedMessageTopic{Name: t, MQClient: *c}
+		if topics[i], err = c.newGroupedMessageTopic(t, nil); err != nil {
+			return nil, 0, err
+		}
 	}
-	return topics, cur, err
+	return topics, cur, nil
+}
+
+// FindPartitionedTopicNames returns the names of the registered PartitionedTopics matching the pattern. The
+// names are returned instead of the topics, as a PartitionedTopic is created with its number of partitions.
+func (c *MQClient) FindPartitionedTopicNames(pattern *string, count int64, cursor uint64) ([]string, uint64, error) {
+	return c.findTopics(PartitionedMessages, pattern, count, cursor)
 }
@@ -156,4 +156,23 @@ func TestFindGroupedMessageTopics(t *testing.T) {
 			}
 		}
 	}
-}
\ No newline at end of file
+}
+
+func TestClientGetTopic(t *testing.T) {
+	name := getTestName(t, "get-topic")
+	if _, err := client.GetTopic(name); err != ErrTopicNotFound {
+		t.Error("GetTopic did not return ErrTopicNotFound for a missing topic", err)
+	}
+	if _, err := client.GetGroupedMessageTopic(name); err != ErrTopicNotFound {
+		t.Error("GetGroupedMessageTopic did not return ErrTopicNotFound for a missing topic", err)
+	}
+	if registered, _ := client.rc.SIsMember(client.c, "redimq:"+string(UngroupedMessages), name).Result(); registered {
+		t.Error("GetTopic registered the name of a missing topic")
+	}
+	levels := int64(2)
+	client.NewTopic(name, &TopicOptions{PriorityLevels: &levels})
+	topic, err := client.GetTopic(name)
+	if err != nil || topic.Name != name || topic.PriorityLevels != levels {
+		t.Error("GetTopic did not return the registered topic", topic, err)
+	}
+}
@@ -0,0 +1,157 @@
+// Package outbox implements the transactional outbox pattern for RediMQ on top of database/sql. The messages
+// are written to an outbox table within the transaction of the application, so that they are published if
+// and only if the transaction commits, and a [Relay] forwards them from the table to their topics.
+//
+//	ob := outbox.New(db, &outbox.Options{Dialect: outbox.Postgres})
+//	tx, _ := db.BeginTx(ctx, nil)
+//	tx.ExecContext(ctx, "UPDATE orders SET status = 'paid' WHERE id = $1", id)
+//	ob.PublishToGroup(ctx, tx, "orders", id, &redimq.Message{Data: map[string]interface{}{"status": "paid"}})
+//	tx.Commit()
+//
+// The messages are relayed at least once, in the order they were written to the outbox unless their rows
+// get parked or their transactions outlast the settle window of the [Relay], so the consumers should be
+// idempotent. Every relayed message has the HeaderOutboxId header which is unique per outbox
+// table and can be used for detecting the duplicates.
+package outbox
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/webbytes/redimq"
+)
+
+// HeaderOutboxId is the header holding the id of the outbox row that a relayed message was written to
+const HeaderOutboxId = "redimq-outbox-id"
+
+// DefaultTable is the name of the outbox table used when it is not set in the Options
+var DefaultTable = "redimq_outbox"
+
+// Dialect holds the SQL that differs between the databases
+type Dialect struct {
+	// Placeholder returns the placeholder of the nth (starting from 1) argument of a query
+	Placeholder func(n int) string
+	// CreateTable is the statement creating the outbox table, with a %s for the name of the table. The
+	// id should be assigned in the order of the inserts, and the attempts and parked columns default to zero
+	// and false.
+	CreateTable string
+}
+
+var (
+	// SQLite is the Dialect for SQLite
+	SQLite = &Dialect{
+		Placeholder: func(n int) string { return "?" },
+		CreateTable: `CREATE TABLE IF NOT EXISTS %s (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	topic TEXT NOT NULL,
+	grouped INTEGER NOT NULL,
+	group_key TEXT NOT NULL,
+	payload TEXT NOT NULL,
+	attempts INTEGER NOT NULL DEFAULT 0,
+	parked INTEGER NOT NULL DEFAULT 0
+)`,
+	}
+	// Postgres is the Dialect for PostgreSQL
+	Postgres = &Dialect{
+		Placeholder: func(n int) string { return "$" + strconv.Itoa(n) },
+		CreateTable: `CREATE TABLE IF NOT EXISTS %s (
+	id BIGSERIAL PRIMARY KEY,
+	topic TEXT NOT NULL,
+	grouped BOOLEAN NOT NULL,
+	group_key TEXT NOT NULL,
+	payload TEXT NOT NULL,
+	attempts INTEGER NOT NULL DEFAULT 0,
+	parked BOOLEAN NOT NULL DEFAULT FALSE
+)`,
+	}
+	// MySQL is the Dialect for MySQL and MariaDB
+	MySQL = &Dialect{
+		Placeholder: func(n int) string { return "?" },
+		CreateTable: `CREATE TABLE IF NOT EXISTS %s (
+	id BIGINT AUTO_INCREMENT PRIMARY KEY,
+	topic VARCHAR(255) NOT NULL,
+	grouped BOOLEAN NOT NULL,
+	group_key VARCHAR(255) NOT NULL,
+	payload LONGTEXT NOT NULL,
+	attempts INT NOT NULL DEFAULT 0,
+	parked BOOLEAN NOT NULL DEFAULT FALSE
+)`,
+	}
+)
+
+// Options are the options of an Outbox
+type Options struct {
+	// Table is the name of the outbox table. Defaults to the DefaultTable.
+	Table string
+	// Dialect is the Dialect of the database. Defaults to SQLite, whose placeholders work for MySQL too.
+	Dialect *Dialect
+}
+
+// Outbox writes the messages to the outbox table of a database
+type Outbox struct {
+	DB      *sql.DB
+	Table   string
+	Dialect *Dialect
+}
+
+// payload is the message as stored in the payload column of the outbox table
+type payload struct {
+	Data      map[string]interface{} `json:"data"`
+	Headers   map[string]string      `json:"headers,omitempty"`
+	Priority  int64                  `json:"priority,omitempty"`
+	ExpiresAt *time.Time             `json:"expiresAt,omitempty"`
+}
+
+// New creates an Outbox using the database
+func New(db *sql.DB, options *Options) *Outbox {
+	if options == nil {
+		options = &Options{}
+	}
+	o := &Outbox{DB: db, Table: options.Table, Dialect: options.Dialect}
+	if o.Table == "" {
+		o.Table = DefaultTable
+	}
+	if o.Dialect == nil {
+		o.Dialect = SQLite
+	}
+	return o
+}
+
+// CreateTable creates the outbox table if it does not exist. The table can be created by the migrations of
+// the application instead, using the CreateTable statement of the Dialect.
+func (o *Outbox) CreateTable(ctx context.Context) error {
+	_, err := o.DB.ExecContext(ctx, fmt.Sprintf(o.Dialect.CreateTable, o.Table))
+	return err
+}
+
+func (o *Outbox) write(ctx context.Context, tx *sql.Tx, topic string, grouped bool, groupKey string, m *redimq.Message) error {
+	p := &payload{Data: m.Data, Headers: m.Headers, Priority: m.Priority}
+	if !m.ExpiresAt.IsZero() {
+		p.ExpiresAt = &m.ExpiresAt
+	}
+	data, err := json.Marshal(p)
+	if err != nil {
+		return err
+	}
+	ph := o.Dialect.Placeholder
+	query := fmt.Sprintf("INSERT INTO %s (topic, grouped, group_key, payload) VALUES (%s, %s, %s, %s)", o.Table, ph(1), ph(2), ph(3), ph(4))
+	_, err = tx.ExecContext(ctx, query, topic, grouped, groupKey, string(data))
+	return err
+}
+
+// Publish writes the message for the Topic of the name to the outbox within the transaction. The message
+// is published by the Relay once the transaction commits, with its Data, Headers, Priority and ExpiresAt.
+func (o *Outbox) Publish(ctx context.Context, tx *sql.Tx, topic string, m *redimq.Message) error {
+	return o.write(ctx, tx, topic, false, "", m)
+}
+
+// PublishToGroup writes the message for the message group of the GroupedMessageTopic of the name to the
+// outbox within the transaction. The messages of a message group are published in the order they were
+// written.
+func (o *Outbox) PublishToGroup(ctx context.Context, tx *sql.Tx, topic string, groupKey string, m *redimq.Message) error {
+	return o.write(ctx, tx, topic, true, groupKey, m)
+}
@@ -0,0 +1,192 @@
+package outbox
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/webbytes/redimq"
+	"github.com/webbytes/redimq/redimqtest"
+	_ "modernc.org/sqlite"
+)
+
+func newOutbox(t *testing.T) *Outbox {
+	db, err := sql.Open("sqlite", filepath.Join(t.TempDir(), "outbox.db"))
+	if err != nil {
+		t.Fatal("Opening the database failed", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	o := New(db, nil)
+	if err := o.CreateTable(context.TODO()); err != nil {
+		t.Fatal("CreateTable failed", err)
+	}
+	return o
+}
+
+func countRows(t *testing.T, o *Outbox) int {
+	var n int
+	if err := o.DB.QueryRow("SELECT COUNT(*) FROM " + o.Table).Scan(&n); err != nil {
+		t.Fatal("Counting the rows failed", err)
+	}
+	return n
+}
+
+func TestPublishWithinTransaction(t *testing.T) {
+	ctx := context.TODO()
+	o := newOutbox(t)
+	tx, _ := o.DB.BeginTx(ctx, nil)
+	o.Publish(ctx, tx, "orders", &redimq.Message{Data: map[string]interface{}{"id": "1"}})
+	tx.Rollback()
+	if n := countRows(t, o); n != 0 {
+		t.Error("Message of a rolled back transaction is in the outbox", n)
+	}
+	tx, _ = o.DB.BeginTx(ctx, nil)
+	if err := o.Publish(ctx, tx, "orders", &redimq.Message{Data: map[string]interface{}{"id": "1"}}); err != nil {
+		t.Fatal("Publish failed", err)
+	}
+	tx.Commit()
+	if n := countRows(t, o); n != 1 {
+		t.Error("Message of a committed transaction is not in the outbox", n)
+	}
+}
+
+func TestRelayMessages(t *testing.T) {
+	ctx := context.TODO()
+	h := redimqtest.New(t)
+	o := newOutbox(t)
+	orders := h.GroupedMessageTopic("orders", nil)
+	tx, _ := o.DB.BeginTx(ctx, nil)
+	for _, v := range []string{"1", "2", "3"} {
+		o.PublishToGroup(ctx, tx, "orders", "customer-"+v, &redimq.Message{Data: map[string]interface{}{"seq": "a" + v}})
+		o.PublishToGroup(ctx, tx, "orders", "customer-1", &redimq.Message{Data: map[string]interface{}{"seq": "b" + v}})
+	}
+	o.Publish(ctx, tx, "audit", &redimq.Message{Data: map[string]interface{}{"seq": "1"}, Headers: map[string]string{"source": "test"}, Priority: 0})
+	tx.Commit()
+	relay := o.NewRelay(h.Client)
+	relay.AddGroupedMessageTopic(orders)
+	relayed, err := relay.RelayMessages(ctx)
+	if err != nil || relayed != 7 {
+		t.Fatal("RelayMessages failed", relayed, err)
+	}
+	if n := countRows(t, o); n != 0 {
+		t.Error("Relayed rows are not deleted", n)
+	}
+	page, _ := orders.BrowseGroup("customer-1", nil)
+	seqs := []interface{}{}
+	for _, m := range page.Messages {
+		seqs = append(seqs, m.Data["seq"])
+	}
+	if len(seqs) != 4 || seqs[0] != "a1" || seqs[1] != "b1" || seqs[2] != "b2" || seqs[3] != "b3" {
+		t.Error("Messages of the message group are not relayed in order", seqs)
+	}
+	if page.Messages[0].Headers[HeaderOutboxId] == "" {
+		t.Error("HeaderOutboxId is not set", page.Messages[0].Headers)
+	}
+	audit := h.Topic("audit", nil)
+	if page, _ := audit.Browse(nil); len(page.Messages) != 1 || page.Messages[0].Headers["source"] != "test" {
+		t.Error("Message of the Topic is not relayed", page.Messages)
+	}
+}
+
+func TestRelayStopsAtFailure(t *testing.T) {
+	ctx := context.TODO()
+	h := redimqtest.New(t)
+	o := newOutbox(t)
+	tx, _ := o.DB.BeginTx(ctx, nil)
+	for _, v := range []string{"1", "2"} {
+		o.Publish(ctx, tx, "orders", &redimq.Message{Data: map[string]interface{}{"seq": v}})
+	}
+	tx.Commit()
+	relay := o.NewRelay(h.Client)
+	injected := errors.New("LOADING Redis is loading the dataset in memory")
+	h.FailCommands(injected, 1, "xadd")
+	if relayed, err := relay.RelayMessages(ctx); err != injected || relayed != 0 {
+		t.Fatal("RelayMessages did not stop at the failure", relayed, err)
+	}
+	if n := countRows(t, o); n != 2 {
+		t.Error("Row of the failed message is deleted", n)
+	}
+	if relayed, err := relay.RelayMessages(ctx); err != nil || relayed != 2 {
+		t.Fatal("RelayMessages did not retry the failed message", relayed, err)
+	}
+	page, _ := h.Topic("orders", nil).Browse(nil)
+	if len(page.Messages) != 2 || page.Messages[0].Data["seq"] != "1" {
+		t.Error("Messages are not relayed in order after the failure", page.Messages)
+	}
+}
+
+func TestRelayWaitsForGap(t *testing.T) {
+	ctx := context.TODO()
+	h := redimqtest.New(t)
+	o := newOutbox(t)
+	tx, _ := o.DB.BeginTx(ctx, nil)
+	for _, v := range []string{"1", "2", "3"} {
+		o.Publish(ctx, tx, "orders", &redimq.Message{Data: map[string]interface{}{"seq": v}})
+	}
+	tx.Commit()
+	var row2 [4]interface{}
+	if err := o.DB.QueryRow("SELECT topic, grouped, group_key, payload FROM "+o.Table+" WHERE id = 2").Scan(&row2[0], &row2[1], &row2[2], &row2[3]); err != nil {
+		t.Fatal("Reading the row failed", err)
+	}
+	o.DB.Exec("DELETE FROM " + o.Table + " WHERE id = 2")
+	relay := o.NewRelay(h.Client)
+	relay.SettleWindow = time.Hour
+	if relayed, err := relay.RelayMessages(ctx); err != nil || relayed != 1 {
+		t.Fatal("RelayMessages did not stop at the gap", relayed, err)
+	}
+	o.DB.Exec("INSERT INTO "+o.Table+" (id, topic, grouped, group_key, payload) VALUES (2, ?, ?, ?, ?)", row2[:]...)
+	if relayed, err := relay.RelayMessages(ctx); err != nil || relayed != 2 {
+		t.Fatal("RelayMessages did not relay the filled gap", relayed, err)
+	}
+	page, _ := h.Topic("orders", nil).Browse(nil)
+	if len(page.Messages) != 3 || page.Messages[1].Data["seq"] != "2" || page.Messages[2].Data["seq"] != "3" {
+		t.Error("Messages are not relayed in the order of the ids", page.Messages)
+	}
+	tx, _ = o.DB.BeginTx(ctx, nil)
+	for _, v := range []string{"4", "5"} {
+		o.Publish(ctx, tx, "orders", &redimq.Message{Data: map[string]interface{}{"seq": v}})
+	}
+	tx.Commit()
+	o.DB.Exec("DELETE FROM " + o.Table + " WHERE id = 4")
+	if relayed, err := relay.RelayMessages(ctx); err != nil || relayed != 0 {
+		t.Fatal("RelayMessages did not stop at the gap", relayed, err)
+	}
+	relay.SettleWindow = 0
+	if relayed, err := relay.RelayMessages(ctx); err != nil || relayed != 1 {
+		t.Fatal("RelayMessages did not skip the settled gap", relayed, err)
+	}
+}
+
+func TestRelayParksFailingRow(t *testing.T) {
+	ctx := context.TODO()
+	h := redimqtest.New(t)
+	o := newOutbox(t)
+	o.DB.Exec("INSERT INTO "+o.Table+" (topic, grouped, group_key, payload) VALUES (?, ?, ?, ?)", "orders", false, "", "invalid")
+	tx, _ := o.DB.BeginTx(ctx, nil)
+	o.Publish(ctx, tx, "orders", &redimq.Message{Data: map[string]interface{}{"seq": "2"}})
+	tx.Commit()
+	relay := o.NewRelay(h.Client)
+	relay.MaxAttempts = 2
+	relay.Errors = make(chan error, 1)
+	if relayed, err := relay.RelayMessages(ctx); err == nil || relayed != 0 {
+		t.Fatal("RelayMessages did not stop at the failing row", relayed, err)
+	}
+	if relayed, err := relay.RelayMessages(ctx); err != nil || relayed != 1 {
+		t.Fatal("RelayMessages did not skip the parked row", relayed, err)
+	}
+	select {
+	case <-relay.Errors:
+	default:
+		t.Error("Error of the parked row is not reported")
+	}
+	var parked bool
+	if err := o.DB.QueryRow("SELECT parked FROM " + o.Table + " WHERE id = 1").Scan(&parked); err != nil || !parked {
+		t.Error("Failing row is not parked", parked, err)
+	}
+	if relayed, err := relay.RelayMessages(ctx); err != nil || relayed != 0 {
+		t.Error("Parked row is relayed", relayed, err)
+	}
+}
@@ -0,0 +1,313 @@
+package outbox
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/webbytes/redimq"
+)
+
+// DefaultRelayBatchSize is the number of rows read from the outbox table at a time by a Relay
+var DefaultRelayBatchSize int64 = 100
+
+// DefaultRelayPollInterval is the time a Relay waits for new rows once the outbox table is empty
+var DefaultRelayPollInterval = time.Second
+
+// DefaultRelaySettleWindow is the time a Relay waits for a gap in the ids of the rows to be filled
+var DefaultRelaySettleWindow = 5 * time.Second
+
+// DefaultRelayMaxAttempts is the number of times a Relay tries to publish the message of a row before
+// parking it
+var DefaultRelayMaxAttempts int64 = 5
+
+// Relay forwards the messages from the outbox table to their topics. A row is deleted once its message is
+// published, so a message may be published twice if the relay stops in between. Only one Relay should run
+// for an outbox table, e.g. as a leader duty of a consumer.
+//
+// The rows are relayed in the order of their ids. The ids are assigned on insert but the rows are seen only
+// once their transactions commit, so a gap in the ids may be a transaction that is still in progress. The
+// relaying stops at a gap till it is filled or it has been seen for the SettleWindow, after which it is
+// taken for a rolled back transaction, so the rows of a transaction committing after that are relayed late.
+// A Relay does not know the last relayed id when it starts, so it waits for the SettleWindow before relaying
+// rows written before it started.
+//
+// The relaying also stops at the first message that could not be published, so that the messages are not
+// published out of order. A message failing with an error other than a connection error or a REDIS error
+// like LOADING is tried MaxAttempts times, after which its row is parked, i.e. skipped and left in the
+// table with parked set, and the error is sent to the Errors channel. A parked row is relayed again once
+// its parked column is reset.
+//
+//	relay := ob.NewRelay(client)
+//	relay.AddGroupedMessageTopic(orders)
+//	consumer.AddLeaderDuty("orders-outbox", time.Second, func(token int64) error {
+//		_, err := relay.RelayMessages(ctx)
+//		return err
+//	})
+type Relay struct {
+	Outbox    *Outbox
+	Client    *redimq.MQClient
+	BatchSize int64
+	// PollInterval is the time waited by Run once the outbox table is empty or relaying has failed
+	PollInterval time.Duration
+	// SettleWindow is the time a gap in the ids of the rows is waited for before it is skipped. The
+	// messages of the transactions taking longer than it to commit may be relayed out of order.
+	SettleWindow time.Duration
+	// MaxAttempts is the number of times the message of a row is tried before the row is parked
+	MaxAttempts int64
+	// Errors receives the errors encountered by Run and the errors of the parked rows, if it is being read
+	Errors   chan error
+	topics   map[string]*redimq.Topic
+	gmts     map[string]*redimq.GroupedMessageTopic
+	lastId   int64
+	gapSince time.Time
+	relayMu  sync.Mutex
+	mu       sync.Mutex
+}
+
+// row is a row of the outbox table
+type row struct {
+	id       int64
+	topic    string
+	grouped  bool
+	groupKey string
+	payload  string
+	attempts int64
+}
+
+// NewRelay creates a Relay forwarding the messages of the Outbox using the client
+func (o *Outbox) NewRelay(client *redimq.MQClient) *Relay {
+	return &Relay{
+		Outbox:       o,
+		Client:       client,
+		BatchSize:    DefaultRelayBatchSize,
+		PollInterval: DefaultRelayPollInterval,
+		SettleWindow: DefaultRelaySettleWindow,
+		MaxAttempts:  DefaultRelayMaxAttempts,
+		Errors:       make(chan error),
+		topics:       map[string]*redimq.Topic{},
+		gmts:         map[string]*redimq.GroupedMessageTopic{},
+	}
+}
+
+// AddTopic sets the Topic used for publishing the messages written for its name, so that they are
+// published with its options. The Topics not added are created with the default options.
+func (r *Relay) AddTopic(t *redimq.Topic) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.topics[t.Name] = t
+}
+
+// AddGroupedMessageTopic sets the GroupedMessageTopic used for publishing the messages written for its
+// name, so that they are published with its options, e.g. its Lanes. The GroupedMessageTopics not added are
+// created with the default options.
+func (r *Relay) AddGroupedMessageTopic(t *redimq.GroupedMessageTopic) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.gmts[t.Name] = t
+}
+
+func (r *Relay) getTopic(name string) (*redimq.Topic, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if t, ok := r.topics[name]; ok {
+		return t, nil
+	}
+	t, err := r.Client.NewTopic(name, nil)
+	if err == nil {
+		r.topics[name] = t
+	}
+	return t, err
+}
+
+func (r *Relay) getGroupedMessageTopic(name string) (*redimq.GroupedMessageTopic, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if t, ok := r.gmts[name]; ok {
+		return t, nil
+	}
+	t, err := r.Client.NewGroupedMessageTopic(name, nil)
+	if err == nil {
+		r.gmts[name] = t
+	}
+	return t, err
+}
+
+// readRows returns the oldest rows of the outbox table, leaving out the parked rows
+func (r *Relay) readRows(ctx context.Context) ([]*row, error) {
+	o := r.Outbox
+	query := fmt.Sprintf("SELECT id, topic, grouped, group_key, payload, attempts FROM %s WHERE parked = %s ORDER BY id LIMIT %d", o.Table, o.Dialect.Placeholder(1), r.BatchSize)
+	res, err := o.DB.QueryContext(ctx, query, false)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Close()
+	rows := []*row{}
+	for res.Next() {
+		rw := &row{}
+		if err := res.Scan(&rw.id, &rw.topic, &rw.grouped, &rw.groupKey, &rw.payload, &rw.attempts); err != nil {
+			return nil, err
+		}
+		rows = append(rows, rw)
+	}
+	return rows, res.Err()
+}
+
+// publish publishes the message of the row to its topic
+func (r *Relay) publish(rw *row) error {
+	p := &payload{}
+	if err := json.Unmarshal([]byte(rw.payload), p); err != nil {
+		return fmt.Errorf("invalid payload of the outbox row %d: %v", rw.id, err)
+	}
+	headers := make(map[string]string, len(p.Headers)+1)
+	for k, v := range p.Headers {
+		headers[k] = v
+	}
+	headers[HeaderOutboxId] = strconv.FormatInt(rw.id, 10)
+	m := &redimq.Message{Data: p.Data, Headers: headers, Priority: p.Priority}
+	if p.ExpiresAt != nil {
+		m.ExpiresAt = *p.ExpiresAt
+	}
+	if rw.grouped {
+		t, err := r.getGroupedMessageTopic(rw.topic)
+		if err != nil {
+			return err
+		}
+		return t.PublishMessage(rw.groupKey, m)
+	}
+	t, err := r.getTopic(rw.topic)
+	if err != nil {
+		return err
+	}
+	return t.PublishMessage(m)
+}
+
+// settled returns whether the row of the id can be relayed, i.e. it follows the last relayed row, the gap
+// before it has been seen for the SettleWindow or it has committed after its gap was skipped
+func (r *Relay) settled(id int64) bool {
+	if id <= r.lastId {
+		return true
+	}
+	if id == r.lastId+1 {
+		r.gapSince = time.Time{}
+		return true
+	}
+	if r.gapSince.IsZero() {
+		r.gapSince = time.Now()
+	}
+	return time.Since(r.gapSince) >= r.SettleWindow
+}
+
+// relayedRow records the row of the id as relayed or parked
+func (r *Relay) relayedRow(id int64) {
+	if id > r.lastId {
+		r.lastId = id
+	}
+}
+
+// isTransient returns whether the error is a connection error or a REDIS error that goes away on its own, so
+// that the message failing with it is retried without counting the attempt
+func isTransient(err error) bool {
+	var netErr net.Error
+	if errors.As(err, &netErr) || errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.Is(err, redis.ErrClosed) || errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return true
+	}
+	for _, prefix := range []string{"LOADING ", "READONLY ", "CLUSTERDOWN ", "TRYAGAIN ", "MASTERDOWN "} {
+		if strings.HasPrefix(err.Error(), prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// fail counts the failed attempt of the row and parks it once it has been tried MaxAttempts times. It returns
+// whether the row is parked.
+func (r *Relay) fail(ctx context.Context, rw *row, err error) (bool, error) {
+	o := r.Outbox
+	ph := o.Dialect.Placeholder
+	attempts := rw.attempts + 1
+	parked := attempts >= r.MaxAttempts
+	query := fmt.Sprintf("UPDATE %s SET attempts = %s, parked = %s WHERE id = %s", o.Table, ph(1), ph(2), ph(3))
+	if _, err := o.DB.ExecContext(ctx, query, attempts, parked, rw.id); err != nil {
+		return false, err
+	}
+	if parked {
+		r.sendError(fmt.Errorf("outbox row %d is parked after %d attempts: %v", rw.id, attempts, err))
+	}
+	return parked, nil
+}
+
+// RelayMessages publishes upto BatchSize of the oldest messages of the outbox table and deletes their rows.
+// It stops at a gap in the ids that has not settled and at the first message that could not be published,
+// so that it is retried before the later ones on the next call, unless its row gets parked. It returns the
+// number of messages relayed.
+func (r *Relay) RelayMessages(ctx context.Context) (int64, error) {
+	r.relayMu.Lock()
+	defer r.relayMu.Unlock()
+	var relayed int64
+	rows, err := r.readRows(ctx)
+	if err != nil {
+		return relayed, err
+	}
+	query := fmt.Sprintf("DELETE FROM %s WHERE id = %s", r.Outbox.Table, r.Outbox.Dialect.Placeholder(1))
+	for _, rw := range rows {
+		if !r.settled(rw.id) {
+			return relayed, nil
+		}
+		if err := r.publish(rw); err != nil {
+			if isTransient(err) {
+				return relayed, err
+			}
+			parked, ferr := r.fail(ctx, rw, err)
+			if ferr != nil {
+				return relayed, ferr
+			}
+			if !parked {
+				return relayed, err
+			}
+			r.relayedRow(rw.id)
+			continue
+		}
+		if _, err := r.Outbox.DB.ExecContext(ctx, query, rw.id); err != nil {
+			return relayed, err
+		}
+		r.relayedRow(rw.id)
+		relayed++
+	}
+	return relayed, nil
+}
+
+func (r *Relay) sendError(err error) {
+	select {
+	case r.Errors <- err:
+	default:
+	}
+}
+
+// Run relays the messages of the outbox table till the context is done, waiting for the PollInterval
+// whenever the table is empty or relaying fails. The errors are sent to the Errors channel.
+func (r *Relay) Run(ctx context.Context) error {
+	for {
+		relayed, err := r.RelayMessages(ctx)
+		if err != nil && ctx.Err() == nil {
+			r.sendError(err)
+		}
+		if err == nil && relayed == r.BatchSize {
+			continue
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(r.PollInterval):
+		}
+	}
+}
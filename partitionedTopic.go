@@ -0,0 +1,284 @@
+package redimq
+
+import (
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"strconv"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// HeaderPartitionKey is the header holding the key used for selecting the partition of a message
+const HeaderPartitionKey = "redimq-partition-key"
+
+// PartitionedTopic is a topic whose messages are spread across a fixed number of partitions, each backed by
+// a separate stream, so that the load is not pinned to a single REDIS key or cluster shard. It is created
+// using the NewPartitionedTopic function of the MQClient.
+//
+// A message published with a partition key always goes to the same partition, selected by the hash of the
+// key, while a message without a key is published to the partitions in a round-robin manner. Every
+// partition is assigned to one of the live consumers of a consumer group using rendezvous hashing, so the
+// partitions are rebalanced when consumers join or leave. If Ordered is set, a partition delivers its next
+// message only after the previous one is acknowledged, which preserves the order of the messages having
+// the same partition key.
+//
+//	pt, err := client.NewPartitionedTopic("orders", 8, nil)
+//	pt.PublishMessage("customer-1", &redimq.Message{Data: data})
+//	msgs, err := pt.ConsumeMessages("billing", "instance-1", 10)
+type PartitionedTopic struct {
+	StreamPrefix           string // redimq:pmts:test
+	PartitionCountKey      string // redimq:pmts:test:partitions
+	RoundRobinKey          string // redimq:pmts:test:round-robin
+	Name                   string
+	Partitions             int64
+	Ordered                bool
+	Retention              *time.Duration
+	MaxLen                 *int64
+	MaxIdleTimeForMessages time.Duration
+	ExpiredMessagesTopic   string
+	// Compression compresses the Data of the large messages published to the topic, see [Compression]
+	Compression *Compression
+	MQClient
+}
+
+// NewPartitionedTopic creates a [PartitionedTopic] with the number of partitions and registers its name, so
+// that it is returned by the [MQClient.FindPartitionedTopicNames] function. The number of partitions is
+// stored in REDIS when the topic is first created and an error is returned if it is created again with a
+// different number, as that would move the partition keys to different partitions.
+func (c *MQClient) NewPartitionedTopic(name string, partitions int64, options *TopicOptions) (*PartitionedTopic, error) {
+	if partitions <= 0 {
+		return nil, errors.New("Partitions should be greater than 0")
+	}
+	if options == nil {
+		options = &TopicOptions{
+			MaxIdleTimeForMessages: &DefaultMaxIdleTimeForMessage,
+		}
+	} else if options.MaxIdleTimeForMessages == nil {
+		options.MaxIdleTimeForMessages = &DefaultMaxIdleTimeForMessage
+	}
+	if options.PriorityLevels != nil {
+		return nil, errors.New("PriorityLevels are not supported for a PartitionedTopic")
+	}
+	idle, err := time.ParseDuration(*options.MaxIdleTimeForMessages)
+	if err != nil {
+		return nil, err
+	}
+	retention, err := parseRetention(options)
+	if err != nil {
+		return nil, err
+	}
+	compression, err := parseCompression(options)
+	if err != nil {
+		return nil, err
+	}
+	topic := &PartitionedTopic{
+		StreamPrefix:           "redimq:pmts:" + name,
+		PartitionCountKey:      "redimq:pmts:" + name + ":partitions",
+		RoundRobinKey:          "redimq:pmts:" + name + ":round-robin",
+		Name:                   name,
+		Partitions:             partitions,
+		Retention:              retention,
+		MaxLen:                 options.MaxLength,
+		MaxIdleTimeForMessages: idle,
+		Compression:            compression,
+		MQClient:               *c,
+	}
+	if options.ExpiredMessagesTopic != nil {
+		topic.ExpiredMessagesTopic = *options.ExpiredMessagesTopic
+	}
+	_, err = c.rc.SetNX(c.c, topic.PartitionCountKey, partitions, 0).Result()
+	if err != nil {
+		return nil, err
+	}
+	existing, err := c.rc.Get(c.c, topic.PartitionCountKey).Int64()
+	if err != nil {
+		return nil, err
+	}
+	if existing != partitions {
+		return nil, fmt.Errorf("PartitionedTopic %s already exists with %d partitions", name, existing)
+	}
+	return topic, c.registerTopicName(PartitionedMessages, name)
+}
+
+func (t *PartitionedTopic) getStreamKeyForPartition(partition int64) string {
+	return fmt.Sprintf("%s:p:%d", t.StreamPrefix, partition)
+}
+
+// getTopicForPartition returns the Topic for the stream of the partition
+func (t *PartitionedTopic) getTopicForPartition(partition int64) *Topic {
+	return &Topic{
+		StreamKey:              t.getStreamKeyForPartition(partition),
+		Name:                   fmt.Sprintf("%s#%d", t.Name, partition),
+		Retention:              t.Retention,
+		MaxLen:                 t.MaxLen,
+		MaxIdleTimeForMessages: t.MaxIdleTimeForMessages,
+		NeedsAcknowledgements:  true,
+		Compression:            t.Compression,
+		MQClient:               t.MQClient,
+	}
+}
+
+// PartitionFor returns the partition for the partition key
+func (t *PartitionedTopic) PartitionFor(partitionKey string) int64 {
+	h := fnv.New64a()
+	h.Write([]byte(partitionKey))
+	return int64(mix64(h.Sum64()) % uint64(t.Partitions))
+}
+
+// PublishMessage publishes the message to the partition selected by the hash of the partition key. If the
+// partition key is empty, the partitions are selected in a round-robin manner. The partition key is
+// published in the headers of the message and returned as the GroupKey of the consumed message.
+func (t *PartitionedTopic) PublishMessage(partitionKey string, m *Message) error {
+	var partition int64
+	if partitionKey != "" {
+		partition = t.PartitionFor(partitionKey)
+		headers := make(map[string]string, len(m.Headers)+1)
+		for k, v := range m.Headers {
+			headers[k] = v
+		}
+		headers[HeaderPartitionKey] = partitionKey
+		m.Headers = headers
+	} else {
+		n, err := t.MQClient.rc.Incr(t.MQClient.c, t.RoundRobinKey).Result()
+		if err != nil {
+			return err
+		}
+		partition = (n - 1) % t.Partitions
+	}
+	m.GroupKey = partitionKey
+	return t.getTopicForPartition(partition).PublishMessage(m)
+}
+
+// GetAssignedPartitions returns the partitions assigned to the consumer of the consumer group. The
+// partitions are spread across the live consumers of the consumer group in the consumer registry that are
+// consuming this topic.
+func (t *PartitionedTopic) GetAssignedPartitions(consumerGroupName string, consumerName string) []int64 {
+	members := t.MQClient.getAssignmentMembers("pmts:"+t.Name, consumerGroupName, consumerName)
+	return t.assignPartitions(members, consumerName)
+}
+
+func (t *PartitionedTopic) assignPartitions(members []string, consumerName string) []int64 {
+	assigned := []int64{}
+	for p := int64(0); p < t.Partitions; p++ {
+		if rendezvousOwner(strconv.FormatInt(p, 10), members) == consumerName {
+			assigned = append(assigned, p)
+		}
+	}
+	return assigned
+}
+
+// ConsumeMessages consumes upto count messages from the partitions assigned to the consumer. The stuck
+// messages of a partition, i.e. the ones not acknowledged within the MaxIdleTimeForMessages, are claimed
+// before new messages are read. If the topic is Ordered, at most one message is returned from every
+// partition and a partition is skipped while its previous message is being processed by another live
+// consumer, e.g. the previous owner of the partition after a rebalance.
+func (t *PartitionedTopic) ConsumeMessages(consumerGroupName string, consumerName string, count int64) ([]*Message, error) {
+	msgs := []*Message{}
+	names := t.MQClient.getAssignmentMembers("pmts:"+t.Name, consumerGroupName, consumerName)
+	members := make(map[string]bool, len(names))
+	for _, m := range names {
+		members[m] = true
+	}
+	for _, p := range t.assignPartitions(names, consumerName) {
+		remaining := count - int64(len(msgs))
+		if remaining <= 0 {
+			break
+		}
+		var res []*Message
+		var err error
+		if t.Ordered {
+			res, err = t.consumeOrderedPartition(consumerGroupName, consumerName, p, members)
+		} else {
+			res, err = t.consumePartition(consumerGroupName, consumerName, p, remaining)
+		}
+		if err != nil {
+			msgs, err = keepDecodedMessages(msgs, err)
+			return t.dropExpiredMessages(msgs), err
+		}
+		msgs = append(msgs, res...)
+	}
+	msgs, err := keepDecodedMessages(msgs, nil)
+	return t.dropExpiredMessages(msgs), err
+}
+
+func (t *PartitionedTopic) toMessages(xms []redis.XMessage, topic *Topic, consumerGroupName string, consumerName string) []*Message {
+	msgs := xMessageArrayToMessageArray(xms, *topic, consumerGroupName, consumerName)
+	for _, m := range msgs {
+		m.GroupKey = m.Headers[HeaderPartitionKey]
+	}
+	return msgs
+}
+
+func (t *PartitionedTopic) consumePartition(consumerGroupName string, consumerName string, partition int64, count int64) ([]*Message, error) {
+	topic := t.getTopicForPartition(partition)
+	res, err := claimStuckStreamMessages(t.MQClient, consumerGroupName, consumerName, count, topic.StreamKey, t.MaxIdleTimeForMessages)
+	if isNoGroupError(err) {
+		res = []redis.XMessage{}
+	} else if err != nil {
+		return nil, err
+	}
+	if remaining := count - int64(len(res)); remaining > 0 {
+		news, err := t.readPartition(consumerGroupName, consumerName, topic, remaining)
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, news...)
+	}
+	return t.toMessages(res, topic, consumerGroupName, consumerName), nil
+}
+
+// consumeOrderedPartition returns the next message of the partition in order. A pending message held by
+// this consumer or by a consumer that is no longer a member is delivered again before any new message.
+func (t *PartitionedTopic) consumeOrderedPartition(consumerGroupName string, consumerName string, partition int64, members map[string]bool) ([]*Message, error) {
+	rc := t.MQClient.rc
+	c := t.MQClient.c
+	topic := t.getTopicForPartition(partition)
+	pending, err := rc.XPendingExt(c, &redis.XPendingExtArgs{
+		Stream: topic.StreamKey,
+		Group:  consumerGroupName,
+		Start:  "-",
+		End:    "+",
+		Count:  1,
+	}).Result()
+	if err != nil && err != redis.Nil && !isNoGroupError(err) {
+		return nil, err
+	}
+	if len(pending) == 0 {
+		res, err := t.readPartition(consumerGroupName, consumerName, topic, 1)
+		if err != nil {
+			return nil, err
+		}
+		return t.toMessages(res, topic, consumerGroupName, consumerName), nil
+	}
+	if pending[0].Consumer != consumerName && members[pending[0].Consumer] {
+		return []*Message{}, nil
+	}
+	res, err := rc.XClaim(c, &redis.XClaimArgs{
+		Stream:   topic.StreamKey,
+		Group:    consumerGroupName,
+		Consumer: consumerName,
+		MinIdle:  0,
+		Messages: []string{pending[0].ID},
+	}).Result()
+	if err != nil {
+		return nil, err
+	}
+	return t.toMessages(res, topic, consumerGroupName, consumerName), nil
+}
+
+// readPartition reads new messages from the stream of the partition. The consumer group is created on the
+// stream if it does not exist yet.
+func (t *PartitionedTopic) readPartition(consumerGroupName string, consumerName string, topic *Topic, count int64) ([]redis.XMessage, error) {
+	res, err := readNewMessageFromStream(t.MQClient, consumerGroupName, consumerName, count, topic.StreamKey)
+	if isNoGroupError(err) {
+		t.MQClient.rc.XGroupCreateMkStream(t.MQClient.c, topic.StreamKey, consumerGroupName, "0")
+		res, err = readNewMessageFromStream(t.MQClient, consumerGroupName, consumerName, count, topic.StreamKey)
+	}
+	return res, err
+}
+
+func (t *PartitionedTopic) dropExpiredMessages(msgs []*Message) []*Message {
+	return dropExpiredMessages(t.MQClient, msgs, t.ExpiredMessagesTopic, t.StreamPrefix+":expired-count")
+}
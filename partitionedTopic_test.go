@@ -0,0 +1,77 @@
+package redimq
+
+import (
+	"testing"
+)
+
+func TestPartitionedTopicPublish(t *testing.T) {
+	name := getTestName(t, "partitioned")
+	pt, err := client.NewPartitionedTopic(name, 4, nil)
+	if err != nil {
+		t.Fatal("NewPartitionedTopic returned error", err)
+	}
+	if _, err = client.NewPartitionedTopic(name, 8, nil); err == nil {
+		t.Error("NewPartitionedTopic did not fail for a different number of partitions")
+	}
+	if names, _, err := client.FindPartitionedTopicNames(&name, 10, 0); err != nil || len(names) != 1 || names[0] != name {
+		t.Error("NewPartitionedTopic did not register the name of the topic", names, err)
+	}
+	for i := 0; i < 4; i++ {
+		if err := pt.PublishMessage("", &Message{Data: map[string]interface{}{"foo": "test"}}); err != nil {
+			t.Fatal("PublishMessage failed", err)
+		}
+	}
+	for p := int64(0); p < 4; p++ {
+		if n, _ := client.rc.XLen(client.c, pt.getStreamKeyForPartition(p)).Result(); n != 1 {
+			t.Error("Round-robin did not publish one message to partition", p)
+		}
+	}
+	m := &Message{Data: map[string]interface{}{"foo": "test"}}
+	pt.PublishMessage("customer-1", m)
+	if m.Topic.StreamKey != pt.getStreamKeyForPartition(pt.PartitionFor("customer-1")) {
+		t.Error("Message is not published to the partition of the key")
+	}
+}
+
+func TestPartitionedTopicConsume(t *testing.T) {
+	group := "partitioned-group"
+	pt, _ := client.NewPartitionedTopic(getTestName(t, "partitioned-consume"), 4, nil)
+	pt.Ordered = true
+	consumers := []*Consumer{
+		client.NewConsumer(group, "consumer-1", func(m *Message) {}),
+		client.NewConsumer(group, "consumer-2", func(m *Message) {}),
+	}
+	assigned := map[int64]string{}
+	for _, c := range consumers {
+		c.DisableJanitor = true
+		c.registerTopic(client, "pmts:"+pt.Name)
+		defer c.Close()
+	}
+	for _, c := range consumers {
+		for _, p := range pt.GetAssignedPartitions(group, c.ConsumerName) {
+			if owner, ok := assigned[p]; ok {
+				t.Error("Partition", p, "assigned to", owner, "and", c.ConsumerName)
+			}
+			assigned[p] = c.ConsumerName
+		}
+	}
+	if len(assigned) != 4 {
+		t.Error("Partitions assigned", len(assigned), "expected 4")
+	}
+	pt.PublishMessage("customer-1", &Message{Data: map[string]interface{}{"seq": "1"}})
+	pt.PublishMessage("customer-1", &Message{Data: map[string]interface{}{"seq": "2"}})
+	owner := assigned[pt.PartitionFor("customer-1")]
+	msgs, err := pt.ConsumeMessages(group, owner, 10)
+	if err != nil || len(msgs) != 1 || msgs[0].Data["seq"] != "1" || msgs[0].GroupKey != "customer-1" {
+		t.Fatal("Ordered ConsumeMessages did not return the first message", err)
+	}
+	msgs, _ = pt.ConsumeMessages(group, owner, 10)
+	if len(msgs) != 1 || msgs[0].Data["seq"] != "1" {
+		t.Fatal("Ordered ConsumeMessages did not redeliver the unacknowledged message")
+	}
+	msgs[0].Acknowledge()
+	msgs, _ = pt.ConsumeMessages(group, owner, 10)
+	if len(msgs) != 1 || msgs[0].Data["seq"] != "2" {
+		t.Error("Ordered ConsumeMessages did not return the next message")
+	}
+}
@@ -0,0 +1,197 @@
+package redimq
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// prioritySchedule divides the messages consumed at a time across the priority levels of a Topic in the
+// ratio of their weights, using a smooth weighted round robin so that the lower levels are drained at a
+// steady rate even while the higher levels have a backlog.
+type prioritySchedule struct {
+	weights []int64
+	current []int64
+	mu      sync.Mutex
+}
+
+func newPrioritySchedule(weights []int64) *prioritySchedule {
+	return &prioritySchedule{weights: weights, current: make([]int64, len(weights))}
+}
+
+// quotas returns the number of messages to be read from each priority level out of the count
+func (s *prioritySchedule) quotas(count int64) []int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var total int64
+	for _, w := range s.weights {
+		total += w
+	}
+	quotas := make([]int64, len(s.weights))
+	if total <= 0 {
+		return quotas
+	}
+	for i := int64(0); i < count; i++ {
+		best := -1
+		for l := len(s.weights) - 1; l >= 0; l-- {
+			s.current[l] += s.weights[l]
+			if best < 0 || s.current[l] > s.current[best] {
+				best = l
+			}
+		}
+		s.current[best] -= total
+		quotas[best]++
+	}
+	return quotas
+}
+
+// validatePriorityOptions checks the priority options and returns the number of priority levels
+func validatePriorityOptions(options *TopicOptions) (int64, error) {
+	if options.PriorityLevels == nil {
+		if len(options.PriorityWeights) > 0 {
+			return 0, errors.New("PriorityWeights are set without the PriorityLevels")
+		}
+		return 0, nil
+	}
+	levels := *options.PriorityLevels
+	if levels < 0 {
+		return 0, errors.New("PriorityLevels should not be negative")
+	}
+	if len(options.PriorityWeights) > 0 && int64(len(options.PriorityWeights)) != levels {
+		return 0, fmt.Errorf("PriorityWeights should have a weight for each of the %d PriorityLevels", levels)
+	}
+	for _, w := range options.PriorityWeights {
+		if w < 0 {
+			return 0, errors.New("PriorityWeights should not be negative")
+		}
+	}
+	return levels, nil
+}
+
+// persistPriorityLevels stores the PriorityLevels of the Topic on its creation, as the messages of the
+// higher levels would not be consumed if the Topic is later used with fewer levels. The stored levels are
+// returned when the options do not set them, and an error when they differ from the options.
+func (c *MQClient) persistPriorityLevels(t *Topic, options *TopicOptions) (int64, error) {
+	levels, err := c.persistTopicSetting(t.StreamKey+":priority-levels", options.PriorityLevels)
+	if err != nil {
+		return 0, err
+	}
+	if options.PriorityLevels != nil && levels != *options.PriorityLevels {
+		return 0, fmt.Errorf("Topic %s already exists with %d PriorityLevels", t.Name, levels)
+	}
+	return levels, nil
+}
+
+// validatePriority checks that the Priority of the message is one of the PriorityLevels of the Topic
+func (t *Topic) validatePriority(m *Message) error {
+	if m.Priority < 0 || (m.Priority > 0 && m.Priority >= t.PriorityLevels) {
+		return fmt.Errorf("Message Priority should be between 0 and %d for the Topic %s", t.PriorityLevels-1, t.Name)
+	}
+	return nil
+}
+
+// getStreamKeyForPriority returns the stream of the priority level. The lowest level uses the StreamKey of
+// the Topic so that the messages published before the priorities were enabled are still consumed.
+func (t *Topic) getStreamKeyForPriority(priority int64) string {
+	if priority == 0 {
+		return t.StreamKey
+	}
+	return fmt.Sprintf("%s:priority:%d", t.StreamKey, priority)
+}
+
+// getTopicForPriority returns the Topic for the stream of the priority level
+func (t *Topic) getTopicForPriority(priority int64) *Topic {
+	pt := *t
+	pt.StreamKey = t.getStreamKeyForPriority(priority)
+	pt.PriorityLevels = 0
+	pt.PriorityWeights = nil
+	pt.schedule = nil
+	return &pt
+}
+
+// getPriorityTopics returns the Topics for the streams of all the priority levels from the lowest to the
+// highest, or just the Topic if it does not have priorities
+func (t *Topic) getPriorityTopics() []*Topic {
+	if t.PriorityLevels <= 1 {
+		return []*Topic{t}
+	}
+	topics := make([]*Topic, t.PriorityLevels)
+	for l := range topics {
+		topics[l] = t.getTopicForPriority(int64(l))
+	}
+	return topics
+}
+
+// forEachPriority runs the purge function for the streams of all the priority levels and combines the reports
+func (t *Topic) forEachPriority(dryRun bool, purge func(pt *Topic) (*PurgeReport, error)) (*PurgeReport, error) {
+	report := &PurgeReport{DryRun: dryRun, MessageGroups: []string{}}
+	for _, pt := range t.getPriorityTopics() {
+		r, err := purge(pt)
+		report.add(r)
+		if err != nil {
+			return report, err
+		}
+	}
+	return report, nil
+}
+
+// readPriorityMessages reads new messages from the stream of the priority level. The consumer group is
+// created on the stream if it does not exist yet.
+func (t *Topic) readPriorityMessages(consumerGroupName string, consumerName string, priority int64, count int64) ([]*Message, error) {
+	pt := t.getTopicForPriority(priority)
+	res, err := readNewMessageFromStream(t.MQClient, consumerGroupName, consumerName, count, pt.StreamKey)
+	if isNoGroupError(err) {
+		t.MQClient.rc.XGroupCreateMkStream(t.MQClient.c, pt.StreamKey, consumerGroupName, "0")
+		res, err = readNewMessageFromStream(t.MQClient, consumerGroupName, consumerName, count, pt.StreamKey)
+	}
+	if err != nil {
+		return nil, err
+	}
+	msgs := xMessageArrayToMessageArray(res, *pt, consumerGroupName, consumerName)
+	for _, m := range msgs {
+		m.Priority = priority
+	}
+	return msgs, nil
+}
+
+// consumePriorityMessages consumes upto count messages from the streams of the priority levels. The stuck
+// messages are claimed first, from the highest level to the lowest. The new messages are then read as per
+// the quotas of the PriorityWeights, if set, and the remaining count is filled from the highest level to
+// the lowest.
+func (t *Topic) consumePriorityMessages(consumerGroupName string, consumerName string, count int64) ([]*Message, error) {
+	msgs := []*Message{}
+	for l := t.PriorityLevels - 1; l >= 0 && int64(len(msgs)) < count; l-- {
+		pt := t.getTopicForPriority(l)
+		res, err := claimStuckStreamMessages(t.MQClient, consumerGroupName, consumerName, count-int64(len(msgs)), pt.StreamKey, t.MaxIdleTimeForMessages)
+		if isNoGroupError(err) {
+			continue
+		} else if err != nil {
+			return msgs, err
+		}
+		for _, m := range xMessageArrayToMessageArray(res, *pt, consumerGroupName, consumerName) {
+			m.Priority = l
+			msgs = append(msgs, m)
+		}
+	}
+	if t.schedule != nil && int64(len(msgs)) < count {
+		quotas := t.schedule.quotas(count - int64(len(msgs)))
+		for l := t.PriorityLevels - 1; l >= 0; l-- {
+			if quotas[l] == 0 {
+				continue
+			}
+			res, err := t.readPriorityMessages(consumerGroupName, consumerName, l, quotas[l])
+			if err != nil {
+				return msgs, err
+			}
+			msgs = append(msgs, res...)
+		}
+	}
+	for l := t.PriorityLevels - 1; l >= 0 && int64(len(msgs)) < count; l-- {
+		res, err := t.readPriorityMessages(consumerGroupName, consumerName, l, count-int64(len(msgs)))
+		if err != nil {
+			return msgs, err
+		}
+		msgs = append(msgs, res...)
+	}
+	return msgs, nil
+}
@@ -0,0 +1,81 @@
+package redimq
+
+import (
+	"testing"
+)
+
+func TestPriorityScheduleQuotas(t *testing.T) {
+	s := newPrioritySchedule([]int64{1, 3})
+	quotas := s.quotas(8)
+	if quotas[0] != 2 || quotas[1] != 6 {
+		t.Error("Quotas do not match the weights", quotas)
+	}
+}
+
+func TestTopicPriority(t *testing.T) {
+	group := "priority-group"
+	levels := int64(3)
+	s, err := client.NewTopic(getTestName(t, "priority"), &TopicOptions{PriorityLevels: &levels})
+	if err != nil {
+		t.Fatal("NewTopic returned error", err)
+	}
+	s.SeekConsumerGroup(group, PositionBeginning)
+	for _, p := range []int64{0, 1, 2, 0} {
+		if err := s.PublishMessage(&Message{Priority: p, Data: map[string]interface{}{"foo": "test"}}); err != nil {
+			t.Fatal("PublishMessage failed", err)
+		}
+	}
+	if err := s.PublishMessage(&Message{Priority: 3, Data: map[string]interface{}{"foo": "test"}}); err == nil {
+		t.Error("PublishMessage did not fail for an invalid priority")
+	}
+	msgs, err := s.ConsumeMessages(group, "priority-consumer", 3)
+	if err != nil || len(msgs) != 3 {
+		t.Fatal("ConsumeMessages did not return 3 messages", err)
+	}
+	if msgs[0].Priority != 2 || msgs[1].Priority != 1 || msgs[2].Priority != 0 {
+		t.Error("Messages are not consumed in the order of priority")
+	}
+	if err := msgs[0].Acknowledge(); err != nil {
+		t.Error("Acknowledge returned error", err)
+	}
+	report, err := s.Purge(false)
+	if err != nil || report.Messages != 4 || report.PendingEntries != 2 {
+		t.Error("Purge did not remove the messages of all the priority levels", report, err)
+	}
+}
+
+func TestTopicPriorityWeights(t *testing.T) {
+	group := "priority-group"
+	levels := int64(2)
+	s, _ := client.NewTopic(getTestName(t, "priority-weights"), &TopicOptions{PriorityLevels: &levels, PriorityWeights: []int64{1, 1}})
+	s.SeekConsumerGroup(group, PositionBeginning)
+	for _, p := range []int64{0, 0, 1, 1, 1, 1} {
+		s.PublishMessage(&Message{Priority: p, Data: map[string]interface{}{"foo": "test"}})
+	}
+	msgs, _ := s.ConsumeMessages(group, "priority-consumer", 4)
+	low := 0
+	for _, m := range msgs {
+		if m.Priority == 0 {
+			low++
+		}
+	}
+	if len(msgs) != 4 || low != 2 {
+		t.Error("Lower priority messages are not drained as per the weights")
+	}
+}
+
+func TestTopicPriorityLevelsPersisted(t *testing.T) {
+	name := getTestName(t, "priority-levels")
+	levels := int64(3)
+	if _, err := client.NewTopic(name, &TopicOptions{PriorityLevels: &levels}); err != nil {
+		t.Fatal("NewTopic returned error", err)
+	}
+	s, err := client.NewTopic(name, nil)
+	if err != nil || s.PriorityLevels != levels {
+		t.Error("NewTopic did not load the persisted PriorityLevels", err)
+	}
+	other := int64(2)
+	if _, err := client.NewTopic(name, &TopicOptions{PriorityLevels: &other}); err == nil {
+		t.Error("NewTopic did not fail for different PriorityLevels")
+	}
+}
@@ -0,0 +1,283 @@
+package redimq
+
+import (
+	"github.com/go-redis/redis/v8"
+)
+
+// PurgeReport describes what was removed, or would be removed in case of a dry run, by the purge, trim and
+// delete functions of the topics
+type PurgeReport struct {
+	DryRun         bool
+	Messages       int64
+	PendingEntries int64
+	MessageGroups  []string
+}
+
+func (r *PurgeReport) add(o *PurgeReport) {
+	r.Messages += o.Messages
+	r.PendingEntries += o.PendingEntries
+	r.MessageGroups = append(r.MessageGroups, o.MessageGroups...)
+}
+
+// countMessages returns the number of messages in the stream between the ids (both inclusive)
+func countMessages(client MQClient, stream string, start string, end string) (int64, error) {
+	var count int64
+	for {
+		res, err := client.rc.XRangeN(client.c, stream, start, end, 1000).Result()
+		if err != nil {
+			return count, err
+		}
+		count += int64(len(res))
+		if len(res) < 1000 {
+			return count, nil
+		}
+		start = nextStreamId(res[len(res)-1].ID)
+	}
+}
+
+// ackPendingMessages acknowledges the messages between the ids (both inclusive) that are pending in any of
+// the consumer groups of the stream, and returns the number of pending entries found
+func ackPendingMessages(client MQClient, stream string, start string, end string, dryRun bool) (int64, error) {
+	groups, err := client.rc.XInfoGroups(client.c, stream).Result()
+	if isNoSuchKeyError(err) {
+		return 0, nil
+	} else if err != nil {
+		return 0, err
+	}
+	var count int64
+	for _, g := range groups {
+		if g.Pending == 0 {
+			continue
+		}
+		pending, err := client.rc.XPendingExt(client.c, &redis.XPendingExtArgs{
+			Stream: stream,
+			Group:  g.Name,
+			Start:  start,
+			End:    end,
+			Count:  g.Pending,
+		}).Result()
+		if err != nil && err != redis.Nil {
+			return count, err
+		}
+		if len(pending) == 0 {
+			continue
+		}
+		count += int64(len(pending))
+		if dryRun {
+			continue
+		}
+		ids := make([]string, len(pending))
+		for i, p := range pending {
+			ids[i] = p.ID
+		}
+		_, err = client.rc.XAck(client.c, stream, g.Name, ids...).Result()
+		if err != nil {
+			return count, err
+		}
+	}
+	return count, nil
+}
+
+// Purge removes all the messages from the Topic and clears the messages pending in its consumer groups. The
+// messages published while the Topic is being purged are kept. The consumer groups and their positions are
+// retained, while the blobs of the ClaimCheck of the messages are removed. If dryRun is true, nothing is
+// removed and the report describes what would have been removed.
+func (t *Topic) Purge(dryRun bool) (*PurgeReport, error) {
+	if t.PriorityLevels > 1 {
+		return t.forEachPriority(dryRun, func(pt *Topic) (*PurgeReport, error) { return pt.Purge(dryRun) })
+	}
+	report := &PurgeReport{DryRun: dryRun, MessageGroups: []string{}}
+	last, err := t.MQClient.rc.XRevRangeN(t.MQClient.c, t.StreamKey, "+", "-", 1).Result()
+	if err != nil || len(last) == 0 {
+		return report, err
+	}
+	// the messages are removed upto the last one at the start, as the new ones can be published meanwhile
+	lastId := last[0].ID
+	report.PendingEntries, err = ackPendingMessages(t.MQClient, t.StreamKey, "-", lastId, dryRun)
+	if err != nil {
+		return report, err
+	}
+	if dryRun {
+		report.Messages, err = t.MQClient.rc.XLen(t.MQClient.c, t.StreamKey).Result()
+		return report, err
+	}
+	report.Messages, err = t.MQClient.rc.XTrimMinID(t.MQClient.c, t.StreamKey, nextStreamId(lastId)).Result()
+	if err == nil && t.ClaimCheck != nil {
+		_, err = collectBlobs(t.MQClient, t.StreamKey, t.StreamKey, t.ClaimCheck.Store, nil)
+	}
+	return report, err
+}
+
+// TrimBefore removes the messages of the Topic upto the position, i.e. the messages that are published before
+// the time for a position created using [PositionAtTime], or the messages before the id for a position
+// created using [PositionAtId]. The removed messages are also cleared from the consumer groups where they
+// are pending, and the blobs of the ClaimCheck of the messages are removed. If dryRun is true, nothing is
+// removed and the report describes what would have been removed.
+func (t *Topic) TrimBefore(position StreamPosition, dryRun bool) (*PurgeReport, error) {
+	if t.PriorityLevels > 1 {
+		return t.forEachPriority(dryRun, func(pt *Topic) (*PurgeReport, error) { return pt.TrimBefore(position, dryRun) })
+	}
+	if position == PositionEnd {
+		return t.Purge(dryRun)
+	}
+	report := &PurgeReport{DryRun: dryRun, MessageGroups: []string{}}
+	if position == PositionBeginning {
+		return report, nil
+	}
+	var err error
+	if dryRun {
+		report.Messages, err = countMessages(t.MQClient, t.StreamKey, "-", string(position))
+		if err != nil {
+			return report, err
+		}
+	}
+	report.PendingEntries, err = ackPendingMessages(t.MQClient, t.StreamKey, "-", string(position), dryRun)
+	if err != nil || dryRun {
+		return report, err
+	}
+	report.Messages, err = t.MQClient.rc.XTrimMinID(t.MQClient.c, t.StreamKey, nextStreamId(string(position))).Result()
+	if err == nil && t.ClaimCheck != nil {
+		_, err = collectBlobs(t.MQClient, t.StreamKey, t.StreamKey, t.ClaimCheck.Store, nil)
+	}
+	return report, err
+}
+
+// DeleteMessage removes a single message from the Topic, e.g. a poison message that cannot be processed, and
+// clears it from the consumer groups where it is pending along with its blob of the ClaimCheck. If dryRun is
+// true, nothing is removed and the report describes what would have been removed.
+func (t *Topic) DeleteMessage(id string, dryRun bool) (*PurgeReport, error) {
+	if t.PriorityLevels > 1 {
+		return t.forEachPriority(dryRun, func(pt *Topic) (*PurgeReport, error) { return pt.DeleteMessage(id, dryRun) })
+	}
+	report := &PurgeReport{DryRun: dryRun, MessageGroups: []string{}}
+	var err error
+	report.PendingEntries, err = ackPendingMessages(t.MQClient, t.StreamKey, id, id, dryRun)
+	if err != nil {
+		return report, err
+	}
+	if dryRun {
+		report.Messages, err = countMessages(t.MQClient, t.StreamKey, id, id)
+		return report, err
+	}
+	report.Messages, err = t.MQClient.rc.XDel(t.MQClient.c, t.StreamKey, id).Result()
+	if err == nil && t.ClaimCheck != nil {
+		_, err = collectBlobs(t.MQClient, t.StreamKey, t.StreamKey, t.ClaimCheck.Store, nil)
+	}
+	return report, err
+}
+
+// findMessageGroupEntry returns the id of the entry of the message group in the MessageGroupStreamKey
+func (t *GroupedMessageTopic) findMessageGroupEntry(groupKey string) (string, error) {
+	start := "-"
+	for {
+		res, err := t.MQClient.rc.XRangeN(t.MQClient.c, t.MessageGroupStreamKey, start, "+", 1000).Result()
+		if err != nil {
+			return "", err
+		}
+		for _, g := range res {
+			if key, _ := g.Values["key"].(string); key == groupKey {
+				return g.ID, nil
+			}
+		}
+		if len(res) < 1000 {
+			return "", nil
+		}
+		start = nextStreamId(res[len(res)-1].ID)
+	}
+}
+
+// PurgeGroup removes a message group along with all its messages from the GroupedMessageTopic. The messages
+// pending in the consumer groups and the registration of the message group are cleared as well. If dryRun
+// is true, nothing is removed and the report describes what would have been removed.
+//
+// For a topic having Lanes, only the messages of the message group are removed from its lane, while the lane
+// itself remains registered.
+func (t *GroupedMessageTopic) PurgeGroup(groupKey string, dryRun bool) (*PurgeReport, error) {
+	if t.Lanes > 0 {
+		return t.purgeLaneGroup(groupKey, dryRun)
+	}
+	return t.purgeMessageGroup(groupKey, dryRun)
+}
+
+// purgeMessageGroup removes the message group along with its stream and its registration
+func (t *GroupedMessageTopic) purgeMessageGroup(groupKey string, dryRun bool) (*PurgeReport, error) {
+	rc := t.MQClient.rc
+	c := t.MQClient.c
+	stream := t.getStreamKeyForGroup(groupKey)
+	report, err := t.getTopicForGroup(groupKey).Purge(true)
+	report.DryRun = dryRun
+	if err != nil {
+		return report, err
+	}
+	registered, err := rc.SIsMember(c, t.MessageGroupSetKey, groupKey).Result()
+	if err != nil {
+		return report, err
+	}
+	id, err := t.findMessageGroupEntry(groupKey)
+	if err != nil {
+		return report, err
+	}
+	if registered || id != "" {
+		report.MessageGroups = append(report.MessageGroups, groupKey)
+	}
+	if dryRun {
+		return report, nil
+	}
+	groups, err := rc.XInfoGroups(c, t.MessageGroupStreamKey).Result()
+	if err != nil && !isNoSuchKeyError(err) {
+		return report, err
+	}
+	_, err = rc.TxPipelined(c, func(pipe redis.Pipeliner) error {
+		if id != "" {
+			for _, g := range groups {
+				pipe.XAck(c, t.MessageGroupStreamKey, g.Name, id)
+			}
+			pipe.XDel(c, t.MessageGroupStreamKey, id)
+		}
+		pipe.SRem(c, t.MessageGroupSetKey, groupKey)
+		pipe.Del(c, stream)
+		return nil
+	})
+	if err == nil && t.ClaimCheck != nil {
+		_, err = collectBlobs(t.MQClient, stream, t.MessageGroupStreamKey, t.ClaimCheck.Store, nil)
+	}
+	return report, err
+}
+
+// Purge removes all the message groups along with their messages and the blobs of their ClaimCheck from the
+// GroupedMessageTopic, and resets the message count of the topic. If dryRun is true, nothing is removed and
+// the report describes what would have been removed.
+func (t *GroupedMessageTopic) Purge(dryRun bool) (*PurgeReport, error) {
+	report := &PurgeReport{DryRun: dryRun, MessageGroups: []string{}}
+	keys, err := t.MQClient.rc.SMembers(t.MQClient.c, t.MessageGroupSetKey).Result()
+	if err != nil {
+		return report, err
+	}
+	for _, k := range keys {
+		r, err := t.purgeMessageGroup(k, dryRun)
+		report.add(r)
+		if err != nil {
+			return report, err
+		}
+	}
+	if !dryRun {
+		_, err = t.MQClient.rc.Del(t.MQClient.c, t.MessageCountKey).Result()
+	}
+	return report, err
+}
+
+// TrimGroupBefore removes the messages of a message group upto the position. It works the same way as
+// [Topic.TrimBefore]. For a topic having Lanes, only the messages of the message group are removed from its
+// lane, leaving the messages of the other message groups sharing the lane intact.
+func (t *GroupedMessageTopic) TrimGroupBefore(groupKey string, position StreamPosition, dryRun bool) (*PurgeReport, error) {
+	if t.Lanes > 0 {
+		return t.trimLaneGroup(groupKey, position, dryRun)
+	}
+	return t.getTopicForGroup(t.getMessageGroupKey(groupKey)).TrimBefore(position, dryRun)
+}
+
+// DeleteGroupMessage removes a single message from a message group, e.g. a poison message that is blocking
+// the message group. It works the same way as [Topic.DeleteMessage].
+func (t *GroupedMessageTopic) DeleteGroupMessage(groupKey string, id string, dryRun bool) (*PurgeReport, error) {
+	return t.getTopicForGroup(t.getMessageGroupKey(groupKey)).DeleteMessage(id, dryRun)
+}
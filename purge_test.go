@@ -0,0 +1,108 @@
+package redimq
+
+import (
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestTopicPurge(t *testing.T) {
+	group := "purge-group"
+	s, _ := client.NewTopic(getTestName(t, "purge"), nil)
+	ids := []string{}
+	for i := 0; i < 4; i++ {
+		m := &Message{Data: map[string]interface{}{"foo": "test"}}
+		if err := s.PublishMessage(m); err != nil {
+			t.Fatal("PublishMessage failed", err)
+		}
+		ids = append(ids, m.Id)
+	}
+	s.SeekConsumerGroup(group, PositionBeginning)
+	s.ConsumeMessages(group, "purge-consumer", 2)
+	report, err := s.DeleteMessage(ids[0], true)
+	if err != nil || report.Messages != 1 || report.PendingEntries != 1 {
+		t.Error("DeleteMessage dry run report is not valid", report, err)
+	}
+	if n, _ := client.rc.XLen(client.c, s.StreamKey).Result(); n != 4 {
+		t.Error("DeleteMessage dry run removed messages")
+	}
+	report, err = s.DeleteMessage(ids[0], false)
+	if err != nil || report.Messages != 1 || report.PendingEntries != 1 {
+		t.Error("DeleteMessage report is not valid", report, err)
+	}
+	report, err = s.TrimBefore(PositionAtId(ids[2]), false)
+	if err != nil || report.Messages != 1 || report.PendingEntries != 1 {
+		t.Error("TrimBefore report is not valid", report, err)
+	}
+	if p, _ := client.rc.XPending(client.c, s.StreamKey, group).Result(); p.Count != 0 {
+		t.Error("TrimBefore did not clear the pending messages")
+	}
+	report, err = s.Purge(false)
+	if err != nil || report.Messages != 2 {
+		t.Error("Purge report is not valid", report, err)
+	}
+	if n, _ := client.rc.XLen(client.c, s.StreamKey).Result(); n != 0 {
+		t.Error("Purge did not remove the messages")
+	}
+}
+
+func TestGMTPurgeGroup(t *testing.T) {
+	g, _ := client.NewGroupedMessageTopic(getTestName(t, "purge"), nil)
+	for _, key := range []string{"a", "a", "b"} {
+		if err := g.PublishMessage(key, &Message{Data: map[string]interface{}{"foo": "test"}}); err != nil {
+			t.Fatal("PublishMessage failed", err)
+		}
+	}
+	report, err := g.PurgeGroup("a", true)
+	if err != nil || report.Messages != 2 || len(report.MessageGroups) != 1 {
+		t.Error("PurgeGroup dry run report is not valid", report, err)
+	}
+	if ok, _ := client.rc.SIsMember(client.c, g.MessageGroupSetKey, "a").Result(); !ok {
+		t.Error("PurgeGroup dry run removed the message group")
+	}
+	report, err = g.Purge(false)
+	if err != nil || report.Messages != 3 || len(report.MessageGroups) != 2 {
+		t.Error("Purge report is not valid", report, err)
+	}
+	if n, _ := client.rc.SCard(client.c, g.MessageGroupSetKey).Result(); n != 0 {
+		t.Error("Purge did not remove the message groups")
+	}
+	if n, _ := client.rc.XLen(client.c, g.MessageGroupStreamKey).Result(); n != 0 {
+		t.Error("Purge did not remove the message group entries")
+	}
+}
+
+func TestTopicTrimAndDeleteClaimCheck(t *testing.T) {
+	store, err := NewFileBlobStore(t.TempDir())
+	if err != nil {
+		t.Fatal("NewFileBlobStore failed", err)
+	}
+	s, _ := client.NewTopic(getTestName(t, "purge-claim-check"), &TopicOptions{ClaimCheck: &ClaimCheck{Store: store, Threshold: 10}})
+	ids := []string{}
+	keys := []string{}
+	for i := 0; i < 3; i++ {
+		m := &Message{Data: map[string]interface{}{"doc": strings.Repeat("order ", 10)}}
+		if err := s.PublishMessage(m); err != nil {
+			t.Fatal("PublishMessage failed", err)
+		}
+		ids = append(ids, m.Id)
+		raw, _ := client.rc.XRange(client.c, s.StreamKey, m.Id, m.Id).Result()
+		key, _ := raw[0].Values[headerFieldPrefix+HeaderClaimCheck].(string)
+		keys = append(keys, key)
+	}
+	if _, err := s.DeleteMessage(ids[1], false); err != nil {
+		t.Fatal("DeleteMessage returned error", err)
+	}
+	if _, err := os.Stat(store.getPath(keys[1])); !os.IsNotExist(err) {
+		t.Error("DeleteMessage did not remove the blob of the message", err)
+	}
+	if _, err := s.TrimBefore(PositionAtId(ids[2]), false); err != nil {
+		t.Fatal("TrimBefore returned error", err)
+	}
+	if _, err := os.Stat(store.getPath(keys[0])); !os.IsNotExist(err) {
+		t.Error("TrimBefore did not remove the blob of the trimmed message", err)
+	}
+	if _, err := os.Stat(store.getPath(keys[2])); err != nil {
+		t.Error("Blob of the remaining message is removed", err)
+	}
+}
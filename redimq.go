@@ -30,17 +30,96 @@ var (
 	//
 	// The value is a string and should be parsable by the [time.ParseDuration] function
 	DefaultMaxIdleTimeForMessage string = "5m" // Default "5m" - (5 minutes)
+
+	// DefaultPauseCheckInterval defines how often a [Consumer] checks whether a paused topic
+	// has been resumed. While a topic is paused the consumer does not read any messages from it.
+	//
+	// The value is a string and should be parsable by the [time.ParseDuration] function
+	DefaultPauseCheckInterval string = "1s" // Default "1s" - (1 second)
+
+	// DefaultHeartbeatInterval defines how often a [Consumer] publishes its heartbeat along with its
+	// metadata to the consumer registry.
+	//
+	// The value is a string and should be parsable by the [time.ParseDuration] function
+	DefaultHeartbeatInterval string = "5s" // Default "5s" - (5 seconds)
+
+	// DefaultHeartbeatTimeout defines the duration after the last heartbeat for which a [Consumer]
+	// is considered to be alive. It should be a few times the DefaultHeartbeatInterval so that a
+	// delayed heartbeat does not mark a consumer as dead.
+	//
+	// The value is a string and should be parsable by the [time.ParseDuration] function
+	DefaultHeartbeatTimeout string = "15s" // Default "15s" - (15 seconds)
+
+	// DefaultConsumerRegistryTTL defines the duration after the last heartbeat for which a [Consumer] is
+	// kept in the consumer registry. The consumers that crashed without being closed are removed from
+	// the registry after it, and the registry of a consumer group expires after it once none of its
+	// consumers publish heartbeats.
+	//
+	// The value is a string and should be parsable by the [time.ParseDuration] function
+	DefaultConsumerRegistryTTL string = "5m" // Default "5m" - (5 minutes)
+
+	// DefaultJanitorInterval defines how often a [Janitor] cleans up a [GroupedMessageTopic].
+	//
+	// The value is a string and should be parsable by the [time.ParseDuration] function
+	DefaultJanitorInterval string = "1m" // Default "1m" - (1 minute)
+
+	// DefaultLeaderLeaseDuration defines the duration of the lease held by the leader elected using a
+	// [LeaderElection]. If the leader stops without releasing the lease, another instance is elected
+	// after this duration.
+	//
+	// The value is a string and should be parsable by the [time.ParseDuration] function
+	DefaultLeaderLeaseDuration string = "15s" // Default "15s" - (15 seconds)
+
+	// DefaultReplayBatchSize defines the number of messages read from REDIS at a time while replaying the
+	// messages of a [Topic] using [Topic.Replay]
+	DefaultReplayBatchSize int64 = 100 // Default 100
+
+	// DefaultBrowsePageSize defines the number of messages returned in a page while browsing a topic
+	// using [Topic.Browse] if the Count is not set
+	DefaultBrowsePageSize int64 = 100 // Default 100
+
+	// DefaultReplyStreamTTL defines the duration after the last reply for which the reply stream of an
+	// MQClient instance is retained. The replies not read by then, e.g. after the requester has stopped,
+	// are removed along with the stream.
+	//
+	// The value is a string and should be parsable by the [time.ParseDuration] function
+	DefaultReplyStreamTTL string = "1m" // Default "1m" - (1 minute)
+
+	// DefaultMaxDeliveryAttempts defines the number of times a message of a [GroupedMessageTopic] is
+	// delivered without being acknowledged before the FailurePolicy of the topic is applied to it
+	DefaultMaxDeliveryAttempts int64 = 5 // Default 5
+
+	// DefaultCompressionThreshold defines the size in bytes of the Data of a message from which it is
+	// compressed, for the topics having a Compression without a Threshold
+	DefaultCompressionThreshold int = 1024 // Default 1024 - (1 KiB)
+
+	// DefaultClaimCheckThreshold defines the size in bytes of the Data of a message from which it is stored
+	// in the BlobStore, for the topics having a ClaimCheck without a Threshold
+	DefaultClaimCheckThreshold int = 1024 * 1024 // Default 1048576 - (1 MiB)
+
+	// DefaultClaimCheckGracePeriod defines the duration after which CollectBlobs removes a blob whose
+	// message was never added to its stream, e.g. because the publisher stopped after storing the blob.
+	// It should be much longer than the time taken for publishing a message.
+	DefaultClaimCheckGracePeriod string = "1h" // Default "1h" - (1 hour)
 )
 
 // NewMQClient is used to get an instance of the MQClient object that can be used
 // to work with the queues. It accepts an instance of context and a REDIS client
 func NewMQClient(c context.Context, rc *redis.Client) (*MQClient, error) {
-	client := &MQClient{rc: rc, c: c}
+	return NewMQClientWithBackend(c, rc)
+}
+
+// NewMQClientWithBackend is used to get an instance of the MQClient object working with the queues stored
+// in the [Backend], e.g. a [MemoryBackend] for the unit tests of the message handlers.
+//
+//	client, err := redimq.NewMQClientWithBackend(context.TODO(), redimq.NewMemoryBackend())
+func NewMQClientWithBackend(c context.Context, rc Backend) (*MQClient, error) {
+	client := &MQClient{rc: rc, c: c, replies: newReplyListener(), configs: newTopicConfigs()}
 	err := initializeRediMQ(c, rc)
 	return client, err
 }
 
-func initializeRediMQ(c context.Context, rc *redis.Client) error {
+func initializeRediMQ(c context.Context, rc Backend) error {
 	_, err := rc.Ping(c).Result()
 	if err != nil {
 		return fmt.Errorf("RediMQ initialization failed: [%w]", err)
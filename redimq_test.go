@@ -25,11 +25,31 @@ func setupTest() {
         DB:       0,  // use default DB
     })
 	// mock.ExpectPing().SetVal("PONG")
-	client, clientError = NewMQClient(context.TODO(), redisClient)
+	if os.Getenv("REDIMQ_TEST_BACKEND") == "memory" {
+		client, clientError = NewMQClientWithBackend(context.TODO(), NewMemoryBackend())
+	} else {
+		client, clientError = NewMQClient(context.TODO(), redisClient)
+	}
 	topic, topicError = client.NewTopic("test", nil)
 	gmt, gmtError = client.NewGroupedMessageTopic("test", nil)
 }
 
+// getTestName returns a name unique to the run of the test for its topics, so that the tests can be run
+// again on the same REDIS. The keys having the name are removed once the test completes.
+func getTestName(t *testing.T, name string) string {
+	name = name + "-" + newRandomId()
+	t.Cleanup(func() {
+		keys, _ := client.rc.Keys(client.c, "*"+name+"*").Result()
+		if len(keys) > 0 {
+			client.rc.Del(client.c, keys...)
+		}
+		for _, topicType := range []TopicType{UngroupedMessages, GroupedMessages, PartitionedMessages} {
+			client.rc.SRem(client.c, "redimq:"+string(topicType), name)
+		}
+	})
+	return name
+}
+
 func TestMain(m *testing.M) {
 	setupTest()
 	code := m.Run()
@@ -0,0 +1,87 @@
+package redimqtest
+
+import (
+	"context"
+	"strings"
+	"sync"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// fault fails the commands of the given names, or all the commands if none are given, the given number of
+// times or forever if negative
+type fault struct {
+	err      error
+	times    int
+	commands map[string]bool
+}
+
+// faultHook is the redis.Hook of the MemoryBackend of a Harness injecting the faults into the commands
+type faultHook struct {
+	mu     sync.Mutex
+	faults []*fault
+}
+
+// inject returns the error of the first fault matching any of the commands and counts it down
+func (h *faultHook) inject(cmds []redis.Cmder) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for i, f := range h.faults {
+		for _, cmd := range cmds {
+			if len(f.commands) > 0 && !f.commands[cmd.Name()] {
+				continue
+			}
+			if f.times > 0 {
+				f.times--
+				if f.times == 0 {
+					h.faults = append(h.faults[:i], h.faults[i+1:]...)
+				}
+			}
+			return f.err
+		}
+	}
+	return nil
+}
+
+func (h *faultHook) BeforeProcess(ctx context.Context, cmd redis.Cmder) (context.Context, error) {
+	return ctx, h.inject([]redis.Cmder{cmd})
+}
+
+func (h *faultHook) AfterProcess(ctx context.Context, cmd redis.Cmder) error {
+	return nil
+}
+
+func (h *faultHook) BeforeProcessPipeline(ctx context.Context, cmds []redis.Cmder) (context.Context, error) {
+	return ctx, h.inject(cmds)
+}
+
+func (h *faultHook) AfterProcessPipeline(ctx context.Context, cmds []redis.Cmder) error {
+	return nil
+}
+
+// FailCommands makes the next times REDIS commands of the given names, e.g. "xack" or "xreadgroup", fail
+// with the error without running them. All the commands fail if no names are given, and they keep failing
+// till ClearFaults is called if times is negative. A pipeline or transaction fails as a whole if any of its
+// commands is to fail. The assertions of the Harness run commands as well, so they should be made after
+// the faults are consumed or cleared.
+//
+//	h.FailCommands(errors.New("READONLY You can't write against a read only replica"), 1, "xack")
+func (h *Harness) FailCommands(err error, times int, commands ...string) {
+	if times == 0 {
+		return
+	}
+	f := &fault{err: err, times: times, commands: map[string]bool{}}
+	for _, name := range commands {
+		f.commands[strings.ToLower(name)] = true
+	}
+	h.faults.mu.Lock()
+	defer h.faults.mu.Unlock()
+	h.faults.faults = append(h.faults.faults, f)
+}
+
+// ClearFaults removes all the faults injected using FailCommands
+func (h *Harness) ClearFaults() {
+	h.faults.mu.Lock()
+	defer h.faults.mu.Unlock()
+	h.faults.faults = nil
+}
@@ -0,0 +1,412 @@
+// Package redimqtest provides a harness for unit testing the consumers of RediMQ topics without a REDIS
+// server. The [Harness] runs the topics on a [redimq.MemoryBackend] driven by a fake [Clock], so that the
+// reclaims of the messages idle for MaxIdleTimeForMessages, the expiry of the messages, the retention and
+// the heartbeats of the consumers happen when the test moves the clock forward instead of after waiting.
+// RediMQ does not have a retry backoff or a scheduled delivery of the messages, as a failed message is
+// delivered again once it is idle for MaxIdleTimeForMessages, so the Clock does not drive them and they are
+// out of the scope of the harness.
+//
+//	func TestOrderHandler(t *testing.T) {
+//		h := redimqtest.New(t)
+//		topic := h.Topic("orders", nil)
+//		m := h.Publish(topic, map[string]interface{}{"id": "1"})
+//		h.Deliver(topic, "billing", "consumer-1", 10, handleOrder)
+//		h.AssertAcked("billing", m)
+//	}
+//
+// The messages are delivered by the harness one call at a time using [Harness.Deliver], running the handler
+// synchronously and recovering from its panics, or by a [redimq.Consumer] started on [Harness.Client] and
+// awaited using [Harness.WaitForAcked]. The faults are injected using [Harness.FailCommands] for the REDIS
+// errors, [PanicTimes] for the handler panics and [Harness.Abandon] for the consumers crashing while
+// processing their messages.
+package redimqtest
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/webbytes/redimq"
+)
+
+// DefaultWaitTimeout is the time waited by the WaitFor functions of the Harness
+var DefaultWaitTimeout = 5 * time.Second
+
+// DefaultStartTime is the time of the Clock of a new Harness
+var DefaultStartTime = time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// Clock is a fake clock which only moves when the test moves it. It is safe for concurrent use.
+type Clock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+// NewClock creates a Clock stopped at the start time
+func NewClock(start time.Time) *Clock {
+	return &Clock{now: start}
+}
+
+// Now returns the current time of the Clock
+func (c *Clock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+// Advance moves the Clock forward by the duration and returns the new time
+func (c *Clock) Advance(d time.Duration) time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+	return c.now
+}
+
+// Set moves the Clock to the time. The ids of the messages published after moving the Clock backwards
+// still follow the ids of the messages published before, as in REDIS.
+func (c *Clock) Set(t time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = t
+}
+
+// Harness holds an MQClient using a MemoryBackend and a Clock for a test. It is closed when the test ends.
+// The functions of the Harness fail the test on errors, so that the tests only check the outcomes.
+type Harness struct {
+	TB      testing.TB
+	Client  *redimq.MQClient
+	Backend *redimq.MemoryBackend
+	Clock   *Clock
+	faults  *faultHook
+}
+
+// New creates a Harness with an empty MemoryBackend and a Clock at the DefaultStartTime
+func New(tb testing.TB) *Harness {
+	tb.Helper()
+	backend := redimq.NewMemoryBackend()
+	tb.Cleanup(func() { backend.Close() })
+	clock := NewClock(DefaultStartTime)
+	backend.SetClock(clock.Now)
+	faults := &faultHook{}
+	backend.AddHook(faults)
+	client, err := redimq.NewMQClientWithBackend(context.TODO(), backend)
+	if err != nil {
+		tb.Fatal("redimqtest: creating the MQClient failed: ", err)
+	}
+	return &Harness{TB: tb, Client: client, Backend: backend, Clock: clock, faults: faults}
+}
+
+// Topic creates the Topic or fails the test
+func (h *Harness) Topic(name string, options *redimq.TopicOptions) *redimq.Topic {
+	h.TB.Helper()
+	t, err := h.Client.NewTopic(name, options)
+	if err != nil {
+		h.TB.Fatal("redimqtest: creating the Topic "+name+" failed: ", err)
+	}
+	return t
+}
+
+// GroupedMessageTopic creates the GroupedMessageTopic or fails the test
+func (h *Harness) GroupedMessageTopic(name string, options *redimq.TopicOptions) *redimq.GroupedMessageTopic {
+	h.TB.Helper()
+	t, err := h.Client.NewGroupedMessageTopic(name, options)
+	if err != nil {
+		h.TB.Fatal("redimqtest: creating the GroupedMessageTopic "+name+" failed: ", err)
+	}
+	return t
+}
+
+// Publish publishes a message with the data to the Topic and returns it, or fails the test
+func (h *Harness) Publish(t *redimq.Topic, data map[string]interface{}) *redimq.Message {
+	h.TB.Helper()
+	m := &redimq.Message{Data: data}
+	if err := t.PublishMessage(m); err != nil {
+		h.TB.Fatal("redimqtest: publishing to "+t.Name+" failed: ", err)
+	}
+	return m
+}
+
+// PublishToGroup publishes a message with the data to the message group of the GroupedMessageTopic and
+// returns it, or fails the test
+func (h *Harness) PublishToGroup(t *redimq.GroupedMessageTopic, groupKey string, data map[string]interface{}) *redimq.Message {
+	h.TB.Helper()
+	m := &redimq.Message{Data: data}
+	if err := t.PublishMessage(groupKey, m); err != nil {
+		h.TB.Fatal("redimqtest: publishing to "+t.Name+" failed: ", err)
+	}
+	return m
+}
+
+// Delivery is a message delivered to a handler by the Harness along with the value the handler panicked
+// with, if it did
+type Delivery struct {
+	Message *redimq.Message
+	Panic   interface{}
+}
+
+// handle runs the handler for the messages in their order, recovering from the panics
+func handle(msgs []*redimq.Message, handler func(m *redimq.Message)) []*Delivery {
+	deliveries := make([]*Delivery, 0, len(msgs))
+	for _, m := range msgs {
+		d := &Delivery{Message: m}
+		func() {
+			defer func() { d.Panic = recover() }()
+			if handler != nil {
+				handler(m)
+			}
+		}()
+		deliveries = append(deliveries, d)
+	}
+	return deliveries
+}
+
+// Deliver consumes upto count messages of the Topic once for the consumer, creating the consumer group at
+// the start of the Topic if needed, and runs the handler for each of them in order. A handler panicking
+// leaves its message pending like a crashed consumer would, instead of failing the test. It returns the
+// messages delivered.
+func (h *Harness) Deliver(t *redimq.Topic, consumerGroupName string, consumerName string, count int64, handler func(m *redimq.Message)) []*Delivery {
+	h.TB.Helper()
+	if t.PriorityLevels <= 1 {
+		err := h.Backend.XGroupCreateMkStream(context.TODO(), t.StreamKey, consumerGroupName, "0").Err()
+		if err != nil && !strings.HasPrefix(err.Error(), "BUSYGROUP") {
+			h.TB.Fatal("redimqtest: creating the consumer group "+consumerGroupName+" failed: ", err)
+		}
+	}
+	msgs, err := t.ConsumeMessages(consumerGroupName, consumerName, count)
+	if err != nil {
+		h.TB.Fatal("redimqtest: consuming "+t.Name+" failed: ", err)
+	}
+	return handle(msgs, handler)
+}
+
+// DeliverGrouped consumes the messages of the GroupedMessageTopic once for the consumer, i.e. one message
+// from each message group locked by it, and runs the handler for each of them in order. A handler
+// panicking leaves its message pending, so that it is delivered again or the FailurePolicy of the topic is
+// applied. A new consumer group is moved to the beginning of the message groups, so that it is delivered the
+// messages published before it. It returns the messages delivered.
+func (h *Harness) DeliverGrouped(t *redimq.GroupedMessageTopic, consumerGroupName string, consumerName string, handler func(m *redimq.Message)) []*Delivery {
+	h.TB.Helper()
+	groups, err := t.GetConsumerGroups()
+	if err != nil {
+		h.TB.Fatal("redimqtest: reading the consumer groups of "+t.Name+" failed: ", err)
+	}
+	created := true
+	for _, g := range groups {
+		if g.Name == consumerGroupName {
+			created = false
+		}
+	}
+	if _, err := t.InitTopicGroups(consumerGroupName, consumerName); err != nil && !strings.HasPrefix(err.Error(), "BUSYGROUP") {
+		h.TB.Fatal("redimqtest: creating the consumer group "+consumerGroupName+" failed: ", err)
+	}
+	if created {
+		if err := t.SeekConsumerGroup(consumerGroupName, redimq.PositionBeginning); err != nil {
+			h.TB.Fatal("redimqtest: moving the consumer group "+consumerGroupName+" failed: ", err)
+		}
+	}
+	msgs, err := t.ConsumeMessages(consumerGroupName, consumerName)
+	if err != nil {
+		h.TB.Fatal("redimqtest: consuming "+t.Name+" failed: ", err)
+	}
+	return handle(msgs, handler)
+}
+
+// Abandon consumes upto count messages of the Topic for the consumer without handling them, as a consumer
+// crashing after receiving its messages would. The messages are delivered to another consumer once the
+// Clock is moved past the MaxIdleTimeForMessages of the Topic.
+//
+//	h.Abandon(topic, "billing", "crashed", 10)
+//	h.Clock.Advance(topic.MaxIdleTimeForMessages)
+//	h.Deliver(topic, "billing", "survivor", 10, handleOrder)
+func (h *Harness) Abandon(t *redimq.Topic, consumerGroupName string, consumerName string, count int64) []*redimq.Message {
+	h.TB.Helper()
+	return deliveredMessages(h.Deliver(t, consumerGroupName, consumerName, count, nil))
+}
+
+// AbandonGrouped consumes the messages of the GroupedMessageTopic once for the consumer without handling
+// them, as a consumer crashing after receiving its messages would. The consumer is not alive in the consumer
+// registry, so its message groups are claimed by the next consumer of the consumer group they are delivered
+// to, along with the abandoned messages.
+//
+//	h.AbandonGrouped(topic, "billing", "crashed")
+//	h.DeliverGrouped(topic, "billing", "survivor", handleOrder)
+func (h *Harness) AbandonGrouped(t *redimq.GroupedMessageTopic, consumerGroupName string, consumerName string) []*redimq.Message {
+	h.TB.Helper()
+	return deliveredMessages(h.DeliverGrouped(t, consumerGroupName, consumerName, nil))
+}
+
+func deliveredMessages(deliveries []*Delivery) []*redimq.Message {
+	msgs := make([]*redimq.Message, len(deliveries))
+	for i, d := range deliveries {
+		msgs[i] = d.Message
+	}
+	return msgs
+}
+
+// PanicTimes returns a handler which panics for the first n messages delivered to it and runs the handler
+// for the rest, for testing the redeliveries and the FailurePolicy of the topics
+func PanicTimes(n int, handler func(m *redimq.Message)) func(m *redimq.Message) {
+	var mu sync.Mutex
+	calls := 0
+	return func(m *redimq.Message) {
+		mu.Lock()
+		calls++
+		fail := calls <= n
+		mu.Unlock()
+		if fail {
+			panic(fmt.Sprintf("redimqtest: injected panic %d of %d for message %s", calls, n, m.Id))
+		}
+		handler(m)
+	}
+}
+
+// MessageState is the state of a message in a consumer group
+type MessageState string
+
+const (
+	// Undelivered is the state of the messages not yet delivered to the consumer group
+	Undelivered MessageState = "undelivered"
+	// Pending is the state of the messages delivered to a consumer but not yet acknowledged
+	Pending MessageState = "pending"
+	// Acknowledged is the state of the messages delivered and acknowledged, which includes the messages
+	// dead lettered or dropped on expiry
+	Acknowledged MessageState = "acknowledged"
+	// Removed is the state of the messages no longer in the topic, e.g. trimmed or purged
+	Removed MessageState = "removed"
+)
+
+// State returns the state of the published or consumed message in the consumer group
+func (h *Harness) State(consumerGroupName string, m *redimq.Message) MessageState {
+	h.TB.Helper()
+	page, err := m.Topic.Browse(&redimq.BrowseOptions{Start: m.Id, End: m.Id, Count: 1})
+	if err != nil {
+		h.TB.Fatal("redimqtest: browsing "+m.Topic.Name+" failed: ", err)
+	}
+	if len(page.Messages) == 0 {
+		return Removed
+	}
+	for _, p := range page.Messages[0].Pending {
+		if p.ConsumerGroupName == consumerGroupName {
+			return Pending
+		}
+	}
+	groups, err := m.Topic.GetConsumerGroups()
+	if err != nil {
+		h.TB.Fatal("redimqtest: reading the consumer groups of "+m.Topic.Name+" failed: ", err)
+	}
+	for _, g := range groups {
+		if g.Name != consumerGroupName || g.LastDeliveredId == "" {
+			continue
+		}
+		// the message is delivered if it is not after the last delivered id of the consumer group
+		page, err := m.Topic.Browse(&redimq.BrowseOptions{Start: m.Id, End: g.LastDeliveredId, Count: 1})
+		if err != nil {
+			h.TB.Fatal("redimqtest: browsing "+m.Topic.Name+" failed: ", err)
+		}
+		if len(page.Messages) > 0 {
+			return Acknowledged
+		}
+	}
+	return Undelivered
+}
+
+func (h *Harness) assertState(consumerGroupName string, state MessageState, msgs []*redimq.Message) {
+	h.TB.Helper()
+	for _, m := range msgs {
+		if s := h.State(consumerGroupName, m); s != state {
+			h.TB.Errorf("redimqtest: message %s of %s is %s in %s, expected %s", m.Id, m.Topic.Name, s, consumerGroupName, state)
+		}
+	}
+}
+
+// AssertAcked fails the test if any of the messages is not acknowledged in the consumer group
+func (h *Harness) AssertAcked(consumerGroupName string, msgs ...*redimq.Message) {
+	h.TB.Helper()
+	h.assertState(consumerGroupName, Acknowledged, msgs)
+}
+
+// AssertPending fails the test if any of the messages is not pending in the consumer group
+func (h *Harness) AssertPending(consumerGroupName string, msgs ...*redimq.Message) {
+	h.TB.Helper()
+	h.assertState(consumerGroupName, Pending, msgs)
+}
+
+// AssertUndelivered fails the test if any of the messages has been delivered to the consumer group
+func (h *Harness) AssertUndelivered(consumerGroupName string, msgs ...*redimq.Message) {
+	h.TB.Helper()
+	h.assertState(consumerGroupName, Undelivered, msgs)
+}
+
+// DeadLettered returns the messages dead lettered from the GroupedMessageTopic to its DeadLetterTopic
+func (h *Harness) DeadLettered(t *redimq.GroupedMessageTopic) []*redimq.BrowsedMessage {
+	h.TB.Helper()
+	if t.DeadLetterTopic == "" {
+		h.TB.Fatal("redimqtest: DeadLetterTopic is not set for " + t.Name)
+	}
+	dlt := h.Topic(t.DeadLetterTopic, nil)
+	options := &redimq.BrowseOptions{Headers: map[string]string{redimq.HeaderDeadLetteredFrom: t.Name}}
+	msgs := []*redimq.BrowsedMessage{}
+	for {
+		page, err := dlt.Browse(options)
+		if err != nil {
+			h.TB.Fatal("redimqtest: browsing "+dlt.Name+" failed: ", err)
+		}
+		msgs = append(msgs, page.Messages...)
+		if page.NextId == "" {
+			return msgs
+		}
+		options.Start = page.NextId
+	}
+}
+
+// AssertDeadLettered fails the test if the messages of the GroupedMessageTopic are not in its
+// DeadLetterTopic. A message is found by its group key and data, as it gets a new id when dead lettered.
+func (h *Harness) AssertDeadLettered(t *redimq.GroupedMessageTopic, msgs ...*redimq.Message) {
+	h.TB.Helper()
+	dead := h.DeadLettered(t)
+	for _, m := range msgs {
+		found := false
+		for _, d := range dead {
+			if d.Headers[redimq.HeaderGroupKey] == m.GroupKey && reflect.DeepEqual(d.Data, m.Data) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			h.TB.Errorf("redimqtest: message %s of the message group %s is not dead lettered from %s", m.Id, m.GroupKey, t.Name)
+		}
+	}
+}
+
+// WaitFor polls the condition till it is true, failing the test if it is not true within the
+// DefaultWaitTimeout. It is used for waiting on the Consumers running in the background.
+func (h *Harness) WaitFor(description string, condition func() bool) {
+	h.TB.Helper()
+	deadline := time.Now().Add(DefaultWaitTimeout)
+	for !condition() {
+		if time.Now().After(deadline) {
+			h.TB.Fatal("redimqtest: timed out waiting for " + description)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+// WaitForAcked waits till all the messages are acknowledged in the consumer group
+//
+//	consumer := h.Client.NewConsumer("billing", "consumer-1", handleOrder)
+//	consumer.StartConsumingTopic(topic, 10)
+//	h.WaitForAcked("billing", m)
+func (h *Harness) WaitForAcked(consumerGroupName string, msgs ...*redimq.Message) {
+	h.TB.Helper()
+	h.WaitFor("the messages to be acknowledged", func() bool {
+		for _, m := range msgs {
+			if h.State(consumerGroupName, m) != Acknowledged {
+				return false
+			}
+		}
+		return true
+	})
+}
@@ -0,0 +1,144 @@
+package redimqtest
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/webbytes/redimq"
+)
+
+func ack(m *redimq.Message) {
+	m.Acknowledge()
+}
+
+func TestDeliverAndAssertions(t *testing.T) {
+	h := New(t)
+	topic := h.Topic("orders", nil)
+	m1 := h.Publish(topic, map[string]interface{}{"id": "1"})
+	m2 := h.Publish(topic, map[string]interface{}{"id": "2"})
+	h.AssertUndelivered("billing", m1, m2)
+	deliveries := h.Deliver(topic, "billing", "consumer-1", 1, ack)
+	if len(deliveries) != 1 || deliveries[0].Message.Id != m1.Id || deliveries[0].Panic != nil {
+		t.Fatal("Deliver is not valid", deliveries)
+	}
+	h.AssertAcked("billing", m1)
+	h.AssertUndelivered("billing", m2)
+	deliveries = h.Deliver(topic, "billing", "consumer-1", 1, PanicTimes(1, ack))
+	if len(deliveries) != 1 || deliveries[0].Panic == nil {
+		t.Fatal("Panic of the handler is not recovered", deliveries)
+	}
+	h.AssertPending("billing", m2)
+}
+
+func TestClockReclaimsAbandonedMessages(t *testing.T) {
+	h := New(t)
+	idle := "1m"
+	topic := h.Topic("orders", &redimq.TopicOptions{MaxIdleTimeForMessages: &idle})
+	m := h.Publish(topic, map[string]interface{}{"id": "1"})
+	if msgs := h.Abandon(topic, "billing", "crashed", 10); len(msgs) != 1 {
+		t.Fatal("Abandon is not valid", msgs)
+	}
+	if deliveries := h.Deliver(topic, "billing", "survivor", 10, ack); len(deliveries) != 0 {
+		t.Fatal("Message is reclaimed before the MaxIdleTimeForMessages", deliveries)
+	}
+	h.Clock.Advance(time.Minute)
+	deliveries := h.Deliver(topic, "billing", "survivor", 10, ack)
+	if len(deliveries) != 1 || deliveries[0].Message.Id != m.Id {
+		t.Fatal("Message is not reclaimed after the MaxIdleTimeForMessages", deliveries)
+	}
+	h.AssertAcked("billing", m)
+}
+
+func TestAbandonGrouped(t *testing.T) {
+	h := New(t)
+	topic := h.GroupedMessageTopic("orders", nil)
+	m := h.PublishToGroup(topic, "customer-1", map[string]interface{}{"id": "1"})
+	if msgs := h.AbandonGrouped(topic, "billing", "crashed"); len(msgs) != 1 || msgs[0].Id != m.Id {
+		t.Fatal("AbandonGrouped is not valid", msgs)
+	}
+	h.AssertPending("billing", m)
+	deliveries := h.DeliverGrouped(topic, "billing", "survivor", ack)
+	if len(deliveries) != 1 || deliveries[0].Message.Id != m.Id {
+		t.Fatal("Abandoned message group is not claimed by the next consumer", deliveries)
+	}
+	h.AssertAcked("billing", m)
+}
+
+func TestClockExpiresMessages(t *testing.T) {
+	h := New(t)
+	topic := h.Topic("orders", nil)
+	m := &redimq.Message{Data: map[string]interface{}{"id": "1"}, ExpiresAt: h.Clock.Now().Add(time.Hour)}
+	topic.PublishMessage(m)
+	h.Clock.Advance(time.Hour)
+	if deliveries := h.Deliver(topic, "billing", "consumer-1", 10, ack); len(deliveries) != 0 {
+		t.Fatal("Expired message is delivered", deliveries)
+	}
+	h.AssertAcked("billing", m)
+}
+
+func TestDeadLettered(t *testing.T) {
+	h := New(t)
+	policy, attempts, dlt := redimq.DeadLetterMessage, int64(2), "orders-dlq"
+	topic := h.GroupedMessageTopic("orders", &redimq.TopicOptions{FailurePolicy: &policy, MaxDeliveryAttempts: &attempts, DeadLetterTopic: &dlt})
+	failed := h.PublishToGroup(topic, "customer-1", map[string]interface{}{"id": "1"})
+	next := h.PublishToGroup(topic, "customer-1", map[string]interface{}{"id": "2"})
+	handler := PanicTimes(2, ack)
+	for i := 0; i < 3; i++ {
+		h.DeliverGrouped(topic, "billing", "consumer-1", handler)
+	}
+	h.AssertDeadLettered(topic, failed)
+	h.AssertAcked("billing", failed, next)
+	if dead := h.DeadLettered(topic); len(dead) != 1 {
+		t.Error("DeadLettered is not valid", dead)
+	}
+}
+
+func TestFailCommands(t *testing.T) {
+	h := New(t)
+	topic := h.Topic("orders", nil)
+	m := h.Publish(topic, map[string]interface{}{"id": "1"})
+	injected := errors.New("READONLY You can't write against a read only replica")
+	h.FailCommands(injected, 1, "XACK")
+	var ackErr error
+	h.Deliver(topic, "billing", "consumer-1", 10, func(m *redimq.Message) {
+		ackErr = m.Acknowledge()
+	})
+	if ackErr != injected {
+		t.Fatal("Injected error is not returned", ackErr)
+	}
+	h.AssertPending("billing", m)
+	h.FailCommands(injected, -1)
+	if err := topic.PublishMessage(&redimq.Message{Data: map[string]interface{}{"id": "2"}}); err != injected {
+		t.Error("Injected error is not returned for all the commands", err)
+	}
+	h.ClearFaults()
+	h.Publish(topic, map[string]interface{}{"id": "2"})
+}
+
+func TestWaitForAcked(t *testing.T) {
+	h := New(t)
+	topic := h.Topic("orders", nil)
+	m := h.Publish(topic, map[string]interface{}{"id": "1"})
+	consumer := h.Client.NewConsumer("billing", "consumer-1", ack)
+	defer consumer.Close()
+	go func() {
+		for range consumer.Errors {
+		}
+	}()
+	if err := consumer.StartConsumingTopic(topic, 10); err != nil {
+		t.Fatal("StartConsumingTopic failed", err)
+	}
+	h.WaitForAcked("billing", m)
+}
+
+func TestClock(t *testing.T) {
+	c := NewClock(DefaultStartTime)
+	if now := c.Advance(time.Second); !now.Equal(DefaultStartTime.Add(time.Second)) || !c.Now().Equal(now) {
+		t.Error("Advance is not valid", now)
+	}
+	c.Set(DefaultStartTime)
+	if !c.Now().Equal(DefaultStartTime) {
+		t.Error("Set is not valid", c.Now())
+	}
+}
@@ -0,0 +1,197 @@
+package redimq
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// Headers used for the request-reply messages
+const (
+	// HeaderCorrelationId is the header holding the id that correlates a reply with its request
+	HeaderCorrelationId = "redimq-correlation-id"
+	// HeaderReplyTo is the header holding the key of the stream where the reply to a request is published
+	HeaderReplyTo = "redimq-reply-to"
+	// HeaderReplyError is the header holding the error returned by the handler of a [MQClient.NewResponder]
+	HeaderReplyError = "redimq-reply-error"
+)
+
+// ErrRequestTimeout is returned by [MQClient.Request] when the reply is not received within the timeout
+var ErrRequestTimeout = errors.New("Request timed out waiting for the reply")
+
+// replyListener reads the replies published to the reply stream of an MQClient instance and hands them
+// over to the requests waiting for them. It runs only while there are requests waiting for replies.
+type replyListener struct {
+	streamKey string
+	lastId    string
+	waiters   map[string]chan *Message
+	running   bool
+	mu        sync.Mutex
+}
+
+func newReplyListener() *replyListener {
+	return &replyListener{
+		streamKey: "redimq:replies:" + newRandomId(),
+		lastId:    "0-0",
+		waiters:   map[string]chan *Message{},
+	}
+}
+
+func (l *replyListener) wait(client *MQClient, correlationId string) chan *Message {
+	ch := make(chan *Message, 1)
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.waiters[correlationId] = ch
+	if !l.running {
+		l.running = true
+		go l.listen(client)
+	}
+	return ch
+}
+
+func (l *replyListener) cancel(correlationId string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	delete(l.waiters, correlationId)
+}
+
+func (l *replyListener) listen(client *MQClient) {
+	topic := Topic{Name: l.streamKey, StreamKey: l.streamKey, MQClient: *client}
+	for {
+		l.mu.Lock()
+		if len(l.waiters) == 0 {
+			l.running = false
+			l.mu.Unlock()
+			return
+		}
+		lastId := l.lastId
+		l.mu.Unlock()
+		res, err := client.rc.XRead(client.c, &redis.XReadArgs{
+			Streams: []string{l.streamKey, lastId},
+			Count:   100,
+			Block:   time.Second,
+		}).Result()
+		if err != nil {
+			if err != redis.Nil {
+				println("Error reading replies: ", err.Error())
+				time.Sleep(time.Second)
+			}
+			continue
+		}
+		ids := []string{}
+		l.mu.Lock()
+		for _, s := range res {
+			for _, xm := range s.Messages {
+				ids = append(ids, xm.ID)
+				l.lastId = xm.ID
+				m := xMessageToMessage(xm, topic, "", "")
+				if ch, ok := l.waiters[m.Headers[HeaderCorrelationId]]; ok {
+					ch <- m
+					delete(l.waiters, m.Headers[HeaderCorrelationId])
+				}
+			}
+		}
+		l.mu.Unlock()
+		if len(ids) > 0 {
+			client.rc.XDel(client.c, l.streamKey, ids...)
+		}
+	}
+}
+
+// Request publishes the message to the Topic as a request and waits for the reply till the timeout. The
+// message is published with a correlation id and the reply stream of this MQClient instance in its headers,
+// which are used by [Message.Reply] to send back the reply. If the handler of a [MQClient.NewResponder]
+// returned an error, the reply is returned along with the error. ErrRequestTimeout is returned if no reply is
+// received within the timeout.
+//
+//	reply, err := client.Request(topic, &redimq.Message{Data: map[string]interface{}{"id": "42"}}, 5*time.Second)
+func (c *MQClient) Request(t *Topic, m *Message, timeout time.Duration) (*Message, error) {
+	return c.request(func() error { return t.PublishMessage(m) }, m, timeout)
+}
+
+// RequestGroup publishes the message to the message group of the GroupedMessageTopic as a request and waits
+// for the reply till the timeout. It works the same way as [MQClient.Request].
+func (c *MQClient) RequestGroup(t *GroupedMessageTopic, groupKey string, m *Message, timeout time.Duration) (*Message, error) {
+	return c.request(func() error { return t.PublishMessage(groupKey, m) }, m, timeout)
+}
+
+func (c *MQClient) request(publish func() error, m *Message, timeout time.Duration) (*Message, error) {
+	if c.replies == nil {
+		return nil, errors.New("MQClient is not created using NewMQClient")
+	}
+	correlationId := newRandomId()
+	headers := make(map[string]string, len(m.Headers)+2)
+	for k, v := range m.Headers {
+		headers[k] = v
+	}
+	headers[HeaderCorrelationId] = correlationId
+	headers[HeaderReplyTo] = c.replies.streamKey
+	m.Headers = headers
+	ch := c.replies.wait(c, correlationId)
+	if err := publish(); err != nil {
+		c.replies.cancel(correlationId)
+		return nil, err
+	}
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case reply := <-ch:
+		if e, ok := reply.Headers[HeaderReplyError]; ok {
+			return reply, errors.New(e)
+		}
+		return reply, nil
+	case <-timer.C:
+		c.replies.cancel(correlationId)
+		return nil, ErrRequestTimeout
+	}
+}
+
+// Reply publishes the data as the reply to the message received as a request using [MQClient.Request].
+// The reply stream expires after the DefaultReplyStreamTTL if the requester is no longer reading it.
+func (m *Message) Reply(data map[string]interface{}) error {
+	return m.reply(data, nil)
+}
+
+func (m *Message) reply(data map[string]interface{}, replyErr error) error {
+	replyTo, ok := m.Headers[HeaderReplyTo]
+	if !ok {
+		return errors.New("Message is not a request")
+	}
+	ttl, err := time.ParseDuration(DefaultReplyStreamTTL)
+	if err != nil {
+		ttl = time.Minute
+	}
+	reply := &Message{Data: data, Headers: map[string]string{HeaderCorrelationId: m.Headers[HeaderCorrelationId]}}
+	if replyErr != nil {
+		reply.Headers[HeaderReplyError] = replyErr.Error()
+	}
+	rc := m.Topic.MQClient.rc
+	c := m.Topic.MQClient.c
+	_, err = rc.TxPipelined(c, func(pipe redis.Pipeliner) error {
+		pipe.XAdd(c, &redis.XAddArgs{Stream: replyTo, Values: reply.getValues(), ID: "*"})
+		pipe.Expire(c, replyTo, ttl)
+		return nil
+	})
+	return err
+}
+
+// NewResponder creates a [Consumer] for serving the requests published using [MQClient.Request]. The data
+// returned by the handler is sent back as the reply, along with the error if any, and the request is
+// acknowledged.
+//
+//	responder := client.NewResponder("quotes", "instance-1", func(m *redimq.Message) (map[string]interface{}, error) {
+//		return map[string]interface{}{"price": "42"}, nil
+//	})
+//	responder.StartConsumingTopic(topic, 10)
+func (c *MQClient) NewResponder(consumerGroupName string, consumerName string, handler func(m *Message) (map[string]interface{}, error)) *Consumer {
+	return c.NewConsumer(consumerGroupName, consumerName, func(m *Message) {
+		data, err := handler(m)
+		if err := m.reply(data, err); err != nil {
+			println("Error sending reply: ", err.Error())
+			return
+		}
+		m.Acknowledge()
+	})
+}
@@ -0,0 +1,42 @@
+package redimq
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestClientRequest(t *testing.T) {
+	s, _ := client.NewTopic(getTestName(t, "rpc"), nil)
+	s.SeekConsumerGroup("rpc-group", PositionEnd)
+	responder := client.NewResponder("rpc-group", "rpc-consumer", func(m *Message) (map[string]interface{}, error) {
+		if m.Data["fail"] == "true" {
+			return nil, errors.New("failed")
+		}
+		return map[string]interface{}{"echo": m.Data["foo"]}, nil
+	})
+	responder.DisableJanitor = true
+	if err := responder.StartConsumingTopic(s, 1); err != nil {
+		t.Fatal("StartConsumingTopic returned error", err)
+	}
+	defer responder.Close()
+	reply, err := client.Request(s, &Message{Data: map[string]interface{}{"foo": "test"}}, 5*time.Second)
+	if err != nil {
+		t.Fatal("Request returned error", err)
+	}
+	if reply.Data["echo"] != "test" {
+		t.Error("Reply does not match", reply.Data)
+	}
+	_, err = client.Request(s, &Message{Data: map[string]interface{}{"fail": "true"}}, 5*time.Second)
+	if err == nil || err.Error() != "failed" {
+		t.Error("Request did not return the error of the handler", err)
+	}
+}
+
+func TestClientRequestTimeout(t *testing.T) {
+	s, _ := client.NewTopic(getTestName(t, "rpc-timeout"), nil)
+	_, err := client.Request(s, &Message{Data: map[string]interface{}{"foo": "test"}}, 100*time.Millisecond)
+	if err != ErrRequestTimeout {
+		t.Error("Request did not time out", err)
+	}
+}
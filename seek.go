@@ -0,0 +1,138 @@
+package redimq
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// StreamPosition is a position in the stream of a topic. When a consumer group is moved to a position using
+// SeekConsumerGroup, the messages after the position are delivered to it next. The positions can be created
+// using the [PositionAtId] and [PositionAtTime] functions, or the [PositionBeginning] and [PositionEnd]
+// constants.
+type StreamPosition string
+
+const (
+	// PositionBeginning is the position before the first message of the stream
+	PositionBeginning StreamPosition = "0-0"
+	// PositionEnd is the position after the last message of the stream
+	PositionEnd StreamPosition = "$"
+)
+
+// PositionAtId returns the position just before the message with the id, so that the message is the first
+// one to be delivered from the position
+func PositionAtId(id string) StreamPosition {
+	return StreamPosition(previousStreamId(id))
+}
+
+// PositionAtTime returns the position just before the first message published at or after the time
+func PositionAtTime(t time.Time) StreamPosition {
+	return StreamPosition(previousStreamId(fmt.Sprintf("%d-0", t.UnixMilli())))
+}
+
+// seekConsumerGroup sets the last delivered id of the consumer group on the stream to the position. The
+// consumer group and the stream are created if they do not exist.
+func seekConsumerGroup(client MQClient, stream string, consumerGroupName string, position StreamPosition) error {
+	_, err := client.rc.XGroupSetID(client.c, stream, consumerGroupName, string(position)).Result()
+	if err != nil && (isNoGroupError(err) || strings.Contains(err.Error(), "key to exist")) {
+		_, err = client.rc.XGroupCreateMkStream(client.c, stream, consumerGroupName, string(position)).Result()
+	}
+	return err
+}
+
+// SeekConsumerGroup moves the consumer group to the position in the Topic, so that the messages after the
+// position are delivered to the consumers of the group next. It can be used to reprocess the messages
+// after fixing a bug, or to skip messages. The messages already delivered to the consumers and not yet
+// acknowledged are not affected and continue to be pending. The consumer group is created if it does not
+// exist.
+//
+// For a Topic with PriorityLevels, the consumer group is moved on the streams of all the levels, so the
+// position should not be created using [PositionAtId].
+func (t *Topic) SeekConsumerGroup(consumerGroupName string, position StreamPosition) error {
+	for _, pt := range t.getPriorityTopics() {
+		if err := seekConsumerGroup(t.MQClient, pt.StreamKey, consumerGroupName, position); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Replay delivers the messages published to the Topic between the from and to times (both inclusive) to the
+// handler one at a time. The messages are read using a temporary consumer group that is removed once the
+// replay is complete, so the position of the other consumer groups is not disturbed. The messages are
+// acknowledged in the temporary consumer group after the handler returns. The streams of the priority levels
+// are replayed one after the other, from the lowest level to the highest. It returns the number of messages
+// replayed.
+func (t *Topic) Replay(from time.Time, to time.Time, handler func(m *Message)) (int64, error) {
+	consumerGroupName := "redimq-replay-" + newRandomId()
+	end := fmt.Sprintf("%d-%d", to.UnixMilli(), ^uint64(0))
+	var count int64
+	for priority, pt := range t.getPriorityTopics() {
+		replayed, err := pt.replayStream(consumerGroupName, from, end, func(m *Message) {
+			m.Priority = int64(priority)
+			handler(m)
+		})
+		count += replayed
+		if err != nil {
+			return count, err
+		}
+	}
+	return count, nil
+}
+
+// replayStream delivers the messages of the stream of the Topic from the time upto the end id to the handler
+// using the temporary consumer group, and returns the number of messages replayed
+func (t *Topic) replayStream(consumerGroupName string, from time.Time, end string, handler func(m *Message)) (int64, error) {
+	consumerName := "replay"
+	_, err := t.MQClient.rc.XGroupCreateMkStream(t.MQClient.c, t.StreamKey, consumerGroupName, string(PositionAtTime(from))).Result()
+	if err != nil {
+		return 0, err
+	}
+	defer t.MQClient.rc.XGroupDestroy(t.MQClient.c, t.StreamKey, consumerGroupName)
+	var count int64
+	for {
+		res, err := readNewMessageFromStream(t.MQClient, consumerGroupName, consumerName, DefaultReplayBatchSize, t.StreamKey)
+		if err != nil || len(res) == 0 {
+			return count, err
+		}
+		for _, xm := range res {
+			if compareStreamIds(xm.ID, end) > 0 {
+				return count, nil
+			}
+			m := xMessageToMessage(xm, *t, consumerGroupName, consumerName)
+			if m.decodeErr != nil {
+				return count, m.decodeErr
+			}
+			handler(m)
+			count++
+			_, err = t.MQClient.rc.XAck(t.MQClient.c, t.StreamKey, consumerGroupName, xm.ID).Result()
+			if err != nil {
+				return count, err
+			}
+		}
+	}
+}
+
+// SeekConsumerGroup moves the consumer group to the position in the streams of all the message groups of the
+// GroupedMessageTopic. As the ids of the messages are not shared across message groups, the position should
+// be one of [PositionBeginning], [PositionEnd] or a position created using [PositionAtTime]. The messages
+// already delivered to the consumers and not yet acknowledged continue to be pending.
+func (t *GroupedMessageTopic) SeekConsumerGroup(consumerGroupName string, position StreamPosition) error {
+	var cursor uint64
+	for {
+		keys, next, err := t.MQClient.rc.SScan(t.MQClient.c, t.MessageGroupSetKey, cursor, "*", 100).Result()
+		if err != nil {
+			return err
+		}
+		for _, k := range keys {
+			err = seekConsumerGroup(t.MQClient, t.getStreamKeyForGroup(k), consumerGroupName, position)
+			if err != nil {
+				return err
+			}
+		}
+		if next == 0 {
+			return nil
+		}
+		cursor = next
+	}
+}
@@ -0,0 +1,79 @@
+package redimq
+
+import (
+	"testing"
+	"time"
+)
+
+func TestTopicSeekConsumerGroup(t *testing.T) {
+	group := "seek-group"
+	s, _ := client.NewTopic(getTestName(t, "seek"), nil)
+	ids := []string{}
+	for i := 0; i < 3; i++ {
+		m := &Message{Data: map[string]interface{}{"foo": "test"}}
+		if err := s.PublishMessage(m); err != nil {
+			t.Fatal("PublishMessage failed", err)
+		}
+		ids = append(ids, m.Id)
+	}
+	if err := s.SeekConsumerGroup(group, PositionEnd); err != nil {
+		t.Fatal("SeekConsumerGroup returned error", err)
+	}
+	msgs, _ := s.ConsumeMessages(group, "seek-consumer", 3)
+	if len(msgs) != 0 {
+		t.Error("Messages consumed after seeking to the end")
+	}
+	if err := s.SeekConsumerGroup(group, PositionAtId(ids[1])); err != nil {
+		t.Fatal("SeekConsumerGroup returned error", err)
+	}
+	msgs, _ = s.ConsumeMessages(group, "seek-consumer", 3)
+	if len(msgs) != 2 || msgs[0].Id != ids[1] {
+		t.Error("Messages consumed after seeking do not match")
+	}
+}
+
+func TestTopicReplay(t *testing.T) {
+	s, _ := client.NewTopic(getTestName(t, "replay"), nil)
+	from := time.Now().Add(-time.Second)
+	for i := 0; i < 3; i++ {
+		if err := s.PublishMessage(&Message{Data: map[string]interface{}{"foo": "test"}}); err != nil {
+			t.Fatal("PublishMessage failed", err)
+		}
+	}
+	count, err := s.Replay(from, time.Now().Add(time.Second), func(m *Message) {
+		if m.Id == "" {
+			t.Error("Replayed message is not valid")
+		}
+	})
+	if err != nil {
+		t.Error("Replay returned error", err)
+	}
+	if count != 3 {
+		t.Error("Replay delivered", count, "messages, expected 3")
+	}
+	groups, _ := client.rc.XInfoGroups(client.c, s.StreamKey).Result()
+	if len(groups) != 0 {
+		t.Error("Replay did not remove the temporary consumer group")
+	}
+}
+
+func TestTopicReplayPriority(t *testing.T) {
+	levels := int64(2)
+	s, _ := client.NewTopic(getTestName(t, "replay-priority"), &TopicOptions{PriorityLevels: &levels})
+	from := time.Now().Add(-time.Second)
+	for _, p := range []int64{1, 0, 1} {
+		if err := s.PublishMessage(&Message{Priority: p, Data: map[string]interface{}{"foo": "test"}}); err != nil {
+			t.Fatal("PublishMessage failed", err)
+		}
+	}
+	priorities := []int64{}
+	count, err := s.Replay(from, time.Now().Add(time.Second), func(m *Message) {
+		priorities = append(priorities, m.Priority)
+	})
+	if err != nil || count != 3 {
+		t.Error("Replay did not deliver the messages of all the priority levels", count, err)
+	}
+	if len(priorities) != 3 || priorities[0] != 0 || priorities[1] != 1 || priorities[2] != 1 {
+		t.Error("Replayed messages do not have the priority of their level", priorities)
+	}
+}
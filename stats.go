@@ -0,0 +1,214 @@
+package redimq
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// TopicStats are the statistics of a [Topic]
+type TopicStats struct {
+	Name            string
+	Paused          bool
+	Messages        int64
+	PendingMessages int64
+	ConsumerGroups  int64
+	ExpiredMessages int64
+}
+
+// GroupedMessageTopicStats are the statistics of a [GroupedMessageTopic]
+type GroupedMessageTopicStats struct {
+	Name            string
+	Paused          bool
+	MessageGroups   int64
+	PausedGroups    int64
+	ConsumerGroups  int64
+	ExpiredMessages int64
+}
+
+// getCounter returns the value of a counter key, or 0 if it does not exist
+func getCounter(client MQClient, key string) (int64, error) {
+	v, err := client.rc.Get(client.c, key).Result()
+	if err == redis.Nil {
+		return 0, nil
+	} else if err != nil {
+		return 0, err
+	}
+	return strconv.ParseInt(v, 10, 64)
+}
+
+// Stats returns the statistics of the Topic. The Messages and the PendingMessages are summed over the
+// streams of all the priority levels and the consumer groups.
+func (t *Topic) Stats() (*TopicStats, error) {
+	stats := &TopicStats{Name: t.Name}
+	var err error
+	stats.Paused, err = t.IsPaused()
+	if err != nil {
+		return nil, err
+	}
+	for _, pt := range t.getPriorityTopics() {
+		count, err := t.MQClient.rc.XLen(t.MQClient.c, pt.StreamKey).Result()
+		if err != nil {
+			return nil, err
+		}
+		stats.Messages += count
+		groups, err := t.MQClient.rc.XInfoGroups(t.MQClient.c, pt.StreamKey).Result()
+		if isNoSuchKeyError(err) {
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+		for _, g := range groups {
+			stats.PendingMessages += g.Pending
+		}
+		if pt.StreamKey == t.StreamKey {
+			stats.ConsumerGroups = int64(len(groups))
+		}
+	}
+	stats.ExpiredMessages, err = getCounter(t.MQClient, t.getExpiredCountKey())
+	if err != nil {
+		return nil, err
+	}
+	return stats, nil
+}
+
+// Stats returns the statistics of the GroupedMessageTopic
+func (t *GroupedMessageTopic) Stats() (*GroupedMessageTopicStats, error) {
+	stats := &GroupedMessageTopicStats{Name: t.Name}
+	var err error
+	stats.Paused, err = t.IsPaused()
+	if err != nil {
+		return nil, err
+	}
+	stats.MessageGroups, err = t.MQClient.rc.SCard(t.MQClient.c, t.MessageGroupSetKey).Result()
+	if err != nil {
+		return nil, err
+	}
+	stats.PausedGroups, err = t.MQClient.rc.SCard(t.MQClient.c, t.getPausedGroupSetKey()).Result()
+	if err != nil {
+		return nil, err
+	}
+	groups, err := t.MQClient.rc.XInfoGroups(t.MQClient.c, t.MessageGroupStreamKey).Result()
+	if err != nil && !isNoSuchKeyError(err) {
+		return nil, err
+	}
+	stats.ConsumerGroups = int64(len(groups))
+	stats.ExpiredMessages, err = getCounter(t.MQClient, t.getExpiredCountKey())
+	if err != nil {
+		return nil, err
+	}
+	return stats, nil
+}
+
+// ConsumerGroupStats are the statistics of a consumer group of a topic
+type ConsumerGroupStats struct {
+	Name      string
+	Consumers []*ConsumerStats
+	// Pending is the number of messages delivered to the consumer group but not yet acknowledged
+	Pending int64
+	// Lag is the number of messages yet to be delivered to the consumer group
+	Lag int64
+	// LastDeliveredId is the id of the last message delivered to the consumer group. It is empty for a
+	// GroupedMessageTopic as every message group has its own stream.
+	LastDeliveredId string
+}
+
+// ConsumerStats are the statistics of a consumer of a consumer group. For a GroupedMessageTopic, the
+// Pending is the number of message groups locked by the consumer.
+type ConsumerStats struct {
+	Name    string
+	Pending int64
+	Idle    time.Duration
+}
+
+// getConsumerStats returns the consumers of the consumer group on the stream
+func getConsumerStats(client MQClient, stream string, consumerGroupName string) ([]*ConsumerStats, error) {
+	res, err := client.rc.XInfoConsumers(client.c, stream, consumerGroupName).Result()
+	if err != nil {
+		return nil, err
+	}
+	consumers := make([]*ConsumerStats, len(res))
+	for i, c := range res {
+		consumers[i] = &ConsumerStats{
+			Name:    c.Name,
+			Pending: c.Pending,
+			Idle:    time.Duration(c.Idle) * time.Millisecond,
+		}
+	}
+	return consumers, nil
+}
+
+// GetConsumerGroups returns the statistics of the consumer groups of the Topic. The Pending messages and
+// the Lag are summed over the streams of all the priority levels.
+func (t *Topic) GetConsumerGroups() ([]*ConsumerGroupStats, error) {
+	rc := t.MQClient.rc
+	c := t.MQClient.c
+	stats := []*ConsumerGroupStats{}
+	byName := map[string]*ConsumerGroupStats{}
+	for _, pt := range t.getPriorityTopics() {
+		groups, err := rc.XInfoGroups(c, pt.StreamKey).Result()
+		if isNoSuchKeyError(err) {
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+		for _, g := range groups {
+			s, ok := byName[g.Name]
+			if !ok {
+				s = &ConsumerGroupStats{Name: g.Name, Consumers: []*ConsumerStats{}}
+				byName[g.Name] = s
+				stats = append(stats, s)
+			}
+			lag, err := countMessages(t.MQClient, pt.StreamKey, nextStreamId(g.LastDeliveredID), "+")
+			if err != nil {
+				return nil, err
+			}
+			s.Pending += g.Pending
+			s.Lag += lag
+			if pt.StreamKey != t.StreamKey {
+				continue
+			}
+			s.LastDeliveredId = g.LastDeliveredID
+			s.Consumers, err = getConsumerStats(t.MQClient, pt.StreamKey, g.Name)
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+	return stats, nil
+}
+
+// GetConsumerGroups returns the statistics of the consumer groups of the GroupedMessageTopic. The Pending
+// messages and the Lag are summed over all the message groups, so this reads the streams of all the
+// message groups of the topic.
+func (t *GroupedMessageTopic) GetConsumerGroups() ([]*ConsumerGroupStats, error) {
+	groups, err := t.MQClient.rc.XInfoGroups(t.MQClient.c, t.MessageGroupStreamKey).Result()
+	if isNoSuchKeyError(err) {
+		return []*ConsumerGroupStats{}, nil
+	} else if err != nil {
+		return nil, err
+	}
+	entries, err := t.getMessageGroupEntries()
+	if err != nil {
+		return nil, err
+	}
+	stats := make([]*ConsumerGroupStats, len(groups))
+	for i, g := range groups {
+		s := &ConsumerGroupStats{Name: g.Name}
+		s.Consumers, err = getConsumerStats(t.MQClient, t.MessageGroupStreamKey, g.Name)
+		if err != nil {
+			return nil, err
+		}
+		for _, e := range entries {
+			info, err := t.describeMessageGroup(g.Name, getMessageGroupEntryKey(e), nil, false)
+			if err != nil {
+				return nil, err
+			}
+			s.Pending += info.Pending
+			s.Lag += info.Backlog - info.Pending
+		}
+		stats[i] = s
+	}
+	return stats, nil
+}
@@ -0,0 +1,71 @@
+package redimq
+
+import (
+	"testing"
+)
+
+func TestTopicStats(t *testing.T) {
+	s, _ := client.NewTopic(getTestName(t, "stats"), nil)
+	s.SeekConsumerGroup("stats-group", PositionBeginning)
+	for i := 0; i < 2; i++ {
+		s.PublishMessage(&Message{Data: map[string]interface{}{"foo": "test"}})
+	}
+	s.ConsumeMessages("stats-group", "stats-consumer", 1)
+	stats, err := s.Stats()
+	if err != nil {
+		t.Fatal("Stats returned error", err)
+	}
+	if stats.Messages != 2 || stats.PendingMessages != 1 || stats.ConsumerGroups != 1 {
+		t.Error("Stats do not match", stats)
+	}
+}
+
+func TestGMTStats(t *testing.T) {
+	g, _ := client.NewGroupedMessageTopic(getTestName(t, "stats"), nil)
+	g.PublishMessage("a", &Message{Data: map[string]interface{}{"foo": "test"}})
+	g.PublishMessage("b", &Message{Data: map[string]interface{}{"foo": "test"}})
+	g.PauseGroup("b")
+	stats, err := g.Stats()
+	if err != nil {
+		t.Fatal("Stats returned error", err)
+	}
+	if stats.MessageGroups != 2 || stats.PausedGroups != 1 {
+		t.Error("Stats do not match", stats)
+	}
+}
+
+func TestTopicGetConsumerGroups(t *testing.T) {
+	s, _ := client.NewTopic(getTestName(t, "consumer-group-stats"), nil)
+	s.SeekConsumerGroup("stats-group", PositionBeginning)
+	for i := 0; i < 3; i++ {
+		s.PublishMessage(&Message{Data: map[string]interface{}{"foo": "test"}})
+	}
+	s.ConsumeMessages("stats-group", "stats-consumer", 1)
+	groups, err := s.GetConsumerGroups()
+	if err != nil || len(groups) != 1 {
+		t.Fatal("GetConsumerGroups failed", groups, err)
+	}
+	g := groups[0]
+	if g.Name != "stats-group" || g.Pending != 1 || g.Lag != 2 || len(g.Consumers) != 1 || g.Consumers[0].Pending != 1 {
+		t.Error("GetConsumerGroups stats do not match", g)
+	}
+	s.Purge(false)
+}
+
+func TestGMTGetConsumerGroups(t *testing.T) {
+	g, _ := client.NewGroupedMessageTopic(getTestName(t, "consumer-group-stats"), nil)
+	g.InitTopicGroups("stats-group", "stats-consumer")
+	g.PublishMessage("a", &Message{Data: map[string]interface{}{"foo": "test"}})
+	g.PublishMessage("a", &Message{Data: map[string]interface{}{"foo": "test"}})
+	g.PublishMessage("b", &Message{Data: map[string]interface{}{"foo": "test"}})
+	g.ConsumeMessages("stats-group", "stats-consumer")
+	groups, err := g.GetConsumerGroups()
+	if err != nil || len(groups) != 1 {
+		t.Fatal("GetConsumerGroups failed", groups, err)
+	}
+	s := groups[0]
+	if s.Pending != 2 || s.Lag != 1 || len(s.Consumers) != 1 || s.Consumers[0].Pending != 2 {
+		t.Error("GetConsumerGroups stats do not match", s)
+	}
+	g.Purge(false)
+}
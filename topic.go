@@ -14,21 +14,73 @@ type Topic struct {
 	MaxLen                 *int64
 	MaxIdleTimeForMessages time.Duration
 	NeedsAcknowledgements  bool
+	// PriorityLevels is the number of priority levels of the Topic, each backed by a separate stream.
+	// The messages of a higher level are consumed before the messages of the lower levels. The levels are
+	// stored when the Topic is created and used when it is later created without them.
+	PriorityLevels int64
+	// PriorityWeights are the weights of the priority levels, from the lowest to the highest, used for
+	// draining the lower levels while the higher levels have a backlog. Without the weights, the lower
+	// levels are consumed only when the higher levels are empty.
+	PriorityWeights []int64
+	// ExpiredMessagesTopic is the name of the Topic where the expired messages are routed to when they
+	// are consumed. The expired messages are only acknowledged and counted if it is not set.
+	ExpiredMessagesTopic string
+	// Compression compresses the Data of the large messages published to the Topic, see [Compression]
+	Compression *Compression
+	// ClaimCheck stores the Data of the very large messages published to the Topic in a BlobStore, see
+	// [ClaimCheck]
+	ClaimCheck *ClaimCheck
+	schedule   *prioritySchedule
 	MQClient
 }
 
 func (t *Topic) getMinId() string {
-	return fmt.Sprint(time.Now().Add(-*t.Retention).UnixMilli())
+	return fmt.Sprint(t.MQClient.now().Add(-*t.Retention).UnixMilli())
 }
 
 // / execute XADD queue:messages:MESSAGE_KEY MAXLEN ~ 10000 * <...data>
+//
+// If the Topic has PriorityLevels, the message is published to the stream of its Priority level.
 func (t *Topic) PublishMessage(m *Message) error {
+	return t.publishMessage(m, "*")
+}
+
+// publishMessage publishes the message with the id, or with a generated id if it is "*". The stream is not
+// trimmed for the Retention when the id is given, as the message may be older than the Retention.
+func (t *Topic) publishMessage(m *Message, id string) error {
+	if err := t.validatePriority(m); err != nil {
+		return err
+	}
+	stream := t.getTopicForPriority(m.Priority)
+	values, blobKey, err := m.getStreamValues(t.MQClient, stream.StreamKey, t.ClaimCheck, t.Compression)
+	if err != nil {
+		return err
+	}
+	var add *redis.StringCmd
+	_, err = t.MQClient.rc.TxPipelined(t.MQClient.c, func(pipe redis.Pipeliner) error {
+		add = pipe.XAdd(t.MQClient.c, stream.getXAddArgs(values, id))
+		markBlobAdded(t.MQClient, pipe, stream.StreamKey, blobKey)
+		return nil
+	})
+	m.Id = add.Val()
+	m.Topic = *stream
+	if err != nil {
+		abandonBlob(t.MQClient, stream.StreamKey, t.ClaimCheck, blobKey, add.Err())
+		return err
+	}
+	return indexBlob(t.MQClient, stream.StreamKey, blobKey, m.Id)
+}
+
+// getXAddArgs returns the arguments for adding the values to the stream of the Topic with the id, or with a
+// generated id if it is "*". The stream is trimmed for the MaxLen, and for the Retention only when the id is
+// generated.
+func (t *Topic) getXAddArgs(values map[string]interface{}, id string) *redis.XAddArgs {
 	args := &redis.XAddArgs{
 		Stream: t.StreamKey,
-		Values: m.Data,
-		ID:     "*",
+		Values: values,
+		ID:     id,
 	}
-	if t.Retention != nil {
+	if t.Retention != nil && id == "*" {
 		args.MinID = t.getMinId()
 		args.Approx = true
 	}
@@ -36,13 +88,45 @@ func (t *Topic) PublishMessage(m *Message) error {
 		args.Approx = true
 		args.MaxLen = *t.MaxLen
 	}
-	res, err := t.MQClient.rc.XAdd(t.MQClient.c, args).Result()
-	m.Id = res
-	m.Topic = *t
+	return args
+}
+
+func (t *Topic) getPausedKey() string {
+	return t.StreamKey + ":paused"
+}
+
+// Pause stops the consumption of messages from the Topic for all the consumers. The state is kept
+// in REDIS so that every consumer instance honors it. Messages can still be published to a paused
+// Topic and are left intact till the Topic is resumed.
+func (t *Topic) Pause() error {
+	_, err := t.MQClient.rc.Set(t.MQClient.c, t.getPausedKey(), 1, 0).Result()
+	return err
+}
+
+// Resume restarts the consumption of messages from a Topic paused using [Topic.Pause]
+func (t *Topic) Resume() error {
+	_, err := t.MQClient.rc.Del(t.MQClient.c, t.getPausedKey()).Result()
 	return err
 }
 
+// IsPaused returns true if the consumption of messages from the Topic is paused
+func (t *Topic) IsPaused() (bool, error) {
+	res, err := t.MQClient.rc.Exists(t.MQClient.c, t.getPausedKey()).Result()
+	return res > 0, err
+}
+
+// ConsumeMessages is used to consume upto count messages from the Topic. Messages that were consumed
+// earlier but not acknowledged within MaxIdleTimeForMessages are claimed first. No messages are
+// returned while the Topic is paused.
 func (t *Topic) ConsumeMessages(consumerGroupName string, consumerName string, count int64) ([]*Message, error) {
+	paused, err := t.IsPaused()
+	if err != nil || paused {
+		return []*Message{}, err
+	}
+	if t.PriorityLevels > 1 {
+		msgs, err := keepDecodedMessages(t.consumePriorityMessages(consumerGroupName, consumerName, count))
+		return t.dropExpiredMessages(msgs), err
+	}
 	res, err := claimStuckStreamMessages(t.MQClient, consumerGroupName, consumerName, count, t.StreamKey, t.MaxIdleTimeForMessages)
 	if err != nil {
 		println("claim stuck message error - ", err.Error())
@@ -54,9 +138,11 @@ func (t *Topic) ConsumeMessages(consumerGroupName string, consumerName string, c
 		res, err = readNewMessageFromStream(t.MQClient, consumerGroupName, consumerName, remainingCount, t.StreamKey)
 		if err != nil {
 			println("read new messages error - ", err.Error())
-			return msgs, err
+			msgs, err = keepDecodedMessages(msgs, err)
+			return t.dropExpiredMessages(msgs), err
 		}
 		msgs = append(msgs, xMessageArrayToMessageArray(res, *t, consumerGroupName, consumerName)...)
 	}
-	return msgs, err
+	msgs, err = keepDecodedMessages(msgs, err)
+	return t.dropExpiredMessages(msgs), err
 }
@@ -40,7 +40,12 @@ func TestTopicConsumeMessages(t *testing.T) {
 	// 	Messages: []redis.XMessage { *msg },
 	// }
 	// mock.ExpectXReadGroup(args).SetVal([]redis.XStream { *resStream })
-	msgs,err := topic.ConsumeMessages(group, consumer, 1)
+	s, _ := client.NewTopic(getTestName(t, "consume"), nil)
+	s.SeekConsumerGroup(group, PositionBeginning)
+	if err := s.PublishMessage(&Message{Data: map[string]interface{}{"foo": "test", "bar": "test"}}); err != nil {
+		t.Fatal("PublishMessage failed", err)
+	}
+	msgs,err := s.ConsumeMessages(group, consumer, 1)
 	if err != nil {
 		t.Error("ConsumeMessage failed", err)
 	}
@@ -48,10 +53,44 @@ func TestTopicConsumeMessages(t *testing.T) {
 		t.Error("ConsumeMessage did not return message")
 	}
 	if len(msgs) != count {
-		t.Error("ConsumeMessage did not return correct number of messages")
+		t.Fatal("ConsumeMessage did not return correct number of messages")
 	}
 	if msgs[0].Id == "" {
 		t.Error("ConsumeMessage message does not match")
 	}
 	fmt.Println("messages consumed - ", *msgs[0])
-} 
\ No newline at end of file
+} 
+
+func TestTopicPauseResume(t *testing.T) {
+	group := "pause-group"
+	s, _ := client.NewTopic(getTestName(t, "pause"), nil)
+	s.PublishMessage(&Message{Data: map[string]interface{}{"foo": "paused"}})
+	s.SeekConsumerGroup(group, PositionBeginning)
+	err := s.Pause()
+	if err != nil {
+		t.Fatal("Pause failed", err)
+	}
+	paused, err := s.IsPaused()
+	if err != nil || !paused {
+		t.Error("Topic is not paused", err)
+	}
+	msgs, err := s.ConsumeMessages(group, "pause-consumer", 1)
+	if err != nil {
+		t.Error("ConsumeMessages failed", err)
+	}
+	if len(msgs) != 0 {
+		t.Error("ConsumeMessages returned messages for a paused topic")
+	}
+	err = s.Resume()
+	if err != nil {
+		t.Fatal("Resume failed", err)
+	}
+	paused, err = s.IsPaused()
+	if err != nil || paused {
+		t.Error("Topic is still paused", err)
+	}
+	msgs, err = s.ConsumeMessages(group, "pause-consumer", 1)
+	if err != nil || len(msgs) != 1 {
+		t.Error("ConsumeMessages did not return the message of the resumed topic", msgs, err)
+	}
+}